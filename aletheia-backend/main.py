@@ -1,17 +1,43 @@
-from fastapi import FastAPI, File, UploadFile, Form, HTTPException
+from fastapi import FastAPI, File, UploadFile, Form, HTTPException, Header, Request, Depends
 from fastapi.middleware.cors import CORSMiddleware
-from pydantic import BaseModel
+from fastapi.middleware.gzip import GZipMiddleware
+from fastapi.responses import JSONResponse, Response
+from pydantic import BaseModel, ValidationError
 from typing import Optional, List
+import asyncio
 import os
+import time
+import uuid
+import zlib
+from urllib.parse import urlparse
+
+import httpx
 from dotenv import load_dotenv
 
 from services.image_processor import process_image
 from services.classifier import classify_misinformation
+from services.media_processor import transcribe_media, download_media, is_media_url_allowed
+from services.social_fetcher import detect_platform, fetch_social
+from services.chat import answer_follow_up
+from services.translator import translate_texts
+from services import wire
 
 load_dotenv()
 
+MODEL_VERSION = os.getenv("MODEL_VERSION", "gpt-4o-mini")
+
+# Largest request body accepted once a gzipped body is unpacked
+MAX_REQUEST_BYTES = int(os.getenv("MAX_REQUEST_BYTES", str(8 << 20)))
+
 app = FastAPI(title="Aletheia - Misinformation Detection API")
 
+# Running callback jobs, kept referenced so they aren't garbage collected
+background_jobs = set()
+
+# Where job results may be posted: each bot's CALLBACK_URL, comma-separated.
+# With none set, callbacks are refused.
+CALLBACK_URLS = [u.strip() for u in os.getenv("CALLBACK_URLS", "").split(",") if u.strip()]
+
 # Configure CORS
 app.add_middleware(
     CORSMiddleware,
@@ -21,13 +47,152 @@ app.add_middleware(
     allow_headers=["*"],
 )
 
+# Gzip responses for clients that accept it
+app.add_middleware(GZipMiddleware, minimum_size=1000)
+
+
+class GzipRequestMiddleware:
+    """Unpacks request bodies sent with Content-Encoding: gzip, refusing ones
+    that unpack to more than MAX_REQUEST_BYTES"""
+
+    def __init__(self, app):
+        self.app = app
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http":
+            return await self.app(scope, receive, send)
+        headers = dict(scope["headers"])
+        if headers.get(b"content-encoding", b"").lower() != b"gzip":
+            return await self.app(scope, receive, send)
+
+        body = await self.read_body(receive)
+        if body is None:
+            response = JSONResponse(
+                status_code=413,
+                content={"detail": f"Request body is larger than {MAX_REQUEST_BYTES} bytes"},
+            )
+            return await response(scope, receive, send)
+        if body is False:
+            response = JSONResponse(status_code=400, content={"detail": "Invalid gzip body"})
+            return await response(scope, receive, send)
+
+        headers.pop(b"content-encoding", None)
+        headers[b"content-length"] = str(len(body)).encode()
+        scope = dict(scope, headers=list(headers.items()))
+        sent = False
+
+        async def unpacked():
+            nonlocal sent
+            if sent:
+                return await receive()
+            sent = True
+            return {"type": "http.request", "body": body, "more_body": False}
+
+        await self.app(scope, unpacked, send)
+
+    async def read_body(self, receive):
+        """Returns the unpacked body, None when it's too large or False when
+        it isn't valid gzip"""
+        inflater = zlib.decompressobj(16 + zlib.MAX_WBITS)
+        body = bytearray()
+        more = True
+        try:
+            while more:
+                message = await receive()
+                more = message.get("more_body", False)
+                chunk = message.get("body", b"")
+                while chunk:
+                    body += inflater.decompress(chunk, MAX_REQUEST_BYTES + 1 - len(body))
+                    if len(body) > MAX_REQUEST_BYTES:
+                        return None
+                    chunk = inflater.unconsumed_tail
+            body += inflater.flush()
+        except zlib.error:
+            return False
+        if len(body) > MAX_REQUEST_BYTES:
+            return None
+        if not inflater.eof:
+            return False
+        return bytes(body)
+
+
+app.add_middleware(GzipRequestMiddleware)
+
 
 class TextMessage(BaseModel):
     text: str
+    sender_types: Optional[List[str]] = None  # business, broadcast or bot
+
+
+# How each sender type the bots report is described to the classifier
+SENDER_DESCRIPTIONS = {
+    "business": "a WhatsApp Business account",
+    "broadcast": "a broadcast list",
+    "bot": "an automated bot account",
+}
+
+
+def with_sender_context(text: str, sender_types: Optional[List[str]]) -> str:
+    """Prefix text with who sent it, so promotional and automated claims get scrutiny"""
+    described = [SENDER_DESCRIPTIONS[t] for t in sender_types or [] if t in SENDER_DESCRIPTIONS]
+    if not described:
+        return text
+    return f"(Sent from {' via '.join(described)})\n{text}"
+
+
+class SocialMessage(BaseModel):
+    url: str
+    text: Optional[str] = None  # the message the link was shared in
+
+
+class MediaURLMessage(BaseModel):
+    url: str  # presigned URL of the recording in object storage
+    kind: str = "audio"
+    file_name: Optional[str] = None
+    duration: Optional[int] = None
+    analyzed_seconds: Optional[int] = None
+    caption: Optional[str] = None
+    callback_url: Optional[str] = None
+    callback_token: Optional[str] = None
+
+
+class ChatTurn(BaseModel):
+    role: str  # user or assistant
+    content: str
+
+
+class ChatMessage(BaseModel):
+    question: str
+    language: Optional[str] = None
+    message: Optional[str] = None  # the text that was fact-checked
+    verdict: dict
+    history: Optional[List[ChatTurn]] = None
+
+
+class ChatAnswer(BaseModel):
+    answer: str
+
+
+class TranslateMessage(BaseModel):
+    texts: List[str]
+    source: str
+    target: str
+
+
+class TranslateResponse(BaseModel):
+    translations: List[str]
+
+
+class SocialContext(BaseModel):
+    platform: str
+    url: str
+    title: Optional[str] = None
+    author: Optional[str] = None
 
 
 class MisinformationResponse(BaseModel):
     is_misinformation: bool
+    verdict: Optional[str] = None  # credible, misinformation or unverifiable
     confidence: float
     is_news: Optional[bool] = True
     summary: Optional[str] = None
@@ -36,7 +201,49 @@ class MisinformationResponse(BaseModel):
     recommendation: Optional[str] = None
     extracted_text: Optional[str] = None
     image_description: Optional[str] = None
-    message_type: str
+    social: Optional[SocialContext] = None
+    developing: Optional[bool] = None  # breaking story whose verdict may still change
+    topic: Optional[str] = None  # health, elections, disasters or other
+    message_type: str  # the input kind, or satire, opinion, advertisement or personal
+    publisher: Optional[str] = None  # the outlet satire and opinion come from
+    model_version: Optional[str] = None
+    analysis_id: Optional[str] = None
+    processing_time: Optional[float] = None
+    schema_version: int = 1  # bump when a field changes meaning; clients ignore new fields
+
+
+async def text_message(request: Request) -> TextMessage:
+    """Read a /analyze/text body sent as JSON or as a protobuf AnalyzeRequest"""
+    content_type = request.headers.get("content-type", "").split(";")[0].strip().lower()
+    body = await request.body()
+    if content_type == wire.CONTENT_TYPE:
+        try:
+            return TextMessage(**wire.decode_analyze_request(body))
+        except (ValueError, ValidationError) as e:
+            raise HTTPException(status_code=400, detail=f"Invalid protobuf body: {str(e)}")
+    if content_type not in ("", "application/json"):
+        raise HTTPException(status_code=415, detail=f"Unsupported content type {content_type}")
+    try:
+        return TextMessage.model_validate_json(body)
+    except ValidationError as e:
+        raise HTTPException(status_code=422, detail=e.errors())
+
+
+def negotiate(request: Request, response: MisinformationResponse):
+    """Send the response as protobuf to clients that accept it, JSON otherwise"""
+    if wire.CONTENT_TYPE in request.headers.get("accept", ""):
+        data = wire.encode_analyze_response(response.model_dump(exclude_none=True))
+        return Response(content=data, media_type=wire.CONTENT_TYPE)
+    return response
+
+
+def with_metadata(response: MisinformationResponse, started: float) -> MisinformationResponse:
+    """Stamp a response with the model version, a unique analysis ID and the time taken"""
+    response.model_version = MODEL_VERSION
+    response.analysis_id = uuid.uuid4().hex[:12]
+    response.processing_time = round(time.perf_counter() - started, 3)
+    print(f"Analysis {response.analysis_id} took {response.processing_time}s")
+    return response
 
 
 @app.get("/")
@@ -44,30 +251,55 @@ async def root():
     return {"message": "Aletheia Misinformation Detection API", "status": "running"}
 
 
+@app.get("/health")
+async def health():
+    return {"status": "ok"}
+
+
 @app.post("/analyze/text", response_model=MisinformationResponse)
-async def analyze_text(message: TextMessage):
+async def analyze_text(
+    request: Request,
+    message: TextMessage = Depends(text_message),
+    idempotency_key: Optional[str] = Header(None),
+):
     """
     Analyze text message for misinformation using AI agent with search tools
     """
-    result = await classify_misinformation(message.text)
+    print(f"Analyzing text (idempotency key {idempotency_key})")
+    started = time.perf_counter()
+    result = await classify_misinformation(with_sender_context(message.text, message.sender_types))
 
-    return MisinformationResponse(
+    return negotiate(request, with_metadata(MisinformationResponse(
         is_misinformation=result["is_misinformation"],
+        verdict=result.get("verdict"),
         confidence=result["confidence"],
         is_news=result.get("is_news", True),
         summary=result.get("summary"),
         evidence=result.get("evidence"),
         sources_checked=result.get("sources_checked"),
         recommendation=result.get("recommendation"),
-        message_type="text",
-    )
+        topic=result.get("topic"),
+        developing=result.get("developing"),
+        message_type=result.get("content_type") or "text",
+        publisher=result.get("publisher"),
+    ), started))
 
 
 @app.post("/analyze/image", response_model=MisinformationResponse)
-async def analyze_image(file: UploadFile = File(...)):
+async def analyze_image(
+    request: Request,
+    file: UploadFile = File(...),
+    caption: Optional[str] = Form(None),
+    context: Optional[str] = Form(None),
+    sender_types: Optional[str] = Form(None),  # comma-separated
+    idempotency_key: Optional[str] = Header(None),
+):
     """
-    Analyze image for misinformation using OCR and image description
+    Analyze image for misinformation using OCR and image description, together
+    with its caption and the text of the message it replies to
     """
+    print(f"Analyzing image (idempotency key {idempotency_key})")
+    started = time.perf_counter()
     image_data = await file.read()
     
     # Validate it's actually image data (check magic bytes)
@@ -90,9 +322,9 @@ async def analyze_image(file: UploadFile = File(...)):
     except Exception as e:
         raise HTTPException(status_code=500, detail=f"Error processing image: {str(e)}")
 
-    # Check if image contains news content
-    if not image_result.get("is_news", True):
-        return MisinformationResponse(
+    # Check if image contains news content; a caption or context can carry the claim on its own
+    if not image_result.get("is_news", True) and not caption and not context:
+        return negotiate(request, with_metadata(MisinformationResponse(
             is_misinformation=False,
             confidence=0.0,
             is_news=False,
@@ -103,37 +335,276 @@ async def analyze_image(file: UploadFile = File(...)):
             extracted_text="",
             image_description=image_result.get("description", ""),
             message_type="image",
-        )
+        ), started))
 
     combined_text = f"{image_result['ocr_text']} {image_result['description']}"
+    if caption:
+        combined_text = f"Caption: {caption}\n{combined_text}"
+    if context:
+        combined_text = f"In reply to: {context}\n{combined_text}"
 
-    result = await classify_misinformation(combined_text)
+    senders = [t.strip() for t in sender_types.split(",")] if sender_types else None
+    result = await classify_misinformation(with_sender_context(combined_text, senders))
 
-    return MisinformationResponse(
+    return negotiate(request, with_metadata(MisinformationResponse(
         is_misinformation=result["is_misinformation"],
+        verdict=result.get("verdict"),
         confidence=result["confidence"],
         is_news=True,
         summary=result.get("summary"),
         evidence=result.get("evidence"),
         sources_checked=result.get("sources_checked"),
         recommendation=result.get("recommendation"),
+        topic=result.get("topic"),
         extracted_text=image_result["ocr_text"],
         image_description=image_result["description"],
-        message_type="image",
+        message_type=result.get("content_type") or "image",
+        publisher=result.get("publisher"),
+    ), started))
+
+
+@app.post("/analyze/media", response_model=MisinformationResponse)
+async def analyze_media(
+    file: UploadFile = File(...),
+    kind: str = Form("audio"),
+    duration: Optional[int] = Form(None),
+    analyzed_seconds: Optional[int] = Form(None),
+    caption: Optional[str] = Form(None),
+    callback_url: Optional[str] = Form(None),
+    callback_token: Optional[str] = Form(None),
+    idempotency_key: Optional[str] = Header(None),
+):
+    """
+    Analyze a voice note, audio or video for misinformation from its transcript.
+    Clients send only the start of long recordings; analyzed_seconds of duration
+    says how much of it the file covers. With callback_url the analysis runs in
+    the background: the response is 202 with a job_id and the result is posted
+    to callback_url when done.
+    """
+    check_callback(callback_url)
+    print(f"Analyzing {kind} of {duration}s, {analyzed_seconds}s sent (idempotency key {idempotency_key})")
+    started = time.perf_counter()
+    media_data = await file.read()
+    analysis = analyze_recording(media_data, file.filename or kind, kind, duration, analyzed_seconds, caption, started)
+    if callback_url:
+        return start_job(analysis, callback_url, callback_token)
+    return await analysis
+
+
+@app.post("/analyze/media-url", response_model=MisinformationResponse)
+async def analyze_media_url(message: MediaURLMessage, idempotency_key: Optional[str] = Header(None)):
+    """
+    Analyze a recording the client uploaded to object storage, fetched from
+    the presigned URL, so large files don't pass through the request body.
+    """
+    if not is_media_url_allowed(message.url):
+        raise HTTPException(status_code=400, detail="Media URL is not on an allowed host (MEDIA_URL_HOSTS)")
+    check_callback(message.callback_url)
+    print(f"Analyzing {message.kind} of {message.duration}s from object storage (idempotency key {idempotency_key})")
+    started = time.perf_counter()
+    try:
+        media_data = await download_media(message.url)
+    except Exception as e:
+        raise HTTPException(status_code=502, detail=f"Error downloading {message.kind}: {str(e)}")
+    analysis = analyze_recording(
+        media_data, message.file_name or message.kind, message.kind,
+        message.duration, message.analyzed_seconds, message.caption, started,
     )
+    if message.callback_url:
+        return start_job(analysis, message.callback_url, message.callback_token)
+    return await analysis
+
+
+def is_callback_allowed(callback_url: str) -> bool:
+    """Report whether callback_url is one of CALLBACK_URLS, or under one."""
+    url = urlparse(callback_url)
+    for allowed in map(urlparse, CALLBACK_URLS):
+        if (url.scheme, (url.netloc or "").lower()) != (allowed.scheme, (allowed.netloc or "").lower()):
+            continue
+        base = allowed.path.rstrip("/")
+        if url.path == base or url.path.startswith(base + "/"):
+            return True
+    return False
+
+
+def check_callback(callback_url: Optional[str]):
+    """Refuse a job whose callback isn't a configured bot callback."""
+    if callback_url and not is_callback_allowed(callback_url):
+        raise HTTPException(status_code=400, detail="Callback URL is not allowed (CALLBACK_URLS)")
+
+
+def start_job(analysis, callback_url: str, callback_token: Optional[str]) -> JSONResponse:
+    """Run an analysis in the background, posting its result to callback_url."""
+    job_id = str(uuid.uuid4())
+    task = asyncio.create_task(run_job(job_id, analysis, callback_url, callback_token))
+    background_jobs.add(task)
+    task.add_done_callback(background_jobs.discard)
+    return JSONResponse(status_code=202, content={"job_id": job_id})
+
+
+async def run_job(job_id: str, analysis, callback_url: str, callback_token: Optional[str]):
+    payload = {"job_id": job_id}
+    try:
+        result = await analysis
+        payload["result"] = result.model_dump(exclude_none=True)
+    except HTTPException as e:
+        payload["error"] = str(e.detail)
+    except Exception as e:
+        payload["error"] = f"Error analyzing: {str(e)}"
+
+    headers = {"X-Callback-Token": callback_token} if callback_token else {}
+    for attempt in range(3):
+        try:
+            async with httpx.AsyncClient(timeout=20.0, follow_redirects=False) as client:
+                response = await client.post(callback_url, json=payload, headers=headers)
+            if response.status_code < 500:
+                print(f"Job {job_id} delivered to callback ({response.status_code})")
+                return
+        except httpx.HTTPError as e:
+            print(f"Error delivering job {job_id}: {e}")
+        await asyncio.sleep(2 ** attempt)
+    print(f"Giving up delivering job {job_id}")
+
+
+async def analyze_recording(media_data, file_name, kind, duration, analyzed_seconds, caption, started):
+    """Transcribe a recording and classify the transcript with its caption."""
+    if not media_data:
+        raise HTTPException(status_code=400, detail="Empty file")
+
+    try:
+        transcript = await transcribe_media(media_data, file_name)
+    except Exception as e:
+        raise HTTPException(status_code=500, detail=f"Error transcribing {kind}: {str(e)}")
+
+    if not transcript and not caption:
+        return with_metadata(MisinformationResponse(
+            is_misinformation=False,
+            confidence=0.0,
+            is_news=False,
+            summary=f"No speech was found in this {kind}.",
+            evidence=[],
+            sources_checked=[],
+            recommendation="No fact-check needed.",
+            extracted_text="",
+            message_type=kind,
+        ), started)
+
+    combined_text = transcript
+    if caption:
+        combined_text = f"Caption: {caption}\n{combined_text}"
+    if analyzed_seconds and duration and analyzed_seconds < duration:
+        combined_text = f"(Transcript of the first {analyzed_seconds} seconds of a {duration}-second {kind})\n{combined_text}"
+
+    result = await classify_misinformation(combined_text)
+
+    return with_metadata(MisinformationResponse(
+        is_misinformation=result["is_misinformation"],
+        verdict=result.get("verdict"),
+        confidence=result["confidence"],
+        is_news=result.get("is_news", True),
+        summary=result.get("summary"),
+        evidence=result.get("evidence"),
+        sources_checked=result.get("sources_checked"),
+        recommendation=result.get("recommendation"),
+        topic=result.get("topic"),
+        extracted_text=transcript,
+        message_type=result.get("content_type") or kind,
+        publisher=result.get("publisher"),
+    ), started)
+
+
+@app.post("/analyze/social", response_model=MisinformationResponse)
+async def analyze_social(message: SocialMessage, idempotency_key: Optional[str] = Header(None)):
+    """
+    Analyze a YouTube, Instagram or X link from its title, author and
+    transcript or caption, together with the message it was shared in
+    """
+    print(f"Analyzing social link {message.url} (idempotency key {idempotency_key})")
+    started = time.perf_counter()
+
+    # Refuse other links before fetching anything, so callers can't make the backend request arbitrary URLs
+    if not detect_platform(message.url):
+        raise HTTPException(status_code=400, detail="Only YouTube, Instagram and X links are supported")
+    try:
+        post = await fetch_social(message.url)
+    except Exception as e:
+        raise HTTPException(status_code=502, detail=f"Error fetching {message.url}: {str(e)}")
+
+    parts = []
+    if message.text:
+        parts.append(f"Shared with the message: {message.text}")
+    if post["title"]:
+        parts.append(f"Title: {post['title']}")
+    if post["author"]:
+        parts.append(f"Posted by: {post['author']}")
+    if post["text"]:
+        parts.append(f"Content: {post['text']}")
+    result = await classify_misinformation("\n".join(parts) or message.url)
+
+    return with_metadata(MisinformationResponse(
+        is_misinformation=result["is_misinformation"],
+        verdict=result.get("verdict"),
+        confidence=result["confidence"],
+        is_news=result.get("is_news", True),
+        summary=result.get("summary"),
+        evidence=result.get("evidence"),
+        sources_checked=result.get("sources_checked"),
+        recommendation=result.get("recommendation"),
+        topic=result.get("topic"),
+        extracted_text=post["text"],
+        social=SocialContext(
+            platform=post["platform"], url=message.url, title=post["title"], author=post["author"]
+        ),
+        message_type=result.get("content_type") or "social",
+        publisher=result.get("publisher"),
+    ), started)
+
+
+@app.post("/chat", response_model=ChatAnswer)
+async def chat(message: ChatMessage):
+    """
+    Answer a follow-up question about a verdict sent earlier
+    """
+    try:
+        answer = await answer_follow_up(
+            message.question,
+            message.verdict,
+            message=message.message,
+            language=message.language,
+            history=[turn.model_dump() for turn in message.history or []],
+        )
+    except Exception as e:
+        raise HTTPException(status_code=500, detail=f"Error answering question: {str(e)}")
+    if not answer:
+        raise HTTPException(status_code=502, detail="The model returned an empty answer")
+    return ChatAnswer(answer=answer)
+
+
+@app.post("/translate", response_model=TranslateResponse)
+async def translate(message: TranslateMessage):
+    """
+    Translate a verdict's summary, recommendation and evidence for chats that read another language
+    """
+    try:
+        translations = await translate_texts(message.texts, message.source, message.target)
+    except Exception as e:
+        raise HTTPException(status_code=500, detail=f"Error translating: {str(e)}")
+    return TranslateResponse(translations=translations)
 
 
 @app.post("/analyze", response_model=MisinformationResponse)
 async def analyze_message(
-    text: Optional[str] = Form(None), file: Optional[UploadFile] = File(None)
+    request: Request, text: Optional[str] = Form(None), file: Optional[UploadFile] = File(None)
 ):
     """
     Unified endpoint to analyze either text or image message
     """
     if file:
-        return await analyze_image(file)
+        return await analyze_image(
+            request, file, caption=text, context=None, sender_types=None, idempotency_key=None
+        )
     elif text:
-        return await analyze_text(TextMessage(text=text))
+        return await analyze_text(request, TextMessage(text=text), idempotency_key=None)
     else:
         raise HTTPException(
             status_code=400, detail="Either text or image file must be provided"
@@ -0,0 +1,52 @@
+import json
+from typing import Dict, List, Optional
+
+from services.image_processor import get_client
+
+CHAT_PROMPT = """You are Aletheia, a fact-checking assistant on WhatsApp. You already fact-checked a message and sent the verdict below; the user is now asking a follow-up question about it.
+
+Answer in a few short sentences, using the verdict, its evidence and its sources. Say plainly when the verdict doesn't cover the question rather than guessing. Don't repeat the whole verdict. Write plain text, without Markdown headings or tables."""
+
+
+async def answer_follow_up(
+    question: str,
+    verdict: Dict[str, any],
+    message: Optional[str] = None,
+    language: Optional[str] = None,
+    history: Optional[List[Dict[str, str]]] = None,
+) -> str:
+    """
+    Answer a question about a verdict sent earlier.
+
+    Args:
+        question: The user's question
+        verdict: The analysis the question is about
+        message: The text that was fact-checked
+        language: Language code to answer in
+        history: Earlier questions and answers, as user and assistant turns
+
+    Returns:
+        The answer
+    """
+    client = get_client()
+
+    context = f"Verdict:\n{json.dumps(verdict, ensure_ascii=False)}"
+    if message:
+        context = f"Message that was checked:\n{message}\n\n{context}"
+    system = f"{CHAT_PROMPT}\n\n{context}"
+    if language:
+        system += f"\n\nAnswer in the language with code {language}."
+
+    messages = [{"role": "system", "content": system}]
+    for turn in history or []:
+        if turn.get("role") in ("user", "assistant") and turn.get("content"):
+            messages.append({"role": turn["role"], "content": turn["content"]})
+    messages.append({"role": "user", "content": question})
+
+    response = client.chat.completions.create(
+        model="gpt-4o-mini",
+        messages=messages,
+        temperature=0.3,
+        max_tokens=400,
+    )
+    return (response.choices[0].message.content or "").strip()
@@ -1,6 +1,23 @@
 from typing import Dict
 from services.fact_checker import check_misinformation
 
+# Fact-checker verdicts that mean the claim couldn't be established either way
+UNVERIFIABLE_VERDICTS = {"UNVERIFIED", "ERROR"}
+
+# Content that isn't a factual claim, reported as the response's message_type
+# so clients can reply to it instead of fact-checking it
+CONTENT_TYPES = {"satire", "opinion", "advertisement", "personal"}
+
+
+def three_state_verdict(result: Dict[str, any]) -> str:
+    """Map the fact-checker's verdict to credible, misinformation or unverifiable"""
+    verdict = str(result.get("verdict", "")).upper()
+    if verdict in UNVERIFIABLE_VERDICTS:
+        return "unverifiable"
+    if verdict in ("FALSE", "MISLEADING") or result.get("is_misinformation", False):
+        return "misinformation"
+    return "credible"
+
 
 async def classify_misinformation(text: str) -> Dict[str, any]:
     """
@@ -15,13 +32,23 @@ async def classify_misinformation(text: str) -> Dict[str, any]:
         Dictionary containing classification result, confidence score, and details
     """
     result = await check_misinformation(text)
-    
+    content_type = str(result.get("content_type") or "claim").lower()
+    if content_type not in CONTENT_TYPES:
+        content_type = None
+    # Satire and opinion aren't misinformation, however false they are literally
+    verdict = None if content_type else three_state_verdict(result)
+
     return {
-        "is_misinformation": result.get("is_misinformation", False),
+        "is_misinformation": verdict == "misinformation",
+        "verdict": verdict,
         "confidence": result.get("confidence", 0.0),
         "is_news": result.get("is_news", True),
         "summary": result.get("summary", ""),
         "evidence": result.get("evidence", []),
         "sources_checked": result.get("sources_checked", []),
-        "recommendation": result.get("recommendation", "")
+        "recommendation": result.get("recommendation", ""),
+        "developing": result.get("developing", False),
+        "topic": result.get("topic", "other"),
+        "content_type": content_type,
+        "publisher": result.get("publisher"),
     }
@@ -187,7 +187,11 @@ Based on this information, provide your analysis in the following JSON format:
     "summary": "Brief 1-2 sentence summary of findings",
     "evidence": ["Key fact 1", "Key fact 2", "Key fact 3"],
     "sources": ["Source 1", "Source 2"],
-    "recommendation": "What the user should do"
+    "recommendation": "What the user should do",
+    "developing": true/false,
+    "topic": "health" | "elections" | "disasters" | "other",
+    "content_type": "claim" | "satire" | "opinion" | "advertisement" | "personal",
+    "publisher": "Name of the outlet that published it, if known"
 }}
 
 Guidelines:
@@ -196,6 +200,11 @@ Guidelines:
 - is_news: false if this is casual conversation, greetings, or non-news content
 - For non-news content, set is_misinformation to false with low confidence
 - Be conservative - only mark as misinformation if there's clear evidence
+- developing: true for breaking news still unfolding, where the facts may change within a day
+- topic: the subject area, so readers can be pointed to the right official resources
+- content_type: "satire" for parody or satire sites, "opinion" for commentary and personal views,
+  "advertisement" for promotions, "personal" for private messages; "claim" for everything else
+- publisher: the outlet's name when the content comes from a known publication, especially satire
 
 Return ONLY the JSON, no other text."""
 
@@ -241,6 +250,10 @@ Return ONLY the JSON, no other text."""
                 "evidence": result.get("evidence", []),
                 "sources_checked": result.get("sources_checked", []),
                 "recommendation": result.get("recommendation", "Verify with multiple sources."),
+                "developing": result.get("developing", False),
+                "topic": result.get("topic", "other"),
+                "content_type": result.get("content_type", "claim"),
+                "publisher": result.get("publisher"),
                 "success": True
             }
             
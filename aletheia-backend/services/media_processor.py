@@ -0,0 +1,63 @@
+import io
+import os
+from urllib.parse import urlparse
+
+import httpx
+
+from services.image_processor import get_client
+
+# Whisper's upload limit; larger downloads are refused
+MAX_DOWNLOAD_BYTES = 25 * 1024 * 1024
+
+# Hosts recordings may be downloaded from: the bots' object storage, as in
+# their presigned URLs. With none set, media URLs are refused.
+MEDIA_URL_HOSTS = {h.strip().lower() for h in os.getenv("MEDIA_URL_HOSTS", "").split(",") if h.strip()}
+
+
+def is_media_url_allowed(url: str) -> bool:
+    """Report whether url is an http(s) URL on one of MEDIA_URL_HOSTS."""
+    parsed = urlparse(url)
+    return parsed.scheme in ("http", "https") and (parsed.hostname or "").lower() in MEDIA_URL_HOSTS
+
+
+async def download_media(url: str) -> bytes:
+    """
+    Download a recording from a presigned object storage URL. Redirects
+    aren't followed, so the download stays on the allowed host.
+
+    Args:
+        url: Presigned GET URL on one of MEDIA_URL_HOSTS
+
+    Returns:
+        The file's bytes
+    """
+    if not is_media_url_allowed(url):
+        raise ValueError("URL is not on an allowed media host")
+    data = bytearray()
+    async with httpx.AsyncClient(timeout=60.0, follow_redirects=False) as client:
+        async with client.stream("GET", url) as response:
+            response.raise_for_status()
+            async for chunk in response.aiter_bytes():
+                data.extend(chunk)
+                if len(data) > MAX_DOWNLOAD_BYTES:
+                    raise ValueError("file is larger than 25 MB")
+    return bytes(data)
+
+
+async def transcribe_media(media_data: bytes, filename: str) -> str:
+    """
+    Transcribe the speech in an audio clip (or a video's audio track) using Whisper.
+
+    Args:
+        media_data: Raw audio or video bytes
+        filename: Name with an extension Whisper uses to detect the format
+
+    Returns:
+        The transcript, or an empty string when nothing was said
+    """
+    client = get_client()
+
+    audio = io.BytesIO(media_data)
+    audio.name = filename
+    transcript = client.audio.transcriptions.create(model="whisper-1", file=audio)
+    return transcript.text.strip()
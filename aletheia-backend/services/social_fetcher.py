@@ -0,0 +1,132 @@
+"""
+Fetches what a social media link shows - title, author and text or transcript -
+so the claim in a shared video or post can be checked rather than just its URL.
+"""
+
+import html
+import re
+from typing import Dict, Optional
+from urllib.parse import urlparse, parse_qs
+
+import httpx
+
+TIMEOUT = 10.0
+HEADERS = {"User-Agent": "Mozilla/5.0 (compatible; AletheiaBot/1.0)"}
+
+PLATFORMS = {
+    "youtube.com": "youtube",
+    "m.youtube.com": "youtube",
+    "youtu.be": "youtube",
+    "instagram.com": "instagram",
+    "x.com": "x",
+    "twitter.com": "x",
+    "mobile.twitter.com": "x",
+}
+
+
+# Redirects followed when fetching a post's page, each to a platform host
+MAX_REDIRECTS = 5
+
+
+def detect_platform(url: str) -> Optional[str]:
+    """Return youtube, instagram or x for links to those platforms, else None."""
+    parsed = urlparse(url)
+    if parsed.scheme not in ("http", "https"):
+        return None
+    host = (parsed.hostname or "").lower()
+    if host.startswith("www."):
+        host = host[4:]
+    return PLATFORMS.get(host)
+
+
+def _strip_tags(text: str) -> str:
+    return html.unescape(re.sub(r"<[^>]+>", " ", text)).strip()
+
+
+def _meta(page: str, prop: str) -> str:
+    """Read an og:/twitter: meta tag from an HTML page."""
+    match = re.search(
+        rf'<meta[^>]+(?:property|name)="{re.escape(prop)}"[^>]+content="([^"]*)"', page
+    )
+    return html.unescape(match.group(1)).strip() if match else ""
+
+
+def _youtube_id(url: str) -> Optional[str]:
+    parsed = urlparse(url)
+    if parsed.hostname and parsed.hostname.endswith("youtu.be"):
+        return parsed.path.lstrip("/") or None
+    if parsed.path.startswith(("/shorts/", "/live/")):
+        return parsed.path.split("/")[2] or None
+    return parse_qs(parsed.query).get("v", [None])[0]
+
+
+def _youtube_transcript(video_id: str) -> str:
+    """Fetch the video's captions when youtube-transcript-api is installed."""
+    try:
+        from youtube_transcript_api import YouTubeTranscriptApi
+    except ImportError:
+        return ""
+    try:
+        parts = YouTubeTranscriptApi.get_transcript(video_id, languages=["en", "hi", "mr"])
+    except Exception as e:
+        print(f"No transcript for {video_id}: {e}")
+        return ""
+    return " ".join(p["text"] for p in parts)[:8000]
+
+
+async def fetch_social(url: str) -> Dict[str, str]:
+    """
+    Fetch the title, author and text of a YouTube video, Instagram post or X post.
+
+    Returns:
+        Dictionary with platform, title, author and text; fields that couldn't
+        be fetched are empty
+    """
+    platform = detect_platform(url) or ""
+    result = {"platform": platform, "title": "", "author": "", "text": ""}
+    # Only platform links are fetched, never whatever host a message names
+    if not platform:
+        return result
+
+    async with httpx.AsyncClient(timeout=TIMEOUT, headers=HEADERS, follow_redirects=True) as client:
+        if platform == "youtube":
+            resp = await client.get(
+                "https://www.youtube.com/oembed", params={"url": url, "format": "json"}
+            )
+            if resp.status_code == 200:
+                data = resp.json()
+                result["title"] = data.get("title", "")
+                result["author"] = data.get("author_name", "")
+            video_id = _youtube_id(url)
+            if video_id:
+                result["text"] = _youtube_transcript(video_id)
+        elif platform == "x":
+            resp = await client.get(
+                "https://publish.twitter.com/oembed", params={"url": url, "omit_script": "true"}
+            )
+            if resp.status_code == 200:
+                data = resp.json()
+                result["author"] = data.get("author_name", "")
+                result["text"] = _strip_tags(data.get("html", ""))
+
+        # Fall back to the page's own preview tags (Instagram has no open oEmbed)
+        if not result["text"] or not result["title"]:
+            resp = await _get_page(client, url)
+            if resp is not None and resp.status_code == 200:
+                page = resp.text
+                result["title"] = result["title"] or _meta(page, "og:title")
+                result["text"] = result["text"] or _meta(page, "og:description")
+
+    return result
+
+
+async def _get_page(client: httpx.AsyncClient, url: str) -> Optional[httpx.Response]:
+    """GET a post's page, following redirects only while they stay on a platform host."""
+    for _ in range(MAX_REDIRECTS + 1):
+        resp = await client.get(url, follow_redirects=False)
+        if not resp.is_redirect:
+            return resp
+        url = str(resp.url.join(resp.headers["location"]))
+        if not detect_platform(url):
+            return None
+    return None
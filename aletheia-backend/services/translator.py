@@ -0,0 +1,40 @@
+import json
+from typing import List
+
+from services.image_processor import get_client
+
+TRANSLATE_PROMPT = """Translate each string in the JSON array the user sends from the language with code {source} into the language with code {target}.
+
+Keep WhatsApp formatting (*bold*, _italic_), emoji, numbers, names and URLs as they are. Return ONLY a JSON object {{"translations": [...]}} with one translated string per input string, in the same order."""
+
+
+async def translate_texts(texts: List[str], source: str, target: str) -> List[str]:
+    """
+    Translate verdict texts for chats that read another language.
+
+    Args:
+        texts: Strings to translate
+        source: Language code they are written in
+        target: Language code to translate them into
+
+    Returns:
+        The translations, one per text and in the same order
+    """
+    if not texts:
+        return []
+    client = get_client()
+
+    response = client.chat.completions.create(
+        model="gpt-4o-mini",
+        messages=[
+            {"role": "system", "content": TRANSLATE_PROMPT.format(source=source, target=target)},
+            {"role": "user", "content": json.dumps(texts, ensure_ascii=False)},
+        ],
+        response_format={"type": "json_object"},
+        temperature=0.1,
+    )
+    translations = json.loads(response.choices[0].message.content).get("translations")
+    if not isinstance(translations, list) or len(translations) != len(texts):
+        raise ValueError(f"expected {len(texts)} translations, got {translations!r}")
+    # Empty strings stay empty instead of whatever the model made of them
+    return [str(t) if text else "" for text, t in zip(texts, translations)]
@@ -0,0 +1,155 @@
+"""
+Protobuf encoding of the /analyze messages, following proto/aletheia.proto.
+
+Hand-written so the backend doesn't need protoc or generated modules for the
+few messages it exchanges; keep the field numbers in step with the .proto.
+"""
+import struct
+from typing import Any, Dict, Iterator, Tuple
+
+CONTENT_TYPE = "application/x-protobuf"
+
+VARINT, FIXED64, BYTES, FIXED32 = 0, 1, 2, 5
+
+
+def _varint(value: int) -> bytes:
+    out = bytearray()
+    while True:
+        byte = value & 0x7F
+        value >>= 7
+        if value:
+            out.append(byte | 0x80)
+        else:
+            out.append(byte)
+            return bytes(out)
+
+
+def _tag(number: int, wire_type: int) -> bytes:
+    return _varint(number << 3 | wire_type)
+
+
+def _string(number: int, value) -> bytes:
+    if not value:
+        return b""
+    data = value if isinstance(value, bytes) else str(value).encode()
+    return _tag(number, BYTES) + _varint(len(data)) + data
+
+
+def _message(number: int, data: bytes) -> bytes:
+    return _tag(number, BYTES) + _varint(len(data)) + data
+
+
+def _bool(number: int, value) -> bytes:
+    return _tag(number, VARINT) + b"\x01" if value else b""
+
+
+def _uint(number: int, value) -> bytes:
+    return _tag(number, VARINT) + _varint(int(value)) if value else b""
+
+
+def _double(number: int, value) -> bytes:
+    return _tag(number, FIXED64) + struct.pack("<d", value) if value else b""
+
+
+def _source(source) -> bytes:
+    """Sources come as a bare URL or name, or as a dict with title, url and credibility"""
+    if isinstance(source, dict):
+        return (
+            _string(1, source.get("title"))
+            + _string(2, source.get("url"))
+            + _string(3, source.get("credibility"))
+        )
+    source = str(source).strip()
+    if source.startswith(("http://", "https://")):
+        return _string(2, source)
+    return _string(1, source)
+
+
+def encode_analyze_response(response: Dict[str, Any]) -> bytes:
+    """Encode a MisinformationResponse dict as an aletheia.AnalyzeResponse"""
+    out = bytearray()
+    out += _bool(1, response.get("is_misinformation"))
+    out += _double(2, response.get("confidence"))
+    out += _bool(3, response.get("is_news"))
+    out += _string(4, response.get("summary"))
+    for item in response.get("evidence") or []:
+        out += _message(5, str(item).encode())
+    for source in response.get("sources_checked") or []:
+        out += _message(6, _source(source))
+    out += _string(7, response.get("recommendation"))
+    out += _string(8, response.get("message_type"))
+    for claim in response.get("claims") or []:
+        out += _message(9, (
+            _string(1, claim.get("text"))
+            + _string(2, claim.get("verdict"))
+            + _double(3, claim.get("confidence"))
+        ))
+    social = response.get("social")
+    if social:
+        out += _message(10, (
+            _string(1, social.get("platform"))
+            + _string(2, social.get("url"))
+            + _string(3, social.get("title"))
+            + _string(4, social.get("author"))
+        ))
+    out += _bool(11, response.get("developing"))
+    out += _string(12, response.get("topic"))
+    out += _string(13, response.get("model_version"))
+    out += _string(14, response.get("analysis_id"))
+    out += _double(15, response.get("processing_time"))
+    out += _string(16, response.get("extracted_text"))
+    out += _string(17, response.get("image_description"))
+    out += _uint(18, response.get("schema_version"))
+    out += _string(19, response.get("verdict"))
+    out += _string(20, response.get("publisher"))
+    return bytes(out)
+
+
+def _read_varint(data: bytes, pos: int) -> Tuple[int, int]:
+    value = shift = 0
+    while True:
+        if pos >= len(data) or shift > 63:
+            raise ValueError("truncated varint")
+        byte = data[pos]
+        pos += 1
+        value |= (byte & 0x7F) << shift
+        if not byte & 0x80:
+            return value, pos
+        shift += 7
+
+
+def _fields(data: bytes) -> Iterator[Tuple[int, int, Any]]:
+    """Yield the (number, wire type, value) of each field, bytes for length-delimited ones"""
+    pos = 0
+    while pos < len(data):
+        key, pos = _read_varint(data, pos)
+        number, wire_type = key >> 3, key & 7
+        if wire_type == VARINT:
+            value, pos = _read_varint(data, pos)
+        elif wire_type == FIXED64:
+            value, pos = data[pos:pos + 8], pos + 8
+        elif wire_type == FIXED32:
+            value, pos = data[pos:pos + 4], pos + 4
+        elif wire_type == BYTES:
+            length, pos = _read_varint(data, pos)
+            value, pos = data[pos:pos + length], pos + length
+        else:
+            raise ValueError(f"unsupported wire type {wire_type}")
+        if pos > len(data):
+            raise ValueError("truncated field")
+        yield number, wire_type, value
+
+
+def decode_analyze_request(data: bytes) -> Dict[str, Any]:
+    """Decode an aletheia.AnalyzeRequest into the fields of the JSON body"""
+    request = {"text": "", "language": None, "sender_types": []}
+    for number, wire_type, value in _fields(data):
+        if wire_type != BYTES:
+            continue
+        if number == 1:
+            request["text"] = value.decode()
+        elif number == 2:
+            request["language"] = value.decode() or None
+        elif number == 3:
+            request["sender_types"].append(value.decode())
+    return request
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const (
+	listAllow = "allow"
+	listBlock = "block"
+)
+
+// AccessLists caches the allowlist and blocklist stored in the bot database
+type AccessLists struct {
+	mu    sync.RWMutex
+	allow map[string]bool
+	block map[string]bool
+}
+
+var access = &AccessLists{allow: map[string]bool{}, block: map[string]bool{}}
+
+func init() {
+	registerCommand("allow", &Command{
+		Usage:   "/allow [jid]",
+		Help:    "Only respond in allowlisted chats (defaults to this chat)",
+		Role:    roleAdmin,
+		Handler: func(evt *events.Message, args []string) { cmdAccessAdd(evt, args, listAllow) },
+	})
+	registerCommand("unallow", &Command{
+		Usage:   "/unallow [jid]",
+		Help:    "Remove a chat or user from the allowlist",
+		Role:    roleAdmin,
+		Handler: func(evt *events.Message, args []string) { cmdAccessRemove(evt, args, listAllow) },
+	})
+	registerCommand("block", &Command{
+		Usage:   "/block <jid>",
+		Help:    "Never respond to a chat or user (or reply to their message)",
+		Role:    roleAdmin,
+		Handler: cmdBlock,
+	})
+	registerCommand("unblock", &Command{
+		Usage:   "/unblock <jid>",
+		Help:    "Remove a chat or user from the blocklist",
+		Role:    roleAdmin,
+		Handler: func(evt *events.Message, args []string) { cmdAccessRemove(evt, args, listBlock) },
+	})
+	registerCommand("access", &Command{
+		Usage:   "/access",
+		Help:    "Show the allowlist and blocklist",
+		Role:    roleAdmin,
+		Handler: cmdAccessShow,
+	})
+}
+
+// loadAccessLists seeds the lists from config and loads them into memory
+func (s *Store) loadAccessLists() error {
+	now := time.Now().Unix()
+	seed := func(jids []types.JID, list string) error {
+		for _, jid := range jids {
+			_, err := s.db.Exec(
+				`INSERT INTO access_list (jid, list, added_by, added_at) VALUES (?, ?, 'config', ?) ON CONFLICT DO NOTHING`,
+				jid.String(), list, now,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to seed %slist: %w", list, err)
+			}
+		}
+		return nil
+	}
+	if err := seed(config.AllowlistJIDs, listAllow); err != nil {
+		return err
+	}
+	if err := seed(config.BlocklistJIDs, listBlock); err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query(`SELECT jid, list FROM access_list`)
+	if err != nil {
+		return fmt.Errorf("failed to load access lists: %w", err)
+	}
+	defer rows.Close()
+
+	access.mu.Lock()
+	defer access.mu.Unlock()
+	// Start afresh so entries another instance removed don't linger
+	access.allow, access.block = map[string]bool{}, map[string]bool{}
+	for rows.Next() {
+		var jid, list string
+		if err := rows.Scan(&jid, &list); err != nil {
+			return fmt.Errorf("failed to scan access list: %w", err)
+		}
+		access.set(list, jid, true)
+	}
+	return rows.Err()
+}
+
+// configuredAccess returns the setting that seeds jid into list, or "" if
+// it isn't seeded from config
+func configuredAccess(list string, jid types.JID) string {
+	jids, setting := config.AllowlistJIDs, "ALLOWLIST_JIDS"
+	if list == listBlock {
+		jids, setting = config.BlocklistJIDs, "BLOCKLIST_JIDS"
+	}
+	for _, configured := range jids {
+		if configured.String() == jid.String() {
+			return setting
+		}
+	}
+	return ""
+}
+
+// addAccess stores jid in the given list
+func (s *Store) addAccess(list string, jid types.JID, addedBy types.JID) error {
+	_, err := s.db.Exec(
+		`INSERT INTO access_list (jid, list, added_by, added_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (jid, list) DO UPDATE SET added_by = excluded.added_by, added_at = excluded.added_at`,
+		jid.String(), list, addedBy.ToNonAD().String(), time.Now().Unix(),
+	)
+	if err != nil {
+		return err
+	}
+	access.mu.Lock()
+	was := access.has(list, jid.String())
+	access.set(list, jid.String(), true)
+	access.mu.Unlock()
+	s.audit(addedBy.ToNonAD().String(), types.JID{}, list+"list", jid.String(), was, true)
+	return nil
+}
+
+// removeAccess deletes jid from the given list, reporting whether it was present
+func (s *Store) removeAccess(list string, jid types.JID, removedBy types.JID) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM access_list WHERE jid = ? AND list = ?`, jid.String(), list)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	access.mu.Lock()
+	access.set(list, jid.String(), false)
+	access.mu.Unlock()
+	if n > 0 {
+		s.audit(removedBy.ToNonAD().String(), types.JID{}, list+"list", jid.String(), true, false)
+	}
+	return n > 0, nil
+}
+
+// set updates the in-memory list; callers must hold mu
+func (a *AccessLists) set(list, jid string, present bool) {
+	m := a.allow
+	if list == listBlock {
+		m = a.block
+	}
+	if present {
+		m[jid] = true
+	} else {
+		delete(m, jid)
+	}
+}
+
+// has reports whether jid is in the list; callers must hold mu
+func (a *AccessLists) has(list, jid string) bool {
+	if list == listBlock {
+		return a.block[jid]
+	}
+	return a.allow[jid]
+}
+
+// isPermitted reports whether the bot may respond to a message: nothing on the
+// blocklist, and, if an allowlist exists, the chat or sender must be on it
+func (a *AccessLists) isPermitted(info types.MessageInfo) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	candidates := []types.JID{info.Chat, info.Sender, info.SenderAlt}
+	for _, jid := range candidates {
+		if !jid.IsEmpty() && a.block[jid.ToNonAD().String()] {
+			return false
+		}
+	}
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, jid := range candidates {
+		if !jid.IsEmpty() && a.allow[jid.ToNonAD().String()] {
+			return true
+		}
+	}
+	return false
+}
+
+// entries returns the sorted contents of a list
+func (a *AccessLists) entries(list string) []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	m := a.allow
+	if list == listBlock {
+		m = a.block
+	}
+	out := make([]string, 0, len(m))
+	for jid := range m {
+		out = append(out, jid)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// quotedParticipant returns the sender of the message evt replies to, if any
+func quotedParticipant(evt *events.Message) string {
+	return evt.Message.GetExtendedTextMessage().GetContextInfo().GetParticipant()
+}
+
+// accessTarget resolves the JID a list command applies to: the argument, the
+// sender of the quoted message, or the current chat
+func accessTarget(evt *events.Message, args []string) (types.JID, error) {
+	if len(args) > 0 {
+		return parseJIDArg(strings.Join(args, " "))
+	}
+	if participant := quotedParticipant(evt); participant != "" {
+		return parseJIDArg(participant)
+	}
+	return evt.Info.Chat.ToNonAD(), nil
+}
+
+// cmdBlock blocks the chat or user named, or the sender of the quoted
+// message. Unlike /allow it never defaults to the current chat, where a
+// mistyped /block would silence the bot
+func cmdBlock(evt *events.Message, args []string) {
+	if len(args) == 0 && quotedParticipant(evt) == "" {
+		sendMessage(evt, "Usage: /block <jid>, or reply to their message with /block")
+		return
+	}
+	cmdAccessAdd(evt, args, listBlock)
+}
+
+func cmdAccessAdd(evt *events.Message, args []string, list string) {
+	jid, err := accessTarget(evt, args)
+	if err != nil {
+		sendMessage(evt, fmt.Sprintf("❌ %v", err))
+		return
+	}
+	if err := botStore.addAccess(list, jid, evt.Info.Sender); err != nil {
+		fmt.Printf("Error updating %slist: %v\n", list, err)
+		sendMessage(evt, "❌ *Error*\n\nCould not update the list. Please try again.")
+		return
+	}
+	sendMessage(evt, fmt.Sprintf("✅ Added `%s` to the %slist.", jid.String(), list))
+}
+
+func cmdAccessRemove(evt *events.Message, args []string, list string) {
+	jid, err := accessTarget(evt, args)
+	if err != nil {
+		sendMessage(evt, fmt.Sprintf("❌ %v", err))
+		return
+	}
+	// Entries from config are seeded again on every start
+	if setting := configuredAccess(list, jid); setting != "" {
+		sendMessage(evt, fmt.Sprintf("⚠️ `%s` is on the %slist from %s, and would be back after a restart. Remove it from %s instead.", jid.String(), list, setting, setting))
+		return
+	}
+	removed, err := botStore.removeAccess(list, jid, evt.Info.Sender)
+	if err != nil {
+		fmt.Printf("Error updating %slist: %v\n", list, err)
+		sendMessage(evt, "❌ *Error*\n\nCould not update the list. Please try again.")
+		return
+	}
+	if !removed {
+		sendMessage(evt, fmt.Sprintf("`%s` is not on the %slist.", jid.String(), list))
+		return
+	}
+	sendMessage(evt, fmt.Sprintf("✅ Removed `%s` from the %slist.", jid.String(), list))
+}
+
+func cmdAccessShow(evt *events.Message, args []string) {
+	var sb strings.Builder
+	for _, list := range []string{listAllow, listBlock} {
+		entries := access.entries(list)
+		title := "Allowlist"
+		if list == listBlock {
+			title = "Blocklist"
+		}
+		fmt.Fprintf(&sb, "*%s* (%d)\n", title, len(entries))
+		if len(entries) == 0 && list == listAllow {
+			sb.WriteString("_empty — responding in all chats_\n")
+		}
+		for _, jid := range entries {
+			fmt.Fprintf(&sb, "• %s\n", jid)
+		}
+		sb.WriteString("\n")
+	}
+	sendMessage(evt, strings.TrimRight(sb.String(), "\n"))
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// maxAlbumImages caps how many images of one album are analyzed
+const maxAlbumImages = 10
+
+// albumImage is one image of an album, with its position in it
+type albumImage struct {
+	evt   *events.Message
+	img   *waE2E.ImageMessage
+	index int32
+}
+
+// album collects the images sent together under one album message
+type album struct {
+	expected int
+	images   []albumImage
+	settings *ChatSettings
+	timer    *time.Timer
+	done     bool
+}
+
+// albums holds the albums still receiving images, keyed by chat and album ID
+var albums = struct {
+	sync.Mutex
+	byKey map[string]*album
+}{byKey: map[string]*album{}}
+
+// collectAlbum gathers album messages and album images, reporting whether evt
+// was one. The album is analyzed once all its images arrived, or after
+// config.AlbumWait when some never do.
+func collectAlbum(evt *events.Message, settings *ChatSettings) bool {
+	var (
+		parentID string
+		expected int
+		image    *albumImage
+	)
+	if a := evt.Message.GetAlbumMessage(); a != nil {
+		parentID = string(evt.Info.ID)
+		expected = int(a.GetExpectedImageCount())
+	} else if img := evt.Message.GetImageMessage(); img != nil {
+		assoc := evt.Message.GetMessageContextInfo().GetMessageAssociation()
+		if assoc.GetAssociationType() != waE2E.MessageAssociation_MEDIA_ALBUM {
+			return false
+		}
+		parentID = assoc.GetParentMessageKey().GetID()
+		image = &albumImage{evt: evt, img: img, index: assoc.GetMessageIndex()}
+	} else {
+		return false
+	}
+
+	key := evt.Info.Chat.String() + "/" + parentID
+	albums.Lock()
+	defer albums.Unlock()
+	a, ok := albums.byKey[key]
+	if !ok {
+		a = &album{settings: settings}
+		a.timer = time.AfterFunc(config.AlbumWait, func() { finishAlbum(key) })
+		albums.byKey[key] = a
+	}
+	if expected > 0 {
+		a.expected = expected
+	}
+	if image != nil && len(a.images) < maxAlbumImages {
+		a.images = append(a.images, *image)
+	}
+	if a.expected > 0 && len(a.images) >= min(a.expected, maxAlbumImages) && a.timer.Stop() {
+		go finishAlbum(key)
+	}
+	return true
+}
+
+// finishAlbum takes a collected album off the pending list and analyzes it
+func finishAlbum(key string) {
+	albums.Lock()
+	a, ok := albums.byKey[key]
+	delete(albums.byKey, key)
+	albums.Unlock()
+	if !ok || len(a.images) == 0 {
+		return
+	}
+	sort.SliceStable(a.images, func(i, j int) bool { return a.images[i].index < a.images[j].index })
+	handleAlbum(a.images, a.settings)
+}
+
+// handleAlbum analyzes every image of an album and replies to the first with
+// one merged verdict
+func handleAlbum(images []albumImage, settings *ChatSettings) {
+	first := images[0].evt
+	fmt.Printf("Received album of %d images from %s\n", len(images), first.Info.Sender.String())
+
+	var results []*AnalyzeResponse
+	for _, image := range images {
+		data, err := messenger.Download(context.Background(), image.img)
+		if err != nil {
+			fmt.Printf("Error downloading album image: %v\n", err)
+			metrics.fail("download_error", err)
+			continue
+		}
+		caption, quotedText := imageContext(image.img)
+		if config.ScrubPII {
+			caption, quotedText = scrubPII(caption, image.evt.Info.PushName), scrubPII(quotedText, image.evt.Info.PushName)
+		}
+		result, err := analyzeImageCached(data, caption, quotedText, idempotencyKey(image.evt.Info), senderTypes(image.evt.Info))
+		if err != nil {
+			fmt.Printf("Error analyzing album image: %v\n", err)
+			metrics.fail("backend_error", err)
+			if backendBreaker.isOpen() {
+				deferMessage(image.evt)
+			}
+			continue
+		}
+		go archiveMedia(image.evt.Info, "image", sha256Hex(data), data, image.img.GetJPEGThumbnail(), image.img.GetMimetype(), result)
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		if !backendBreaker.isOpen() {
+			sendError(first, "❌ *Error*\n\nCould not analyze the images. Please try again later.")
+		}
+		return
+	}
+
+	merged := mergeVerdicts(results)
+	metrics.inc("analyzed_album")
+	botStore.recordAnalysis(first.Info, "album", "", merged)
+	if !merged.IsNews {
+		fmt.Println("Not news album, ignoring")
+		return
+	}
+	sendVerdict(first, merged, settings, false)
+}
+
+// mergeVerdicts combines per-image verdicts into one: the most severe verdict
+// leads, and the evidence and sources of the others follow its own
+func mergeVerdicts(results []*AnalyzeResponse) *AnalyzeResponse {
+	lead := results[0]
+	for _, r := range results[1:] {
+		if severity(r) > severity(lead) {
+			lead = r
+		}
+	}
+
+	merged := *lead
+	merged.MessageType = "album"
+	merged.IsNews = false
+	merged.Evidence = nil
+	merged.SourcesChecked = nil
+	merged.Claims = nil
+	ordered := []*AnalyzeResponse{lead}
+	for _, r := range results {
+		if r != lead {
+			ordered = append(ordered, r)
+		}
+	}
+	seenEvidence, seenSource := map[string]bool{}, map[string]bool{}
+	for _, r := range ordered {
+		merged.IsNews = merged.IsNews || r.IsNews
+		for _, e := range r.Evidence {
+			if !seenEvidence[e] {
+				seenEvidence[e] = true
+				merged.Evidence = append(merged.Evidence, e)
+			}
+		}
+		for _, src := range r.SourcesChecked {
+			if !seenSource[src.String()] {
+				seenSource[src.String()] = true
+				merged.SourcesChecked = append(merged.SourcesChecked, src)
+			}
+		}
+		merged.Claims = append(merged.Claims, r.Claims...)
+	}
+	return &merged
+}
+
+// severity orders verdicts: confident misinformation first, non-news last
+func severity(r *AnalyzeResponse) float64 {
+	switch {
+	case !r.IsNews:
+		return -1
+	case r.IsMisinformation:
+		return 1 + r.Confidence
+	case r.isUnverifiable():
+		return 0.5
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"golang.org/x/image/draw"
+)
+
+// thumbnailSize is the longest side of archived thumbnails, in pixels
+const thumbnailSize = 320
+
+// archiveListSize is how many items /archive list shows
+const archiveListSize = 10
+
+// archiveStore holds archived thumbnails and files when ARCHIVE_MEDIA is on
+var archiveStore BlobStore
+
+func init() {
+	registerCommand("archive", &Command{
+		Usage:   "/archive <analysis-id> | list",
+		Help:    "Retrieve archived flagged media",
+		Role:    roleAdmin,
+		Handler: cmdArchive,
+	})
+}
+
+// ArchivedMedia is a flagged image or recording kept for review
+type ArchivedMedia struct {
+	ID           string
+	Chat         string
+	Sender       string
+	Kind         string
+	SHA256       string
+	ThumbnailKey string
+	OriginalKey  string
+	Mimetype     string
+	Verdict      AnalyzeResponse
+	CreatedAt    time.Time
+}
+
+// openArchive sets up the archive storage when ARCHIVE_MEDIA is on
+func openArchive() error {
+	if !config.ArchiveMedia {
+		return nil
+	}
+	store, err := newBlobStore()
+	if err != nil {
+		return err
+	}
+	archiveStore = store
+	fmt.Printf("Archiving flagged media to %s storage\n", config.ArchiveStorage)
+	return nil
+}
+
+// makeThumbnail decodes an image and returns it as a PNG no larger than
+// thumbnailSize on either side
+func makeThumbnail(data []byte) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scaleDown(src, thumbnailSize)); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleDown shrinks src to fit within size pixels on either side
+func scaleDown(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+// archiveMedia keeps the hash, a thumbnail and the verdict of flagged media.
+// The thumbnail is made from the message's embedded preview, or for images
+// from the image itself. data may be nil when the file is no longer at hand.
+// Failures are logged and otherwise ignored.
+func archiveMedia(info types.MessageInfo, kind, hash string, data, preview []byte, mimetype string, result *AnalyzeResponse) {
+	if archiveStore == nil || !result.IsMisinformation {
+		return
+	}
+	// Chats with disappearing messages expect their content not to outlive the timer
+	if isDisappearingChat(info.Chat) {
+		fmt.Printf("Not archiving media from %s: disappearing messages are on\n", info.Chat)
+		return
+	}
+	id := result.AnalysisID
+	if id == "" {
+		id = hash[:16]
+	}
+	if item, err := botStore.archivedMedia(id); err != nil {
+		fmt.Printf("Error looking up archived media: %v\n", err)
+		return
+	} else if item != nil {
+		return
+	}
+
+	item := ArchivedMedia{
+		ID:       id,
+		Chat:     info.Chat.ToNonAD().String(),
+		Sender:   info.Sender.ToNonAD().String(),
+		Kind:     kind,
+		SHA256:   hash,
+		Mimetype: mimetype,
+		Verdict:  *result,
+	}
+	source := preview
+	if len(source) == 0 && kind == "image" {
+		source = data
+	}
+	if len(source) > 0 {
+		thumb, err := makeThumbnail(source)
+		if err != nil {
+			fmt.Printf("Error making thumbnail: %v\n", err)
+		} else if err := archiveStore.Put("thumbnails/"+id+".png", thumb, "image/png"); err != nil {
+			fmt.Printf("Error archiving thumbnail: %v\n", err)
+		} else {
+			item.ThumbnailKey = "thumbnails/" + id + ".png"
+		}
+	}
+	if config.ArchiveOriginals && data != nil {
+		if err := archiveStore.Put("media/"+id, data, mimetype); err != nil {
+			fmt.Printf("Error archiving %s: %v\n", kind, err)
+		} else {
+			item.OriginalKey = "media/" + id
+		}
+	}
+
+	if err := botStore.saveArchivedMedia(&item); err != nil {
+		fmt.Printf("Error saving archived media: %v\n", err)
+		return
+	}
+	metrics.inc("archived_" + kind)
+	fmt.Printf("Archived flagged %s as %s\n", kind, id)
+}
+
+// saveArchivedMedia records an archived item
+func (s *Store) saveArchivedMedia(item *ArchivedMedia) error {
+	verdict, err := json.Marshal(item.Verdict)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO archived_media (id, chat, sender, kind, sha256, thumbnail_key, original_key, mimetype, verdict, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		item.ID, item.Chat, item.Sender, item.Kind, item.SHA256, item.ThumbnailKey, item.OriginalKey, item.Mimetype, string(verdict), time.Now().Unix(),
+	)
+	return err
+}
+
+const archivedMediaColumns = `id, chat, sender, kind, sha256, thumbnail_key, original_key, mimetype, verdict, created_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanArchivedMedia(row rowScanner) (*ArchivedMedia, error) {
+	var (
+		item      ArchivedMedia
+		verdict   string
+		createdAt int64
+	)
+	if err := row.Scan(&item.ID, &item.Chat, &item.Sender, &item.Kind, &item.SHA256, &item.ThumbnailKey,
+		&item.OriginalKey, &item.Mimetype, &verdict, &createdAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(verdict), &item.Verdict); err != nil {
+		return nil, fmt.Errorf("failed to decode archived verdict: %w", err)
+	}
+	item.CreatedAt = time.Unix(createdAt, 0)
+	return &item, nil
+}
+
+// archivedMedia returns the archived item with id, or nil if there is none
+func (s *Store) archivedMedia(id string) (*ArchivedMedia, error) {
+	item, err := scanArchivedMedia(s.db.QueryRow(`SELECT `+archivedMediaColumns+` FROM archived_media WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return item, err
+}
+
+// recentArchivedMedia returns the latest archived items, newest first
+func (s *Store) recentArchivedMedia(limit int) ([]ArchivedMedia, error) {
+	rows, err := s.db.Query(`SELECT `+archivedMediaColumns+` FROM archived_media ORDER BY created_at DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ArchivedMedia
+	for rows.Next() {
+		item, err := scanArchivedMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *item)
+	}
+	return out, rows.Err()
+}
+
+// archivedItems returns the archived items matching where
+func (s *Store) archivedItems(where string, args ...any) ([]*ArchivedMedia, error) {
+	rows, err := s.db.Query(`SELECT `+archivedMediaColumns+` FROM archived_media WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*ArchivedMedia
+	for rows.Next() {
+		item, err := scanArchivedMedia(rows)
+		if err != nil {
+			fmt.Printf("Error reading archive item: %v\n", err)
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// deleteArchivedFiles deletes the files of item from the archive, reporting
+// whether they are all gone. A row must only go once its files have, or
+// nothing could find them again.
+func deleteArchivedFiles(item *ArchivedMedia) bool {
+	deleted := true
+	for _, key := range []string{item.ThumbnailKey, item.OriginalKey} {
+		if key == "" {
+			continue
+		}
+		if err := archiveStore.Delete(key); err != nil {
+			fmt.Printf("Error deleting archived file %s: %v\n", key, err)
+			deleted = false
+		}
+	}
+	return deleted
+}
+
+// pruneArchive deletes archived items and their files older than retention
+func (s *Store) pruneArchive(retention time.Duration) {
+	expired, err := s.archivedItems(`created_at < ?`, time.Now().Add(-retention).Unix())
+	if err != nil {
+		fmt.Printf("Error loading expired archive items: %v\n", err)
+		return
+	}
+
+	pruned := 0
+	for _, item := range expired {
+		// Keep the row so a file that failed to delete is retried next time
+		if !deleteArchivedFiles(item) {
+			continue
+		}
+		if _, err := s.db.Exec(`DELETE FROM archived_media WHERE id = ?`, item.ID); err != nil {
+			fmt.Printf("Error pruning archive item: %v\n", err)
+			continue
+		}
+		pruned++
+	}
+	if pruned > 0 {
+		fmt.Printf("Pruned %d old archive items\n", pruned)
+	}
+}
+
+// deleteUserArchive deletes the files of media archived from the given JIDs'
+// chats or sent by them, ahead of their rows. It fails if any file couldn't
+// be deleted, so the rows stay for the next attempt.
+func (s *Store) deleteUserArchive(jids []string) error {
+	if archiveStore == nil || len(jids) == 0 {
+		return nil
+	}
+	inChat, args := userDataWhere(userDataTable{Column: "chat"}, jids)
+	sentBy, senderArgs := userDataWhere(userDataTable{Column: "sender"}, jids)
+	items, err := s.archivedItems(inChat+" OR "+sentBy, append(args, senderArgs...)...)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if !deleteArchivedFiles(item) {
+			return fmt.Errorf("failed to delete the files of archive item %s", item.ID)
+		}
+	}
+	return nil
+}
+
+// runArchivePruner enforces the archive retention period in the background
+func runArchivePruner() {
+	if archiveStore == nil || config.ArchiveRetention <= 0 {
+		return
+	}
+	for {
+		if ownsJob("archive-pruner") {
+			botStore.pruneArchive(config.ArchiveRetention)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// describeArchivedMedia summarizes an archived item for admins
+func describeArchivedMedia(item *ArchivedMedia) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🗄️ *Archived %s* %s\n", item.Kind, item.ID)
+	fmt.Fprintf(&sb, "Seen %s in %s\n", item.CreatedAt.In(config.TimeZone).Format("2 Jan 2006 15:04"), item.Chat)
+	fmt.Fprintf(&sb, "SHA-256: %s\n\n", item.SHA256)
+	sb.WriteString(formatShortResponse(&item.Verdict, "", ""))
+	return sb.String()
+}
+
+func cmdArchive(evt *events.Message, args []string) {
+	if archiveStore == nil {
+		sendMessage(evt, "ℹ️ Media archiving is off. Set ARCHIVE_MEDIA=true to enable it.")
+		return
+	}
+	if len(args) == 0 {
+		sendMessage(evt, "Usage: /archive <analysis-id> | list")
+		return
+	}
+
+	if strings.ToLower(args[0]) == "list" {
+		items, err := botStore.recentArchivedMedia(archiveListSize)
+		if err != nil {
+			fmt.Printf("Error loading archived media: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not load the archive.")
+			return
+		}
+		if len(items) == 0 {
+			sendMessage(evt, "ℹ️ Nothing has been archived yet.")
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("🗄️ *Recently archived*\n")
+		for _, item := range items {
+			fmt.Fprintf(&sb, "\n• %s (%s, %s) %s", item.ID, item.Kind,
+				item.CreatedAt.In(config.TimeZone).Format("2 Jan 15:04"), item.Verdict.Summary)
+		}
+		sendMessage(evt, sb.String())
+		return
+	}
+
+	item, err := botStore.archivedMedia(args[0])
+	switch {
+	case err != nil:
+		fmt.Printf("Error loading archived media: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not load the archived item.")
+		return
+	case item == nil:
+		sendMessage(evt, fmt.Sprintf("ℹ️ No archived item %q.", args[0]))
+		return
+	}
+
+	caption := describeArchivedMedia(item)
+	if item.ThumbnailKey != "" {
+		thumb, err := archiveStore.Get(item.ThumbnailKey)
+		if err == nil {
+			_, err = sendQuotedImage(evt.Info.Chat, string(evt.Info.ID), evt.Info.Sender.String(), evt.Message, thumb, caption)
+		}
+		if err == nil {
+			caption = ""
+		} else {
+			fmt.Printf("Error sending archived thumbnail: %v\n", err)
+		}
+	}
+	if caption != "" {
+		sendMessage(evt, caption)
+	}
+	if item.OriginalKey != "" {
+		data, err := archiveStore.Get(item.OriginalKey)
+		if err == nil {
+			err = sendDocument(evt.Info.Chat, data, item.Kind+"-"+item.ID, item.Mimetype, "")
+		}
+		if err != nil {
+			fmt.Printf("Error sending archived %s: %v\n", item.Kind, err)
+			sendMessage(evt, fmt.Sprintf("❌ Could not retrieve the archived %s file.", item.Kind))
+		}
+	}
+}
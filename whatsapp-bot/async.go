@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxCallbackBody caps the size of a backend callback
+const maxCallbackBody = 1 << 20
+
+// asyncJob is a media analysis the backend is running in the background,
+// with what's needed to reply once it calls back
+type asyncJob struct {
+	jobID     string
+	token     string
+	evt       *events.Message
+	hash      string
+	caption   string
+	claimKey  string
+	analyzed  int
+	explicit  bool
+	createdAt time.Time
+}
+
+// jobCallback is the body the backend posts to /callback
+type jobCallback struct {
+	JobID  string           `json:"job_id"`
+	Result *AnalyzeResponse `json:"result"`
+	Error  string           `json:"error"`
+}
+
+// submitMediaJob hands a recording to the backend to analyze in the
+// background. The reply is sent when the backend posts the result to
+// CALLBACK_URL; until then the message gets a ⏳ reaction.
+func submitMediaJob(evt *events.Message, item *mediaItem, data []byte, fileName string, analyzed int, caption, key, hash string, explicit bool) error {
+	if !backendBreaker.allow() {
+		return errBackendUnavailable
+	}
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(secret)
+
+	resp, err := postMedia(item, data, fileName, analyzed, caption, key, map[string]string{
+		"callback_url":   config.CallbackURL,
+		"callback_token": token,
+	})
+	var limited *rateLimitError
+	if errors.As(err, &limited) {
+		pauseBackend(limited.retryAfter)
+		return err
+	}
+	if err != nil {
+		backendBreaker.failure()
+		return err
+	}
+	defer resp.Body.Close()
+	backendBreaker.success()
+
+	var accepted struct {
+		JobID string `json:"job_id"`
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("backend answered with status %d instead of accepting a job", resp.StatusCode)
+	}
+	if err := decodeResponse(resp, &accepted); err != nil || accepted.JobID == "" {
+		return fmt.Errorf("backend accepted a job without an ID: %v", err)
+	}
+
+	job := &asyncJob{
+		jobID:    accepted.JobID,
+		token:    token,
+		evt:      evt,
+		hash:     hash,
+		caption:  caption,
+		claimKey: mediaResultKey(item, data, caption),
+		analyzed: analyzed,
+		explicit: explicit,
+	}
+	if err := botStore.saveAsyncJob(job); err != nil {
+		// The backend will call back for a job we can't match; analyze it directly instead
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	metrics.inc("async_submitted")
+	fmt.Printf("Submitted %s %s as job %s\n", item.kind, evt.Info.ID, job.jobID)
+	if !isShadowChat(evt.Info.Chat) {
+		react(evt.Info.Chat, evt.Info.Sender, evt.Info.ID, "⏳")
+	}
+	return nil
+}
+
+// saveAsyncJob records a submitted job
+func (s *Store) saveAsyncJob(job *asyncJob) error {
+	message, err := proto.Marshal(job.evt.Message)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO async_jobs (job_id, token, chat, sender, message_id, push_name, message, hash, caption, claim_key, analyzed, explicit, created_at, instance)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.jobID, job.token, job.evt.Info.Chat.String(), job.evt.Info.Sender.String(), job.evt.Info.ID, job.evt.Info.PushName,
+		message, job.hash, job.caption, job.claimKey, job.analyzed, job.explicit, time.Now().Unix(), config.InstanceID,
+	)
+	return err
+}
+
+const asyncJobColumns = `job_id, token, chat, sender, message_id, push_name, message, hash, caption, claim_key, analyzed, explicit, created_at`
+
+func scanAsyncJob(row rowScanner) (*asyncJob, error) {
+	var (
+		job                               asyncJob
+		chat, sender, messageID, pushName string
+		raw                               []byte
+		createdAt                         int64
+	)
+	if err := row.Scan(&job.jobID, &job.token, &chat, &sender, &messageID, &pushName, &raw,
+		&job.hash, &job.caption, &job.claimKey, &job.analyzed, &job.explicit, &createdAt); err != nil {
+		return nil, err
+	}
+	job.createdAt = time.Unix(createdAt, 0)
+	evt, err := decodeEvent(chat, sender, messageID, pushName, raw, job.createdAt)
+	if err != nil {
+		return nil, err
+	}
+	job.evt = evt
+	return &job, nil
+}
+
+// asyncJob returns the job with id, or nil if there is none
+func (s *Store) asyncJob(id string) (*asyncJob, error) {
+	job, err := scanAsyncJob(s.db.QueryRow(`SELECT `+asyncJobColumns+` FROM async_jobs WHERE job_id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// finishAsyncJob deletes a job, reporting whether it was still pending so a
+// job is only ever completed once
+func (s *Store) finishAsyncJob(id string) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM async_jobs WHERE job_id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// expiredAsyncJobs returns the jobs submitted before cutoff
+func (s *Store) expiredAsyncJobs(cutoff time.Time) ([]*asyncJob, error) {
+	rows, err := s.db.Query(`SELECT `+asyncJobColumns+` FROM async_jobs WHERE created_at < ? AND instance = ?`, cutoff.Unix(), config.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*asyncJob
+	for rows.Next() {
+		job, err := scanAsyncJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// handleCallback receives a finished job from the backend. The job's token
+// proves the callback comes from the backend it was submitted to.
+func handleCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var cb jobCallback
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCallbackBody)).Decode(&cb); err != nil || cb.JobID == "" {
+		http.Error(w, "invalid callback", http.StatusBadRequest)
+		return
+	}
+
+	job, err := botStore.asyncJob(cb.JobID)
+	switch {
+	case err != nil:
+		fmt.Printf("Error loading job %s: %v\n", cb.JobID, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	case job == nil:
+		http.Error(w, "unknown job", http.StatusNotFound)
+		return
+	}
+	token := r.Header.Get("X-Callback-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(job.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	pending, err := botStore.finishAsyncJob(job.jobID)
+	if err != nil {
+		fmt.Printf("Error finishing job %s: %v\n", job.jobID, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	if pending {
+		go completeAsyncJob(job, &cb)
+	}
+}
+
+// completeAsyncJob replies to the message of a finished job
+func completeAsyncJob(job *asyncJob, cb *jobCallback) {
+	evt := job.evt
+	item := mediaItemFrom(evt.Message)
+	if item == nil {
+		fmt.Printf("Job %s is not for a recording, dropping it\n", job.jobID)
+		return
+	}
+	if !isShadowChat(evt.Info.Chat) {
+		react(evt.Info.Chat, evt.Info.Sender, evt.Info.ID, "")
+	}
+	fmt.Printf("Job %s finished after %s\n", job.jobID, time.Since(job.createdAt).Round(time.Second))
+	if cb.Result != nil {
+		jobTime.add(time.Since(job.createdAt))
+	}
+
+	switch {
+	case cb.Error != "":
+		failMedia(evt, item, errors.New(cb.Error))
+		return
+	case cb.Result == nil:
+		failMedia(evt, item, errors.New("backend called back without a result"))
+		return
+	}
+	if err := validateAnalysis(cb.Result); err != nil {
+		failMedia(evt, item, err)
+		return
+	}
+	metrics.inc("async_completed")
+	logAnalysis(cb.Result)
+	cacheMediaResult(job.claimKey, job.caption, cb.Result)
+	settings := botStore.getChatSettings(evt.Info.Chat)
+	finishMedia(evt, item, job.hash, nil, job.analyzed, cb.Result, settings, job.explicit)
+}
+
+// runAsyncJobReaper gives up on jobs the backend never called back for
+func runAsyncJobReaper() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		jobs, err := botStore.expiredAsyncJobs(time.Now().Add(-config.AsyncJobTimeout))
+		if err != nil {
+			fmt.Printf("Error expiring jobs: %v\n", err)
+			continue
+		}
+		for _, job := range jobs {
+			if pending, err := botStore.finishAsyncJob(job.jobID); err != nil || !pending {
+				continue
+			}
+			metrics.inc("async_expired")
+			completeAsyncJob(job, &jobCallback{JobID: job.jobID, Error: "backend never called back"})
+		}
+	}
+}
+
+// startCallbackServer listens for backend callbacks when async analysis is on
+func startCallbackServer() {
+	if !config.AsyncAnalysis {
+		return
+	}
+	if config.CallbackURL == "" || config.CallbackAddr == "" {
+		fmt.Println("ASYNC_ANALYSIS is on but CALLBACK_ADDR or CALLBACK_URL is empty, analyzing media directly")
+		config.AsyncAnalysis = false
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", handleCallback)
+	go func() {
+		fmt.Printf("📨 Callback endpoint listening on %s\n", config.CallbackAddr)
+		if err := http.ListenAndServe(config.CallbackAddr, mux); err != nil {
+			fmt.Printf("Callback server stopped: %v\n", err)
+		}
+	}()
+	go runAsyncJobReaper()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const (
+	auditDefaultLimit = 20
+	auditMaxLimit     = 100
+	// auditValueLength caps how much of an old or new value /audit shows
+	auditValueLength = 80
+)
+
+// actorDashboard is the actor recorded for changes made on the web dashboard
+const actorDashboard = "dashboard"
+
+// AuditEntry is one administrative action in the audit log
+type AuditEntry struct {
+	ID     int64
+	Actor  string
+	Chat   string
+	Action string
+	Target string
+	Old    string // JSON, empty when there was no previous value
+	New    string // JSON, empty when the value was removed
+	At     time.Time
+}
+
+func init() {
+	registerCommand("audit", &Command{
+		Usage:   "/audit [jid|action] [limit]",
+		Help:    "Show recent administrative actions",
+		Role:    roleOwner,
+		Handler: cmdAudit,
+	})
+}
+
+// actorOf is the audit actor for a message: its sender without the device
+func actorOf(info types.MessageInfo) string {
+	return info.Sender.ToNonAD().String()
+}
+
+// audit appends an action to the audit log. Old and new values are stored as
+// JSON, nil meaning absent. Failures are logged so they never block the action.
+func (s *Store) audit(actor string, chat types.JID, action, target string, old, new any) {
+	var chatKey string
+	if !chat.IsEmpty() {
+		chatKey = chat.ToNonAD().String()
+	}
+	oldJSON, err := auditValue(old)
+	if err == nil {
+		var newJSON sql.NullString
+		if newJSON, err = auditValue(new); err == nil {
+			_, err = s.db.Exec(
+				`INSERT INTO audit_log (actor, chat, action, target, old_value, new_value, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				actor, chatKey, action, target, oldJSON, newJSON, time.Now().Unix(),
+			)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error writing audit log: %v\n", err)
+	}
+}
+
+func auditValue(v any) (sql.NullString, error) {
+	if v == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// auditLog returns the most recent entries, newest first. A non-empty filter
+// matches the actor, chat, target or action exactly.
+func (s *Store) auditLog(filter string, limit int) ([]AuditEntry, error) {
+	rows, err := s.db.Query(
+		`SELECT id, actor, chat, action, target, COALESCE(old_value, ''), COALESCE(new_value, ''), created_at
+		 FROM audit_log
+		 WHERE ? = '' OR actor = ? OR chat = ? OR target = ? OR action = ?
+		 ORDER BY id DESC LIMIT ?`,
+		filter, filter, filter, filter, filter, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var at int64
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Chat, &e.Action, &e.Target, &e.Old, &e.New, &at); err != nil {
+			return nil, err
+		}
+		e.At = time.Unix(at, 0)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// String formats the entry on one line for /audit
+func (e AuditEntry) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#%d %s `%s` %s", e.ID, e.At.In(config.TimeZone).Format("2 Jan 15:04"), e.Actor, e.Action)
+	if e.Target != "" {
+		fmt.Fprintf(&sb, " %s", e.Target)
+	}
+	if e.Chat != "" && e.Chat != e.Target {
+		fmt.Fprintf(&sb, " in `%s`", e.Chat)
+	}
+	if e.Old != "" || e.New != "" {
+		fmt.Fprintf(&sb, ": %s → %s", shortAuditValue(e.Old), shortAuditValue(e.New))
+	}
+	return sb.String()
+}
+
+func shortAuditValue(v string) string {
+	if v == "" {
+		return "∅"
+	}
+	runes := []rune(v)
+	if len(runes) > auditValueLength {
+		return string(runes[:auditValueLength]) + "…"
+	}
+	return v
+}
+
+func cmdAudit(evt *events.Message, args []string) {
+	var filter string
+	limit := auditDefaultLimit
+	for _, arg := range args {
+		// Small numbers are a limit, longer ones a phone number
+		if n, err := strconv.Atoi(arg); err == nil && n > 0 && n <= auditMaxLimit {
+			limit = n
+			continue
+		}
+		if jid, err := parseJIDArg(arg); err == nil {
+			filter = jid.String()
+		} else {
+			filter = strings.ToLower(arg)
+		}
+	}
+
+	entries, err := botStore.auditLog(filter, limit)
+	if err != nil {
+		fmt.Printf("Error loading audit log: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not load the audit log.")
+		return
+	}
+	if len(entries) == 0 {
+		sendMessage(evt, "📭 No matching audit entries.")
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("📜 *Audit log*\n")
+	for _, e := range entries {
+		sb.WriteString("\n" + e.String())
+	}
+	sendMessage(evt, sb.String())
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// backendCheckInterval is how often a newly set backend is health-checked
+const backendCheckInterval = 30 * time.Second
+
+// backendMaxFailures is how many failed health checks in a row revert a
+// newly set backend
+const backendMaxFailures = 3
+
+// actorHealthCheck is the audit actor of automatic backend reverts
+const actorHealthCheck = "health-check"
+
+// backendOverride is the backend set with /backend set, replacing
+// BACKEND_URL until a restart or /backend reset
+var backendOverride = struct {
+	sync.Mutex
+	url string
+	// generation increases with every switch, stopping older watches
+	generation int
+}{}
+
+func init() {
+	registerCommand("backend", &Command{
+		Usage:   "/backend [set <url> | test [url] | reset]",
+		Help:    "Show, test or switch the analysis backend without a restart",
+		Role:    roleAdmin,
+		Handler: cmdBackend,
+	})
+}
+
+// backendURL is the base URL of the analysis backend in use
+func backendURL() string {
+	backendOverride.Lock()
+	defer backendOverride.Unlock()
+	if backendOverride.url != "" {
+		return backendOverride.url
+	}
+	return config.BackendURL
+}
+
+// switchBackend points the bot at url, or back to BACKEND_URL when url is
+// empty, returning the previous URL and the new generation
+func switchBackend(url, actor string) (string, int) {
+	backendOverride.Lock()
+	previous := backendOverride.url
+	if previous == "" {
+		previous = config.BackendURL
+	}
+	backendOverride.url = url
+	backendOverride.generation++
+	generation := backendOverride.generation
+	backendOverride.Unlock()
+
+	current := backendURL()
+	fmt.Printf("Backend switched from %s to %s by %s\n", previous, current, actor)
+	botStore.audit(actor, types.JID{}, "backend", "", previous, current)
+	// Failures of the old backend say nothing about the new one
+	backendBreaker.success()
+	return previous, generation
+}
+
+// pingURL calls the /health endpoint of the backend at base and returns its latency
+func pingURL(base string) (time.Duration, error) {
+	start := time.Now()
+	resp, err := healthClient.Get(fmt.Sprintf("%s/health", base))
+	if err != nil {
+		return 0, fmt.Errorf("failed to call backend: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("backend returned status %d", resp.StatusCode)
+	}
+	return time.Since(start), nil
+}
+
+// watchBackend health-checks a newly set backend for config.BackendSwitchWatch
+// and switches back to previous after backendMaxFailures failed checks in a
+// row, telling report about it
+func watchBackend(generation int, previous string, report types.JID) {
+	deadline := time.Now().Add(config.BackendSwitchWatch)
+	failures := 0
+	for time.Now().Before(deadline) {
+		time.Sleep(backendCheckInterval)
+
+		backendOverride.Lock()
+		current, superseded := backendOverride.url, backendOverride.generation != generation
+		backendOverride.Unlock()
+		if superseded {
+			return
+		}
+		if _, err := pingURL(current); err != nil {
+			failures++
+			fmt.Printf("Health check %d of new backend %s failed: %v\n", failures, current, err)
+			if failures < backendMaxFailures {
+				continue
+			}
+			if previous == config.BackendURL {
+				previous = ""
+			}
+			switchBackend(previous, actorHealthCheck)
+			if err := sendText(report, fmt.Sprintf("↩️ *Backend reverted*\n\n%s failed %d health checks in a row (%v), so I switched back to %s.",
+				current, failures, err, backendURL())); err != nil {
+				fmt.Printf("Error reporting backend revert: %v\n", err)
+			}
+			return
+		}
+		failures = 0
+	}
+}
+
+func cmdBackend(evt *events.Message, args []string) {
+	if len(args) == 0 {
+		current := backendURL()
+		text := fmt.Sprintf("🔌 *Backend*\n\nIn use: %s", current)
+		if current != config.BackendURL {
+			text += fmt.Sprintf("\nConfigured: %s (send /backend reset to go back)", config.BackendURL)
+		}
+		if latency, err := pingURL(current); err != nil {
+			text += fmt.Sprintf("\nHealth: ❌ %v", err)
+		} else {
+			text += fmt.Sprintf("\nHealth: ✅ %s", latency.Round(time.Millisecond))
+		}
+		sendMessage(evt, text)
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "test":
+		url := backendURL()
+		if len(args) > 1 {
+			url = strings.TrimRight(args[1], "/")
+		}
+		latency, err := pingURL(url)
+		if err != nil {
+			sendMessage(evt, fmt.Sprintf("❌ %s is unhealthy: %v", url, err))
+			return
+		}
+		sendMessage(evt, fmt.Sprintf("✅ %s is healthy (%s).", url, latency.Round(time.Millisecond)))
+
+	case "set":
+		if len(args) != 2 || !isURL(args[1]) {
+			sendMessage(evt, "Usage: /backend set <http(s) url>")
+			return
+		}
+		url := strings.TrimRight(args[1], "/")
+		if _, err := pingURL(url); err != nil {
+			sendMessage(evt, fmt.Sprintf("❌ Not switching: %s is unhealthy: %v", url, err))
+			return
+		}
+		previous, generation := switchBackend(url, actorOf(evt.Info))
+		if config.BackendSwitchWatch > 0 {
+			go watchBackend(generation, previous, evt.Info.Chat)
+		}
+		sendMessage(evt, fmt.Sprintf("✅ Now using %s. I'll switch back to %s if it fails %d health checks in a row in the next %s. It lasts until a restart or /backend reset.",
+			url, previous, backendMaxFailures, config.BackendSwitchWatch))
+
+	case "reset":
+		switchBackend("", actorOf(evt.Info))
+		sendMessage(evt, fmt.Sprintf("✅ Back to the configured backend, %s.", config.BackendURL))
+
+	default:
+		sendMessage(evt, "Usage: /backend [set <url> | test [url] | reset]")
+	}
+}
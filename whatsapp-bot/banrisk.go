@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// errSendingPaused is returned for messages held back because WhatsApp has
+// temporarily banned the number
+var errSendingPaused = errors.New("sending is paused while the number is temporarily banned")
+
+// banRisk tracks signs that WhatsApp is restricting or about to restrict the
+// number: failed sends and delivery receipts, temporary bans and an outdated
+// client. Too many failures slow sending down; a ban stops it until it ends.
+var banRisk = struct {
+	sync.Mutex
+	failures       []time.Time // failed sends and receipts within BAN_RISK_WINDOW
+	throttledUntil time.Time
+	pausedUntil    time.Time
+	reason         string
+	// pendingAlert waits for operators until the bot can send again
+	pendingAlert string
+}{}
+
+// sendingPaused returns how much longer sending is paused, if it is
+func sendingPaused() (time.Duration, bool) {
+	banRisk.Lock()
+	defer banRisk.Unlock()
+	left := time.Until(banRisk.pausedUntil)
+	return left, left > 0
+}
+
+// sendSlowdown returns how many times further apart than usual sends are
+// spaced while the number is at risk
+func sendSlowdown() float64 {
+	banRisk.Lock()
+	defer banRisk.Unlock()
+	if time.Now().Before(banRisk.throttledUntil) && config.BanRiskSlowdown > 1 {
+		return config.BanRiskSlowdown
+	}
+	return 1
+}
+
+// banRiskState describes the current risk for /selftest and /debug/state
+func banRiskState() string {
+	banRisk.Lock()
+	defer banRisk.Unlock()
+	now := time.Now()
+	switch {
+	case now.Before(banRisk.pausedUntil):
+		return fmt.Sprintf("paused for %s: %s", banRisk.pausedUntil.Sub(now).Round(time.Second), banRisk.reason)
+	case now.Before(banRisk.throttledUntil):
+		return fmt.Sprintf("throttled for %s: %s", banRisk.throttledUntil.Sub(now).Round(time.Second), banRisk.reason)
+	}
+	return "ok"
+}
+
+// noteSendFailure counts a message WhatsApp didn't accept. Sends that never
+// reached WhatsApp, for lack of a connection, say nothing about the number.
+func noteSendFailure(err error) {
+	for _, local := range []error{errSendingPaused, errConnectionDegraded, whatsmeow.ErrNotConnected, whatsmeow.ErrNotLoggedIn, context.Canceled, context.DeadlineExceeded} {
+		if errors.Is(err, local) {
+			return
+		}
+	}
+	metrics.inc("send_failed")
+	noteDeliveryFailure("messages are failing to send")
+}
+
+// noteDeliveryFailure records a failure, throttling sending and alerting
+// operators once BAN_RISK_FAILURES of them fall within BAN_RISK_WINDOW
+func noteDeliveryFailure(reason string) {
+	if config.BanRiskFailures <= 0 {
+		return
+	}
+	now := time.Now()
+	banRisk.Lock()
+	n := 0
+	for n < len(banRisk.failures) && now.Sub(banRisk.failures[n]) > config.BanRiskWindow {
+		n++
+	}
+	banRisk.failures = append(banRisk.failures[n:], now)
+	escalate := len(banRisk.failures) >= config.BanRiskFailures && !now.Before(banRisk.throttledUntil)
+	if escalate {
+		banRisk.throttledUntil = now.Add(config.BanRiskThrottle)
+		banRisk.reason = reason
+		banRisk.failures = nil
+	}
+	banRisk.Unlock()
+	if !escalate {
+		return
+	}
+	fmt.Printf("⚠️ Ban risk: %s, slowing sends down for %s\n", reason, config.BanRiskThrottle)
+	metrics.inc("ban_risk_throttled")
+	go alertOperators(fmt.Sprintf("⚠️ *Ban risk*\n\nWhatsApp may be restricting this number: %s "+
+		"(%d failures in %s). Sending is %.0f× slower for %s.",
+		reason, config.BanRiskFailures, config.BanRiskWindow, config.BanRiskSlowdown, config.BanRiskThrottle))
+}
+
+// handleTemporaryBan stops sending until the ban ends, reconnects then and
+// keeps sending slow for a while after. Operators hear about it once the bot
+// is back, since it can't message anyone while banned.
+func handleTemporaryBan(evt *events.TemporaryBan) {
+	fmt.Printf("🚫 %s\n", evt)
+	metrics.inc("temporary_ban")
+	expire := evt.Expire
+	if expire <= 0 {
+		expire = config.BanRiskThrottle
+	}
+	now := time.Now()
+	banRisk.Lock()
+	banRisk.pausedUntil = now.Add(expire)
+	banRisk.throttledUntil = banRisk.pausedUntil.Add(config.BanRiskThrottle)
+	banRisk.reason = fmt.Sprintf("temporarily banned (%s)", tempBanReason(evt.Code))
+	banRisk.pendingAlert = fmt.Sprintf("🚫 *Temporary ban*\n\nWhatsApp banned this number for %s at %s: %s. "+
+		"Sending stayed paused until it ended and is %.0f× slower for the next %s.",
+		expire.Round(time.Minute), now.In(config.TimeZone).Format("2 Jan 15:04"), tempBanReason(evt.Code),
+		config.BanRiskSlowdown, config.BanRiskThrottle)
+	banRisk.Unlock()
+
+	time.AfterFunc(expire, func() {
+		if err := client.Connect(); err != nil {
+			fmt.Printf("Error reconnecting after temporary ban: %v\n", err)
+		}
+	})
+}
+
+// handleClientOutdated records that WhatsApp refuses this client version,
+// which needs a whatsmeow update before the bot can connect again
+func handleClientOutdated() {
+	fmt.Println("❌ WhatsApp rejected the client as outdated; update whatsmeow and rebuild the bot")
+	metrics.inc("client_outdated")
+	banRisk.Lock()
+	banRisk.reason = "client outdated"
+	banRisk.pendingAlert = "❌ *Client outdated*\n\nWhatsApp rejected the bot's client version. " +
+		"Update whatsmeow and redeploy; older clients are a ban risk."
+	banRisk.Unlock()
+}
+
+// sendPendingBanAlert tells operators about a ban or rejection once the bot
+// is connected again
+func sendPendingBanAlert() {
+	banRisk.Lock()
+	alert := banRisk.pendingAlert
+	banRisk.pendingAlert = ""
+	banRisk.Unlock()
+	if alert != "" {
+		go alertOperators(alert)
+	}
+}
+
+// tempBanReason describes a temporary ban code
+func tempBanReason(code events.TempBanReason) string {
+	switch code {
+	case events.TempBanSentToTooManyPeople:
+		return "sent to too many people"
+	case events.TempBanBlockedByUsers:
+		return "blocked by too many users"
+	case events.TempBanCreatedTooManyGroups:
+		return "created too many groups"
+	case events.TempBanSentTooManySameMessage:
+		return "sent the same message too often"
+	case events.TempBanBroadcastList:
+		return "broadcast list misuse"
+	}
+	return fmt.Sprintf("code %d", code)
+}
+
+// alertOperators messages every owner and admin
+func alertOperators(text string) {
+	for _, jid := range operatorsWith(roleAdmin) {
+		if err := sendText(jid, text); err != nil {
+			fmt.Printf("Error alerting %s: %v\n", jid, err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	storageDisk = "disk"
+	storageS3   = "s3"
+)
+
+// BlobStore keeps archived files by key, on local disk or in an
+// S3-compatible bucket
+type BlobStore interface {
+	Put(key string, data []byte, contentType string) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// newBlobStore returns the store configured by ARCHIVE_STORAGE
+func newBlobStore() (BlobStore, error) {
+	switch config.ArchiveStorage {
+	case storageDisk:
+		return &diskBlobStore{dir: config.ArchiveDir}, nil
+	case storageS3:
+		return newS3BlobStore()
+	}
+	return nil, fmt.Errorf("unknown storage %q (use disk or s3)", config.ArchiveStorage)
+}
+
+// newS3BlobStore returns the bucket configured by the S3_* settings. GCS
+// works too through its S3-compatible XML API with HMAC keys.
+func newS3BlobStore() (*s3BlobStore, error) {
+	if config.S3Endpoint == "" || config.S3Bucket == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for S3 storage")
+	}
+	return &s3BlobStore{
+		endpoint: strings.TrimSuffix(config.S3Endpoint, "/"),
+		bucket:   config.S3Bucket,
+		region:   config.S3Region,
+		client:   &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// diskBlobStore keeps files under a local directory
+type diskBlobStore struct {
+	dir string
+}
+
+func (d *diskBlobStore) path(key string) string {
+	return filepath.Join(d.dir, filepath.FromSlash(key))
+}
+
+func (d *diskBlobStore) Put(key string, data []byte, contentType string) error {
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func (d *diskBlobStore) Get(key string) ([]byte, error) {
+	return os.ReadFile(d.path(key))
+}
+
+func (d *diskBlobStore) Delete(key string) error {
+	err := os.Remove(d.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// s3BlobStore keeps files in an S3-compatible bucket, addressed path-style
+// so it works with MinIO and other self-hosted stores
+type s3BlobStore struct {
+	endpoint, bucket, region string
+	client                   *http.Client
+}
+
+// credentials signs with the current S3 keys, which can be rotated
+func (s *s3BlobStore) credentials() awsCredentials {
+	return awsCredentials{region: s.region, service: "s3",
+		accessKey: config.S3AccessKey.Get(), secretKey: config.S3SecretKey.Get()}
+}
+
+func (s *s3BlobStore) Put(key string, data []byte, contentType string) error {
+	_, err := s.do("PUT", key, data, contentType)
+	return err
+}
+
+func (s *s3BlobStore) Get(key string) ([]byte, error) {
+	return s.do("GET", key, nil, "")
+}
+
+func (s *s3BlobStore) Delete(key string) error {
+	_, err := s.do("DELETE", key, nil, "")
+	return err
+}
+
+// objectPath is the escaped path-style path of key
+func (s *s3BlobStore) objectPath(key string) string {
+	var segments []string
+	for _, part := range strings.Split(s.bucket+"/"+key, "/") {
+		segments = append(segments, url.PathEscape(part))
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// PresignGet returns a URL anyone can GET key from until ttl has passed
+func (s *s3BlobStore) PresignGet(key string, ttl time.Duration) (string, error) {
+	u, err := url.Parse(s.endpoint + s.objectPath(key))
+	if err != nil {
+		return "", fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	creds := s.credentials()
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", creds.accessKey+"/"+creds.scope(now))
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	// url.Values encodes spaces as +, SigV4 wants %20
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	canonical := strings.Join([]string{
+		"GET",
+		u.EscapedPath(),
+		canonicalQuery,
+		"host:" + u.Host,
+		"",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + creds.signature(now, amzDate, canonical)
+	return u.String(), nil
+}
+
+// do sends a request for key signed with AWS Signature Version 4
+func (s *s3BlobStore) do(method, key string, body []byte, contentType string) ([]byte, error) {
+	path := s.objectPath(key)
+	req, err := http.NewRequest(method, s.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.credentials().sign(req, path, body)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call object storage: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound && method == "DELETE" {
+		return nil, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("object storage returned status %d for %s %s", resp.StatusCode, method, key)
+	}
+	return data, nil
+}
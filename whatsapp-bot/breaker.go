@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxDeferredMessages caps how many messages are held while the backend is down
+const maxDeferredMessages = 500
+
+// deferredMaxAge is how old a held message may get before it's dropped
+// instead of checked; its media has likely expired by then
+const deferredMaxAge = 24 * time.Hour
+
+// errBackendUnavailable is returned instead of calling the backend while the breaker is open
+var errBackendUnavailable = errors.New("backend unavailable (circuit breaker open)")
+
+// CircuitBreaker stops calling the backend after repeated failures and lets
+// one probe through per cooldown until a call succeeds again
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+var backendBreaker = &CircuitBreaker{}
+
+// drainMu keeps recovery from running twice at once
+var drainMu sync.Mutex
+
+// allow reports whether a backend call may be made now
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if config.BreakerThreshold <= 0 || b.failures < config.BreakerThreshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) {
+		return false
+	}
+	// Let this call probe the backend and hold everything else back meanwhile
+	b.openUntil = time.Now().Add(config.BreakerCooldown)
+	return true
+}
+
+// isOpen reports whether the backend is currently considered down
+func (b *CircuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return config.BreakerThreshold > 0 && b.failures >= config.BreakerThreshold
+}
+
+// success closes the breaker, starting recovery if it was open
+func (b *CircuitBreaker) success() {
+	b.mu.Lock()
+	wasOpen := config.BreakerThreshold > 0 && b.failures >= config.BreakerThreshold
+	b.failures = 0
+	b.mu.Unlock()
+	if wasOpen {
+		fmt.Println("Backend is back, leaving degraded mode")
+		metrics.inc("breaker_closed")
+		go drainDeferred()
+	}
+}
+
+// failure records a failed call, opening the breaker at the threshold
+func (b *CircuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if config.BreakerThreshold > 0 && b.failures >= config.BreakerThreshold {
+		b.openUntil = time.Now().Add(config.BreakerCooldown)
+		if b.failures == config.BreakerThreshold {
+			fmt.Printf("Backend failed %d times in a row, entering degraded mode\n", b.failures)
+			metrics.inc("breaker_opened")
+		}
+	}
+}
+
+// callBackend runs call unless the breaker is open, retrying failures with
+// a growing delay and recording each outcome with the breaker
+func callBackend(call func() (*AnalyzeResponse, error)) (*AnalyzeResponse, error) {
+	if !backendBreaker.allow() {
+		return nil, errBackendUnavailable
+	}
+	var err error
+	for attempt := 0; attempt <= config.BackendRetries; attempt++ {
+		if attempt > 0 {
+			fmt.Printf("Retrying backend call (attempt %d): %v\n", attempt+1, err)
+			time.Sleep(time.Duration(attempt) * time.Second)
+			if !backendBreaker.allow() {
+				return nil, errBackendUnavailable
+			}
+		}
+		var result *AnalyzeResponse
+		result, err = call()
+		if err == nil {
+			backendBreaker.success()
+			return result, nil
+		}
+		// A rate limit means the backend is up: pause instead of counting a
+		// failure, and leave the retry to the caller
+		var limited *rateLimitError
+		if errors.As(err, &limited) {
+			pauseBackend(limited.retryAfter)
+			return nil, err
+		}
+		backendBreaker.failure()
+	}
+	return nil, err
+}
+
+// deferMessage holds a message that couldn't be checked while the backend is
+// down, reacting with 🕐 so the sender knows it will be looked at
+func deferMessage(evt *events.Message) {
+	var n int
+	botStore.db.QueryRow(`SELECT COUNT(*) FROM deferred_messages WHERE instance = ?`, config.InstanceID).Scan(&n)
+	if n >= maxDeferredMessages {
+		fmt.Printf("Deferred queue full, dropping message %s\n", evt.Info.ID)
+		metrics.inc("deferred_dropped")
+		return
+	}
+
+	message, err := proto.Marshal(evt.Message)
+	if err != nil {
+		fmt.Printf("Error encoding deferred message: %v\n", err)
+		return
+	}
+	_, err = botStore.db.Exec(
+		`INSERT INTO deferred_messages (chat, sender, message_id, push_name, message, created_at, instance) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		evt.Info.Chat.String(), evt.Info.Sender.String(), evt.Info.ID, evt.Info.PushName, message, time.Now().Unix(), config.InstanceID,
+	)
+	if err != nil {
+		fmt.Printf("Error deferring message: %v\n", err)
+		return
+	}
+	metrics.inc("deferred")
+	fmt.Printf("Backend down, deferred message %s in %s\n", evt.Info.ID, evt.Info.Chat)
+
+	if !isShadowChat(evt.Info.Chat) {
+		react(evt.Info.Chat, evt.Info.Sender, evt.Info.ID, "🕐")
+	}
+}
+
+// react sets (or with an empty emoji, clears) the bot's reaction to a message
+func react(chat, sender types.JID, id types.MessageID, emoji string) {
+	reaction := client.BuildReaction(chat, sender, id, emoji)
+	if _, err := messenger.SendMessage(context.Background(), chat, reaction); err != nil {
+		fmt.Printf("Error sending reaction: %v\n", err)
+	}
+}
+
+// deferredMessage is a message held back while the backend was down
+type deferredMessage struct {
+	id        int64
+	evt       *events.Message
+	createdAt time.Time
+}
+
+// deferredMessages loads the held messages, oldest first
+func (s *Store) deferredMessages() ([]deferredMessage, error) {
+	rows, err := s.db.Query(
+		`SELECT id, chat, sender, message_id, push_name, message, created_at FROM deferred_messages WHERE instance = ? ORDER BY id`,
+		config.InstanceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []deferredMessage
+	for rows.Next() {
+		var (
+			id                                int64
+			chat, sender, messageID, pushName string
+			raw                               []byte
+			createdAt                         int64
+		)
+		if err := rows.Scan(&id, &chat, &sender, &messageID, &pushName, &raw, &createdAt); err != nil {
+			return nil, err
+		}
+		evt, err := decodeEvent(chat, sender, messageID, pushName, raw, time.Unix(createdAt, 0))
+		if err != nil {
+			fmt.Printf("Dropping unreadable deferred message %d: %v\n", id, err)
+			s.db.Exec(`DELETE FROM deferred_messages WHERE id = ?`, id)
+			continue
+		}
+		out = append(out, deferredMessage{id: id, evt: evt, createdAt: time.Unix(createdAt, 0)})
+	}
+	return out, rows.Err()
+}
+
+// decodeEvent rebuilds a message event stored for later processing
+func decodeEvent(chat, sender, messageID, pushName string, raw []byte, timestamp time.Time) (*events.Message, error) {
+	chatJID, err := types.ParseJID(chat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chat: %w", err)
+	}
+	senderJID, err := types.ParseJID(sender)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %w", err)
+	}
+	var msg waE2E.Message
+	if err := proto.Unmarshal(raw, &msg); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	return &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{
+				Chat:    chatJID,
+				Sender:  senderJID,
+				IsGroup: chatJID.Server == types.GroupServer,
+			},
+			ID:        messageID,
+			PushName:  pushName,
+			Timestamp: timestamp,
+		},
+		Message: &msg,
+	}, nil
+}
+
+// drainDeferred announces that the backend is back in every chat with held
+// messages, then checks them in the order they arrived
+func drainDeferred() {
+	if !drainMu.TryLock() {
+		return
+	}
+	defer drainMu.Unlock()
+
+	held, err := botStore.deferredMessages()
+	if err != nil {
+		fmt.Printf("Error loading deferred messages: %v\n", err)
+		return
+	}
+	if len(held) == 0 {
+		return
+	}
+	fmt.Printf("Checking %d messages deferred while the backend was down\n", len(held))
+
+	perChat := map[types.JID]int{}
+	for _, d := range held {
+		perChat[d.evt.Info.Chat]++
+	}
+	for chat, n := range perChat {
+		if inQuietHours(chat) || isShadowChat(chat) {
+			continue
+		}
+		notice := fmt.Sprintf("✅ *Back online*\n\nThe analysis service is available again. Checking the %d message(s) sent while it was down.", n)
+		if err := sendText(chat, notice); err != nil {
+			fmt.Printf("Error announcing recovery in %s: %v\n", chat, err)
+		}
+	}
+
+	for _, d := range held {
+		if backendBreaker.isOpen() {
+			fmt.Println("Backend down again, keeping the remaining deferred messages")
+			return
+		}
+		botStore.db.Exec(`DELETE FROM deferred_messages WHERE id = ?`, d.id)
+		info := d.evt.Info
+		if !isShadowChat(info.Chat) {
+			react(info.Chat, info.Sender, info.ID, "")
+		}
+		if time.Since(d.createdAt) > deferredMaxAge {
+			fmt.Printf("Dropping deferred message %s, too old to check\n", info.ID)
+			continue
+		}
+		handleMessage(d.evt)
+	}
+}
+
+// runBackendProbe checks an open breaker's backend every cooldown, so held
+// messages are picked up even when no new ones arrive
+func runBackendProbe() {
+	interval := config.BreakerCooldown
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if backendBreaker.isOpen() && backendBreaker.allow() {
+			if _, err := pingBackend(); err != nil {
+				continue
+			}
+			backendBreaker.success()
+		} else if !backendBreaker.isOpen() && client.IsConnected() {
+			// Pick up messages held before a restart
+			drainDeferred()
+		}
+	}
+}
+
+// countDeferred returns how many messages are held for the backend
+func (s *Store) countDeferred() int {
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM deferred_messages`).Scan(&n); err != nil {
+		fmt.Printf("Error counting deferred messages: %v\n", err)
+	}
+	return n
+}
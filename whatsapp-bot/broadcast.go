@@ -0,0 +1,376 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// broadcastMu serializes fan-outs so two broadcasts never double the send rate
+var broadcastMu sync.Mutex
+
+func init() {
+	subscriptionTopics["announcements"] = "announcements from the bot's operators"
+
+	registerCommand("broadcast", &Command{
+		Usage:   "/broadcast [at HH:MM] <message> | list | cancel <id>",
+		Help:    "Send an announcement to chats subscribed to announcements",
+		Role:    roleOwner,
+		Confirm: confirmBroadcast,
+		Handler: cmdBroadcast,
+	})
+}
+
+// ScheduledBroadcast is an announcement waiting for its send time
+type ScheduledBroadcast struct {
+	ID     int64
+	Text   string
+	SendAt time.Time
+}
+
+// stripFields removes the first n whitespace-separated fields from text,
+// keeping the rest (including its line breaks) intact
+func stripFields(text string, n int) string {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	for i := 0; i < n; i++ {
+		end := strings.IndexFunc(text, unicode.IsSpace)
+		if end < 0 {
+			return ""
+		}
+		text = strings.TrimLeftFunc(text[end:], unicode.IsSpace)
+	}
+	return strings.TrimSpace(text)
+}
+
+// nextOccurrence returns the next time the clock reads minutes after midnight in the bot's time zone
+func nextOccurrence(minutes int, now time.Time) time.Time {
+	now = now.In(config.TimeZone)
+	t := time.Date(now.Year(), now.Month(), now.Day(), minutes/60, minutes%60, 0, 0, config.TimeZone)
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// scheduleBroadcast stores an announcement to send at sendAt
+func (s *Store) scheduleBroadcast(text string, sendAt time.Time, by types.JID) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(
+		`INSERT INTO scheduled_broadcasts (text, send_at, created_by, created_at) VALUES (?, ?, ?, ?) RETURNING id`,
+		text, sendAt.Unix(), by.ToNonAD().String(), time.Now().Unix(),
+	).Scan(&id)
+	if err == nil {
+		s.audit(by.ToNonAD().String(), types.JID{}, "broadcast-scheduled", fmt.Sprintf("#%d", id), nil, text)
+	}
+	return id, err
+}
+
+// pendingBroadcasts returns unsent announcements, soonest first
+func (s *Store) pendingBroadcasts() ([]ScheduledBroadcast, error) {
+	rows, err := s.db.Query(`SELECT id, text, send_at FROM scheduled_broadcasts WHERE sent_at IS NULL ORDER BY send_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ScheduledBroadcast
+	for rows.Next() {
+		var b ScheduledBroadcast
+		var sendAt int64
+		if err := rows.Scan(&b.ID, &b.Text, &sendAt); err != nil {
+			return nil, err
+		}
+		b.SendAt = time.Unix(sendAt, 0)
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// dueBroadcasts returns the announcements this instance has yet to send.
+// Instances sharing the database each send every announcement to their own
+// chats, so one another instance sent recently is still due here.
+func (s *Store) dueBroadcasts() ([]ScheduledBroadcast, error) {
+	now := time.Now()
+	query := `SELECT id, text, send_at FROM scheduled_broadcasts WHERE send_at <= ? AND sent_at IS NULL ORDER BY send_at`
+	args := []any{now.Unix()}
+	if isClustered() {
+		query = `SELECT id, text, send_at FROM scheduled_broadcasts WHERE send_at <= ? AND (sent_at IS NULL OR sent_at > ?)
+			AND id NOT IN (SELECT broadcast_id FROM broadcast_deliveries WHERE instance = ?) ORDER BY send_at`
+		args = append(args, now.Add(-time.Hour).Unix(), config.InstanceID)
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ScheduledBroadcast
+	for rows.Next() {
+		var b ScheduledBroadcast
+		var sendAt int64
+		if err := rows.Scan(&b.ID, &b.Text, &sendAt); err != nil {
+			return nil, err
+		}
+		b.SendAt = time.Unix(sendAt, 0)
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// claimBroadcast marks a scheduled announcement as sent by this instance,
+// reporting false if it was cancelled or this instance already sent it
+func (s *Store) claimBroadcast(id int64) (bool, error) {
+	now := time.Now().Unix()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE scheduled_broadcasts SET sent_at = COALESCE(sent_at, ?) WHERE id = ?`, now, id)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	res, err = tx.Exec(
+		`INSERT INTO broadcast_deliveries (broadcast_id, instance, sent_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`,
+		id, config.InstanceID, now,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// shareBroadcast records an announcement this instance is sending right
+// away, so the other instances sharing the database send it to their chats
+func (s *Store) shareBroadcast(text string, by types.JID) error {
+	var id int64
+	now := time.Now().Unix()
+	err := s.db.QueryRow(
+		`INSERT INTO scheduled_broadcasts (text, send_at, created_by, created_at, sent_at) VALUES (?, ?, ?, ?, ?) RETURNING id`,
+		text, now, by.ToNonAD().String(), now, now,
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO broadcast_deliveries (broadcast_id, instance, sent_at) VALUES (?, ?, ?)`, id, config.InstanceID, now)
+	return err
+}
+
+// cancelBroadcast deletes an unsent announcement
+func (s *Store) cancelBroadcast(id int64, by types.JID) (bool, error) {
+	var text string
+	err := s.db.QueryRow(`SELECT text FROM scheduled_broadcasts WHERE id = ? AND sent_at IS NULL`, id).Scan(&text)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	res, err := s.db.Exec(`DELETE FROM scheduled_broadcasts WHERE id = ? AND sent_at IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if n > 0 {
+		s.audit(by.ToNonAD().String(), types.JID{}, "broadcast-cancelled", fmt.Sprintf("#%d", id), text, nil)
+	}
+	return n > 0, err
+}
+
+// fanOut sends text to every chat subscribed to announcements, pacing sends
+// by config.BroadcastInterval. Chats in quiet hours, shadow mode or blocked are skipped.
+func fanOut(text string) (sent, skipped, failed int, err error) {
+	broadcastMu.Lock()
+	defer broadcastMu.Unlock()
+
+	chats, err := botStore.subscribers("announcements")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for _, chat := range chats {
+		if !servesChat(chat) {
+			// Another instance sharing the database sends to this chat
+			continue
+		}
+		if inQuietHours(chat) || isShadowChat(chat) || !access.isPermitted(types.MessageInfo{MessageSource: types.MessageSource{Chat: chat}}) {
+			skipped++
+			continue
+		}
+		if sent+failed > 0 {
+			time.Sleep(config.BroadcastInterval)
+		}
+		if err := sendText(chat, "📢 "+text); err != nil {
+			fmt.Printf("Error broadcasting to %s: %v\n", chat, err)
+			failed++
+			continue
+		}
+		sent++
+	}
+	metrics.add("broadcast_sent", int64(sent))
+	return sent, skipped, failed, nil
+}
+
+// broadcastNow fans out text in the background and reports the outcome to chat
+func broadcastNow(text string, report types.JID) {
+	go func() {
+		sent, skipped, failed, err := fanOut(text)
+		var summary string
+		if err != nil {
+			fmt.Printf("Error broadcasting: %v\n", err)
+			summary = "❌ *Error*\n\nCould not load the subscriber list."
+		} else {
+			summary = fmt.Sprintf("📢 Broadcast finished: sent to %d chats, skipped %d (quiet hours, shadow mode or blocked), failed %d.", sent, skipped, failed)
+		}
+		if err := sendText(report, summary); err != nil {
+			fmt.Printf("Error reporting broadcast result: %v\n", err)
+		}
+	}()
+}
+
+// sendDueBroadcasts sends scheduled announcements whose time has come
+func sendDueBroadcasts() {
+	due, err := botStore.dueBroadcasts()
+	if err != nil {
+		fmt.Printf("Error loading scheduled broadcasts: %v\n", err)
+		return
+	}
+	for _, b := range due {
+		claimed, err := botStore.claimBroadcast(b.ID)
+		if err != nil || !claimed {
+			continue
+		}
+		sent, skipped, failed, err := fanOut(b.Text)
+		if err != nil {
+			fmt.Printf("Error sending scheduled broadcast #%d: %v\n", b.ID, err)
+			continue
+		}
+		fmt.Printf("Scheduled broadcast #%d: sent %d, skipped %d, failed %d\n", b.ID, sent, skipped, failed)
+	}
+}
+
+// runBroadcastScheduler sends scheduled announcements in the background
+func runBroadcastScheduler() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		if client.IsConnected() {
+			sendDueBroadcasts()
+		}
+	}
+}
+
+// confirmBroadcast asks to confirm announcements sent right away; scheduled
+// ones can still be cancelled
+func confirmBroadcast(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	switch strings.ToLower(args[0]) {
+	case "list", "cancel", "at":
+		return ""
+	}
+	return "This sends your announcement to every chat subscribed to announcements right away."
+}
+
+func cmdBroadcast(evt *events.Message, args []string) {
+	if len(args) == 0 {
+		sendMessage(evt, "Usage: /broadcast [at HH:MM] <message> | list | cancel <id>")
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "list":
+		pending, err := botStore.pendingBroadcasts()
+		if err != nil {
+			fmt.Printf("Error loading scheduled broadcasts: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not load scheduled broadcasts.")
+			return
+		}
+		if len(pending) == 0 {
+			sendMessage(evt, "📭 No scheduled broadcasts.")
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("🗓️ *Scheduled broadcasts*\n")
+		for _, b := range pending {
+			preview := []rune(b.Text)
+			if len(preview) > 60 {
+				preview = append(preview[:60], '…')
+			}
+			sb.WriteString(fmt.Sprintf("\n#%d at %s: %s", b.ID, b.SendAt.In(config.TimeZone).Format("2 Jan 15:04"), string(preview)))
+		}
+		sendMessage(evt, sb.String())
+		return
+
+	case "cancel":
+		if len(args) < 2 {
+			sendMessage(evt, "Usage: /broadcast cancel <id>")
+			return
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(args[1], "#"), 10, 64)
+		if err != nil {
+			sendMessage(evt, fmt.Sprintf("❌ Invalid broadcast id %q", args[1]))
+			return
+		}
+		cancelled, err := botStore.cancelBroadcast(id, evt.Info.Sender)
+		if err != nil {
+			fmt.Printf("Error cancelling broadcast: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not cancel the broadcast.")
+			return
+		}
+		if !cancelled {
+			sendMessage(evt, fmt.Sprintf("ℹ️ No scheduled broadcast #%d.", id))
+			return
+		}
+		sendMessage(evt, fmt.Sprintf("🗑️ Cancelled broadcast #%d.", id))
+		return
+
+	case "at":
+		if len(args) < 3 {
+			sendMessage(evt, "Usage: /broadcast at HH:MM <message>")
+			return
+		}
+		minutes, err := parseClock(args[1])
+		if err != nil {
+			sendMessage(evt, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		text := stripFields(extractText(evt.Message), 3)
+		sendAt := nextOccurrence(minutes, time.Now())
+		id, err := botStore.scheduleBroadcast(text, sendAt, evt.Info.Sender)
+		if err != nil {
+			fmt.Printf("Error scheduling broadcast: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not schedule the broadcast.")
+			return
+		}
+		sendMessage(evt, fmt.Sprintf("🗓️ Broadcast #%d scheduled for %s (%s).",
+			id, sendAt.In(config.TimeZone).Format("Mon 2 Jan 15:04"), config.TimeZone))
+		return
+	}
+
+	text := stripFields(extractText(evt.Message), 1)
+	sendMessage(evt, "📢 Broadcasting to subscribed chats…")
+	botStore.audit(actorOf(evt.Info), types.JID{}, "broadcast", "", nil, text)
+	if isClustered() {
+		if err := botStore.shareBroadcast(text, evt.Info.Sender); err != nil {
+			fmt.Printf("Error sharing broadcast with other instances: %v\n", err)
+		}
+	}
+	broadcastNow(text, evt.Info.Chat)
+}
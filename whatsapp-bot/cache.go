@@ -0,0 +1,310 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// minSimHashTokens is the shortest text (in words) checked for near-duplicates;
+// very short texts overlap too easily for the match to be meaningful
+const minSimHashTokens = 8
+
+// TextSignature summarizes a text for near-duplicate matching: a SimHash used
+// to cheaply rule out unrelated texts, and the word set used to score the
+// remaining candidates by Jaccard similarity
+type TextSignature struct {
+	SimHash uint64
+	Words   map[string]struct{}
+}
+
+type cacheEntry struct {
+	key      string
+	sig      *TextSignature
+	result   *AnalyzeResponse
+	cachedAt time.Time
+}
+
+// Cache remembers recent analysis results by exact content hash and, for
+// text, by signature so reworded copies can reuse a verdict
+type Cache interface {
+	Get(key string) (*AnalyzeResponse, bool)
+	FindSimilar(sig *TextSignature, maxDistance int, minSimilarity float64) (*AnalyzeResponse, float64, bool)
+	Put(key string, sig *TextSignature, result *AnalyzeResponse)
+	Replace(key string, result *AnalyzeResponse)
+	Len() int
+}
+
+// VerdictCache is the in-memory Cache, lost on restart
+type VerdictCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[string]*cacheEntry
+	order   []*cacheEntry // oldest first
+}
+
+var verdictCache Cache
+
+// newVerdictCache creates a cache holding at most max entries for ttl each
+func newVerdictCache(ttl time.Duration, max int) *VerdictCache {
+	return &VerdictCache{ttl: ttl, max: max, entries: map[string]*cacheEntry{}}
+}
+
+// textCacheKey hashes normalized text into a cache key
+func textCacheKey(text string) string {
+	sum := sha256.Sum256([]byte("text:" + strings.ToLower(text)))
+	return hex.EncodeToString(sum[:])
+}
+
+// senderCacheKey extends key with the sender types sent to the backend,
+// which judges claims pushed by businesses, broadcasts and bots differently
+func senderCacheKey(key string, senders []string) string {
+	if len(senders) == 0 {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key + "\x00senders:" + strings.Join(senders, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+// mediaCacheKey hashes raw media bytes into a cache key
+func mediaCacheKey(kind string, data []byte) string {
+	h := sha256.New()
+	h.Write([]byte(kind + ":"))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// textSignature computes the near-duplicate signature of text, or nil if the
+// text is too short to compare meaningfully
+func textSignature(text string) *TextSignature {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r)
+	})
+	if len(words) < minSimHashTokens {
+		return nil
+	}
+
+	set := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		set[w] = struct{}{}
+	}
+	return &TextSignature{SimHash: simHash(words), Words: set}
+}
+
+// simHash computes a 64-bit SimHash over words and word pairs. Texts that
+// differ by a few words produce signatures a small Hamming distance apart.
+func simHash(words []string) uint64 {
+	features := make([]string, 0, 2*len(words))
+	features = append(features, words...)
+	for i := 0; i+1 < len(words); i++ {
+		features = append(features, words[i]+" "+words[i+1])
+	}
+
+	var weights [64]int
+	for _, f := range features {
+		h := fnv.New64a()
+		h.Write([]byte(f))
+		feature := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if feature&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var sig uint64
+	for bit, w := range weights {
+		if w > 0 {
+			sig |= 1 << bit
+		}
+	}
+	return sig
+}
+
+// jaccard returns the Jaccard similarity of two word sets
+func jaccard(a, b map[string]struct{}) float64 {
+	shared := 0
+	for w := range a {
+		if _, ok := b[w]; ok {
+			shared++
+		}
+	}
+	union := len(a) + len(b) - shared
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
+
+// Get returns the cached result for key, if present and fresh
+func (c *VerdictCache) Get(key string) (*AnalyzeResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return e.result, true
+}
+
+// FindSimilar returns the most similar cached text result whose SimHash is
+// within maxDistance bits of sig and whose word overlap is at least
+// minSimilarity, along with that similarity in [0, 1]
+func (c *VerdictCache) FindSimilar(sig *TextSignature, maxDistance int, minSimilarity float64) (*AnalyzeResponse, float64, bool) {
+	if sig == nil {
+		return nil, 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire()
+
+	var best *cacheEntry
+	bestSimilarity := 0.0
+	for _, e := range c.order {
+		if e.sig == nil || bits.OnesCount64(e.sig.SimHash^sig.SimHash) > maxDistance {
+			continue
+		}
+		if sim := jaccard(e.sig.Words, sig.Words); sim >= minSimilarity && sim > bestSimilarity {
+			best, bestSimilarity = e, sim
+		}
+	}
+	if best == nil {
+		return nil, 0, false
+	}
+	return best.result, bestSimilarity, true
+}
+
+// Put stores a result under key with an optional text signature, unless
+// the result is hollow
+func (c *VerdictCache) Put(key string, sig *TextSignature, result *AnalyzeResponse) {
+	if isHollowVerdict(result) {
+		// Let the next copy ask the backend again
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if old, ok := c.entries[key]; ok {
+		c.remove(old)
+	}
+	e := &cacheEntry{key: key, sig: sig, result: result, cachedAt: time.Now()}
+	c.entries[key] = e
+	c.order = append(c.order, e)
+	for len(c.order) > c.max {
+		c.remove(c.order[0])
+	}
+}
+
+// Replace swaps in a newer result for key, keeping its text signature, if
+// key is still cached
+func (c *VerdictCache) Replace(key string, result *AnalyzeResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		result.claimKey = key
+		e.result = result
+	}
+}
+
+// Len returns the number of cached entries
+func (c *VerdictCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.order)
+}
+
+// expire drops entries older than the TTL; callers must hold mu
+func (c *VerdictCache) expire() {
+	cutoff := time.Now().Add(-c.ttl)
+	n := 0
+	for n < len(c.order) && c.order[n].cachedAt.Before(cutoff) {
+		delete(c.entries, c.order[n].key)
+		n++
+	}
+	c.order = c.order[n:]
+}
+
+// remove deletes e from the cache; callers must hold mu
+func (c *VerdictCache) remove(e *cacheEntry) {
+	delete(c.entries, e.key)
+	for i, o := range c.order {
+		if o == e {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// analyzeTextCached returns a cached verdict for text, an exact or
+// near-duplicate match, or calls the backend with backendText (the scrubbed
+// form of text) and caches the result. idempotency is sent as the request's
+// Idempotency-Key and senders describes the sender to the backend. Verdicts
+// are cached per sender types, and only those for regular senders are
+// matched as near-duplicates.
+func analyzeTextCached(text, backendText, language, idempotency string, senders []string) (*AnalyzeResponse, error) {
+	claim := textCacheKey(text)
+	key := senderCacheKey(claim, senders)
+	if result, ok := verdictCache.Get(key); ok {
+		fmt.Println("Cache hit for text")
+		return result, nil
+	}
+
+	var sig *TextSignature
+	if len(senders) == 0 {
+		sig = textSignature(text)
+	}
+	if result, similarity, ok := verdictCache.FindSimilar(sig, config.SimHashMaxDistance, config.NearDuplicateMinSimilarity); ok {
+		fmt.Printf("Near-duplicate cache hit (%.0f%% similar)\n", similarity*100)
+		near := *result
+		near.similarity = similarity
+		return &near, nil
+	}
+
+	result, err := callBackend(func() (*AnalyzeResponse, error) {
+		return analyzeText(backendText, language, idempotency, senders)
+	})
+	if err != nil {
+		return nil, err
+	}
+	enrichWithFactChecks(result, backendText, language)
+	rateSources(result)
+	result.claimKey = claim
+	verdictCache.Put(key, sig, result)
+	return result, nil
+}
+
+// analyzeImageCached returns a cached verdict for identical image bytes with
+// the same caption, context and sender types, or calls the backend
+func analyzeImageCached(data []byte, caption, quotedText, idempotency string, senders []string) (*AnalyzeResponse, error) {
+	claim := mediaCacheKey("image", data)
+	if caption != "" || quotedText != "" {
+		claim = mediaCacheKey("image+text", []byte(claim+"\x00"+caption+"\x00"+quotedText))
+	}
+	key := senderCacheKey(claim, senders)
+	if result, ok := verdictCache.Get(key); ok {
+		fmt.Println("Cache hit for image")
+		return result, nil
+	}
+
+	result, err := callBackend(func() (*AnalyzeResponse, error) {
+		return analyzeImage(data, caption, quotedText, idempotency, senders)
+	})
+	if err != nil {
+		return nil, err
+	}
+	enrichWithFactChecks(result, caption, "")
+	rateSources(result)
+	result.claimKey = claim
+	verdictCache.Put(key, nil, result)
+	return result, nil
+}
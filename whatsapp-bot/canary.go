@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// canaryMaxInFlight caps concurrent canary calls; samples beyond it are
+// skipped so a slow canary can't pile up goroutines
+const canaryMaxInFlight = 4
+
+// canaryWindow is the period /canary reports on
+const canaryWindow = 7 * 24 * time.Hour
+
+var canarySlots = make(chan struct{}, canaryMaxInFlight)
+
+func init() {
+	registerCommand("canary", &Command{
+		Usage:   "/canary",
+		Help:    "Compare the canary backend's verdicts with production",
+		Role:    roleAdmin,
+		Handler: cmdCanary,
+	})
+}
+
+// canarySampled reports whether the analysis with key is also sent to the
+// canary. Keys are hashed so retries of a message get the same answer.
+func canarySampled(key string) bool {
+	if config.CanaryBackendURL == "" || config.CanaryPercent <= 0 {
+		return false
+	}
+	if key == "" {
+		return rand.IntN(100) < config.CanaryPercent
+	}
+	sum := sha256.Sum256([]byte("canary/" + key))
+	return int(binary.BigEndian.Uint64(sum[:8])%100) < config.CanaryPercent
+}
+
+// shadowCanary repeats a sampled analysis against the canary backend in the
+// background and records whether its verdict agrees with production's. The
+// canary's verdict is never shown to users.
+func shadowCanary(kind, key string, production *AnalyzeResponse, analyze func(base string) (*AnalyzeResponse, error)) {
+	if !canarySampled(key) {
+		return
+	}
+	select {
+	case canarySlots <- struct{}{}:
+	default:
+		metrics.inc("canary_skipped")
+		return
+	}
+	go func() {
+		defer func() { <-canarySlots }()
+		start := time.Now()
+		canary, err := analyze(config.CanaryBackendURL)
+		latency := time.Since(start)
+		if err != nil {
+			fmt.Printf("Canary analysis %s failed: %v\n", key, err)
+			metrics.inc("canary_error")
+			botStore.recordCanary(kind, key, production, nil, "", err, latency)
+			return
+		}
+		reason := canaryDisagreement(production, canary)
+		if reason != "" {
+			fmt.Printf("Canary disagrees on %s (%s): production misinformation=%t confidence=%.2f model %s, canary misinformation=%t confidence=%.2f model %s\n",
+				key, reason, production.IsMisinformation, production.Confidence, production.ModelVersion,
+				canary.IsMisinformation, canary.Confidence, canary.ModelVersion)
+			metrics.inc("canary_disagreement")
+		} else {
+			metrics.inc("canary_agreement")
+		}
+		botStore.recordCanary(kind, key, production, canary, reason, nil, latency)
+	}()
+}
+
+// canaryDisagreement names how the canary's verdict differs from
+// production's, or returns "" when they agree
+func canaryDisagreement(production, canary *AnalyzeResponse) string {
+	switch {
+	case production.IsNews != canary.IsNews:
+		return "is_news"
+	case production.IsMisinformation != canary.IsMisinformation,
+		production.isUnverifiable() != canary.isUnverifiable():
+		return "verdict"
+	case math.Abs(production.Confidence-canary.Confidence) >= config.CanaryConfidenceDelta:
+		return "confidence"
+	}
+	return ""
+}
+
+// recordCanary stores the outcome of a canary comparison. Only verdicts are
+// kept, never the message.
+func (s *Store) recordCanary(kind, key string, production, canary *AnalyzeResponse, reason string, canaryErr error, latency time.Duration) {
+	var canaryModel, errText string
+	var canaryMisinformation *bool
+	var canaryConfidence *float64
+	if canary != nil {
+		canaryModel = canary.ModelVersion
+		canaryMisinformation, canaryConfidence = &canary.IsMisinformation, &canary.Confidence
+	}
+	if canaryErr != nil {
+		errText = canaryErr.Error()
+	}
+	_, err := s.db.Exec(
+		`INSERT INTO canary_results
+			(kind, analysis_key, reason, production_model, canary_model, production_misinformation,
+			 canary_misinformation, production_confidence, canary_confidence, error, latency_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		kind, key, reason, production.ModelVersion, canaryModel, production.IsMisinformation,
+		canaryMisinformation, production.Confidence, canaryConfidence, errText, latency.Milliseconds(), time.Now().Unix(),
+	)
+	if err != nil {
+		fmt.Printf("Error recording canary result: %v\n", err)
+	}
+}
+
+// CanaryStats summarizes canary comparisons
+type CanaryStats struct {
+	Compared   int
+	Errors     int
+	IsNews     int // disagreed on whether it's news
+	Verdict    int // disagreed on misinformation
+	Confidence int // same verdict, confidence apart by CANARY_CONFIDENCE_DELTA
+	// Flipped counts production misinformation the canary called credible
+	Flipped   int
+	AvgMillis float64
+}
+
+// Agreement is the share of successful comparisons that agreed
+func (c CanaryStats) Agreement() float64 {
+	ok := c.Compared - c.Errors
+	if ok == 0 {
+		return 0
+	}
+	return float64(ok-c.IsNews-c.Verdict-c.Confidence) / float64(ok)
+}
+
+// canaryStats aggregates the comparisons made since since
+func (s *Store) canaryStats(since time.Time) (CanaryStats, error) {
+	var c CanaryStats
+	err := s.db.QueryRow(`
+		SELECT COUNT(*), COUNT(CASE WHEN error != '' THEN 1 END),
+			COUNT(CASE WHEN reason = 'is_news' THEN 1 END), COUNT(CASE WHEN reason = 'verdict' THEN 1 END), COUNT(CASE WHEN reason = 'confidence' THEN 1 END),
+			COUNT(CASE WHEN reason = 'verdict' AND production_misinformation = 1 THEN 1 END),
+			COALESCE(AVG(CASE WHEN error = '' THEN latency_ms END), 0)
+		FROM canary_results WHERE created_at >= ?`, since.Unix(),
+	).Scan(&c.Compared, &c.Errors, &c.IsNews, &c.Verdict, &c.Confidence, &c.Flipped, &c.AvgMillis)
+	return c, err
+}
+
+func cmdCanary(evt *events.Message, args []string) {
+	if config.CanaryBackendURL == "" || config.CanaryPercent <= 0 {
+		sendMessage(evt, "ℹ️ No canary is configured. Set CANARY_BACKEND_URL and CANARY_PERCENT.")
+		return
+	}
+	stats, err := botStore.canaryStats(time.Now().Add(-canaryWindow))
+	if err != nil {
+		fmt.Printf("Error loading canary stats: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not load the canary results.")
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🐤 *Canary* (%d%% of analyses to %s, last 7 days)\n\n", config.CanaryPercent, config.CanaryBackendURL)
+	if stats.Compared == 0 {
+		sb.WriteString("No comparisons yet.")
+		sendMessage(evt, sb.String())
+		return
+	}
+	fmt.Fprintf(&sb, "Compared: %d (%d canary errors)\n", stats.Compared, stats.Errors)
+	fmt.Fprintf(&sb, "Agreement: %.1f%%\n", stats.Agreement()*100)
+	fmt.Fprintf(&sb, "Verdict flips: %d (%d misinformation called credible)\n", stats.Verdict, stats.Flipped)
+	fmt.Fprintf(&sb, "News/not news: %d\n", stats.IsNews)
+	fmt.Fprintf(&sb, "Confidence ±%.0f%%+: %d\n", config.CanaryConfidenceDelta*100, stats.Confidence)
+	fmt.Fprintf(&sb, "Canary latency: %.0f ms on average", stats.AvgMillis)
+	sendMessage(evt, sb.String())
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	cardWidth   = 800
+	cardPadding = 40
+)
+
+var (
+	cardBackground = color.RGBA{0xFA, 0xFA, 0xF7, 0xFF}
+	cardText       = color.RGBA{0x22, 0x22, 0x22, 0xFF}
+	cardMuted      = color.RGBA{0x77, 0x77, 0x77, 0xFF}
+	cardTrack      = color.RGBA{0xE0, 0xE0, 0xDC, 0xFF}
+
+	cardRed   = color.RGBA{0xC6, 0x28, 0x28, 0xFF}
+	cardAmber = color.RGBA{0xEF, 0x8F, 0x00, 0xFF}
+	cardGreen = color.RGBA{0x2E, 0x7D, 0x32, 0xFF}
+)
+
+// cardFonts holds the faces used on verdict cards, parsed once on first use
+var (
+	cardFonts struct {
+		title, heading, body, small font.Face
+	}
+	cardFontsOnce sync.Once
+	cardFontsErr  error
+	// font faces cache glyphs internally and aren't safe for concurrent use
+	cardRenderMu sync.Mutex
+)
+
+// loadCardFonts parses the embedded Go fonts. The Go fonts only cover Latin
+// scripts, so cards are always rendered in English; the caption carries the
+// localized reply.
+func loadCardFonts() error {
+	regular, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return err
+	}
+	bold, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return err
+	}
+	face := func(f *opentype.Font, size float64) (font.Face, error) {
+		return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	}
+	if cardFonts.title, err = face(bold, 36); err != nil {
+		return err
+	}
+	if cardFonts.heading, err = face(bold, 24); err != nil {
+		return err
+	}
+	if cardFonts.body, err = face(regular, 24); err != nil {
+		return err
+	}
+	cardFonts.small, err = face(regular, 18)
+	return err
+}
+
+// verdictColor picks the card's accent color for a result
+func verdictColor(result *AnalyzeResponse) color.RGBA {
+	if result.isUnverifiable() {
+		return cardAmber
+	}
+	if result.IsMisinformation {
+		if result.Confidence > 0.7 {
+			return cardRed
+		}
+		return cardAmber
+	}
+	return cardGreen
+}
+
+// cardLine is one line of text laid out on the card
+type cardLine struct {
+	text  string
+	face  font.Face
+	color color.Color
+	gap   int // extra space above the line
+}
+
+// wrapText breaks text into lines no wider than width when drawn with face
+func wrapText(text string, face font.Face, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if font.MeasureString(face, candidate).Ceil() > width && line != "" {
+				lines = append(lines, line)
+				line = word
+			} else {
+				line = candidate
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// renderVerdictCard draws a shareable PNG summarizing the verdict
+func renderVerdictCard(result *AnalyzeResponse) ([]byte, error) {
+	cardFontsOnce.Do(func() { cardFontsErr = loadCardFonts() })
+	if cardFontsErr != nil {
+		return nil, fmt.Errorf("failed to load card fonts: %w", cardFontsErr)
+	}
+	cardRenderMu.Lock()
+	defer cardRenderMu.Unlock()
+
+	m := messagesFor("en")
+	_, status := verdictStatus(result, m)
+	accent := verdictColor(result)
+	textWidth := cardWidth - 2*cardPadding
+
+	// Lay out the body first so the card height fits its content
+	var lines []cardLine
+	add := func(text string, face font.Face, c color.Color, gap int) {
+		for i, l := range wrapText(text, face, textWidth) {
+			g := 0
+			if i == 0 {
+				g = gap
+			}
+			lines = append(lines, cardLine{text: l, face: face, color: c, gap: g})
+		}
+	}
+	if result.Summary != "" {
+		add(m.Summary, cardFonts.heading, cardText, 24)
+		add(result.Summary, cardFonts.body, cardText, 8)
+	}
+	if claims := claimViews(result.Claims); len(claims) > 0 {
+		add(m.Claims, cardFonts.heading, cardText, 24)
+		for _, c := range claims {
+			add(fmt.Sprintf("%s (%.0f%%) %s", strings.ToUpper(c.Rating), c.ConfidencePercent, c.Text), cardFonts.body, cardText, 8)
+		}
+	}
+	if evidence := firstN(result.Evidence, maxListedItems); len(evidence) > 0 {
+		add(m.Evidence, cardFonts.heading, cardText, 24)
+		for _, e := range evidence {
+			add("• "+e, cardFonts.body, cardText, 8)
+		}
+	}
+	if result.Recommendation != "" {
+		add(m.Recommendation, cardFonts.heading, cardText, 24)
+		add(result.Recommendation, cardFonts.body, cardText, 8)
+	}
+	add("Checked by Aletheia • "+time.Now().In(config.TimeZone).Format("2 Jan 2006"), cardFonts.small, cardMuted, 32)
+
+	const headerHeight = 110
+	const barTop = headerHeight + 30
+	const barHeight = 24
+	bodyTop := barTop + barHeight + 20
+	height := bodyTop
+	for _, l := range lines {
+		height += l.gap + l.face.Metrics().Ascent.Ceil() + l.face.Metrics().Descent.Ceil()
+	}
+	height += cardPadding
+
+	img := image.NewRGBA(image.Rect(0, 0, cardWidth, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{cardBackground}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, cardWidth, headerHeight), &image.Uniform{accent}, image.Point{}, draw.Src)
+
+	drawString := func(s string, face font.Face, c color.Color, x, baseline int) {
+		d := &font.Drawer{Dst: img, Src: &image.Uniform{c}, Face: face, Dot: fixed.P(x, baseline)}
+		d.DrawString(s)
+	}
+	drawString(status, cardFonts.title, color.White, cardPadding, 70)
+
+	// Confidence bar with the percentage to its right
+	label := fmt.Sprintf("%.0f%%", result.Confidence*100)
+	labelWidth := font.MeasureString(cardFonts.heading, label).Ceil()
+	barWidth := textWidth - labelWidth - 16
+	draw.Draw(img, image.Rect(cardPadding, barTop, cardPadding+barWidth, barTop+barHeight), &image.Uniform{cardTrack}, image.Point{}, draw.Src)
+	filled := int(float64(barWidth) * clamp01(result.Confidence))
+	draw.Draw(img, image.Rect(cardPadding, barTop, cardPadding+filled, barTop+barHeight), &image.Uniform{accent}, image.Point{}, draw.Src)
+	drawString(label, cardFonts.heading, cardText, cardWidth-cardPadding-labelWidth, barTop+barHeight-2)
+
+	y := bodyTop
+	for _, l := range lines {
+		y += l.gap + l.face.Metrics().Ascent.Ceil()
+		drawString(l.text, l.face, l.color, cardPadding, y)
+		y += l.face.Metrics().Descent.Ceil()
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode card: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func clamp01(f float64) float64 {
+	if f < 0 {
+		return 0
+	}
+	if f > 1 {
+		return 1
+	}
+	return f
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// chatSessionCookie holds a chat admin's dashboard session
+const chatSessionCookie = "aletheia_chat"
+
+// linkCodeAlphabet leaves out letters and digits that are easy to mistype
+const linkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+//go:embed web/link.html web/chat.html
+var chatLinkFS embed.FS
+
+var chatLinkTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"whole": func(f float64) string { return fmt.Sprintf("%.0f", f*100) },
+}).ParseFS(chatLinkFS, "web/link.html", "web/chat.html"))
+
+func init() {
+	registerCommand("link", &Command{
+		Usage:   "/link [revoke]",
+		Help:    "Get a one-time code to manage this chat's settings on the web dashboard",
+		Handler: cmdLink,
+	})
+}
+
+func cmdLink(evt *events.Message, args []string) {
+	if !canManageChat(evt.Info) {
+		sendMessage(evt, "⛔ Only group admins can link a group to the dashboard.")
+		return
+	}
+	if len(args) > 0 && strings.EqualFold(args[0], "revoke") {
+		n, err := botStore.revokeChatSessions(evt.Info.Chat)
+		if err != nil {
+			fmt.Printf("Error revoking dashboard sessions: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not revoke dashboard access.")
+			return
+		}
+		botStore.audit(actorOf(evt.Info), evt.Info.Chat, "link_revoke", "", nil, n)
+		sendMessage(evt, fmt.Sprintf("✅ Ended %d dashboard connections for this chat.", n))
+		return
+	}
+	if config.DashboardURL == "" || config.DashboardAddr == "" {
+		sendMessage(evt, "ℹ️ The web dashboard isn't available on this bot.")
+		return
+	}
+
+	code, err := botStore.createLinkCode(evt.Info.Chat, evt.Info.Sender)
+	if err != nil {
+		fmt.Printf("Error creating link code: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not create a link code. Please try again.")
+		return
+	}
+	botStore.audit(actorOf(evt.Info), evt.Info.Chat, "link_code", "", nil, nil)
+
+	// The code goes to the admin privately, so members can't take over the link
+	name := "this chat"
+	if evt.Info.IsGroup {
+		if meta, err := groupInfo(evt.Info.Chat); err == nil && meta.Name != "" {
+			name = meta.Name
+		}
+	}
+	text := fmt.Sprintf("🔗 *Dashboard link for %s*\n\nOpen %s/link?code=%s\n\nor enter *%s* at %s/link. "+
+		"The code works once and expires in %s.",
+		name, config.DashboardURL, code, code, config.DashboardURL, config.LinkCodeTTL)
+	if err := sendText(evt.Info.Sender.ToNonAD(), text); err != nil {
+		fmt.Printf("Error sending link code: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not send you the link code.")
+		return
+	}
+	if evt.Info.IsGroup {
+		sendMessage(evt, "🔗 Sent you a dashboard link for this group as a private message.")
+	}
+}
+
+// createLinkCode stores a one-time code linking chat to the dashboard
+func (s *Store) createLinkCode(chat, by types.JID) (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := make([]byte, len(raw))
+	for i, b := range raw {
+		code[i] = linkCodeAlphabet[int(b)%len(linkCodeAlphabet)]
+	}
+	now := time.Now()
+	if _, err := s.db.Exec(`DELETE FROM dashboard_links WHERE expires_at < ?`, now.Unix()); err != nil {
+		return "", err
+	}
+	_, err := s.db.Exec(
+		`INSERT INTO dashboard_links (code, chat, created_by, expires_at) VALUES (?, ?, ?, ?)`,
+		string(code), chat.ToNonAD().String(), by.ToNonAD().String(), now.Add(config.LinkCodeTTL).Unix(),
+	)
+	return string(code), err
+}
+
+// redeemLinkCode uses up a link code and opens a dashboard session for its
+// chat, returning the session token
+func (s *Store) redeemLinkCode(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var chat, by string
+	err = tx.QueryRow(`SELECT chat, created_by FROM dashboard_links WHERE code = ? AND expires_at >= ?`, code, time.Now().Unix()).Scan(&chat, &by)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`DELETE FROM dashboard_links WHERE code = ?`, code); err != nil {
+		return "", err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+	now := time.Now()
+	if _, err := tx.Exec(`DELETE FROM dashboard_sessions WHERE expires_at < ?`, now.Unix()); err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO dashboard_sessions (token, chat, created_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		token, chat, by, now.Unix(), now.Add(config.DashboardSessionTTL).Unix(),
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// ChatSession is a chat admin's dashboard session
+type ChatSession struct {
+	Chat     types.JID
+	LinkedBy types.JID
+	Expires  time.Time
+}
+
+// chatSession looks up an unexpired session by token
+func (s *Store) chatSession(token string) (*ChatSession, error) {
+	var chat, by string
+	var expires int64
+	err := s.db.QueryRow(
+		`SELECT chat, created_by, expires_at FROM dashboard_sessions WHERE token = ? AND expires_at >= ?`,
+		token, time.Now().Unix(),
+	).Scan(&chat, &by, &expires)
+	if err != nil {
+		return nil, err
+	}
+	session := &ChatSession{Expires: time.Unix(expires, 0)}
+	if session.Chat, err = types.ParseJID(chat); err != nil {
+		return nil, err
+	}
+	if session.LinkedBy, err = types.ParseJID(by); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// revokeChatSessions ends every dashboard session and unused code for chat
+func (s *Store) revokeChatSessions(chat types.JID) (int64, error) {
+	key := chat.ToNonAD().String()
+	if _, err := s.db.Exec(`DELETE FROM dashboard_links WHERE chat = ?`, key); err != nil {
+		return 0, err
+	}
+	res, err := s.db.Exec(`DELETE FROM dashboard_sessions WHERE chat = ?`, key)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// registerChatLinkRoutes adds the pages chat admins reach with /link. They
+// sit on the dashboard server but use a session cookie scoped to one chat
+// instead of DASHBOARD_TOKEN.
+func registerChatLinkRoutes() {
+	dashboardMux.HandleFunc("GET /link", handleLinkPage)
+	dashboardMux.HandleFunc("POST /link", handleLinkRedeem)
+	dashboardMux.HandleFunc("GET /chat", requireChatSession(handleChatPage))
+	dashboardMux.HandleFunc("POST /chat", requireChatSession(handleChatSave))
+}
+
+// handleLinkPage asks for the code; links from /link fill it in, but only a
+// POST uses it up, so previews and prefetches of the link don't
+func handleLinkPage(w http.ResponseWriter, r *http.Request) {
+	renderChatLink(w, "link.html", map[string]string{"Code": r.URL.Query().Get("code")})
+}
+
+func handleLinkRedeem(w http.ResponseWriter, r *http.Request) {
+	token, err := botStore.redeemLinkCode(r.FormValue("code"))
+	if errors.Is(err, sql.ErrNoRows) {
+		metrics.inc("link_code_rejected")
+		w.WriteHeader(http.StatusForbidden)
+		renderChatLink(w, "link.html", map[string]string{"Error": "That code is wrong, used or expired. Send /link again for a new one."})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error redeeming link code: %v\n", err)
+		http.Error(w, "failed to link", http.StatusInternalServerError)
+		return
+	}
+	metrics.inc("chat_linked")
+	http.SetCookie(w, &http.Cookie{
+		Name:     chatSessionCookie,
+		Value:    token,
+		Path:     "/chat",
+		MaxAge:   int(config.DashboardSessionTTL / time.Second),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(config.DashboardURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/chat", http.StatusSeeOther)
+}
+
+// requireChatSession passes requests with a valid chat session through
+func requireChatSession(next func(http.ResponseWriter, *http.Request, *ChatSession)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(chatSessionCookie)
+		if err != nil {
+			http.Redirect(w, r, "/link", http.StatusSeeOther)
+			return
+		}
+		session, err := botStore.chatSession(cookie.Value)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Redirect(w, r, "/link", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error loading dashboard session: %v\n", err)
+			http.Error(w, "failed to load session", http.StatusInternalServerError)
+			return
+		}
+		next(w, r, session)
+	}
+}
+
+// settingChoice is a setting picked from a fixed list on the chat page
+type settingChoice struct {
+	Key, Label, Current string
+	Options             []string
+}
+
+// topicChoice is a subscription topic on the chat page
+type topicChoice struct {
+	Name, Description string
+	On                bool
+}
+
+// ChatPage is what the chat page shows
+type ChatPage struct {
+	Name     string
+	Settings *ChatSettings
+	Cooldown string
+	Choices  []settingChoice
+	Topics   []topicChoice
+	Expires  time.Time
+	Notice   string
+	Error    string
+}
+
+func handleChatPage(w http.ResponseWriter, r *http.Request, session *ChatSession) {
+	page, err := chatPage(session)
+	if err != nil {
+		fmt.Printf("Error loading chat page: %v\n", err)
+		http.Error(w, "failed to load settings", http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("saved") != "" {
+		page.Notice = "Settings saved."
+	}
+	renderChatLink(w, "chat.html", page)
+}
+
+// chatPage collects the chat's current settings and subscriptions
+func chatPage(session *ChatSession) (*ChatPage, error) {
+	settings := botStore.getChatSettings(session.Chat)
+	subscribed, err := botStore.chatTopics(session.Chat)
+	if err != nil {
+		return nil, err
+	}
+	var topics []topicChoice
+	for name, description := range subscriptionTopics {
+		on := false
+		for _, t := range subscribed {
+			on = on || t == name
+		}
+		topics = append(topics, topicChoice{Name: name, Description: description, On: on})
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+
+	name := session.Chat.User
+	if session.Chat.Server == types.GroupServer {
+		if meta, err := groupInfo(session.Chat); err == nil && meta.Name != "" {
+			name = meta.Name
+		}
+	}
+	cooldown := modeOff
+	if settings.Cooldown > 0 {
+		cooldown = settings.Cooldown.String()
+	}
+	return &ChatPage{
+		Name:     name,
+		Settings: settings,
+		Cooldown: cooldown,
+		Topics:   topics,
+		Expires:  session.Expires.In(config.TimeZone),
+		Choices: []settingChoice{
+			{"verbosity", "Verbosity", settings.Verbosity, []string{verbosityFull, verbosityShort}},
+			{"mode", "Mode", settings.Mode, []string{modeAuto, modeCommand, modeOff, modeShadow, modeObserve}},
+			{"format", "Format", settings.Format, []string{formatRich, formatPlain}},
+			{"confidence", "Confidence display", settings.Confidence, []string{confidenceBar, confidenceStars, confidencePercent, confidenceNone}},
+		},
+	}, nil
+}
+
+// handleChatSave applies the settings that changed, validated exactly like
+// /settings, and the subscription choices. Changes are audited under the
+// admin who linked the chat.
+func handleChatSave(w http.ResponseWriter, r *http.Request, session *ChatSession) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	page, err := chatPage(session)
+	if err != nil {
+		fmt.Printf("Error loading chat page: %v\n", err)
+		http.Error(w, "failed to load settings", http.StatusInternalServerError)
+		return
+	}
+	settings := page.Settings
+	before := map[string]string{
+		"language":   settings.Language,
+		"threshold":  fmt.Sprintf("%.0f", settings.Threshold*100),
+		"verbosity":  settings.Verbosity,
+		"mode":       settings.Mode,
+		"format":     settings.Format,
+		"confidence": settings.Confidence,
+		"cooldown":   page.Cooldown,
+	}
+	values := map[string]any{}
+	for key, old := range before {
+		value := strings.TrimSpace(r.PostFormValue(key))
+		if value == "" || strings.EqualFold(value, old) {
+			continue
+		}
+		if key == "threshold" {
+			value += "%"
+		}
+		parsed, err := parseSetting(key, []string{value})
+		if err != nil {
+			page.Error = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+			renderChatLink(w, "chat.html", page)
+			return
+		}
+		for column, v := range parsed {
+			values[column] = v
+		}
+	}
+	actor := session.LinkedBy.ToNonAD().String()
+	if len(values) > 0 {
+		if err := botStore.updateChatSettings(session.Chat, values, actor); err != nil {
+			fmt.Printf("Error saving settings from dashboard: %v\n", err)
+			http.Error(w, "failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	wanted := map[string]bool{}
+	for _, topic := range r.PostForm["topic"] {
+		wanted[topic] = true
+	}
+	for _, t := range page.Topics {
+		switch {
+		case wanted[t.Name] && !t.On:
+			_, err = botStore.subscribe(session.Chat, t.Name, session.LinkedBy)
+		case !wanted[t.Name] && t.On:
+			_, err = botStore.unsubscribe(session.Chat, t.Name)
+		}
+		if err != nil {
+			fmt.Printf("Error saving subscriptions from dashboard: %v\n", err)
+			http.Error(w, "failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	fmt.Printf("Dashboard link saved settings of %s\n", session.Chat)
+	http.Redirect(w, r, "/chat?saved=1", http.StatusSeeOther)
+}
+
+// renderChatLink renders one of the chat link pages
+func renderChatLink(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := chatLinkTemplates.ExecuteTemplate(w, name, data); err != nil {
+		fmt.Printf("Error rendering %s: %v\n", name, err)
+	}
+}
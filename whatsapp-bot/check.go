@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func init() {
+	registerCommand("check", &Command{
+		Usage:   "/check [text]",
+		Help:    "Fact-check the given text, or the message you reply to",
+		Handler: cmdCheck,
+	})
+}
+
+// cmdCheck analyzes the quoted message (text, image, audio or video) or the command's own text
+func cmdCheck(evt *events.Message, args []string) {
+	settings := botStore.getChatSettings(evt.Info.Chat)
+
+	if len(args) > 0 {
+		text := prepareText(strings.Join(args, " "))
+		if !handleScamLinks(evt, text, settings, true) {
+			handleTextMessage(evt, text, settings, true)
+		}
+		return
+	}
+
+	quoted := evt.Message.GetExtendedTextMessage().GetContextInfo().GetQuotedMessage()
+	if quoted == nil {
+		sendMessage(evt, "Reply to a message with /check, or send /check followed by the text to verify.")
+		return
+	}
+	if imgMsg := quoted.GetImageMessage(); imgMsg != nil {
+		handleImageMessage(evt, imgMsg, settings, true)
+		return
+	}
+	if item := mediaItemFrom(quoted); item != nil {
+		handleMediaMessage(evt, item, settings, true)
+		return
+	}
+	if contacts := sharedContacts(quoted); len(contacts) > 0 {
+		handleContactMessage(evt, contacts, settings, true)
+		return
+	}
+	if isLocation(quoted) {
+		sendMessage(evt, "ℹ️ Locations have no claim to check.")
+		return
+	}
+	if text := prepareText(extractText(quoted)); text != "" {
+		if handleScamLinks(evt, text, settings, true) {
+			return
+		}
+		handleTextMessage(evt, text, settings, true)
+		return
+	}
+	sendMessage(evt, "❌ I can only check text, image, audio and video messages.")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	overflowSplit = "split"
+	overflowShort = "short"
+)
+
+// partLabelReserve is the room kept in each part for its "(n/m)" label
+const partLabelReserve = 12
+
+// tooLong reports whether text exceeds the configured reply length
+func tooLong(text string) bool {
+	return config.MaxReplyLength > 0 && utf8.RuneCountInString(text) > config.MaxReplyLength
+}
+
+// splitReply splits text into numbered parts no longer than
+// config.MaxReplyLength, breaking between paragraphs, then lines, then words
+func splitReply(text string) []string {
+	if !tooLong(text) {
+		return []string{text}
+	}
+	limit := config.MaxReplyLength - partLabelReserve
+	if limit < 1 {
+		limit = 1
+	}
+
+	var parts []string
+	current := ""
+	flush := func() {
+		if strings.TrimSpace(current) != "" {
+			parts = append(parts, strings.TrimSpace(current))
+		}
+		current = ""
+	}
+	// add appends piece to the current part after sep, starting a new part
+	// when it doesn't fit and splitting the piece itself with the next finer
+	// separator when it doesn't fit in a part of its own
+	var add func(piece, sep string, finer []string)
+	add = func(piece, sep string, finer []string) {
+		candidate := piece
+		if current != "" {
+			candidate = current + sep + piece
+		}
+		if utf8.RuneCountInString(candidate) <= limit {
+			current = candidate
+			return
+		}
+		if len(finer) == 0 {
+			// A single word longer than a whole part: hard-split it
+			flush()
+			runes := []rune(piece)
+			for len(runes) > limit {
+				parts = append(parts, string(runes[:limit]))
+				runes = runes[limit:]
+			}
+			current = string(runes)
+			return
+		}
+		if utf8.RuneCountInString(piece) <= limit {
+			flush()
+			current = piece
+			return
+		}
+		for i, sub := range strings.Split(piece, finer[0]) {
+			if i > 0 {
+				sep = finer[0]
+			}
+			add(sub, sep, finer[1:])
+		}
+	}
+	for i, paragraph := range strings.Split(text, "\n\n") {
+		sep := ""
+		if i > 0 {
+			sep = "\n\n"
+		}
+		add(paragraph, sep, []string{"\n", " "})
+	}
+	flush()
+
+	if len(parts) > 1 {
+		for i := range parts {
+			parts[i] = fmt.Sprintf("(%d/%d) %s", i+1, len(parts), parts[i])
+		}
+	}
+	return parts
+}
@@ -0,0 +1,69 @@
+package main
+
+import "strings"
+
+// Claim is one statement extracted from a message with its own verdict
+type Claim struct {
+	Text       string  `json:"text"`
+	Verdict    string  `json:"verdict"` // e.g. true, false, misleading, unverified
+	Confidence float64 `json:"confidence"`
+}
+
+// ClaimView is the template data for one claim in the per-claim breakdown
+type ClaimView struct {
+	Emoji             string
+	Text              string
+	Rating            string // true, false, misleading or unverified
+	ConfidencePercent float64
+}
+
+// claimRating normalizes a backend claim verdict to true, false, misleading or unverified
+func claimRating(verdict string) string {
+	switch strings.ToLower(strings.TrimSpace(verdict)) {
+	case "true", "accurate", "correct", "credible":
+		return "true"
+	case "false", "fake", "misinformation", "incorrect":
+		return "false"
+	case "misleading", "partly true", "partly_true", "mixed", "out of context":
+		return "misleading"
+	}
+	return "unverified"
+}
+
+// knownClaimVerdict reports whether claimRating recognizes verdict rather
+// than falling back to unverified
+func knownClaimVerdict(verdict string) bool {
+	v := strings.ToLower(strings.TrimSpace(verdict))
+	return v == "unverified" || claimRating(v) != "unverified"
+}
+
+// claimEmoji marks a claim's rating
+func claimEmoji(rating string) string {
+	switch rating {
+	case "true":
+		return "✅"
+	case "false":
+		return "❌"
+	case "misleading":
+		return "⚠️"
+	}
+	return "❓"
+}
+
+// claimViews prepares the claims of a result for templates
+func claimViews(claims []Claim) []ClaimView {
+	views := make([]ClaimView, 0, len(claims))
+	for _, c := range claims {
+		if strings.TrimSpace(c.Text) == "" {
+			continue
+		}
+		rating := claimRating(c.Verdict)
+		views = append(views, ClaimView{
+			Emoji:             claimEmoji(rating),
+			Text:              strings.TrimSpace(c.Text),
+			Rating:            rating,
+			ConfidencePercent: c.Confidence * 100,
+		})
+	}
+	return views
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mdp/qrterminal/v3"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+	"rsc.io/qr"
+)
+
+// Besides 0 for success, subcommands exit with 1 for failures a restart may
+// fix, 2 for invalid usage and exitAuth when the bot needs linking again, so
+// a supervisor can restart the first and not the others
+const exitAuth = 3
+
+// Subcommand is one of the binary's subcommands
+type Subcommand struct {
+	Usage string
+	Help  string
+	// Offline subcommands run without loading secrets from a secrets manager
+	Offline bool
+	Run     func(args []string) int
+}
+
+// subcommands maps names to subcommands
+var subcommands = map[string]*Subcommand{}
+
+// registerSubcommand adds a subcommand to the CLI
+func registerSubcommand(name string, sub *Subcommand) {
+	subcommands[name] = sub
+}
+
+func init() {
+	registerSubcommand("run", &Subcommand{
+		Usage: "run [-once-login]",
+		Help:  "Connect to WhatsApp and answer messages",
+		Run:   runBot,
+	})
+	registerSubcommand("login", &Subcommand{
+		Usage: "login [-pair-phone NUMBER] [-qr-file PNG] [-qr-addr ADDR]",
+		Help:  "Link the bot to a WhatsApp account by QR code or pairing code",
+		Run:   runLogin,
+	})
+}
+
+// runCLI runs the subcommand named by args[0] and returns the exit code
+func runCLI(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage()
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	sub, ok := subcommands[args[0]]
+	if !ok {
+		fmt.Printf("Unknown command %q\n\n", args[0])
+		printUsage()
+		return 2
+	}
+	if configFileErr != nil {
+		fmt.Println(configFileErr)
+		return 1
+	}
+	if config.LogFormat != logFormatText && config.LogFormat != logFormatJSON {
+		fmt.Printf("Unknown LOG_FORMAT %q (use text or json)\n", config.LogFormat)
+		return 2
+	}
+	if !sub.Offline {
+		if err := loadSecrets(); err != nil {
+			fmt.Printf("Failed to load secrets: %v\n", err)
+			return 1
+		}
+		if err := ensureDataDir(); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	}
+	return sub.Run(args[1:])
+}
+
+// printUsage lists the subcommands
+func printUsage() {
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println("Usage: whatsapp-bot <command> [flags]")
+	fmt.Println()
+	for _, name := range names {
+		sub := subcommands[name]
+		fmt.Printf("  %s\n      %s\n", sub.Usage, sub.Help)
+	}
+	fmt.Println()
+	fmt.Println("Run a command with -h for its flags.")
+}
+
+//go:embed web/login.html
+var loginPage []byte
+
+// runLogin links the bot to a WhatsApp account: by scanning a QR code, or
+// with -pair-phone by entering a code on that phone. Without a terminal, as in
+// a container, the QR code is written to -qr-file or served on -qr-addr.
+func runLogin(args []string) int {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	pairPhone := flags.String("pair-phone", "", "phone number with country code to link by pairing code instead of QR code")
+	qrFile := flags.String("qr-file", config.LoginQRFile, "write the QR code to this PNG file")
+	qrAddr := flags.String("qr-addr", config.LoginQRAddr, "serve the QR code as a web page on this address")
+	flags.Parse(args)
+
+	deviceStore, err := openDevice()
+	if err != nil {
+		fmt.Printf("Failed to log in: %v\n", err)
+		return 1
+	}
+	if deviceStore.ID != nil {
+		fmt.Printf("Already logged in as %s. Remove the bot under Linked Devices on the phone to link it again.\n", deviceStore.ID.ToNonAD())
+		return 0
+	}
+	phone := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, *pairPhone)
+	if *pairPhone != "" && phone == "" {
+		fmt.Println("-pair-phone must be a phone number with country code, e.g. +91 98765 43210")
+		return 2
+	}
+
+	if err := linkDevice(deviceStore, phone, *qrFile, *qrAddr); err != nil {
+		fmt.Printf("Login failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("✅ Logged in as %s. Start the bot with: whatsapp-bot run\n", deviceStore.ID.ToNonAD())
+	return 0
+}
+
+// linkDevice links deviceStore to the account whose phone scans the QR code,
+// or to phone by pairing code when it's set. The QR code is drawn on a
+// terminal, and written to qrFile and served on qrAddr when they're set.
+func linkDevice(deviceStore *store.Device, phone, qrFile, qrAddr string) error {
+	client := whatsmeow.NewClient(deviceStore, waLogger("Client"))
+	qrChan, _ := client.GetQRChannel(context.Background())
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer client.Disconnect()
+
+	var current atomic.Pointer[[]byte]
+	if qrAddr != "" && phone == "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(loginPage)
+		})
+		mux.HandleFunc("GET /qr.png", func(w http.ResponseWriter, r *http.Request) {
+			png := current.Load()
+			if png == nil {
+				http.Error(w, "no QR code yet", http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write(*png)
+		})
+		server := &http.Server{Addr: qrAddr, Handler: mux}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Printf("QR code server stopped: %v\n", err)
+			}
+		}()
+		defer server.Close()
+	}
+	if qrFile != "" && phone == "" {
+		defer os.Remove(qrFile)
+	}
+
+	prompted := false
+	for evt := range qrChan {
+		switch {
+		case evt.Event == "code" && phone == "":
+			if !prompted {
+				fmt.Println("\n📱 Scan this QR code with WhatsApp to login:")
+				fmt.Println("   (WhatsApp > Settings > Linked Devices > Link a Device)")
+				if qrFile != "" {
+					fmt.Printf("   QR code image: %s\n", qrFile)
+				}
+				if qrAddr != "" {
+					fmt.Printf("   QR code page: http://%s/\n", qrAddr)
+				}
+				fmt.Println()
+				prompted = true
+			}
+			if qrFile != "" || qrAddr != "" {
+				code, err := qr.Encode(evt.Code, qr.L)
+				if err != nil {
+					return fmt.Errorf("failed to encode QR code: %w", err)
+				}
+				png := code.PNG()
+				current.Store(&png)
+				if qrFile != "" {
+					if err := writeFileAtomic(qrFile, png); err != nil {
+						return fmt.Errorf("failed to write QR code: %w", err)
+					}
+				}
+			}
+			switch {
+			case stdoutTerminal:
+				qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stdout)
+			case qrFile == "" && qrAddr == "":
+				// Render it with any QR code generator, e.g. qrencode -t UTF8
+				fmt.Printf("QR code: %s\n", evt.Code)
+			}
+		case evt.Event == "code":
+			// A pairing code needs the connection up, which the first QR code shows
+			if prompted {
+				continue
+			}
+			code, err := client.PairPhone(context.Background(), phone, true, whatsmeow.PairClientChrome, "Chrome (Linux)")
+			if err != nil {
+				return fmt.Errorf("failed to get a pairing code: %w", err)
+			}
+			fmt.Printf("\n📱 Enter this code on +%s:\n\n   %s\n\n", phone, code)
+			fmt.Println("   (WhatsApp > Settings > Linked Devices > Link a Device > Link with phone number instead)")
+			prompted = true
+		case evt.Event == "success":
+			return nil
+		case evt.Error != nil:
+			return fmt.Errorf("%s: %w", evt.Event, evt.Error)
+		default:
+			return fmt.Errorf("%s", evt.Event)
+		}
+	}
+	return fmt.Errorf("connection closed before logging in")
+}
+
+// writeFileAtomic replaces path with data through a temporary file, so a
+// reader never sees half of it
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
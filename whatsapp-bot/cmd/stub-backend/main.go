@@ -0,0 +1,25 @@
+// Command stub-backend serves the scriptable stub analysis backend used by
+// the integration tests, for running them against a container:
+//
+//	stub-backend [-addr :8000]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aletheia/whatsapp-bot/stubbackend"
+)
+
+func main() {
+	addr := flag.String("addr", ":8000", "address to listen on")
+	flag.Parse()
+
+	fmt.Printf("Stub backend listening on %s\n", *addr)
+	if err := http.ListenAndServe(*addr, stubbackend.New()); err != nil {
+		fmt.Printf("Stub backend failed: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Command is a slash command the bot responds to
+type Command struct {
+	Usage   string
+	Help    string
+	Role    Role                       // the least role needed to run it; roleNone for everyone
+	Confirm func(args []string) string // a warning when args need a /confirm first, else ""
+	Handler func(evt *events.Message, args []string)
+}
+
+var commands = map[string]*Command{}
+
+// registerCommand adds a command to the registry under name (without the slash)
+func registerCommand(name string, cmd *Command) {
+	commands[name] = cmd
+}
+
+func init() {
+	registerCommand("help", &Command{
+		Usage:   "/help",
+		Help:    "Show available commands",
+		Handler: cmdHelp,
+	})
+}
+
+// parseCommand splits "/name arg1 arg2" into its name and arguments
+func parseCommand(text string) (string, []string, bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return "", nil, false
+	}
+	fields := strings.Fields(text[1:])
+	if len(fields) == 0 {
+		return "", nil, false
+	}
+	name := strings.ToLower(fields[0])
+	// Strip a "@botname" suffix so "/help@aletheia" works the same as "/help"
+	if at := strings.IndexByte(name, '@'); at >= 0 {
+		name = name[:at]
+	}
+	return name, fields[1:], true
+}
+
+// handleCommand runs the command in text, returning false if text is not a known command
+func handleCommand(evt *events.Message, text string) bool {
+	name, args, ok := parseCommand(text)
+	if !ok {
+		return false
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		return false
+	}
+
+	if roleOf(evt.Info) < cmd.Role {
+		sendMessage(evt, fmt.Sprintf("⛔ This command needs the %s role.", cmd.Role))
+		return true
+	}
+
+	if cmd.Confirm != nil {
+		if warning := cmd.Confirm(args); warning != "" {
+			askConfirmation(evt, name, cmd, args, warning)
+			return true
+		}
+	}
+	runCommand(evt, name, cmd, args)
+	return true
+}
+
+// runCommand runs a command the sender is allowed to run
+func runCommand(evt *events.Message, name string, cmd *Command, args []string) {
+	fmt.Printf("Command /%s from %s in %s\n", name, evt.Info.Sender.String(), evt.Info.Chat.String())
+	if cmd.Role > roleNone {
+		botStore.audit(actorOf(evt.Info), evt.Info.Chat, "command", "/"+name, nil, strings.Join(args, " "))
+	}
+	cmd.Handler(evt, args)
+}
+
+// isAdmin reports whether the message sender is a bot admin or owner
+func isAdmin(info types.MessageInfo) bool {
+	return roleOf(info) >= roleAdmin
+}
+
+// canManageChat reports whether the sender may change settings for the chat:
+// bot admins anywhere, group admins in their group, and anyone in their own
+// direct chat
+func canManageChat(info types.MessageInfo) bool {
+	return isAdmin(info) || !info.IsGroup || isGroupAdmin(info)
+}
+
+// parseJIDArg parses a user-supplied JID, accepting bare phone numbers like "+91 98765 43210"
+func parseJIDArg(arg string) (types.JID, error) {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return types.JID{}, fmt.Errorf("empty JID")
+	}
+	if !strings.Contains(arg, "@") {
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			if r == '+' || r == ' ' || r == '-' {
+				return -1
+			}
+			return 'x'
+		}, arg)
+		if digits == "" || strings.Contains(digits, "x") {
+			return types.JID{}, fmt.Errorf("invalid phone number %q", arg)
+		}
+		return types.NewJID(digits, types.DefaultUserServer), nil
+	}
+	jid, err := types.ParseJID(arg)
+	if err != nil {
+		return types.JID{}, err
+	}
+	return jid.ToNonAD(), nil
+}
+
+// cmdHelp lists the commands available to the sender
+func cmdHelp(evt *events.Message, args []string) {
+	role := roleOf(evt.Info)
+	names := make([]string, 0, len(commands))
+	for name, cmd := range commands {
+		if cmd.Role > role {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("🤖 *Aletheia commands*\n\n")
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(&sb, "`%s` — %s\n", cmd.Usage, cmd.Help)
+	}
+	sendMessage(evt, strings.TrimRight(sb.String(), "\n"))
+}
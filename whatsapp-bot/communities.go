@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Groups linked to a WhatsApp community take the community's settings for
+// every key they haven't set themselves. The community itself has no chat:
+// its admins manage it from the announcement group, whose settings are the
+// community's.
+
+// setCommunity records the community a group is linked to, and whether it's
+// the community's announcement group; an empty community unlinks it
+func (s *Store) setCommunity(chat, community types.JID, announcement bool) {
+	var err error
+	if community.IsEmpty() {
+		_, err = s.db.Exec(`DELETE FROM community_groups WHERE chat = ?`, chat.ToNonAD().String())
+	} else {
+		_, err = s.db.Exec(
+			`INSERT INTO community_groups (chat, community, announcement, updated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (chat) DO UPDATE SET community = excluded.community, announcement = excluded.announcement, updated_at = excluded.updated_at`,
+			chat.ToNonAD().String(), community.ToNonAD().String(), announcement, time.Now().Unix(),
+		)
+	}
+	if err != nil {
+		fmt.Printf("Error recording community of %s: %v\n", chat, err)
+	}
+}
+
+// communityOf returns the community chat is linked to, empty when it isn't,
+// and whether chat is the community's announcement group
+func (s *Store) communityOf(chat types.JID) (types.JID, bool) {
+	if chat.Server != types.GroupServer {
+		return types.JID{}, false
+	}
+	var community string
+	var announcement bool
+	err := s.db.QueryRow(`SELECT community, announcement FROM community_groups WHERE chat = ?`, chat.ToNonAD().String()).Scan(&community, &announcement)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			fmt.Printf("Error loading community of %s: %v\n", chat, err)
+		}
+		return types.JID{}, false
+	}
+	jid, err := types.ParseJID(community)
+	if err != nil {
+		return types.JID{}, false
+	}
+	return jid, announcement
+}
+
+// settingsChat is the chat whose settings a change made in chat applies to:
+// the community for its announcement group, and chat itself otherwise
+func (s *Store) settingsChat(chat types.JID) types.JID {
+	if community, announcement := s.communityOf(chat); announcement {
+		return community
+	}
+	return chat
+}
+
+// communityNote explains where a chat's settings come from when it's part
+// of a community, for /settings
+func communityNote(chat types.JID) string {
+	switch community, announcement := botStore.communityOf(chat); {
+	case announcement:
+		return "\n\n_This is the community's announcement group: its settings apply to every group in the community that hasn't changed them._"
+	case !community.IsEmpty():
+		return "\n\n_Settings this group hasn't changed come from its community's announcement group._"
+	}
+	return ""
+}
+
+// handleCommunityLink keeps community links current as groups are linked
+// to and unlinked from communities. The change arrives on the community
+// for its sub groups, and on a group for its parent.
+func handleCommunityLink(evt *events.GroupInfo) {
+	if change := evt.Link; change != nil {
+		switch change.Type {
+		case types.GroupLinkChangeTypeSub:
+			botStore.setCommunity(change.Group.JID, evt.JID, change.Group.IsDefaultSubGroup)
+		case types.GroupLinkChangeTypeParent:
+			botStore.setCommunity(evt.JID, change.Group.JID, false)
+			forgetGroupInfo(evt.JID)
+		}
+	}
+	if change := evt.Unlink; change != nil {
+		switch change.Type {
+		case types.GroupLinkChangeTypeSub:
+			botStore.setCommunity(change.Group.JID, types.JID{}, false)
+		case types.GroupLinkChangeTypeParent:
+			botStore.setCommunity(evt.JID, types.JID{}, false)
+			forgetGroupInfo(evt.JID)
+		}
+	}
+}
+
+// cannotPost reports whether only admins can send messages in chat and the
+// bot isn't one, as in most community announcement groups. Members can
+// still react there.
+func cannotPost(chat types.JID) bool {
+	if chat.Server != types.GroupServer {
+		return false
+	}
+	meta, err := groupInfo(chat)
+	if err != nil {
+		fmt.Printf("Error checking group permissions: %v\n", err)
+		return false
+	}
+	return meta.AnnounceOnly && !meta.botAdmin
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxErrorBodyBytes is how much of an error response is read for the log
+const maxErrorBodyBytes = 1024
+
+// newJSONRequest builds a POST of a JSON body to the backend
+func newJSONRequest(url string, body []byte) (*http.Request, error) {
+	return newRequest(url, "application/json", body)
+}
+
+// newRequest builds a POST to the backend, gzipping bodies of at least
+// config.BackendGzipOver bytes. Responses are gzipped too when the backend
+// supports it: the transport asks for and unpacks them.
+func newRequest(url, contentType string, body []byte) (*http.Request, error) {
+	encoding := ""
+	if config.BackendGzipOver > 0 && len(body) >= config.BackendGzipOver {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, fmt.Errorf("failed to compress request: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress request: %w", err)
+		}
+		body, encoding = buf.Bytes(), "gzip"
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	return req, nil
+}
+
+// readResponse reads a response body, failing instead of reading more than
+// config.BackendMaxResponseBytes (after decompression)
+func readResponse(resp *http.Response) ([]byte, error) {
+	if config.BackendMaxResponseBytes <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, config.BackendMaxResponseBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if int64(len(body)) > config.BackendMaxResponseBytes {
+		return nil, fmt.Errorf("response is larger than %d bytes", config.BackendMaxResponseBytes)
+	}
+	return body, nil
+}
+
+// decodeResponse decodes a JSON response body into v, with the size limit of
+// readResponse
+func decodeResponse(resp *http.Response, v any) error {
+	body := io.Reader(resp.Body)
+	var limited *io.LimitedReader
+	if config.BackendMaxResponseBytes > 0 {
+		limited = &io.LimitedReader{R: resp.Body, N: config.BackendMaxResponseBytes + 1}
+		body = limited
+	}
+	err := json.NewDecoder(body).Decode(v)
+	if limited != nil && limited.N <= 0 {
+		return fmt.Errorf("response is larger than %d bytes", config.BackendMaxResponseBytes)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// errorBody reads the start of an error response for the log
+func errorBody(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	return string(body)
+}
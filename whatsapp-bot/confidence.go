@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Ways a verdict's confidence can be shown, set per chat with /settings
+const (
+	confidenceBar     = "bar"     // [████████░░] 80%
+	confidenceStars   = "stars"   // ★★★★☆
+	confidencePercent = "percent" // 80%
+	confidenceNone    = "none"    // not shown
+)
+
+// confidenceStyle returns the chat's confidence display. Plain-format chats
+// get the percentage instead of the bar or stars, which plainText drops.
+func (s *ChatSettings) confidenceStyle() string {
+	if s.Format == formatPlain && (s.Confidence == confidenceBar || s.Confidence == confidenceStars) {
+		return confidencePercent
+	}
+	return s.Confidence
+}
+
+// confidenceBarText draws confidence as ten block characters
+func confidenceBarText(confidence float64) string {
+	filled := int(confidence * 10)
+	bar := ""
+	for i := 0; i < 10; i++ {
+		if i < filled {
+			bar += "█"
+		} else {
+			bar += "░"
+		}
+	}
+	return bar
+}
+
+// confidenceStarsText draws confidence as five stars. Confidences below 0,
+// and NaN, get none and those above 1 get all five, where counting stars
+// from them made strings.Repeat panic on a negative count.
+func confidenceStarsText(confidence float64) string {
+	filled := 0
+	if confidence > 0 {
+		filled = int(math.Round(min(confidence, 1) * 5))
+	}
+	return strings.Repeat("★", filled) + strings.Repeat("☆", 5-filled)
+}
+
+// confidenceDisplay renders confidence in the full reply's style; short
+// replies use confidenceShort
+func confidenceDisplay(confidence float64, style string) string {
+	switch style {
+	case confidenceNone:
+		return ""
+	case confidencePercent:
+		return fmt.Sprintf("%.0f%%", confidence*100)
+	case confidenceStars:
+		return confidenceStarsText(confidence)
+	}
+	return fmt.Sprintf("[%s] %.0f%%", confidenceBarText(confidence), confidence*100)
+}
+
+// confidenceShort renders confidence for the one-line headline of short
+// replies, where the bar would be too wide
+func confidenceShort(confidence float64, style string) string {
+	switch style {
+	case confidenceNone:
+		return ""
+	case confidenceStars:
+		return confidenceStarsText(confidence)
+	}
+	return fmt.Sprintf("%.0f%%", confidence*100)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+	// totpSkew is how many periods either side of now a code is accepted for,
+	// to allow for clock drift and typing time
+	totpSkew = 1
+)
+
+// pendingCommand is a destructive command waiting for /confirm
+type pendingCommand struct {
+	name    string
+	cmd     *Command
+	evt     *events.Message
+	args    []string
+	expires time.Time
+}
+
+// pendingCommands holds each operator's command awaiting confirmation, by sender
+var pendingCommands = struct {
+	sync.Mutex
+	bySender map[string]*pendingCommand
+	// lastStep is the last TOTP time step used per sender, so a code can't be replayed
+	lastStep map[string]int64
+}{bySender: map[string]*pendingCommand{}, lastStep: map[string]int64{}}
+
+func init() {
+	registerCommand("confirm", &Command{
+		Usage:   "/confirm [code]",
+		Help:    "Confirm a pending destructive command, with your authenticator code if you have one",
+		Role:    roleModerator,
+		Handler: cmdConfirm,
+	})
+	registerCommand("shutdown", &Command{
+		Usage:   "/shutdown",
+		Help:    "Stop the bot",
+		Role:    roleOwner,
+		Confirm: confirmAlways("This stops the bot until someone restarts it."),
+		Handler: cmdShutdown,
+	})
+}
+
+// confirmAlways makes a command always need a /confirm, showing warning
+func confirmAlways(warning string) func(args []string) string {
+	return func(args []string) string { return warning }
+}
+
+// askConfirmation holds back a destructive command until the sender confirms it
+func askConfirmation(evt *events.Message, name string, cmd *Command, args []string, warning string) {
+	pendingCommands.Lock()
+	pendingCommands.bySender[evt.Info.Sender.ToNonAD().String()] = &pendingCommand{
+		name:    name,
+		cmd:     cmd,
+		evt:     evt,
+		args:    args,
+		expires: time.Now().Add(confirmationTTL),
+	}
+	pendingCommands.Unlock()
+
+	how := "Reply */confirm*"
+	if totpSecret(evt.Info) != nil {
+		how = "Reply */confirm <code>* with the code from your authenticator app"
+	}
+	sendMessage(evt, fmt.Sprintf("⚠️ *Confirm /%s*\n\n%s\n\n%s within 5 minutes to continue.", name, warning, how))
+}
+
+func cmdConfirm(evt *events.Message, args []string) {
+	sender := evt.Info.Sender.ToNonAD().String()
+	pendingCommands.Lock()
+	pending := pendingCommands.bySender[sender]
+	delete(pendingCommands.bySender, sender)
+	pendingCommands.Unlock()
+	if pending == nil || time.Now().After(pending.expires) {
+		sendMessage(evt, "⌛ Nothing is waiting for confirmation.")
+		return
+	}
+	// The command must be confirmed where it was sent, so a reply in another
+	// chat can't trigger it
+	if pending.evt.Info.Chat != evt.Info.Chat {
+		sendMessage(evt, fmt.Sprintf("⛔ Confirm /%s in the chat where you sent it.", pending.name))
+		return
+	}
+
+	if secret := totpSecret(evt.Info); secret != nil {
+		if len(args) != 1 || !checkTOTP(sender, secret, args[0], time.Now()) {
+			botStore.audit(actorOf(evt.Info), evt.Info.Chat, "confirm-failed", "/"+pending.name, nil, nil)
+			sendMessage(evt, fmt.Sprintf("⛔ Wrong or missing authenticator code. Send /%s again to retry.", pending.name))
+			return
+		}
+	}
+	runCommand(pending.evt, pending.name, pending.cmd, pending.args)
+}
+
+// totpSecret returns the sender's TOTP key from ADMIN_TOTP_SECRETS, or nil
+// when they have none and a plain /confirm is enough
+func totpSecret(info types.MessageInfo) []byte {
+	for _, entry := range strings.Split(config.AdminTOTPSecrets.Get(), ",") {
+		who, secret, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		jid, err := parseJIDArg(who)
+		if err != nil {
+			continue
+		}
+		for _, sender := range []types.JID{info.Sender, info.SenderAlt} {
+			if sender.IsEmpty() || sender.User != jid.User || sender.Server != jid.Server {
+				continue
+			}
+			key, err := decodeTOTPSecret(secret)
+			if err != nil {
+				fmt.Printf("Ignoring invalid TOTP secret for %s: %v\n", jid, err)
+				return nil
+			}
+			return key
+		}
+	}
+	return nil
+}
+
+// decodeTOTPSecret decodes a base32 key as shown by authenticator apps,
+// ignoring case, spaces and padding
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+}
+
+// totpCode computes the RFC 6238 code for a time step
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// checkTOTP reports whether code is valid for key around now and hasn't been
+// used by sender before
+func checkTOTP(sender string, key []byte, code string, now time.Time) bool {
+	code = strings.TrimSpace(code)
+	current := now.Unix() / int64(totpPeriod/time.Second)
+	pendingCommands.Lock()
+	defer pendingCommands.Unlock()
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= pendingCommands.lastStep[sender] {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			pendingCommands.lastStep[sender] = step
+			return true
+		}
+	}
+	return false
+}
+
+func cmdShutdown(evt *events.Message, args []string) {
+	fmt.Printf("Shutdown requested by %s\n", evt.Info.Sender)
+	sendMessage(evt, "👋 Shutting down.")
+	process, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = process.Signal(os.Interrupt)
+	}
+	if err != nil {
+		fmt.Printf("Error shutting down: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not shut down.")
+	}
+}
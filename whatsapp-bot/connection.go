@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// errConnectionDegraded is returned for messages held back while keepalive
+// pings to WhatsApp keep timing out, and sent together once they work again
+var errConnectionDegraded = errors.New("sending is paused while the connection to WhatsApp is unreliable")
+
+// connection tracks the quality of the connection to WhatsApp and whether
+// the paired phone is online
+var connection = struct {
+	sync.Mutex
+	connectedAt       time.Time
+	disconnectedAt    time.Time
+	connects          int
+	disconnects       int
+	keepAliveFailures int
+	lastKeepAlive     time.Time
+	degradedSince     time.Time
+	offlineMessages   int
+	phoneSeen         bool // a presence update for the phone arrived
+	phoneOnline       bool
+	phoneLastSeen     time.Time
+}{}
+
+// ConnectionState is the connection quality shown in /debug/state
+type ConnectionState struct {
+	ConnectedFor      string     `json:"connected_for,omitempty"`
+	Connects          int        `json:"connects"`
+	Disconnects       int        `json:"disconnects"`
+	KeepAliveFailures int        `json:"keepalive_failures"`
+	LastKeepAlive     *time.Time `json:"last_keepalive,omitempty"`
+	DegradedFor       string     `json:"degraded_for,omitempty"`
+	OfflineMessages   int        `json:"offline_messages"`
+	PhoneOnline       *bool      `json:"phone_online,omitempty"`
+	PhoneLastSeen     *time.Time `json:"phone_last_seen,omitempty"`
+}
+
+// connectionDegraded reports whether outgoing messages are being held
+// because keepalives keep failing
+func connectionDegraded() bool {
+	connection.Lock()
+	defer connection.Unlock()
+	return !connection.degradedSince.IsZero()
+}
+
+// handleConnected records a (re)connection and how long the bot was offline
+func handleConnected() {
+	connection.Lock()
+	connection.connects++
+	if !connection.disconnectedAt.IsZero() {
+		outage := time.Since(connection.disconnectedAt)
+		metrics.add("connection_outage_seconds", int64(outage.Seconds()))
+		fmt.Printf("Reconnected after %s offline\n", outage.Round(time.Second))
+		connection.disconnectedAt = time.Time{}
+	}
+	connection.connectedAt = time.Now()
+	connection.keepAliveFailures = 0
+	connection.lastKeepAlive = time.Now()
+	connection.degradedSince = time.Time{}
+	connection.Unlock()
+	metrics.inc("connected")
+
+	if config.PhonePresence {
+		go watchPhonePresence()
+	}
+}
+
+// handleDisconnected records when the connection dropped
+func handleDisconnected() {
+	connection.Lock()
+	connection.disconnects++
+	if connection.disconnectedAt.IsZero() {
+		connection.disconnectedAt = time.Now()
+	}
+	connection.Unlock()
+	metrics.inc("disconnected")
+}
+
+// handleKeepAliveTimeout starts holding outgoing messages after
+// KEEPALIVE_HOLD_AFTER pings in a row failed, rather than letting each one
+// time out on a connection that isn't getting through
+func handleKeepAliveTimeout(evt *events.KeepAliveTimeout) {
+	metrics.inc("keepalive_timeout")
+	connection.Lock()
+	connection.keepAliveFailures = evt.ErrorCount
+	connection.lastKeepAlive = evt.LastSuccess
+	hold := config.KeepAliveHoldAfter > 0 && evt.ErrorCount >= config.KeepAliveHoldAfter && connection.degradedSince.IsZero()
+	if hold {
+		connection.degradedSince = time.Now()
+	}
+	connection.Unlock()
+	if hold {
+		fmt.Printf("⚠️ %d keepalive pings to WhatsApp failed, last success %s ago; holding outgoing messages\n",
+			evt.ErrorCount, time.Since(evt.LastSuccess).Round(time.Second))
+		sdNotify("STATUS=Connection unreliable, holding outgoing messages")
+	}
+}
+
+// handleKeepAliveRestored sends the messages held while keepalives failed
+func handleKeepAliveRestored() {
+	metrics.inc("keepalive_restored")
+	connection.Lock()
+	since := connection.degradedSince
+	connection.keepAliveFailures = 0
+	connection.lastKeepAlive = time.Now()
+	connection.degradedSince = time.Time{}
+	connection.Unlock()
+	if since.IsZero() {
+		return
+	}
+	metrics.add("connection_degraded_seconds", int64(time.Since(since).Seconds()))
+	fmt.Printf("✅ Keepalive pings to WhatsApp work again after %s; sending held messages\n", time.Since(since).Round(time.Second))
+	sdNotify("STATUS=Connected")
+	go outbox.flush()
+}
+
+// handleOfflineSync notes how many messages arrived while the bot was offline
+func handleOfflineSync(evt *events.OfflineSyncPreview) {
+	if evt.Messages == 0 {
+		return
+	}
+	connection.Lock()
+	connection.offlineMessages += evt.Messages
+	connection.Unlock()
+	metrics.add("offline_messages", int64(evt.Messages))
+	fmt.Printf("Catching up on %d messages sent while the bot was offline\n", evt.Messages)
+}
+
+// handleUndecryptable counts messages that couldn't be decrypted. whatsmeow
+// asks the sender to retry, and with PHONE_REREQUEST the phone as well.
+func handleUndecryptable(evt *events.UndecryptableMessage) {
+	if evt.IsUnavailable {
+		metrics.inc("message_unavailable")
+	} else {
+		metrics.inc("message_undecryptable")
+	}
+}
+
+// watchPhonePresence marks the bot available, without which WhatsApp sends
+// no presence updates, and subscribes to the paired phone's
+func watchPhonePresence() {
+	own := client.Store.GetJID()
+	if own.IsEmpty() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := client.SendPresence(ctx, types.PresenceAvailable); err != nil {
+		fmt.Printf("Error sending presence: %v\n", err)
+		return
+	}
+	if err := client.SubscribePresence(ctx, own.ToNonAD()); err != nil {
+		fmt.Printf("Error subscribing to the phone's presence: %v\n", err)
+	}
+}
+
+// handlePresence tracks whether the paired phone is online. Linked devices
+// keep working while it's away, but history syncs, message re-requests and
+// app state changes wait for it.
+func handlePresence(evt *events.Presence) {
+	if !isBotJID(evt.From) {
+		return
+	}
+	connection.Lock()
+	changed := !connection.phoneSeen || connection.phoneOnline == evt.Unavailable
+	connection.phoneSeen = true
+	connection.phoneOnline = !evt.Unavailable
+	if !evt.LastSeen.IsZero() {
+		connection.phoneLastSeen = evt.LastSeen
+	}
+	connection.Unlock()
+	if !changed {
+		return
+	}
+	if evt.Unavailable {
+		metrics.inc("phone_offline")
+		fmt.Println("📵 The paired phone went offline")
+	} else {
+		fmt.Println("📱 The paired phone is online")
+	}
+}
+
+// connectionState returns the connection quality for /debug/state
+func connectionState() ConnectionState {
+	connection.Lock()
+	defer connection.Unlock()
+	state := ConnectionState{
+		Connects:          connection.connects,
+		Disconnects:       connection.disconnects,
+		KeepAliveFailures: connection.keepAliveFailures,
+		OfflineMessages:   connection.offlineMessages,
+	}
+	if !connection.connectedAt.IsZero() && connection.disconnectedAt.IsZero() {
+		state.ConnectedFor = time.Since(connection.connectedAt).Round(time.Second).String()
+	}
+	if !connection.lastKeepAlive.IsZero() {
+		last := connection.lastKeepAlive
+		state.LastKeepAlive = &last
+	}
+	if !connection.degradedSince.IsZero() {
+		state.DegradedFor = time.Since(connection.degradedSince).Round(time.Second).String()
+	}
+	if connection.phoneSeen {
+		online := connection.phoneOnline
+		state.PhoneOnline = &online
+	}
+	if !connection.phoneLastSeen.IsZero() {
+		seen := connection.phoneLastSeen
+		state.PhoneLastSeen = &seen
+	}
+	return state
+}
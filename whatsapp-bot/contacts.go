@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// minScamNumberDigits is the shortest number matched by its trailing
+// digits, so a list entry matches with or without its country code
+const minScamNumberDigits = 8
+
+// scamNumbers is the loaded scam-number file, reloaded whenever it changes.
+// Numbers are kept as digits only, mapped to the note given for them.
+var scamNumbers struct {
+	sync.Mutex
+	notes   map[string]string
+	modTime time.Time
+	checked time.Time
+}
+
+// loadScamNumbers reads the scam-number file: one number per line, optionally
+// followed by a note, with # comments. The current list is kept when the file
+// is missing or unreadable.
+func loadScamNumbers() {
+	if config.ScamNumbersPath == "" {
+		return
+	}
+	info, err := os.Stat(config.ScamNumbersPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Error reading scam number list: %v\n", err)
+		}
+		return
+	}
+	if info.ModTime().Equal(scamNumbers.modTime) {
+		return
+	}
+
+	data, err := os.ReadFile(config.ScamNumbersPath)
+	if err != nil {
+		fmt.Printf("Error reading scam number list: %v\n", err)
+		return
+	}
+	notes := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if number := phoneDigits(fields[0]); len(number) >= minScamNumberDigits {
+			notes[number] = strings.Join(fields[1:], " ")
+		}
+	}
+	scamNumbers.notes = notes
+	scamNumbers.modTime = info.ModTime()
+	fmt.Printf("Loaded %d scam numbers from %s\n", len(notes), config.ScamNumbersPath)
+}
+
+// phoneDigits strips everything but the digits from a phone number
+func phoneDigits(number string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, number)
+}
+
+// matchScamNumber reports whether number is on the scam list, returning its note
+func matchScamNumber(number string) (string, bool) {
+	scamNumbers.Lock()
+	defer scamNumbers.Unlock()
+	if time.Since(scamNumbers.checked) >= hoaxReloadInterval {
+		scamNumbers.checked = time.Now()
+		loadScamNumbers()
+	}
+
+	digits := phoneDigits(number)
+	if len(digits) < minScamNumberDigits {
+		return "", false
+	}
+	if note, ok := scamNumbers.notes[digits]; ok {
+		return note, true
+	}
+	for listed, note := range scamNumbers.notes {
+		if strings.HasSuffix(listed, digits) || strings.HasSuffix(digits, listed) {
+			return note, true
+		}
+	}
+	return "", false
+}
+
+// vcardNumbers returns the phone numbers in a vCard, preferring the WhatsApp
+// ID WhatsApp adds to TEL lines
+func vcardNumbers(vcard string) []string {
+	var numbers []string
+	for _, line := range strings.Split(vcard, "\n") {
+		line = strings.TrimSpace(line)
+		name, value, ok := strings.Cut(line, ":")
+		// Grouped properties look like item1.TEL;waid=...
+		if _, prop, grouped := strings.Cut(name, "."); grouped {
+			name = prop
+		}
+		if !ok || !strings.HasPrefix(strings.ToUpper(name), "TEL") {
+			continue
+		}
+		if _, waid, ok := strings.Cut(name, "waid="); ok {
+			value, _, _ = strings.Cut(waid, ";")
+		}
+		if number := phoneDigits(value); number != "" {
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers
+}
+
+// sharedContacts returns the contact cards in msg, or nil if it has none
+func sharedContacts(msg *waE2E.Message) []*waE2E.ContactMessage {
+	if contact := msg.GetContactMessage(); contact != nil {
+		return []*waE2E.ContactMessage{contact}
+	}
+	return msg.GetContactsArrayMessage().GetContacts()
+}
+
+// isLocation reports whether msg is a shared or live location
+func isLocation(msg *waE2E.Message) bool {
+	return msg.GetLocationMessage() != nil || msg.GetLiveLocationMessage() != nil
+}
+
+// scamContactVerdict builds the warning for contacts whose numbers are on
+// the scam list, or nil when none are
+func scamContactVerdict(contacts []*waE2E.ContactMessage) *AnalyzeResponse {
+	var evidence []string
+	for _, contact := range contacts {
+		for _, number := range vcardNumbers(contact.GetVcard()) {
+			note, ok := matchScamNumber(number)
+			if !ok {
+				continue
+			}
+			item := fmt.Sprintf("%s (%s) is on the list of numbers reported for scams", contact.GetDisplayName(), number)
+			if note != "" {
+				item += ": " + note
+			}
+			evidence = append(evidence, item)
+		}
+	}
+	if len(evidence) == 0 {
+		return nil
+	}
+	return &AnalyzeResponse{
+		IsMisinformation: true,
+		Confidence:       1,
+		IsNews:           true,
+		Summary:          "This contact has been reported for scams.",
+		Evidence:         evidence,
+		Recommendation:   "Do not call, pay or share codes with this number. Block and report it.",
+		MessageType:      "scam_contact",
+	}
+}
+
+// handleContactMessage checks shared contacts against the scam-number list.
+// Contacts that aren't on it are skipped, as there's no claim to check.
+func handleContactMessage(evt *events.Message, contacts []*waE2E.ContactMessage, settings *ChatSettings, explicit bool) {
+	fmt.Printf("Received %d contacts from %s\n", len(contacts), evt.Info.Sender.String())
+
+	result := scamContactVerdict(contacts)
+	if result == nil {
+		metrics.inc("skipped_contact")
+		if explicit {
+			sendMessage(evt, "ℹ️ This contact isn't on the list of numbers reported for scams.")
+		}
+		return
+	}
+	fmt.Println("Shared contact matched the scam number list")
+	metrics.inc("scam_contact")
+	botStore.recordAnalysis(evt.Info, "contact", "", result)
+	sendVerdict(evt, result, settings, explicit)
+}
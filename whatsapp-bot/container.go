@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// configFileErr is why CONFIG_FILE couldn't be read. The file is read while
+// package variables are initialized, before init builds the config from the
+// environment, so the error is reported once the CLI starts.
+var configFileErr = loadConfigFile(os.Getenv("CONFIG_FILE"))
+
+// stdoutTerminal is whether stdout was a terminal at startup, before
+// captureLogs replaced it with a pipe
+var stdoutTerminal = isTerminal(os.Stdout)
+
+// loadConfigFile sets environment variables from a file of KEY=VALUE lines in
+// the format of .env.example, for deployments that mount their configuration.
+// Variables already set in the environment win over the file.
+func loadConfigFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read CONFIG_FILE: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("CONFIG_FILE %s line %d: expected KEY=VALUE", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, value)
+		}
+	}
+	return scanner.Err()
+}
+
+// dataPath places a relative path for state the bot writes under DATA_DIR,
+// so one volume holds the session and bot databases and the archive
+func dataPath(path string) string {
+	dir := os.Getenv("DATA_DIR")
+	if dir == "" || path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// ensureDataDir creates DATA_DIR when it's set but missing
+func ensureDataDir() error {
+	if config.DataDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(config.DataDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create DATA_DIR: %w", err)
+	}
+	return nil
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// waLogger returns a whatsmeow logger for module, colored only on a terminal
+func waLogger(module string) waLog.Logger {
+	return waLog.Stdout(module, "WARN", stdoutTerminal && config.LogFormat == logFormatText)
+}
@@ -0,0 +1,46 @@
+package main
+
+import "fmt"
+
+// Backend message types for content that isn't a factual claim. They replace
+// the input kind (text, image) in message_type.
+const (
+	contentSatire        = "satire"
+	contentOpinion       = "opinion"
+	contentAdvertisement = "advertisement"
+	contentPersonal      = "personal"
+)
+
+// isSatire reports whether the backend recognized the content as satire
+func (r *AnalyzeResponse) isSatire() bool {
+	return r.MessageType == contentSatire
+}
+
+// contentTypeReply returns the tailored reply for satire, opinion, ads and
+// personal messages, or "" for a factual claim
+func contentTypeReply(result *AnalyzeResponse, lang string) string {
+	m := messagesFor(lang)
+	switch result.MessageType {
+	case contentSatire:
+		if result.Publisher != "" {
+			return fmt.Sprintf(m.SatireFrom, result.Publisher)
+		}
+		return m.Satire
+	case contentOpinion:
+		return m.Opinion
+	case contentAdvertisement:
+		return m.Advertisement
+	case contentPersonal:
+		return m.Personal
+	}
+	return ""
+}
+
+// notNewsReply is the answer to an explicit check of something that isn't
+// news: the tailored reply for its content type, else the generic one
+func notNewsReply(result *AnalyzeResponse, lang string) string {
+	if reply := contentTypeReply(result, lang); reply != "" {
+		return reply
+	}
+	return messagesFor(lang).NotNews
+}
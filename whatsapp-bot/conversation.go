@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// maxFollowUpTurns is how many question/answer turns are kept per chat
+const maxFollowUpTurns = 6
+
+// ChatTurn is one message in a follow-up conversation
+type ChatTurn struct {
+	Role    string `json:"role"` // user or assistant
+	Content string `json:"content"`
+}
+
+// ChatRequest is the request body for the backend /chat endpoint
+type ChatRequest struct {
+	Question string           `json:"question"`
+	Language string           `json:"language,omitempty"`
+	Message  string           `json:"message,omitempty"` // the text that was fact-checked
+	Verdict  *AnalyzeResponse `json:"verdict"`
+	History  []ChatTurn       `json:"history,omitempty"`
+}
+
+// ChatResponse is the response from the backend /chat endpoint
+type ChatResponse struct {
+	Answer string `json:"answer"`
+}
+
+// conversation is the context of the last verdict sent in a chat
+type conversation struct {
+	message  string
+	verdict  *AnalyzeResponse
+	language string
+	history  []ChatTurn
+	expires  time.Time
+}
+
+// conversations holds the follow-up context per chat, in memory only
+var conversations = struct {
+	sync.Mutex
+	byChat map[string]*conversation
+}{byChat: map[string]*conversation{}}
+
+// rememberVerdict starts a follow-up conversation for the verdict just sent in chat
+func rememberVerdict(chat types.JID, message string, verdict *AnalyzeResponse, language string) {
+	if config.FollowUpTTL <= 0 {
+		return
+	}
+	conversations.Lock()
+	defer conversations.Unlock()
+	conversations.byChat[chat.String()] = &conversation{
+		message:  message,
+		verdict:  verdict,
+		language: language,
+		expires:  time.Now().Add(config.FollowUpTTL),
+	}
+}
+
+// activeConversation returns a copy of chat's unexpired conversation, if any
+func activeConversation(chat types.JID) (conversation, bool) {
+	conversations.Lock()
+	defer conversations.Unlock()
+	c, ok := conversations.byChat[chat.String()]
+	if !ok {
+		return conversation{}, false
+	}
+	if time.Now().After(c.expires) {
+		delete(conversations.byChat, chat.String())
+		return conversation{}, false
+	}
+	out := *c
+	out.history = append([]ChatTurn(nil), c.history...)
+	return out, true
+}
+
+// recordTurn appends a question and its answer to chat's conversation and extends it
+func recordTurn(chat types.JID, question, answer string) {
+	conversations.Lock()
+	defer conversations.Unlock()
+	c, ok := conversations.byChat[chat.String()]
+	if !ok {
+		return
+	}
+	c.history = append(c.history,
+		ChatTurn{Role: "user", Content: question},
+		ChatTurn{Role: "assistant", Content: answer})
+	if len(c.history) > 2*maxFollowUpTurns {
+		c.history = c.history[len(c.history)-2*maxFollowUpTurns:]
+	}
+	c.expires = time.Now().Add(config.FollowUpTTL)
+}
+
+// forgetConversation drops chat's follow-up context
+func forgetConversation(chat types.JID) {
+	conversations.Lock()
+	defer conversations.Unlock()
+	delete(conversations.byChat, chat.String())
+}
+
+// checkedText returns the text a verdict for evt was about: the message
+// itself, its caption, or for /check the quoted message
+func checkedText(evt *events.Message) string {
+	msg := evt.Message
+	text := extractText(msg)
+	if text == "" {
+		text = msg.GetImageMessage().GetCaption()
+	}
+	if strings.HasPrefix(text, "/") {
+		quoted := msg.GetExtendedTextMessage().GetContextInfo().GetQuotedMessage()
+		if quoted != nil {
+			if q := extractText(quoted); q != "" {
+				return q
+			}
+			return quoted.GetImageMessage().GetCaption()
+		}
+	}
+	return text
+}
+
+// isReplyToBot reports whether msg quotes one of the bot's own messages
+func isReplyToBot(msg *waE2E.Message) bool {
+	participant := msg.GetExtendedTextMessage().GetContextInfo().GetParticipant()
+	if participant == "" {
+		return false
+	}
+	jid, err := types.ParseJID(participant)
+	if err != nil {
+		return false
+	}
+	return isBotJID(jid)
+}
+
+// isBotJID reports whether jid is the bot's own phone number or LID
+func isBotJID(jid types.JID) bool {
+	if own := client.Store.GetJID(); !own.IsEmpty() && jid.User == own.User {
+		return true
+	}
+	own := client.Store.GetLID()
+	return !own.IsEmpty() && jid.User == own.User
+}
+
+// handleFollowUp answers a reply to the bot's verdict using the /chat
+// endpoint, reporting whether the message was handled as a follow-up
+func handleFollowUp(evt *events.Message, text string, settings *ChatSettings) bool {
+	question := strings.TrimSpace(text)
+	if question == "" || !isReplyToBot(evt.Message) {
+		return false
+	}
+	conv, ok := activeConversation(evt.Info.Chat)
+	if !ok {
+		return false
+	}
+
+	language := conv.language
+	if detected := detectLanguage(question); detected != "" {
+		language = replyLanguage(settings.Language, detected)
+	}
+
+	fmt.Printf("Follow-up question in %s:%s\n", evt.Info.Chat, logContent(question))
+	// Mask personal data in the question and the checked text, as for analyses
+	message := conv.message
+	if config.ScrubPII {
+		question, message = scrubPII(question, evt.Info.PushName), scrubPII(message, evt.Info.PushName)
+	}
+	answer, err := askFollowUp(&ChatRequest{
+		Question: question,
+		Language: language,
+		Message:  message,
+		Verdict:  conv.verdict,
+		History:  conv.history,
+	})
+	if err != nil {
+		fmt.Printf("Error answering follow-up: %v\n", err)
+		sendError(evt, "❌ *Error*\n\nCould not answer your question. Please try again later.")
+		return true
+	}
+
+	recordTurn(evt.Info.Chat, question, answer)
+	recordExperimentEvent(evt.Info.Chat, experimentFollowUp)
+	sendMessage(evt, "💬 "+answer)
+	return true
+}
+
+// askFollowUp sends a follow-up question with its verdict context to the backend
+func askFollowUp(req *ChatRequest) (string, error) {
+	jsonBody, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := newJSONRequest(fmt.Sprintf("%s/chat", backendURL()), jsonBody)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to call backend: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("backend returned status %d", resp.StatusCode)
+	}
+
+	var result ChatResponse
+	if err := decodeResponse(resp, &result); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(result.Answer) == "" {
+		return "", fmt.Errorf("backend returned an empty answer")
+	}
+	return strings.TrimSpace(result.Answer), nil
+}
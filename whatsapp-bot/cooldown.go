@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Limiter keeps cooldowns and pauses by key: in memory, or in Redis where
+// they survive restarts and hold back every instance using it
+type Limiter interface {
+	// Take reports whether key is past its cooldown and, if so, starts it again
+	Take(key string, cooldown time.Duration) bool
+	// Cooling reports whether key is within cooldown of its last Take
+	Cooling(key string, cooldown time.Duration) bool
+	// Pause holds key back until until, reporting false if it already was for longer
+	Pause(key string, until time.Time) bool
+	// PausedFor returns how much longer key is held back
+	PausedFor(key string) time.Duration
+}
+
+var limiter Limiter = newMemoryLimiter()
+
+// memoryLimiter is the in-memory Limiter
+type memoryLimiter struct {
+	sync.Mutex
+	last  map[string]time.Time
+	until map[string]time.Time
+}
+
+func newMemoryLimiter() *memoryLimiter {
+	return &memoryLimiter{last: map[string]time.Time{}, until: map[string]time.Time{}}
+}
+
+func (l *memoryLimiter) Take(key string, cooldown time.Duration) bool {
+	l.Lock()
+	defer l.Unlock()
+	if time.Since(l.last[key]) < cooldown {
+		return false
+	}
+	l.last[key] = time.Now()
+	return true
+}
+
+func (l *memoryLimiter) Cooling(key string, cooldown time.Duration) bool {
+	l.Lock()
+	defer l.Unlock()
+	return time.Since(l.last[key]) < cooldown
+}
+
+func (l *memoryLimiter) Pause(key string, until time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+	if !until.After(l.until[key]) {
+		return false
+	}
+	l.until[key] = until
+	return true
+}
+
+func (l *memoryLimiter) PausedFor(key string) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	return time.Until(l.until[key])
+}
+
+// takeCooldown reports whether an automatic verdict may be sent in chat now
+// and, if so, starts the chat's cooldown. Only groups have a cooldown.
+func takeCooldown(chat types.JID, settings *ChatSettings) bool {
+	if settings.Cooldown <= 0 || chat.Server != types.GroupServer {
+		return true
+	}
+	return limiter.Take("cooldown:"+chat.ToNonAD().String(), settings.Cooldown)
+}
+
+// onCooldown reports whether chat is in its cooldown, without starting one
+func onCooldown(chat types.JID, settings *ChatSettings) bool {
+	if settings.Cooldown <= 0 || chat.Server != types.GroupServer {
+		return false
+	}
+	return limiter.Cooling("cooldown:"+chat.ToNonAD().String(), settings.Cooldown)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// crisisStateKey is the bot_state row holding the crisis mode state
+const crisisStateKey = "crisis"
+
+func init() {
+	registerCommand("crisis", &Command{
+		Usage:   "/crisis [on [reason] | off]",
+		Help:    "Show or toggle crisis mode for high-misinformation periods",
+		Role:    roleOwner,
+		Handler: cmdCrisis,
+	})
+}
+
+// CrisisState is whether crisis mode is on, and who turned it on and why
+type CrisisState struct {
+	Active bool      `json:"active"`
+	Reason string    `json:"reason,omitempty"`
+	By     string    `json:"by,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// crisis holds the current crisis mode state, loaded from the database at startup
+var crisis struct {
+	sync.Mutex
+	state CrisisState
+}
+
+// crisisWorkers counts the extra queue workers running for crisis mode
+var crisisWorkers atomic.Int32
+
+// inCrisis reports whether crisis mode is on
+func inCrisis() bool {
+	crisis.Lock()
+	defer crisis.Unlock()
+	return crisis.state.Active
+}
+
+// setState stores a value in the bot_state table
+func (s *Store) setState(key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO bot_state (key, value, updated_at) VALUES (?, ?, ?)
+		 ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		key, string(data), time.Now().Unix(),
+	)
+	return err
+}
+
+// getState loads a value from the bot_state table, reporting whether it was set
+func (s *Store) getState(key string, value any) (bool, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT value FROM bot_state WHERE key = ?`, key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+// loadCrisisState restores crisis mode after a restart
+func loadCrisisState() {
+	var state CrisisState
+	if _, err := botStore.getState(crisisStateKey, &state); err != nil {
+		fmt.Printf("Error loading crisis mode: %v\n", err)
+		return
+	}
+	crisis.Lock()
+	crisis.state = state
+	crisis.Unlock()
+	if state.Active {
+		fmt.Printf("Crisis mode is on (since %s)\n", state.Since.Format(time.RFC3339))
+		startCrisisWorkers()
+	}
+}
+
+// refreshCrisisState picks up crisis mode turned on or off by another
+// instance sharing the database
+func refreshCrisisState() {
+	var state CrisisState
+	if _, err := botStore.getState(crisisStateKey, &state); err != nil {
+		fmt.Printf("Error loading crisis mode: %v\n", err)
+		return
+	}
+	crisis.Lock()
+	changed := state.Active != crisis.state.Active
+	crisis.state = state
+	crisis.Unlock()
+	if changed && state.Active {
+		fmt.Printf("Crisis mode turned on by another instance\n")
+		startCrisisWorkers()
+	}
+}
+
+// setCrisis turns crisis mode on or off and persists it
+func setCrisis(state CrisisState, actor string) error {
+	if err := botStore.setState(crisisStateKey, state); err != nil {
+		return err
+	}
+	crisis.Lock()
+	old := crisis.state
+	crisis.state = state
+	crisis.Unlock()
+	botStore.audit(actor, types.JID{}, "crisis", "", old, state)
+	if state.Active {
+		startCrisisWorkers()
+	}
+	return nil
+}
+
+// startCrisisWorkers tops the extra queue workers up to config.CrisisWorkers;
+// each exits after its next message once crisis mode is off
+func startCrisisWorkers() {
+	for crisisWorkers.Load() < int32(config.CrisisWorkers) {
+		crisisWorkers.Add(1)
+		go func() {
+			defer crisisWorkers.Add(-1)
+			runWorker(inCrisis)
+		}()
+	}
+}
+
+// applyCrisis adjusts a chat's effective settings while crisis mode is on:
+// short verdicts, a lower confidence threshold and a shorter cooldown
+func applyCrisis(settings *ChatSettings) {
+	if !inCrisis() {
+		return
+	}
+	settings.Verbosity = verbosityShort
+	if settings.Threshold > config.CrisisThreshold {
+		settings.Threshold = config.CrisisThreshold
+	}
+	if settings.Cooldown > config.CrisisCooldown {
+		settings.Cooldown = config.CrisisCooldown
+	}
+}
+
+func cmdCrisis(evt *events.Message, args []string) {
+	if len(args) == 0 {
+		crisis.Lock()
+		state := crisis.state
+		crisis.Unlock()
+		if !state.Active {
+			sendMessage(evt, "🟢 Crisis mode is off. Send /crisis on [reason] to turn it on.")
+			return
+		}
+		text := fmt.Sprintf("🚨 *Crisis mode is on* since %s", state.Since.In(config.TimeZone).Format("2 Jan 15:04"))
+		if state.Reason != "" {
+			text += "\n" + state.Reason
+		}
+		sendMessage(evt, text+"\n\nSend /crisis off to end it.")
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "on":
+		state := CrisisState{
+			Active: true,
+			Reason: strings.Join(args[1:], " "),
+			By:     evt.Info.Sender.ToNonAD().String(),
+			Since:  time.Now(),
+		}
+		if err := setCrisis(state, actorOf(evt.Info)); err != nil {
+			fmt.Printf("Error saving crisis mode: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not turn on crisis mode.")
+			return
+		}
+		metrics.inc("crisis_started")
+		sendMessage(evt, fmt.Sprintf("🚨 *Crisis mode on.*\n\n"+
+			"• Short verdicts in every chat\n"+
+			"• Auto-reply threshold lowered to %.0f%%\n"+
+			"• Group cooldown at most %s\n"+
+			"• %d extra workers\n"+
+			"• Trend alerts every %s to all active chats",
+			config.CrisisThreshold*100, config.CrisisCooldown, config.CrisisWorkers, config.CrisisTrendsPollInterval))
+	case "off":
+		if err := setCrisis(CrisisState{}, actorOf(evt.Info)); err != nil {
+			fmt.Printf("Error saving crisis mode: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not turn off crisis mode.")
+			return
+		}
+		sendMessage(evt, "🟢 Crisis mode off. Chats are back to their own settings.")
+	default:
+		sendMessage(evt, "Usage: /crisis [on [reason] | off]")
+	}
+}
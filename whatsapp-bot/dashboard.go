@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"runtime"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+//go:embed web/dashboard.html
+var dashboardFS embed.FS
+
+var dashboardTemplate = template.Must(template.New("dashboard.html").Funcs(template.FuncMap{
+	"percent": func(f float64) string { return fmt.Sprintf("%.0f%%", f*100) },
+	"list":    func(items ...string) []string { return items },
+}).ParseFS(dashboardFS, "web/dashboard.html"))
+
+// recentVerdictLimit is how many history rows the dashboard shows
+const recentVerdictLimit = 25
+
+// RecentVerdict is a history row shown on the dashboard
+type RecentVerdict struct {
+	Time             time.Time `json:"time"`
+	Chat             string    `json:"chat"`
+	Kind             string    `json:"kind"`
+	IsNews           bool      `json:"is_news"`
+	IsMisinformation bool      `json:"is_misinformation"`
+	Confidence       float64   `json:"confidence"`
+	Summary          string    `json:"summary"`
+}
+
+// ChatStatus is a known chat and its current mode
+type ChatStatus struct {
+	Chat string `json:"chat"`
+	Mode string `json:"mode"`
+}
+
+// DashboardState is everything the dashboard shows, also served as JSON
+type DashboardState struct {
+	Connected      bool             `json:"connected"`
+	LoggedIn       bool             `json:"logged_in"`
+	Uptime         string           `json:"uptime"`
+	Goroutines     int              `json:"goroutines"`
+	PendingReplies int              `json:"pending_replies"`
+	CacheEntries   int              `json:"cache_entries"`
+	ErrorRate      float64          `json:"error_rate"`
+	Counters       map[string]int64 `json:"counters"`
+	Recent         []RecentVerdict  `json:"recent"`
+	Chats          []ChatStatus     `json:"chats"`
+}
+
+// recentVerdicts returns the latest analysis history rows
+func (s *Store) recentVerdicts(limit int) ([]RecentVerdict, error) {
+	rows, err := s.db.Query(
+		`SELECT created_at, chat, kind, is_news, is_misinformation, confidence, COALESCE(summary, '')
+		FROM analysis_history ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []RecentVerdict
+	for rows.Next() {
+		var v RecentVerdict
+		var createdAt int64
+		if err := rows.Scan(&createdAt, &v.Chat, &v.Kind, &v.IsNews, &v.IsMisinformation, &v.Confidence, &v.Summary); err != nil {
+			return nil, err
+		}
+		v.Time = time.Unix(createdAt, 0).In(config.TimeZone)
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// knownChats lists every chat the bot has greeted or has settings for,
+// leaving out groups it has been removed from
+func (s *Store) knownChats() ([]types.JID, error) {
+	rows, err := s.db.Query(`SELECT chat FROM (SELECT chat FROM onboarded_chats UNION SELECT chat FROM chat_settings)
+		WHERE chat NOT IN (SELECT chat FROM group_membership WHERE active = 0) ORDER BY chat`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chats []types.JID
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		if jid, err := types.ParseJID(raw); err == nil {
+			chats = append(chats, jid)
+		}
+	}
+	return chats, rows.Err()
+}
+
+// countPendingReplies returns how many replies are queued for quiet hours
+func (s *Store) countPendingReplies() int {
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM pending_replies`).Scan(&n); err != nil {
+		fmt.Printf("Error counting pending replies: %v\n", err)
+	}
+	return n
+}
+
+// dashboardState gathers the current state for the dashboard
+func dashboardState() (*DashboardState, error) {
+	counters := metrics.snapshot()
+	state := &DashboardState{
+		Connected:      client.IsConnected(),
+		LoggedIn:       client.IsLoggedIn(),
+		Uptime:         time.Since(startedAt).Round(time.Second).String(),
+		Goroutines:     runtime.NumGoroutine(),
+		PendingReplies: botStore.countPendingReplies(),
+		CacheEntries:   verdictCache.Len(),
+		Counters:       counters,
+	}
+	if analyzed := counters["analyzed_text"] + counters["analyzed_image"] + counters["backend_error"]; analyzed > 0 {
+		state.ErrorRate = float64(counters["backend_error"]) / float64(analyzed)
+	}
+
+	var err error
+	if state.Recent, err = botStore.recentVerdicts(recentVerdictLimit); err != nil {
+		return nil, err
+	}
+	chats, err := botStore.knownChats()
+	if err != nil {
+		return nil, err
+	}
+	for _, chat := range chats {
+		state.Chats = append(state.Chats, ChatStatus{Chat: chat.String(), Mode: botStore.getChatSettings(chat).Mode})
+	}
+	return state, nil
+}
+
+// requireDashboardAuth checks the dashboard token, accepted as a bearer token
+// or as the password of HTTP basic auth so it works from a browser
+func requireDashboardAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if _, password, ok := r.BasicAuth(); ok {
+			token = password
+		} else if h := r.Header.Get("Authorization"); len(h) > 7 && h[:7] == "Bearer " {
+			token = h[7:]
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.DashboardToken.Get())) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Aletheia"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func handleDashboard(w http.ResponseWriter, r *http.Request) {
+	state, err := dashboardState()
+	if err != nil {
+		fmt.Printf("Error building dashboard state: %v\n", err)
+		http.Error(w, "failed to load state", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, state); err != nil {
+		fmt.Printf("Error rendering dashboard: %v\n", err)
+	}
+}
+
+func handleDashboardState(w http.ResponseWriter, r *http.Request) {
+	state, err := dashboardState()
+	if err != nil {
+		fmt.Printf("Error building dashboard state: %v\n", err)
+		http.Error(w, "failed to load state", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// handleDashboardMode changes a chat's mode from the dashboard's toggles
+func handleDashboardMode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Browsers resend basic auth on cross-site form posts, so check where the post came from
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+	}
+	chat, err := types.ParseJID(r.FormValue("chat"))
+	if err != nil {
+		http.Error(w, "invalid chat", http.StatusBadRequest)
+		return
+	}
+	values, err := parseSetting("mode", []string{r.FormValue("mode")})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := botStore.updateChatSettings(chat, values, actorDashboard); err != nil {
+		fmt.Printf("Error saving settings from dashboard: %v\n", err)
+		http.Error(w, "failed to save", http.StatusInternalServerError)
+		return
+	}
+	fmt.Printf("Dashboard set mode of %s to %s\n", chat, r.FormValue("mode"))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// dashboardMux holds the dashboard's routes; other operator endpoints register here too
+var dashboardMux = http.NewServeMux()
+
+// startDashboard serves the operator dashboard when DASHBOARD_ADDR and DASHBOARD_TOKEN are set
+func startDashboard() {
+	if config.DashboardAddr == "" {
+		return
+	}
+	if config.DashboardToken.Get() == "" {
+		fmt.Println("DASHBOARD_ADDR is set but DASHBOARD_TOKEN is empty, not starting the dashboard")
+		return
+	}
+
+	dashboardMux.HandleFunc("/", requireDashboardAuth(handleDashboard))
+	dashboardMux.HandleFunc("/api/state", requireDashboardAuth(handleDashboardState))
+	dashboardMux.HandleFunc("/chats/mode", requireDashboardAuth(handleDashboardMode))
+	registerChatLinkRoutes()
+	if config.DebugEndpoints {
+		registerDebugEndpoints()
+	}
+
+	go func() {
+		fmt.Printf("📊 Dashboard listening on %s\n", config.DashboardAddr)
+		if err := http.ListenAndServe(config.DashboardAddr, dashboardMux); err != nil {
+			fmt.Printf("Dashboard server stopped: %v\n", err)
+		}
+	}()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver opens SQLite databases, unlocking them first with
+// DB_ENCRYPTION_KEY when it's set. Encryption needs a build linked against
+// SQLCipher instead of SQLite (go build -tags libsqlite3 with SQLCipher
+// installed as the system SQLite library).
+const sqliteDriver = "sqlite3_aletheia"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			key, err := databaseKey()
+			if err != nil || key == "" {
+				return err
+			}
+			_, err = conn.Exec("PRAGMA key = "+quoteSQL(key), nil)
+			return err
+		},
+	})
+	registerSubcommand("encrypt-db", &Subcommand{
+		Usage: "encrypt-db [DATABASE...]",
+		Help:  "Encrypt plain-text databases with DB_ENCRYPTION_KEY",
+		Run:   runEncryptDB,
+	})
+}
+
+// databaseKey returns the database encryption key, from DB_ENCRYPTION_KEY or
+// the file named by DB_ENCRYPTION_KEY_FILE (e.g. written by a KMS agent)
+var databaseKey = sync.OnceValues(func() (string, error) {
+	if config.DBEncryptionKey.Get() != "" || config.DBEncryptionKeyFile == "" {
+		return config.DBEncryptionKey.Get(), nil
+	}
+	data, err := os.ReadFile(config.DBEncryptionKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read database key: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+})
+
+// quoteSQL quotes s as an SQL string literal
+func quoteSQL(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// openDatabase opens the SQLite database dsn, making sure it's really
+// encrypted when a key is configured: without SQLCipher, PRAGMA key is
+// silently ignored and the data would be written in plain text.
+func openDatabase(dsn string) (*sql.DB, error) {
+	key, err := databaseKey()
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(sqliteDriver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return db, nil
+	}
+	var cipher string
+	if err := db.QueryRow(`PRAGMA cipher_version`).Scan(&cipher); err != nil || cipher == "" {
+		db.Close()
+		return nil, fmt.Errorf("DB_ENCRYPTION_KEY is set but this build has no SQLCipher support")
+	}
+	// Reading the schema fails with a wrong key or a database still in plain text
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master`).Scan(&tables); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot unlock database (wrong key, or not encrypted yet: run encrypt-db): %w", err)
+	}
+	return db, nil
+}
+
+// runEncryptDB encrypts existing plain-text databases in place with
+// DB_ENCRYPTION_KEY, for deployments turning encryption on
+func runEncryptDB(args []string) int {
+	if len(args) == 0 {
+		args = []string{config.SessionDBPath, config.BotDBPath}
+	}
+	key, err := databaseKey()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if key == "" {
+		fmt.Println("Set DB_ENCRYPTION_KEY or DB_ENCRYPTION_KEY_FILE first")
+		return 2
+	}
+	for _, path := range args {
+		if err := encryptDatabase(path, key); err != nil {
+			fmt.Printf("Error encrypting %s: %v\n", path, err)
+			return 1
+		}
+		fmt.Printf("Encrypted %s\n", path)
+	}
+	return 0
+}
+
+// encryptDatabase copies the plain-text database at path into an encrypted
+// one and swaps it in, keeping the original as path.plain
+func encryptDatabase(path, key string) error {
+	plain, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		return err
+	}
+	defer plain.Close()
+	// ATTACH only applies to the connection it runs on
+	plain.SetMaxOpenConns(1)
+	var cipher string
+	if err := plain.QueryRow(`PRAGMA cipher_version`).Scan(&cipher); err != nil || cipher == "" {
+		return fmt.Errorf("this build has no SQLCipher support")
+	}
+
+	encrypted := path + ".encrypted"
+	os.Remove(encrypted)
+	if _, err := plain.Exec(`ATTACH DATABASE ` + quoteSQL(encrypted) + ` AS encrypted KEY ` + quoteSQL(key)); err != nil {
+		return err
+	}
+	if _, err := plain.Exec(`SELECT sqlcipher_export('encrypted')`); err != nil {
+		return err
+	}
+	if _, err := plain.Exec(`DETACH DATABASE encrypted`); err != nil {
+		return err
+	}
+	plain.Close()
+
+	if err := os.Rename(path, path+".plain"); err != nil {
+		return err
+	}
+	return os.Rename(encrypted, path)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// DebugState is the runtime snapshot served at /debug/state
+type DebugState struct {
+	Uptime     string `json:"uptime"`
+	Connected  bool   `json:"connected"`
+	BanRisk    string `json:"ban_risk"`
+	Goroutines int    `json:"goroutines"`
+	Memory     struct {
+		AllocBytes uint64 `json:"alloc_bytes"`
+		SysBytes   uint64 `json:"sys_bytes"`
+		NumGC      uint32 `json:"num_gc"`
+	} `json:"memory"`
+	Queues struct {
+		PendingReplies       int `json:"pending_replies"`
+		PendingBroadcasts    int `json:"pending_broadcasts"`
+		FollowUpContexts     int `json:"followup_contexts"`
+		PendingConfirmations int `json:"pending_confirmations"`
+		DeferredMessages     int `json:"deferred_messages"`
+		DeadLetters          int `json:"dead_letters"`
+		PriorityMessages     int `json:"priority_messages"`
+		PassiveMessages      int `json:"passive_messages"`
+		OutgoingMessages     int `json:"outgoing_messages"`
+		Outbox               int `json:"outbox"`
+	} `json:"queues"`
+	Caches struct {
+		Verdicts int `json:"verdicts"`
+		Hoaxes   int `json:"hoaxes"`
+	} `json:"caches"`
+	Connection   ConnectionState  `json:"connection"`
+	Counters     map[string]int64 `json:"counters"`
+	RecentErrors []RecentError    `json:"recent_errors"`
+}
+
+// debugState collects the runtime snapshot
+func debugState() *DebugState {
+	state := &DebugState{
+		Uptime:       time.Since(startedAt).Round(time.Second).String(),
+		Connected:    client.IsConnected(),
+		BanRisk:      banRiskState(),
+		Connection:   connectionState(),
+		Goroutines:   runtime.NumGoroutine(),
+		Counters:     metrics.snapshot(),
+		RecentErrors: metrics.recentErrors(),
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	state.Memory.AllocBytes = mem.Alloc
+	state.Memory.SysBytes = mem.Sys
+	state.Memory.NumGC = mem.NumGC
+
+	state.Queues.PendingReplies = botStore.countPendingReplies()
+	state.Queues.PriorityMessages, state.Queues.PassiveMessages = messageQueue.depth()
+	state.Queues.DeferredMessages = botStore.countDeferred()
+	state.Queues.OutgoingMessages = sendQueue.depth()
+	state.Queues.Outbox = botStore.countOutgoing()
+	botStore.db.QueryRow(`SELECT COUNT(*) FROM dead_letters`).Scan(&state.Queues.DeadLetters)
+	if pending, err := botStore.pendingBroadcasts(); err == nil {
+		state.Queues.PendingBroadcasts = len(pending)
+	}
+	conversations.Lock()
+	state.Queues.FollowUpContexts = len(conversations.byChat)
+	conversations.Unlock()
+	confirmations.Lock()
+	state.Queues.PendingConfirmations = len(confirmations.pending)
+	confirmations.Unlock()
+
+	state.Caches.Verdicts = verdictCache.Len()
+	hoaxList.Lock()
+	state.Caches.Hoaxes = len(hoaxList.hoaxes)
+	hoaxList.Unlock()
+	return state
+}
+
+func handleDebugState(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(debugState()); err != nil {
+		fmt.Printf("Error writing debug state: %v\n", err)
+	}
+}
+
+// registerDebugEndpoints adds /debug/state and the pprof handlers to the
+// dashboard server, behind the same token
+func registerDebugEndpoints() {
+	dashboardMux.HandleFunc("/debug/state", requireDashboardAuth(handleDebugState))
+	dashboardMux.HandleFunc("/debug/pprof/", requireDashboardAuth(pprof.Index))
+	dashboardMux.HandleFunc("/debug/pprof/cmdline", requireDashboardAuth(pprof.Cmdline))
+	dashboardMux.HandleFunc("/debug/pprof/profile", requireDashboardAuth(pprof.Profile))
+	dashboardMux.HandleFunc("/debug/pprof/symbol", requireDashboardAuth(pprof.Symbol))
+	dashboardMux.HandleFunc("/debug/pprof/trace", requireDashboardAuth(pprof.Trace))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// disappearingMessenger sends replies to chats with disappearing messages on
+// with the chat's timer, so they vanish along with the messages they answer
+type disappearingMessenger struct {
+	Messenger
+}
+
+func (m disappearingMessenger) SendMessage(ctx context.Context, to types.JID, msg *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	if botStore != nil {
+		if timer, settingAt := botStore.disappearingTimer(to); timer > 0 {
+			msg = withExpiration(msg, timer, settingAt)
+		}
+	}
+	return m.Messenger.SendMessage(ctx, to, msg, extra...)
+}
+
+// withExpiration sets a disappearing timer on an outgoing message. Plain text
+// becomes extended text, which can carry one; reactions, edits and other
+// messages without a context are sent as they are.
+func withExpiration(msg *waE2E.Message, timer uint32, settingAt int64) *waE2E.Message {
+	if msg.Conversation != nil {
+		msg = &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{Text: msg.Conversation}}
+	}
+	if info := messageContextInfo(msg, true); info != nil {
+		info.Expiration = proto.Uint32(timer)
+		if settingAt > 0 {
+			info.EphemeralSettingTimestamp = proto.Int64(settingAt)
+		}
+	}
+	return msg
+}
+
+// messageContextInfo returns the context info of whichever kind of message
+// msg holds, creating an empty one when create is set and it has none
+func messageContextInfo(msg *waE2E.Message, create bool) *waE2E.ContextInfo {
+	var found *waE2E.ContextInfo
+	contextInfoName := (&waE2E.ContextInfo{}).ProtoReflect().Descriptor().FullName()
+	msg.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return true
+		}
+		inner := v.Message()
+		field := inner.Descriptor().Fields().ByName("contextInfo")
+		if field == nil || field.Message() == nil || field.Message().FullName() != contextInfoName {
+			return true
+		}
+		if inner.Has(field) || create {
+			found = inner.Mutable(field).Message().Interface().(*waE2E.ContextInfo)
+		}
+		return false
+	})
+	return found
+}
+
+// noteDisappearing keeps track of each chat's disappearing-message timer,
+// from timer changes and from the expiration every message in such a chat
+// carries. Messages without a context say nothing either way.
+func noteDisappearing(evt *events.Message) {
+	chat := evt.Info.Chat
+	if protocol := evt.Message.GetProtocolMessage(); protocol.GetType() == waE2E.ProtocolMessage_EPHEMERAL_SETTING {
+		botStore.setDisappearingTimer(chat, protocol.GetEphemeralExpiration(), evt.Info.Timestamp.Unix())
+		return
+	}
+	info := messageContextInfo(evt.Message, false)
+	if info == nil {
+		return
+	}
+	timer := info.GetExpiration()
+	if current, _ := botStore.disappearingTimer(chat); current != timer {
+		botStore.setDisappearingTimer(chat, timer, info.GetEphemeralSettingTimestamp())
+	}
+}
+
+// noteGroupEphemeral records a group's disappearing-message setting from its
+// group info
+func noteGroupEphemeral(chat types.JID, setting types.GroupEphemeral) {
+	timer := uint32(0)
+	if setting.IsEphemeral {
+		timer = setting.DisappearingTimer
+	}
+	botStore.setDisappearingTimer(chat, timer, time.Now().Unix())
+}
+
+// isDisappearingChat reports whether chat has disappearing messages on, in
+// which case its content isn't archived or kept
+func isDisappearingChat(chat types.JID) bool {
+	timer, _ := botStore.disappearingTimer(chat)
+	return timer > 0
+}
+
+// setDisappearingTimer records chat's disappearing-message timer in seconds,
+// 0 meaning off, and when it was set
+func (s *Store) setDisappearingTimer(chat types.JID, timer uint32, settingAt int64) {
+	var err error
+	if timer == 0 {
+		_, err = s.db.Exec(`DELETE FROM disappearing_chats WHERE chat = ?`, chat.ToNonAD().String())
+	} else {
+		_, err = s.db.Exec(
+			`INSERT INTO disappearing_chats (chat, timer, setting_at, updated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (chat) DO UPDATE SET timer = excluded.timer, setting_at = excluded.setting_at, updated_at = excluded.updated_at`,
+			chat.ToNonAD().String(), timer, settingAt, time.Now().Unix(),
+		)
+	}
+	if err != nil {
+		fmt.Printf("Error recording disappearing messages for %s: %v\n", chat, err)
+	}
+}
+
+// disappearingTimer returns chat's disappearing-message timer in seconds, 0
+// when it's off, and when it was set
+func (s *Store) disappearingTimer(chat types.JID) (uint32, int64) {
+	var timer uint32
+	var settingAt int64
+	err := s.db.QueryRow(`SELECT timer, setting_at FROM disappearing_chats WHERE chat = ?`, chat.ToNonAD().String()).Scan(&timer, &settingAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("Error loading disappearing messages for %s: %v\n", chat, err)
+	}
+	return timer, settingAt
+}
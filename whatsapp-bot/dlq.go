@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxListedDeadLetters is how many entries /dlq list shows
+const maxListedDeadLetters = 20
+
+func init() {
+	registerCommand("dlq", &Command{
+		Usage:   "/dlq list | retry <id>",
+		Help:    "Show or re-run analyses that failed after all retries",
+		Role:    roleAdmin,
+		Handler: cmdDLQ,
+	})
+}
+
+// DeadLetter is a message whose analysis failed after all retries
+type DeadLetter struct {
+	ID        int64
+	Chat      string
+	Preview   string
+	Error     string
+	CreatedAt time.Time
+}
+
+// deadLetter stores a message whose analysis failed so it can be retried later
+func (s *Store) deadLetter(evt *events.Message, cause error) {
+	message, err := proto.Marshal(evt.Message)
+	if err != nil {
+		fmt.Printf("Error encoding dead-lettered message: %v\n", err)
+		return
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO dead_letters (chat, sender, message_id, push_name, message, error, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		evt.Info.Chat.String(), evt.Info.Sender.String(), evt.Info.ID, evt.Info.PushName, message, cause.Error(), time.Now().Unix(),
+	)
+	if err != nil {
+		fmt.Printf("Error dead-lettering message: %v\n", err)
+		return
+	}
+	metrics.inc("dead_lettered")
+}
+
+// deadLetters returns the most recent dead letters, newest first
+func (s *Store) deadLetters(limit int) ([]DeadLetter, error) {
+	rows, err := s.db.Query(
+		`SELECT id, chat, message, error, created_at FROM dead_letters ORDER BY id DESC LIMIT ?`, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DeadLetter
+	for rows.Next() {
+		var (
+			d         DeadLetter
+			raw       []byte
+			createdAt int64
+		)
+		if err := rows.Scan(&d.ID, &d.Chat, &raw, &d.Error, &createdAt); err != nil {
+			return nil, err
+		}
+		d.CreatedAt = time.Unix(createdAt, 0)
+		if evt, err := decodeEvent(d.Chat, d.Chat, "", "", raw, d.CreatedAt); err == nil {
+			d.Preview = checkedText(evt)
+			if d.Preview == "" && evt.Message.GetImageMessage() != nil {
+				d.Preview = "[image]"
+			}
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// takeDeadLetter removes dead letter id and returns its message event
+func (s *Store) takeDeadLetter(id int64) (*events.Message, error) {
+	var (
+		chat, sender, messageID, pushName string
+		raw                               []byte
+		createdAt                         int64
+	)
+	err := s.db.QueryRow(
+		`SELECT chat, sender, message_id, push_name, message, created_at FROM dead_letters WHERE id = ?`, id,
+	).Scan(&chat, &sender, &messageID, &pushName, &raw, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.db.Exec(`DELETE FROM dead_letters WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return decodeEvent(chat, sender, messageID, pushName, raw, time.Unix(createdAt, 0))
+}
+
+func cmdDLQ(evt *events.Message, args []string) {
+	if len(args) == 0 {
+		sendMessage(evt, "Usage: /dlq list | retry <id>")
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "list":
+		letters, err := botStore.deadLetters(maxListedDeadLetters)
+		if err != nil {
+			fmt.Printf("Error loading dead letters: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not load the dead-letter queue.")
+			return
+		}
+		if len(letters) == 0 {
+			sendMessage(evt, "📭 The dead-letter queue is empty.")
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("🪦 *Failed analyses*\n")
+		for _, d := range letters {
+			preview := []rune(d.Preview)
+			if len(preview) > 40 {
+				preview = append(preview[:40], '…')
+			}
+			sb.WriteString(fmt.Sprintf("\n#%d %s in %s: %s\n   %s",
+				d.ID, d.CreatedAt.In(config.TimeZone).Format("2 Jan 15:04"), d.Chat, string(preview), d.Error))
+		}
+		sendMessage(evt, sb.String())
+
+	case "retry":
+		if len(args) < 2 {
+			sendMessage(evt, "Usage: /dlq retry <id>")
+			return
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(args[1], "#"), 10, 64)
+		if err != nil {
+			sendMessage(evt, fmt.Sprintf("❌ Invalid dead letter id %q", args[1]))
+			return
+		}
+		failed, err := botStore.takeDeadLetter(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			sendMessage(evt, fmt.Sprintf("ℹ️ No dead letter #%d.", id))
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error loading dead letter %d: %v\n", id, err)
+			sendMessage(evt, "❌ *Error*\n\nCould not load the dead letter.")
+			return
+		}
+		sendMessage(evt, fmt.Sprintf("🔁 Retrying #%d in %s.", id, failed.Info.Chat))
+		// A retry that fails again is dead-lettered under a new id
+		go handleMessage(failed)
+
+	default:
+		sendMessage(evt, "Usage: /dlq list | retry <id>")
+	}
+}
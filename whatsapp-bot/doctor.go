@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+func init() {
+	registerSubcommand("doctor", &Subcommand{
+		Usage: "doctor",
+		Help:  "Check the configuration, databases, backend and tools without connecting",
+		Run:   runDoctor,
+	})
+}
+
+// runDoctor checks what the bot needs before it can start, printing one line
+// per check, and fails if any check fails
+func runDoctor(args []string) int {
+	failed := 0
+	check := func(name string, fn func() (string, error)) {
+		detail, err := fn()
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", name, err)
+			failed++
+			return
+		}
+		if detail != "" {
+			fmt.Printf("✅ %s: %s\n", name, detail)
+		} else {
+			fmt.Printf("✅ %s\n", name)
+		}
+	}
+
+	if config.DataDir != "" {
+		check("Data directory", func() (string, error) {
+			f, err := os.CreateTemp(config.DataDir, ".doctor-*")
+			if err != nil {
+				return "", fmt.Errorf("not writable: %w", err)
+			}
+			f.Close()
+			return config.DataDir, os.Remove(f.Name())
+		})
+	}
+	check("WhatsApp session", func() (string, error) {
+		device, err := openDevice()
+		if err != nil {
+			return "", err
+		}
+		if device.ID == nil {
+			return "", fmt.Errorf("not logged in, run: whatsapp-bot login")
+		}
+		return "logged in as " + device.ID.ToNonAD().String(), nil
+	})
+	check("Bot database", func() (string, error) {
+		if err := openBotStore(); err != nil {
+			return "", err
+		}
+		version, err := schemaVersion(botStore.db)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("schema version %d", version), botStore.checkWritable()
+	})
+	if botStore != nil {
+		defer botStore.Close()
+	}
+	check("Backend", func() (string, error) {
+		latency, err := pingBackend()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s in %s", backendURL(), latency.Round(time.Millisecond)), nil
+	})
+	check("Cache store", func() (string, error) {
+		return config.CacheStore, openCacheStore()
+	})
+	check("Resources", func() (string, error) {
+		return config.ResourcesPath, loadResources(config.ResourcesPath)
+	})
+	check("Response templates", func() (string, error) {
+		return "", loadResponseTemplates(config.ResponseTemplateDir)
+	})
+	if config.MediaAnalysis {
+		check("ffmpeg", func() (string, error) {
+			return exec.LookPath(config.FFmpegPath)
+		})
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%d check(s) failed\n", failed)
+		return 1
+	}
+	fmt.Println("\nAll checks passed")
+	return 0
+}
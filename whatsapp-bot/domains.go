@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// domainFileEditor marks reputation rows imported from the reputation file;
+// rows set with /domain override them and survive re-imports
+const domainFileEditor = "file"
+
+func init() {
+	registerCommand("domain", &Command{
+		Usage:   "/domain <domain> [high|medium|low [note] | remove] | list",
+		Help:    "Show or set a news domain's credibility tier",
+		Role:    roleAdmin,
+		Handler: cmdDomain,
+	})
+}
+
+// DomainReputation is the credibility tier of a news domain
+type DomainReputation struct {
+	Domain    string
+	Tier      string // high, medium or low
+	Note      string
+	UpdatedBy string
+	UpdatedAt time.Time
+}
+
+// normalizeDomain lowercases a domain or URL host and strips a leading www.
+func normalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if strings.Contains(domain, "://") {
+		domain = linkHost(domain)
+	}
+	return strings.TrimPrefix(strings.TrimSuffix(domain, "."), "www.")
+}
+
+// setDomainReputation stores the tier of domain, replacing any previous one
+func (s *Store) setDomainReputation(domain, tier, note, updatedBy string) error {
+	_, err := s.db.Exec(
+		`INSERT INTO domain_reputation (domain, tier, note, updated_by, updated_at) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (domain) DO UPDATE SET tier = excluded.tier, note = excluded.note, updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+		domain, tier, note, updatedBy, time.Now().Unix(),
+	)
+	return err
+}
+
+// removeDomainReputation deletes domain's tier, reporting whether it had one
+func (s *Store) removeDomainReputation(domain string) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM domain_reputation WHERE domain = ?`, domain)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// domainReputation returns the tier of host or its closest rated parent domain
+func (s *Store) domainReputation(host string) (*DomainReputation, error) {
+	for host = normalizeDomain(host); host != ""; {
+		var (
+			r         DomainReputation
+			updatedAt int64
+		)
+		err := s.db.QueryRow(
+			`SELECT domain, tier, note, updated_by, updated_at FROM domain_reputation WHERE domain = ?`, host,
+		).Scan(&r.Domain, &r.Tier, &r.Note, &r.UpdatedBy, &updatedAt)
+		if err == nil {
+			r.UpdatedAt = time.Unix(updatedAt, 0)
+			return &r, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok || !strings.Contains(parent, ".") {
+			break
+		}
+		host = parent
+	}
+	return nil, nil
+}
+
+// domainReputations returns the rated domains of tier (or all tiers when empty)
+func (s *Store) domainReputations(tier string) ([]DomainReputation, error) {
+	rows, err := s.db.Query(
+		`SELECT domain, tier, note, updated_by, updated_at FROM domain_reputation WHERE ? = '' OR tier = ? ORDER BY tier, domain`, tier, tier,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DomainReputation
+	for rows.Next() {
+		var (
+			r         DomainReputation
+			updatedAt int64
+		)
+		if err := rows.Scan(&r.Domain, &r.Tier, &r.Note, &r.UpdatedBy, &updatedAt); err != nil {
+			return nil, err
+		}
+		r.UpdatedAt = time.Unix(updatedAt, 0)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// importDomainReputation loads the reputation file (one "domain tier [note]"
+// per line, # comments) into the table. Domains set with /domain keep their
+// admin-set tier.
+func (s *Store) importDomainReputation(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	imported := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		tier := strings.ToLower(fields[1])
+		if tier != credibilityHigh && tier != credibilityMedium && tier != credibilityLow {
+			fmt.Printf("Skipping %s in %s: unknown tier %q\n", fields[0], path, fields[1])
+			continue
+		}
+		_, err := s.db.Exec(
+			`INSERT INTO domain_reputation (domain, tier, note, updated_by, updated_at) VALUES (?, ?, ?, ?, ?)
+			 ON CONFLICT (domain) DO UPDATE SET tier = excluded.tier, note = excluded.note, updated_at = excluded.updated_at
+			 WHERE domain_reputation.updated_by = ?`,
+			normalizeDomain(fields[0]), tier, strings.Join(fields[2:], " "), domainFileEditor, time.Now().Unix(), domainFileEditor,
+		)
+		if err != nil {
+			return err
+		}
+		imported++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	fmt.Printf("Loaded %d domain ratings from %s\n", imported, path)
+	return nil
+}
+
+// lowCredibilityLinks returns the low-credibility domains linked in text
+func lowCredibilityLinks(text string) []DomainReputation {
+	var low []DomainReputation
+	for _, link := range extractLinks(text) {
+		r, err := botStore.domainReputation(linkHost(link))
+		if err != nil {
+			fmt.Printf("Error looking up domain reputation: %v\n", err)
+			return nil
+		}
+		if r != nil && r.Tier == credibilityLow {
+			low = append(low, *r)
+		}
+	}
+	return low
+}
+
+// rateSources fills in the credibility of the backend's sources from the
+// reputation table where the backend didn't rate them
+func rateSources(result *AnalyzeResponse) {
+	for i, source := range result.SourcesChecked {
+		if source.Credibility != "" || source.URL == "" {
+			continue
+		}
+		if r, err := botStore.domainReputation(source.Host()); err == nil && r != nil {
+			result.SourcesChecked[i].Credibility = r.Tier
+		}
+	}
+}
+
+// noteLowCredibilityLinks tells the chat right away when the message links to
+// a low-credibility domain, before the full verdict arrives
+func noteLowCredibilityLinks(evt *events.Message, text string, settings *ChatSettings, explicit bool) {
+	low := lowCredibilityLinks(text)
+	if len(low) == 0 || muted(evt, settings, explicit) || (!explicit && onCooldown(evt.Info.Chat, settings)) {
+		return
+	}
+	metrics.inc("low_credibility_link")
+
+	m := messagesFor(settings.Language)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🔴 *%s*\n", m.LowCredibilityTitle)
+	for _, r := range low {
+		sb.WriteString("\n• " + fmt.Sprintf(m.LowCredibilityNote, r.Domain))
+		if r.Note != "" {
+			sb.WriteString(" (" + r.Note + ")")
+		}
+	}
+	sb.WriteString("\n\n_" + m.FullCheckPending + "_")
+	sendMessage(evt, sb.String())
+}
+
+func cmdDomain(evt *events.Message, args []string) {
+	if len(args) == 0 {
+		sendMessage(evt, "Usage: /domain <domain> [high|medium|low [note] | remove] | list")
+		return
+	}
+
+	if strings.ToLower(args[0]) == "list" {
+		tier := ""
+		if len(args) > 1 {
+			tier = strings.ToLower(args[1])
+		}
+		ratings, err := botStore.domainReputations(tier)
+		if err != nil {
+			fmt.Printf("Error loading domain ratings: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not load the domain ratings.")
+			return
+		}
+		if len(ratings) == 0 {
+			sendMessage(evt, "ℹ️ No domains are rated yet.")
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("📰 *Domain credibility*\n")
+		for _, r := range ratings {
+			sb.WriteString(fmt.Sprintf("\n%s %s", Source{Credibility: r.Tier}.CredibilityEmoji(), r.Domain))
+			if r.Note != "" {
+				sb.WriteString(" – " + r.Note)
+			}
+		}
+		sendMessage(evt, sb.String())
+		return
+	}
+
+	domain := normalizeDomain(args[0])
+	if domain == "" || !strings.Contains(domain, ".") {
+		sendMessage(evt, fmt.Sprintf("❌ Invalid domain %q", args[0]))
+		return
+	}
+
+	if len(args) == 1 {
+		r, err := botStore.domainReputation(domain)
+		switch {
+		case err != nil:
+			fmt.Printf("Error looking up domain reputation: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not look up the domain.")
+		case r == nil:
+			sendMessage(evt, fmt.Sprintf("ℹ️ %s isn't rated.", domain))
+		default:
+			text := fmt.Sprintf("%s *%s* is rated %s (set by %s on %s)", Source{Credibility: r.Tier}.CredibilityEmoji(),
+				r.Domain, r.Tier, r.UpdatedBy, r.UpdatedAt.In(config.TimeZone).Format("2 Jan 2006"))
+			if r.Note != "" {
+				text += "\n" + r.Note
+			}
+			sendMessage(evt, text)
+		}
+		return
+	}
+
+	switch tier := strings.ToLower(args[1]); tier {
+	case "remove":
+		removed, err := botStore.removeDomainReputation(domain)
+		switch {
+		case err != nil:
+			fmt.Printf("Error removing domain reputation: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not remove the rating.")
+		case !removed:
+			sendMessage(evt, fmt.Sprintf("ℹ️ %s isn't rated.", domain))
+		default:
+			sendMessage(evt, fmt.Sprintf("✅ Removed the rating of %s.", domain))
+		}
+	case credibilityHigh, credibilityMedium, credibilityLow:
+		note := strings.Join(args[2:], " ")
+		if err := botStore.setDomainReputation(domain, tier, note, evt.Info.Sender.ToNonAD().String()); err != nil {
+			fmt.Printf("Error saving domain reputation: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not save the rating.")
+			return
+		}
+		sendMessage(evt, fmt.Sprintf("✅ %s is now rated %s.", domain, tier))
+	default:
+		sendMessage(evt, "Usage: /domain <domain> [high|medium|low [note] | remove] | list")
+	}
+}
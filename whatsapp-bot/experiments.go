@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Response format variants a chat can be assigned to
+const (
+	variantFull     = "full"     // the full text verdict
+	variantShort    = "short"    // the one-paragraph verdict
+	variantCard     = "card"     // the verdict card image
+	variantReaction = "reaction" // an emoji reaction; details on /more
+)
+
+// Engagement events counted per variant
+const (
+	experimentVerdict  = "verdict"
+	experimentMore     = "more"
+	experimentFollowUp = "followup"
+	experimentPollVote = "poll_vote"
+	experimentRead     = "read" // a verdict reply read by at least one reader
+)
+
+func init() {
+	registerCommand("experiment", &Command{
+		Usage:   "/experiment",
+		Help:    "Compare engagement across response format variants",
+		Role:    roleAdmin,
+		Handler: cmdExperiment,
+	})
+}
+
+// experimentVariant returns the response format chat is assigned to in the
+// running experiment, or "" when no experiment is configured. Assignment is a
+// stable hash of the experiment name and chat, so chats keep their variant
+// across restarts and a new experiment name reshuffles them.
+func experimentVariant(chat types.JID) string {
+	if len(config.ExperimentVariants) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(config.ExperimentName + "/" + chat.String()))
+	n := binary.BigEndian.Uint64(sum[:8]) % uint64(len(config.ExperimentVariants))
+	return config.ExperimentVariants[n]
+}
+
+// parseVariants parses a comma-separated list of response format variants
+func parseVariants(spec string) []string {
+	var variants []string
+	for _, v := range strings.Split(spec, ",") {
+		switch v = strings.ToLower(strings.TrimSpace(v)); v {
+		case "":
+		case variantFull, variantShort, variantCard, variantReaction:
+			variants = append(variants, v)
+		default:
+			fmt.Printf("Ignoring unknown experiment variant %q\n", v)
+		}
+	}
+	return variants
+}
+
+// recordExperimentEvent counts an engagement event for chat's variant
+func recordExperimentEvent(chat types.JID, event string) {
+	variant := experimentVariant(chat)
+	if variant == "" {
+		return
+	}
+	_, err := botStore.db.Exec(
+		`INSERT INTO experiment_events (experiment, variant, chat, event, created_at) VALUES (?, ?, ?, ?, ?)`,
+		config.ExperimentName, variant, chat.String(), event, time.Now().Unix(),
+	)
+	if err != nil {
+		fmt.Printf("Error recording experiment event: %v\n", err)
+	}
+}
+
+// VariantStats is the engagement of one variant in an experiment
+type VariantStats struct {
+	Variant   string
+	Chats     int
+	Verdicts  int
+	More      int
+	FollowUps int
+	PollVotes int
+	Read      int
+}
+
+// EngagementRate is the engagement events per verdict sent
+func (v VariantStats) EngagementRate() float64 {
+	if v.Verdicts == 0 {
+		return 0
+	}
+	return float64(v.More+v.FollowUps+v.PollVotes) / float64(v.Verdicts)
+}
+
+// ReadRate is the share of verdict replies someone read, as far as read
+// receipts show; reactions and readers with receipts off never count
+func (v VariantStats) ReadRate() float64 {
+	if v.Verdicts == 0 {
+		return 0
+	}
+	return float64(v.Read) / float64(v.Verdicts)
+}
+
+// experimentStats aggregates the events of experiment by variant
+func (s *Store) experimentStats(experiment string) ([]VariantStats, error) {
+	rows, err := s.db.Query(`
+		SELECT variant, COUNT(DISTINCT chat),
+			SUM(CASE WHEN event = ? THEN 1 ELSE 0 END), SUM(CASE WHEN event = ? THEN 1 ELSE 0 END),
+			SUM(CASE WHEN event = ? THEN 1 ELSE 0 END), SUM(CASE WHEN event = ? THEN 1 ELSE 0 END),
+			SUM(CASE WHEN event = ? THEN 1 ELSE 0 END)
+		FROM experiment_events WHERE experiment = ?
+		GROUP BY variant ORDER BY variant`,
+		experimentVerdict, experimentMore, experimentFollowUp, experimentPollVote, experimentRead, experiment)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []VariantStats
+	for rows.Next() {
+		var v VariantStats
+		if err := rows.Scan(&v.Variant, &v.Chats, &v.Verdicts, &v.More, &v.FollowUps, &v.PollVotes, &v.Read); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func cmdExperiment(evt *events.Message, args []string) {
+	if len(config.ExperimentVariants) == 0 {
+		sendMessage(evt, "ℹ️ No experiment is running. Set EXPERIMENT_VARIANTS to start one.")
+		return
+	}
+	stats, err := botStore.experimentStats(config.ExperimentName)
+	if err != nil {
+		fmt.Printf("Error loading experiment stats: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not load experiment results.")
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🧪 *Experiment %s*\nVariants: %s\n", config.ExperimentName, strings.Join(config.ExperimentVariants, ", ")))
+	if len(stats) == 0 {
+		sb.WriteString("\nNo verdicts sent yet.")
+	}
+	for _, v := range stats {
+		sb.WriteString(fmt.Sprintf("\n*%s* (%d chats)\n   %d verdicts · %d /more · %d follow-ups · %d poll votes\n   %.2f engagements per verdict · %.0f%% read",
+			v.Variant, v.Chats, v.Verdicts, v.More, v.FollowUps, v.PollVotes, v.EngagementRate(), 100*v.ReadRate()))
+	}
+	sendMessage(evt, sb.String())
+}
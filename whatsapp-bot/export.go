@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const (
+	exportCSV   = "csv"
+	exportJSONL = "jsonl"
+)
+
+func init() {
+	registerCommand("export", &Command{
+		Usage:   "/export <YYYY-MM | YYYY-MM-DD> [csv|jsonl]",
+		Help:    "Export pseudonymized analysis history for a period",
+		Role:    roleOwner,
+		Handler: cmdExport,
+	})
+	registerSubcommand("export-history", &Subcommand{
+		Usage: "export-history [-format csv|jsonl] [-o FILE] PERIOD",
+		Help:  "Export pseudonymized analysis history for a month or day",
+		Run:   runExportHistory,
+	})
+}
+
+// HistoryRecord is one exported analysis. Chats and senders are replaced by
+// stable pseudonyms so exports can be shared with researchers.
+type HistoryRecord struct {
+	Time             string  `json:"time"`
+	Chat             string  `json:"chat"`
+	Sender           string  `json:"sender"`
+	Kind             string  `json:"kind"`
+	ClaimKey         string  `json:"claim_key"`
+	Language         string  `json:"language"`
+	IsNews           bool    `json:"is_news"`
+	IsMisinformation bool    `json:"is_misinformation"`
+	Confidence       float64 `json:"confidence"`
+	Summary          string  `json:"summary"`
+}
+
+var (
+	exportSalt     []byte
+	exportSaltOnce sync.Once
+)
+
+// pseudonym maps a JID to a stable opaque ID. Without EXPORT_SALT a random
+// salt is used, so pseudonyms only match within one run of the bot.
+func pseudonym(jid string) string {
+	exportSaltOnce.Do(func() {
+		if config.ExportSalt.Get() != "" {
+			exportSalt = []byte(config.ExportSalt.Get())
+			return
+		}
+		exportSalt = make([]byte, 32)
+		rand.Read(exportSalt)
+	})
+	mac := hmac.New(sha256.New, exportSalt)
+	mac.Write([]byte(jid))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// parseExportPeriod turns "2025-01" or "2025-01-15" into a [from, to) range in the bot's time zone
+func parseExportPeriod(spec string) (time.Time, time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01", spec, config.TimeZone); err == nil {
+		return t, t.AddDate(0, 1, 0), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", spec, config.TimeZone); err == nil {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid period %q, expected YYYY-MM or YYYY-MM-DD", spec)
+}
+
+// exportHistory writes the analysis history between from and to to w in the
+// given format, returning the number of records written
+func (s *Store) exportHistory(w io.Writer, from, to time.Time, format string) (int, error) {
+	rows, err := s.db.Query(
+		`SELECT chat, sender, kind, claim_key, COALESCE(language, ''), is_news, is_misinformation,
+			confidence, COALESCE(summary, ''), created_at
+		FROM analysis_history WHERE created_at >= ? AND created_at < ? ORDER BY created_at`,
+		from.Unix(), to.Unix(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var csvWriter *csv.Writer
+	var jsonEncoder *json.Encoder
+	switch format {
+	case exportCSV:
+		csvWriter = csv.NewWriter(w)
+		csvWriter.Write([]string{"time", "chat", "sender", "kind", "claim_key", "language",
+			"is_news", "is_misinformation", "confidence", "summary"})
+	case exportJSONL:
+		jsonEncoder = json.NewEncoder(w)
+	default:
+		return 0, fmt.Errorf("unknown export format %q", format)
+	}
+
+	n := 0
+	for rows.Next() {
+		var r HistoryRecord
+		var chat, sender string
+		var createdAt int64
+		if err := rows.Scan(&chat, &sender, &r.Kind, &r.ClaimKey, &r.Language, &r.IsNews,
+			&r.IsMisinformation, &r.Confidence, &r.Summary, &createdAt); err != nil {
+			return n, err
+		}
+		r.Time = time.Unix(createdAt, 0).UTC().Format(time.RFC3339)
+		r.Chat = pseudonym(chat)
+		r.Sender = pseudonym(sender)
+
+		if csvWriter != nil {
+			err = csvWriter.Write([]string{r.Time, r.Chat, r.Sender, r.Kind, r.ClaimKey, r.Language,
+				strconv.FormatBool(r.IsNews), strconv.FormatBool(r.IsMisinformation),
+				strconv.FormatFloat(r.Confidence, 'f', 3, 64), r.Summary})
+		} else {
+			err = jsonEncoder.Encode(r)
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return n, err
+		}
+	}
+	return n, rows.Err()
+}
+
+func cmdExport(evt *events.Message, args []string) {
+	if len(args) == 0 {
+		sendMessage(evt, "Usage: /export <YYYY-MM | YYYY-MM-DD> [csv|jsonl]")
+		return
+	}
+	from, to, err := parseExportPeriod(args[0])
+	if err != nil {
+		sendMessage(evt, fmt.Sprintf("❌ %v", err))
+		return
+	}
+	format := exportCSV
+	if len(args) > 1 {
+		format = strings.ToLower(args[1])
+	}
+	if format != exportCSV && format != exportJSONL {
+		sendMessage(evt, fmt.Sprintf("❌ Unknown format %q, use csv or jsonl.", args[1]))
+		return
+	}
+
+	var buf bytes.Buffer
+	n, err := botStore.exportHistory(&buf, from, to, format)
+	if err != nil {
+		fmt.Printf("Error exporting history: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not export the history. Please try again later.")
+		return
+	}
+	if n == 0 {
+		sendMessage(evt, fmt.Sprintf("📭 No analyses recorded for %s.", args[0]))
+		return
+	}
+
+	mimeType := "text/csv"
+	if format == exportJSONL {
+		mimeType = "application/x-ndjson"
+	}
+	fileName := fmt.Sprintf("aletheia-history-%s.%s", args[0], format)
+	caption := fmt.Sprintf("📤 Analysis history for %s (%d records)", args[0], n)
+	if err := sendDocument(evt.Info.Sender.ToNonAD(), buf.Bytes(), fileName, mimeType, caption); err != nil {
+		fmt.Printf("Error sending history export: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not send the export. Please try again later.")
+		return
+	}
+	if evt.Info.IsGroup {
+		sendMessage(evt, "📤 Sent the export as a private message.")
+	}
+}
+
+// runExportHistory writes the history export for a period to a file, or to
+// standard output with the count on standard error
+func runExportHistory(args []string) int {
+	flags := flag.NewFlagSet("export-history", flag.ExitOnError)
+	format := flags.String("format", exportCSV, "csv or jsonl")
+	out := flags.String("o", "-", "file to write, - for standard output")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: whatsapp-bot export-history [-format csv|jsonl] [-o FILE] <YYYY-MM | YYYY-MM-DD>")
+		return 2
+	}
+	from, to, err := parseExportPeriod(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := openBotStore(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer botStore.Close()
+
+	w := os.Stdout
+	if *out != "-" {
+		if w, err = os.Create(*out); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer w.Close()
+	}
+	n, err := botStore.exportHistory(w, from, to, strings.ToLower(*format))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error exporting history: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d records for %s\n", n, flags.Arg(0))
+	return 0
+}
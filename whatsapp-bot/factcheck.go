@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxFactChecks is how many published fact-checks are added to a verdict
+const maxFactChecks = 2
+
+// maxFactCheckQueries caps the claims searched per message
+const maxFactCheckQueries = 3
+
+var factCheckClient = &http.Client{Timeout: 10 * time.Second}
+
+// FactCheck is a published fact-check matching a claim
+type FactCheck struct {
+	Publisher string
+	Rating    string
+	URL       string
+}
+
+// String formats the fact-check as an evidence bullet
+func (f FactCheck) String() string {
+	return fmt.Sprintf("%s rated this \"%s\": %s", f.Publisher, f.Rating, f.URL)
+}
+
+// searchFactChecks queries the Google Fact Check Tools claims:search API
+func searchFactChecks(query, language string) ([]FactCheck, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("key", config.GoogleFactCheckAPIKey.Get())
+	params.Set("pageSize", "5")
+	if language != "" {
+		params.Set("languageCode", language)
+	}
+
+	resp, err := factCheckClient.Get("https://factchecktools.googleapis.com/v1alpha1/claims:search?" + params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to call fact check API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fact check API returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Claims []struct {
+			ClaimReview []struct {
+				Publisher struct {
+					Name string `json:"name"`
+					Site string `json:"site"`
+				} `json:"publisher"`
+				URL           string `json:"url"`
+				TextualRating string `json:"textualRating"`
+			} `json:"claimReview"`
+		} `json:"claims"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	var checks []FactCheck
+	for _, claim := range result.Claims {
+		for _, review := range claim.ClaimReview {
+			if review.URL == "" || review.TextualRating == "" {
+				continue
+			}
+			publisher := review.Publisher.Name
+			if publisher == "" {
+				publisher = review.Publisher.Site
+			}
+			checks = append(checks, FactCheck{
+				Publisher: publisher,
+				Rating:    review.TextualRating,
+				URL:       review.URL,
+			})
+		}
+	}
+	return checks, nil
+}
+
+// factCheckQueries returns the texts to search for: the extracted claims, or
+// the start of the message when the backend didn't split it into claims
+func factCheckQueries(result *AnalyzeResponse, text string) []string {
+	var queries []string
+	for _, c := range result.Claims {
+		if q := strings.TrimSpace(c.Text); q != "" {
+			queries = append(queries, q)
+		}
+	}
+	if len(queries) == 0 && strings.TrimSpace(text) != "" {
+		runes := []rune(strings.TrimSpace(text))
+		if len(runes) > 200 {
+			runes = runes[:200]
+		}
+		queries = append(queries, string(runes))
+	}
+	return firstN(queries, maxFactCheckQueries)
+}
+
+// enrichWithFactChecks adds matching published fact-checks to the evidence of
+// result. They take the last listed evidence slots so they're always shown;
+// the backend's remaining evidence follows them. Failures are logged and the
+// result is left unchanged.
+func enrichWithFactChecks(result *AnalyzeResponse, text, language string) {
+	if config.GoogleFactCheckAPIKey.Get() == "" || !result.IsNews {
+		return
+	}
+
+	seen := map[string]bool{}
+	var found []string
+	for _, query := range factCheckQueries(result, text) {
+		checks, err := searchFactChecks(query, language)
+		if err != nil {
+			fmt.Printf("Error searching fact checks: %v\n", err)
+			return
+		}
+		for _, check := range checks {
+			if len(found) == maxFactChecks {
+				break
+			}
+			if !seen[check.URL] {
+				seen[check.URL] = true
+				found = append(found, check.String())
+			}
+		}
+	}
+	if len(found) == 0 {
+		return
+	}
+	fmt.Printf("Found %d published fact checks\n", len(found))
+
+	keep := maxListedItems - len(found)
+	if keep > len(result.Evidence) {
+		keep = len(result.Evidence)
+	}
+	evidence := append([]string{}, result.Evidence[:keep]...)
+	evidence = append(evidence, found...)
+	result.Evidence = append(evidence, result.Evidence[keep:]...)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Feature flags gating capabilities that are still being rolled out
+const (
+	flagVideo  = "video"  // analyze video messages
+	flagAlerts = "alerts" // proactive trend alerts
+	flagPolls  = "polls"  // "did you believe this?" polls after verdicts
+)
+
+// featureFlagHelp describes each flag for /flag
+var featureFlagHelp = map[string]string{
+	flagVideo:  "analyze video messages",
+	flagAlerts: "send proactive trend alerts",
+	flagPolls:  "follow verdicts with a poll",
+}
+
+// featureFlagsStateKey is the bot_state key runtime flag changes are kept under
+const featureFlagsStateKey = "feature_flags"
+
+// FlagState is how far a flag is rolled out: to a percentage of chats,
+// with per-chat overrides on top
+type FlagState struct {
+	Percent int             `json:"percent"`
+	Chats   map[string]bool `json:"chats,omitempty"`
+}
+
+// featureFlags holds the state of every flag: FEATURE_FLAGS, then the
+// changes made with /flag, which are saved in bot_state
+var featureFlags = struct {
+	sync.RWMutex
+	byName map[string]*FlagState
+}{byName: map[string]*FlagState{}}
+
+func init() {
+	registerCommand("flag", &Command{
+		Usage:   "/flag [list | enable|disable <name> [here|<jid>|<percent>%] | reset <name>]",
+		Help:    "Roll features out to chats or a share of them",
+		Role:    roleOwner,
+		Handler: cmdFlag,
+	})
+}
+
+// parseFeatureFlags parses FEATURE_FLAGS, a comma-separated list of
+// name=on|off|<percent>%. Flags not listed are fully on.
+func parseFeatureFlags(spec string) map[string]int {
+	percents := map[string]int{}
+	for name := range featureFlagHelp {
+		percents[name] = 100
+	}
+	for _, item := range strings.Split(spec, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(item, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := featureFlagHelp[name]; !ok {
+			fmt.Printf("Ignoring unknown feature flag %q\n", name)
+			continue
+		}
+		percent, err := parseRollout(value)
+		if err != nil {
+			fmt.Printf("Ignoring feature flag %s: %v\n", name, err)
+			continue
+		}
+		percents[name] = percent
+	}
+	return percents
+}
+
+// parseRollout parses on, off or a percentage like 25%
+func parseRollout(value string) (int, error) {
+	switch value = strings.ToLower(strings.TrimSpace(value)); value {
+	case "on", "true":
+		return 100, nil
+	case "off", "false":
+		return 0, nil
+	}
+	percent, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid rollout %q (use on, off or 0-100%%)", value)
+	}
+	return percent, nil
+}
+
+// loadFeatureFlags sets every flag to its FEATURE_FLAGS rollout, then applies
+// the changes saved with /flag
+func loadFeatureFlags() {
+	saved := map[string]*FlagState{}
+	if _, err := botStore.getState(featureFlagsStateKey, &saved); err != nil {
+		fmt.Printf("Error loading feature flags: %v\n", err)
+	}
+
+	featureFlags.Lock()
+	defer featureFlags.Unlock()
+	for name, percent := range config.FeatureFlags {
+		featureFlags.byName[name] = &FlagState{Percent: percent, Chats: map[string]bool{}}
+	}
+	for name, state := range saved {
+		if _, ok := featureFlags.byName[name]; !ok || state == nil {
+			continue
+		}
+		if state.Chats == nil {
+			state.Chats = map[string]bool{}
+		}
+		featureFlags.byName[name] = state
+	}
+}
+
+// featureEnabled reports whether flag is on in chat: its per-chat override
+// if any, else whether the chat falls in the rolled out percentage. Buckets
+// are a stable hash of the flag and chat, so raising the percentage only adds chats.
+func featureEnabled(flag string, chat types.JID) bool {
+	featureFlags.RLock()
+	defer featureFlags.RUnlock()
+	state, ok := featureFlags.byName[flag]
+	if !ok {
+		return true
+	}
+	if on, ok := state.Chats[chat.ToNonAD().String()]; ok {
+		return on
+	}
+	return flagBucket(flag, chat) < state.Percent
+}
+
+// flagBucket places chat in one of 100 buckets for flag
+func flagBucket(flag string, chat types.JID) int {
+	sum := sha256.Sum256([]byte(flag + "/" + chat.ToNonAD().String()))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
+
+// updateFeatureFlag changes a flag with update and saves every flag,
+// returning the flag's state before and after
+func updateFeatureFlag(name string, update func(state *FlagState)) (before, after FlagState, err error) {
+	featureFlags.Lock()
+	defer featureFlags.Unlock()
+	state := featureFlags.byName[name]
+	before = copyFlagState(state)
+	update(state)
+	after = copyFlagState(state)
+	if err := botStore.setState(featureFlagsStateKey, featureFlags.byName); err != nil {
+		*state = before
+		return before, before, err
+	}
+	return before, after, nil
+}
+
+func copyFlagState(state *FlagState) FlagState {
+	out := FlagState{Percent: state.Percent, Chats: make(map[string]bool, len(state.Chats))}
+	for chat, on := range state.Chats {
+		out.Chats[chat] = on
+	}
+	return out
+}
+
+// String summarizes the rollout for /flag
+func (f FlagState) String() string {
+	text := fmt.Sprintf("%d%% of chats", f.Percent)
+	var on, off int
+	for _, enabled := range f.Chats {
+		if enabled {
+			on++
+		} else {
+			off++
+		}
+	}
+	if on > 0 {
+		text += fmt.Sprintf(", +%d chats", on)
+	}
+	if off > 0 {
+		text += fmt.Sprintf(", -%d chats", off)
+	}
+	return text
+}
+
+func cmdFlag(evt *events.Message, args []string) {
+	if len(args) == 0 || strings.ToLower(args[0]) == "list" {
+		names := make([]string, 0, len(featureFlagHelp))
+		for name := range featureFlagHelp {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var sb strings.Builder
+		sb.WriteString("🚩 *Feature flags*\n")
+		featureFlags.RLock()
+		for _, name := range names {
+			sb.WriteString(fmt.Sprintf("\n*%s* (%s): %s", name, featureFlagHelp[name], featureFlags.byName[name]))
+		}
+		featureFlags.RUnlock()
+		sendMessage(evt, sb.String())
+		return
+	}
+
+	action := strings.ToLower(args[0])
+	if len(args) < 2 || (action != "enable" && action != "disable" && action != "reset") {
+		sendMessage(evt, "Usage: /flag [list | enable|disable <name> [here|<jid>|<percent>%] | reset <name>]")
+		return
+	}
+	name := strings.ToLower(args[1])
+	if _, ok := featureFlagHelp[name]; !ok {
+		sendMessage(evt, fmt.Sprintf("❌ Unknown feature flag %q. Send /flag list to see them.", name))
+		return
+	}
+
+	var update func(state *FlagState)
+	var done string
+	switch {
+	case action == "reset":
+		percent := config.FeatureFlags[name]
+		update = func(state *FlagState) { *state = FlagState{Percent: percent, Chats: map[string]bool{}} }
+		done = fmt.Sprintf("✅ *%s* is back to its configured rollout (%d%%).", name, percent)
+
+	case len(args) < 3 || strings.HasSuffix(args[2], "%"):
+		// A bot-wide change: all chats, none, or a percentage
+		percent := 0
+		if action == "enable" {
+			percent = 100
+			if len(args) >= 3 {
+				var err error
+				if percent, err = parseRollout(args[2]); err != nil {
+					sendMessage(evt, fmt.Sprintf("❌ %v", err))
+					return
+				}
+			}
+		}
+		update = func(state *FlagState) { state.Percent = percent }
+		done = fmt.Sprintf("✅ *%s* is now on in %d%% of chats.", name, percent)
+		if percent == 0 {
+			done = fmt.Sprintf("✅ *%s* is now off, except in chats it's enabled in.", name)
+		}
+
+	default:
+		chat := evt.Info.Chat.ToNonAD()
+		if strings.ToLower(args[2]) != "here" {
+			jid, err := parseJIDArg(args[2])
+			if err != nil {
+				sendMessage(evt, fmt.Sprintf("❌ %v", err))
+				return
+			}
+			chat = jid
+		}
+		on := action == "enable"
+		update = func(state *FlagState) { state.Chats[chat.String()] = on }
+		done = fmt.Sprintf("✅ *%s* is now %sd in `%s`.", name, action, chat.String())
+	}
+
+	before, after, err := updateFeatureFlag(name, update)
+	if err != nil {
+		fmt.Printf("Error saving feature flags: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not save the feature flag.")
+		return
+	}
+	botStore.audit(actorOf(evt.Info), types.JID{}, "flag", name, before, after)
+	sendMessage(evt, done)
+}
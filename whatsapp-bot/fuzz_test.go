@@ -0,0 +1,240 @@
+package main
+
+// Fuzz targets for everything that handles content from WhatsApp or the
+// backend before a person has looked at it. The seeds run with go test;
+// fuzz one target at a time with, for example:
+//
+//	go test -run '^$' -fuzz FuzzNormalizeText -fuzztime 1m
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// pathological is text that has broken text handling elsewhere
+var pathological = []string{
+	"",
+	" ",
+	"/",
+	"/ /",
+	"/check@",
+	"/@",
+	"/CheCK arg",
+	"\x00\x01\x02",
+	"\xff\xfe\xfd",
+	"\u200b\u200c\u200d\u2060\ufeff",
+	"👨‍👩‍👧‍👦🏳️‍🌈🇮🇳",
+	"क्\u200dष ज़्\u200cञ",
+	"Z̵̡̢̛̗̘̙̜̝̞̟̠̀́̂̃̄̅̆̇̈̉̊̋̌̍̎̏a̸l̷g̶o̵",
+	"ｆｕｌｌｗｉｄｔｈ 𝐟𝐚𝐧𝐜𝐲 𝔣𝔯𝔞𝔨𝔱𝔲𝔯",
+	"f.a.k.e F-A-K-E n-e-w-s",
+	"v@cc1ne c0v1d-19 5G",
+	"раураl аррӏе",
+	"\u202eevil\u202c \u2066isolate\u2069",
+	"call +91 98765 43210 or mail a@b.co",
+	strings.Repeat("a", 70000),
+	strings.Repeat("🔥", 10000),
+	strings.Repeat("\n\n", 5000),
+	strings.Repeat("word ", 20000),
+}
+
+func FuzzParseCommand(f *testing.F) {
+	for _, s := range pathological {
+		f.Add(s)
+	}
+	f.Add("/help")
+	f.Add("  /settings verbosity short ")
+	f.Add("/help@aletheia extra args")
+
+	f.Fuzz(func(t *testing.T, text string) {
+		name, args, ok := parseCommand(text)
+		if !ok {
+			if name != "" || args != nil {
+				t.Fatalf("parseCommand(%q) = %q, %q without a command", text, name, args)
+			}
+			return
+		}
+		if strings.ContainsAny(name, "@ \t\n") {
+			t.Errorf("command name %q of %q has a separator", name, text)
+		}
+		for _, arg := range args {
+			if arg == "" || strings.TrimSpace(arg) != arg {
+				t.Errorf("argument %q of %q is empty or padded", arg, text)
+			}
+		}
+	})
+}
+
+func FuzzNormalizeText(f *testing.F) {
+	for _, s := range pathological {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, text string) {
+		normalized := normalizeText(text)
+		if utf8.ValidString(text) && !utf8.ValidString(normalized) {
+			t.Fatalf("normalizeText(%q) = %q, not valid UTF-8", text, normalized)
+		}
+		if strings.TrimSpace(normalized) != normalized || strings.Contains(normalized, "  ") {
+			t.Errorf("normalizeText(%q) = %q, whitespace not collapsed", text, normalized)
+		}
+		scrubPII(text, text)
+		scrubPII(normalized)
+		plainText(text)
+		detectLanguage(text)
+	})
+}
+
+// FuzzMessage feeds arbitrary messages, including ones that aren't valid
+// protobuf, through what the handler reads of a message before it's queued
+func FuzzMessage(f *testing.F) {
+	seeds := []*waE2E.Message{
+		{Conversation: proto.String("Breaking news: 5G spreads the virus")},
+		{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text: proto.String("/check"),
+			ContextInfo: &waE2E.ContextInfo{
+				StanzaID:      proto.String("ABC"),
+				Participant:   proto.String("919800000001@s.whatsapp.net"),
+				QuotedMessage: &waE2E.Message{Conversation: proto.String("quoted claim")},
+			},
+		}},
+		{ImageMessage: &waE2E.ImageMessage{Caption: proto.String("📷"), Mimetype: proto.String("image/jpeg")}},
+		{AudioMessage: &waE2E.AudioMessage{Seconds: proto.Uint32(1 << 31), PTT: proto.Bool(true)}},
+		{VideoMessage: &waE2E.VideoMessage{Seconds: proto.Uint32(0), FileLength: proto.Uint64(1 << 63)}},
+		{ContactMessage: &waE2E.ContactMessage{Vcard: proto.String("BEGIN:VCARD\nTEL;waid=91:\nEND:VCARD")}},
+		{LocationMessage: &waE2E.LocationMessage{}},
+	}
+	for _, msg := range seeds {
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte{0x0a, 0xff, 0xff, 0xff, 0xff, 0x0f})
+	// Quotes are checked against the bot's own number
+	if client == nil {
+		client = whatsmeow.NewClient(&store.Device{ID: &replayBotJID}, nil)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var msg waE2E.Message
+		if proto.Unmarshal(data, &msg) != nil {
+			return
+		}
+		chat := types.NewJID("120363000000000001", types.GroupServer)
+		evt := &events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: chat, Sender: types.NewJID("919800000001", types.DefaultUserServer), IsGroup: true},
+				ID:            "FUZZ",
+			},
+			Message: &msg,
+		}
+
+		text := extractText(evt.Message)
+		prepareText(text)
+		parseCommand(text)
+		isPriority(evt)
+		mediaItemFrom(evt.Message)
+		sharedContacts(evt.Message)
+		isLocation(evt.Message)
+		imageContext(evt.Message.GetImageMessage())
+		mediaMessageInfo(evt)
+	})
+}
+
+// loadTemplatesOnce loads the response templates for the formatting targets
+var loadTemplatesOnce = sync.OnceValue(func() error {
+	return loadResponseTemplates(config.ResponseTemplateDir)
+})
+
+// formatAll renders result in every language and confidence style, and
+// checks the replies split into parts WhatsApp takes
+func formatAll(t *testing.T, result *AnalyzeResponse) {
+	if err := loadTemplatesOnce(); err != nil {
+		t.Fatalf("loading templates: %v", err)
+	}
+	for lang := range translations {
+		for _, confidence := range []string{confidenceBar, confidenceStars, confidencePercent, confidenceNone, "bogus"} {
+			for _, reply := range []string{formatResponse(result, lang, confidence), formatShortResponse(result, lang, confidence)} {
+				if reply == "" {
+					t.Fatalf("empty reply for %+v in %s", result, lang)
+				}
+				plainText(reply)
+				for _, part := range splitReply(reply) {
+					if config.MaxReplyLength > 0 && utf8.RuneCountInString(part) > config.MaxReplyLength {
+						t.Fatalf("reply part of %d runes, over MAX_REPLY_LENGTH %d", utf8.RuneCountInString(part), config.MaxReplyLength)
+					}
+				}
+			}
+		}
+	}
+}
+
+func FuzzFormatResponse(f *testing.F) {
+	for _, s := range pathological {
+		f.Add(s, s, uint16(1), 0.5, true)
+	}
+	f.Add("Claim is false", "Evidence {{.Summary}} %s %d", uint16(5000), -1.0, false)
+	f.Add("", "", uint16(0), 1e308, true)
+	f.Add("*_~`", "```", uint16(300), 0.999, false)
+	f.Add("stars", "", uint16(1), math.NaN(), true)
+	f.Add("stars", "", uint16(1), 1.3, true)
+
+	f.Fuzz(func(t *testing.T, summary, evidence string, n uint16, confidence float64, misinformation bool) {
+		result := &AnalyzeResponse{
+			IsMisinformation: misinformation,
+			Confidence:       confidence,
+			IsNews:           true,
+			Summary:          summary,
+			Recommendation:   evidence,
+			Topic:            summary,
+		}
+		// Huge evidence arrays: up to a few thousand items
+		count := int(n % 4096)
+		for i := 0; i < count; i++ {
+			result.Evidence = append(result.Evidence, evidence)
+			if i%8 == 0 {
+				result.SourcesChecked = append(result.SourcesChecked, Source{Title: summary, URL: evidence, Credibility: evidence})
+				result.Claims = append(result.Claims, Claim{Text: evidence, Verdict: summary, Confidence: confidence})
+			}
+		}
+		formatAll(t, result)
+	})
+}
+
+// FuzzAnalysisResponse decodes backend answers, however malformed, and
+// formats the ones that pass validation
+func FuzzAnalysisResponse(f *testing.F) {
+	f.Add([]byte(`{"is_misinformation": true, "confidence": 0.9, "is_news": true, "summary": "s", "evidence": ["e"], "sources_checked": ["https://example.com", {"title": "t", "url": "u", "credibility": "high"}]}`))
+	f.Add([]byte(`{"is_news": true, "confidence": "high", "claims": [{"text": null}]}`))
+	f.Add([]byte(`{"verdict": "unverifiable", "confidence": NaN}`))
+	f.Add([]byte(`{"sources_checked": [1, true, null, [], {}]}`))
+	f.Add([]byte(`{"schema_version": 99, "social": {}, "developing": true}`))
+	f.Add([]byte(`null`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var result AnalyzeResponse
+		if json.Unmarshal(data, &result) != nil {
+			return
+		}
+		if validateAnalysis(&result) != nil {
+			return
+		}
+		if len(result.Evidence)+len(result.SourcesChecked)+len(result.Claims) > 10000 {
+			return
+		}
+		formatAll(t, &result)
+	})
+}
@@ -3,10 +3,14 @@ module github.com/aletheia/whatsapp-bot
 go 1.24.0
 
 require (
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.32
 	github.com/mdp/qrterminal/v3 v3.2.0
 	go.mau.fi/whatsmeow v0.0.0-20251127132918-b9ac3d51d746
+	golang.org/x/image v0.33.0
+	golang.org/x/text v0.31.0
 	google.golang.org/protobuf v1.36.10
+	rsc.io/qr v0.2.0
 )
 
 require (
@@ -27,6 +31,4 @@ require (
 	golang.org/x/net v0.47.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/term v0.37.0 // indirect
-	golang.org/x/text v0.31.0 // indirect
-	rsc.io/qr v0.2.0 // indirect
 )
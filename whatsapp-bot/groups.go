@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// GroupMeta is the cached metadata of a group the bot is in
+type GroupMeta struct {
+	Name         string
+	Participants int
+	Community    types.JID       // the community the group is linked to, if any
+	Announcement bool            // the group is its community's announcement group
+	AnnounceOnly bool            // only admins can send messages
+	admins       map[string]bool // user parts of admin phone numbers and LIDs
+	members      map[string]bool // user parts of every participant's phone number and LID
+	botAdmin     bool
+	fetched      time.Time
+}
+
+// groupMeta caches group metadata per group JID
+var groupMeta = struct {
+	sync.Mutex
+	byChat map[string]*GroupMeta
+}{byChat: map[string]*GroupMeta{}}
+
+func init() {
+	registerCommand("aletheia", &Command{
+		Usage:   "/aletheia on|off",
+		Help:    "Turn automatic fact-checking on or off in this chat",
+		Handler: cmdAletheia,
+	})
+}
+
+// groupInfo returns the group's metadata, fetching it when it's not cached or stale
+func groupInfo(chat types.JID) (*GroupMeta, error) {
+	groupMeta.Lock()
+	meta, ok := groupMeta.byChat[chat.String()]
+	groupMeta.Unlock()
+	if ok && time.Since(meta.fetched) < config.GroupInfoTTL {
+		return meta, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	info, err := client.GetGroupInfo(ctx, chat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group info: %w", err)
+	}
+
+	meta = &GroupMeta{
+		Name:         info.Name,
+		Participants: len(info.Participants),
+		Community:    info.LinkedParentJID,
+		Announcement: info.IsDefaultSubGroup,
+		AnnounceOnly: info.IsAnnounce,
+		admins:       map[string]bool{},
+		members:      map[string]bool{},
+		fetched:      time.Now(),
+	}
+	for _, p := range info.Participants {
+		for _, jid := range []types.JID{p.JID, p.PhoneNumber, p.LID} {
+			if jid.IsEmpty() {
+				continue
+			}
+			meta.members[jid.User] = true
+			if p.IsAdmin || p.IsSuperAdmin {
+				meta.admins[jid.User] = true
+				meta.botAdmin = meta.botAdmin || isBotJID(jid)
+			}
+		}
+	}
+	botStore.setCommunity(chat, meta.Community, meta.Announcement)
+
+	groupMeta.Lock()
+	groupMeta.byChat[chat.String()] = meta
+	groupMeta.Unlock()
+	return meta, nil
+}
+
+// forgetGroupInfo drops cached metadata so the next lookup refetches it
+func forgetGroupInfo(chat types.JID) {
+	groupMeta.Lock()
+	defer groupMeta.Unlock()
+	delete(groupMeta.byChat, chat.String())
+}
+
+// handleGroupInfo refreshes cached metadata when a group's name or members
+// change, tracks disappearing messages, rescans a changed description, and
+// notices when the bot itself was removed
+func handleGroupInfo(evt *events.GroupInfo) {
+	for _, jid := range evt.Leave {
+		if isBotJID(jid) {
+			handleLeftGroup(evt.JID)
+			return
+		}
+	}
+	if evt.Name != nil || evt.Announce != nil || len(evt.Join) > 0 || len(evt.Leave) > 0 || len(evt.Promote) > 0 || len(evt.Demote) > 0 {
+		forgetGroupInfo(evt.JID)
+	}
+	handleCommunityLink(evt)
+	if evt.Ephemeral != nil {
+		noteGroupEphemeral(evt.JID, *evt.Ephemeral)
+	}
+	// Scam groups often put the payload in the description itself
+	if evt.Topic != nil && !evt.Topic.TopicDeleted && config.GroupScan {
+		go reportGroupScan(evt.JID)
+	}
+}
+
+// isGroupAdmin reports whether the message sender is an admin of the group it was sent in
+func isGroupAdmin(info types.MessageInfo) bool {
+	if !info.IsGroup {
+		return false
+	}
+	meta, err := groupInfo(info.Chat)
+	if err != nil {
+		fmt.Printf("Error checking group admins: %v\n", err)
+		return false
+	}
+	for _, jid := range []types.JID{info.Sender, info.SenderAlt} {
+		if !jid.IsEmpty() && meta.admins[jid.User] {
+			return true
+		}
+	}
+	return false
+}
+
+// isLargeGroup reports whether chat is a group big enough that automatic
+// verdicts are sent as reactions only
+func isLargeGroup(chat types.JID) bool {
+	if config.LargeGroupSize <= 0 || chat.Server != types.GroupServer {
+		return false
+	}
+	meta, err := groupInfo(chat)
+	if err != nil {
+		fmt.Printf("Error checking group size: %v\n", err)
+		return false
+	}
+	return meta.Participants >= config.LargeGroupSize
+}
+
+func cmdAletheia(evt *events.Message, args []string) {
+	if len(args) != 1 {
+		sendMessage(evt, "Usage: /aletheia on|off")
+		return
+	}
+	if !canManageChat(evt.Info) {
+		sendMessage(evt, "⛔ Only group admins can turn the bot on or off in groups.")
+		return
+	}
+
+	var mode string
+	switch strings.ToLower(args[0]) {
+	case "on":
+		mode = modeAuto
+	case "off":
+		mode = modeOff
+	default:
+		sendMessage(evt, "Usage: /aletheia on|off")
+		return
+	}
+	if err := botStore.updateChatSettings(evt.Info.Chat, map[string]any{"mode": mode}, actorOf(evt.Info)); err != nil {
+		fmt.Printf("Error saving settings: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not save settings. Please try again.")
+		return
+	}
+	if mode == modeOff {
+		sendMessage(evt, "🔕 Automatic fact-checking is off. Reply to a message with /check to check it, or send /aletheia on to turn it back on.")
+		return
+	}
+	sendMessage(evt, "🔔 Automatic fact-checking is on.")
+}
@@ -0,0 +1,543 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func init() {
+	registerCommand("scan", &Command{
+		Usage:   "/scan [last <n>]",
+		Help:    "Check this group's description and pinned messages, or its last n messages, for misinformation and scams",
+		Handler: cmdScan,
+	})
+}
+
+// GroupScan is what a scan of a group's description and pinned messages found
+type GroupScan struct {
+	Name        string
+	Description string
+	Verdict     *AnalyzeResponse // nil when the description is empty or wasn't news
+	Threats     []LinkThreat     // scam and phishing links in the description
+	Err         error            // the description couldn't be analyzed
+	Pinned      int              // messages pinned while the bot was in the group
+	Flagged     []string         // summaries of pinned messages flagged when they were checked
+	Unchecked   int              // pinned messages the bot never analyzed
+	admins      []types.JID
+}
+
+// flagged reports whether the scan found anything worth telling admins about
+func (g *GroupScan) flagged() bool {
+	return len(g.Threats) > 0 || len(g.Flagged) > 0 || (g.Verdict != nil && g.Verdict.IsMisinformation)
+}
+
+// scanSnippetLength is how much of each flagged message /scan last quotes
+const scanSnippetLength = 80
+
+// KeptMessage is a message kept for /scan last in a chat that turned on history
+type KeptMessage struct {
+	ID     string
+	Sender string
+	Text   string
+}
+
+// HistoryScan is what /scan last found in a group's recent messages
+type HistoryScan struct {
+	Scanned   int
+	Checked   int
+	Failed    int
+	Flagged   []HistoryFinding
+	Truncated bool // the backend went down and the scan stopped early
+}
+
+// HistoryFinding is a flagged message from a history scan
+type HistoryFinding struct {
+	Snippet string
+	Summary string
+}
+
+// keepMessage saves the text of a message that could be a claim, keeping
+// only the chat's last HistoryScanMax
+func (s *Store) keepMessage(evt *events.Message, text string) {
+	text = prepareText(text)
+	if text == "" || prefilterReason(evt, text) != "" || isDisappearingChat(evt.Info.Chat) {
+		return
+	}
+	chat := evt.Info.Chat.ToNonAD().String()
+	_, err := s.db.Exec(
+		`INSERT INTO message_history (chat, message_id, sender, text, created_at) VALUES (?, ?, ?, ?, ?)`,
+		chat, evt.Info.ID, evt.Info.Sender.ToNonAD().String(), text, time.Now().Unix(),
+	)
+	if err != nil {
+		fmt.Printf("Error keeping message history: %v\n", err)
+		return
+	}
+	_, err = s.db.Exec(
+		`DELETE FROM message_history WHERE chat = ? AND id NOT IN
+			(SELECT id FROM message_history WHERE chat = ? ORDER BY id DESC LIMIT ?)`,
+		chat, chat, config.HistoryScanMax,
+	)
+	if err != nil {
+		fmt.Printf("Error trimming message history: %v\n", err)
+	}
+}
+
+// forgetMessages deletes the kept message text of chat, and what a history
+// sync recorded of its messages
+func (s *Store) forgetMessages(chat types.JID) {
+	if _, err := s.db.Exec(`DELETE FROM message_history WHERE chat = ?`, chat.ToNonAD().String()); err != nil {
+		fmt.Printf("Error deleting message history: %v\n", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM synced_messages WHERE chat = ?`, chat.ToNonAD().String()); err != nil {
+		fmt.Printf("Error deleting synced messages: %v\n", err)
+	}
+}
+
+// keptMessages returns the last n kept messages of chat, oldest first
+func (s *Store) keptMessages(chat types.JID, n int) ([]KeptMessage, error) {
+	rows, err := s.db.Query(
+		`SELECT message_id, sender, text FROM
+			(SELECT id, message_id, sender, text FROM message_history WHERE chat = ? ORDER BY id DESC LIMIT ?)
+		ORDER BY id`,
+		chat.ToNonAD().String(), n,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var messages []KeptMessage
+	for rows.Next() {
+		var m KeptMessage
+		if err := rows.Scan(&m.ID, &m.Sender, &m.Text); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// pinMessage records a message pinned in chat
+func (s *Store) pinMessage(chat types.JID, messageID string, by types.JID) error {
+	_, err := s.db.Exec(
+		`INSERT INTO pinned_messages (chat, message_id, pinned_by, pinned_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (chat, message_id) DO UPDATE SET pinned_by = excluded.pinned_by, pinned_at = excluded.pinned_at`,
+		chat.ToNonAD().String(), messageID, by.ToNonAD().String(), time.Now().Unix(),
+	)
+	return err
+}
+
+// unpinMessage forgets a message that was unpinned
+func (s *Store) unpinMessage(chat types.JID, messageID string) error {
+	_, err := s.db.Exec(`DELETE FROM pinned_messages WHERE chat = ? AND message_id = ?`, chat.ToNonAD().String(), messageID)
+	return err
+}
+
+// pinnedMessages lists the IDs of messages currently pinned in chat
+func (s *Store) pinnedMessages(chat types.JID) ([]string, error) {
+	rows, err := s.db.Query(`SELECT message_id FROM pinned_messages WHERE chat = ? ORDER BY pinned_at DESC`, chat.ToNonAD().String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// messageVerdict returns whether a message was flagged when the bot analyzed
+// it, and the verdict's summary. checked is false if it was never analyzed.
+func (s *Store) messageVerdict(chat types.JID, messageID string) (flagged bool, summary string, checked bool, err error) {
+	var text sql.NullString
+	err = s.db.QueryRow(
+		`SELECT is_misinformation, summary FROM analysis_history WHERE chat = ? AND message_id = ? ORDER BY id DESC LIMIT 1`,
+		chat.ToNonAD().String(), messageID,
+	).Scan(&flagged, &text)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, "", false, nil
+	}
+	if err != nil {
+		return false, "", false, err
+	}
+	return flagged, text.String, true, nil
+}
+
+// handlePin tracks messages pinned and unpinned in groups, and warns admins
+// when a message already flagged is pinned. It reports whether evt was a pin.
+func handlePin(evt *events.Message) bool {
+	pin := evt.Message.GetPinInChatMessage()
+	if pin == nil {
+		return false
+	}
+	if !evt.Info.IsGroup {
+		return true
+	}
+	id := pin.GetKey().GetID()
+	if pin.GetType() == waE2E.PinInChatMessage_UNPIN_FOR_ALL {
+		if err := botStore.unpinMessage(evt.Info.Chat, id); err != nil {
+			fmt.Printf("Error recording unpin: %v\n", err)
+		}
+		return true
+	}
+	if pin.GetType() != waE2E.PinInChatMessage_PIN_FOR_ALL {
+		return true
+	}
+	if err := botStore.pinMessage(evt.Info.Chat, id, evt.Info.Sender); err != nil {
+		fmt.Printf("Error recording pin: %v\n", err)
+		return true
+	}
+
+	flagged, summary, _, err := botStore.messageVerdict(evt.Info.Chat, id)
+	if err != nil {
+		fmt.Printf("Error looking up pinned message: %v\n", err)
+		return true
+	}
+	if flagged && config.GroupScan && !isShadowChat(evt.Info.Chat) {
+		metrics.inc("flagged_pin")
+		go notifyGroupAdmins(evt.Info.Chat, fmt.Sprintf("📌 *A flagged message was pinned*\n\nA message I flagged as misleading was just pinned in a group you manage:\n\n_%s_", summary))
+	}
+	return true
+}
+
+// scanGroup analyzes a group's description and looks up the verdicts of its
+// pinned messages. Pinned messages are only known if they were pinned while
+// the bot was in the group, and only judged if the bot analyzed them.
+func scanGroup(chat types.JID) (*GroupScan, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	info, err := client.GetGroupInfo(ctx, chat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group info: %w", err)
+	}
+	metrics.inc("group_scan")
+
+	scan := &GroupScan{Name: info.Name, Description: strings.TrimSpace(info.Topic), admins: groupAdmins(info)}
+
+	if scan.Description != "" {
+		if config.LinkCheck {
+			scan.Threats = checkLinks(extractLinks(scan.Description))
+		}
+		scan.Verdict, scan.Err = analyzeDescription(chat, info.TopicID, scan.Description)
+	}
+
+	ids, err := botStore.pinnedMessages(chat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pinned messages: %w", err)
+	}
+	scan.Pinned = len(ids)
+	for _, id := range ids {
+		flagged, summary, checked, err := botStore.messageVerdict(chat, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up pinned message: %w", err)
+		}
+		switch {
+		case !checked:
+			scan.Unchecked++
+		case flagged:
+			scan.Flagged = append(scan.Flagged, summary)
+		}
+	}
+	return scan, nil
+}
+
+// analyzeDescription fact-checks a group description like message text,
+// returning nil when it isn't a news claim
+func analyzeDescription(chat types.JID, topicID, description string) (*AnalyzeResponse, error) {
+	text := prepareText(description)
+	if result := matchHoax(text); result != nil {
+		return result, nil
+	}
+	backendText := text
+	if config.ScrubPII {
+		backendText = scrubPII(text)
+	}
+	key := "description:" + chat.User + ":" + topicID
+	result, err := analyzeTextCached(text, backendText, detectLanguage(text), key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !result.IsNews {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// formatGroupScan renders a scan's findings
+func formatGroupScan(scan *GroupScan, lang string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🔎 *Scan of %s*\n\n*Description:* ", scan.Name)
+	switch {
+	case scan.Description == "":
+		sb.WriteString("none")
+	case scan.Err != nil:
+		sb.WriteString("could not be analyzed, please try again later")
+	case scan.Verdict != nil:
+		emoji, headline := verdictStatus(scan.Verdict, messagesFor(lang))
+		fmt.Fprintf(&sb, "%s %s", emoji, headline)
+		if scan.Verdict.Summary != "" {
+			sb.WriteString("\n" + scan.Verdict.Summary)
+		}
+	case len(scan.Threats) == 0:
+		sb.WriteString("✅ nothing to fact-check")
+	default:
+		sb.WriteString("contains flagged links")
+	}
+	for _, t := range scan.Threats {
+		sb.WriteString("\n• ⚠️ " + t.String())
+	}
+
+	fmt.Fprintf(&sb, "\n\n*Pinned messages:* %d", scan.Pinned)
+	if len(scan.Flagged) > 0 {
+		fmt.Fprintf(&sb, ", %d flagged", len(scan.Flagged))
+		for _, summary := range scan.Flagged {
+			sb.WriteString("\n• 🚩 " + summary)
+		}
+	}
+	if scan.Unchecked > 0 {
+		fmt.Fprintf(&sb, "\n_%d pinned messages were never checked._", scan.Unchecked)
+	}
+	sb.WriteString("\n\n_Only messages pinned while I'm in the group are known._")
+	return sb.String()
+}
+
+// groupAdmins returns the JIDs to message a group's admins at, other than the bot
+func groupAdmins(info *types.GroupInfo) []types.JID {
+	var admins []types.JID
+	for _, p := range info.Participants {
+		if !p.IsAdmin && !p.IsSuperAdmin {
+			continue
+		}
+		jid := p.JID
+		if !p.PhoneNumber.IsEmpty() {
+			jid = p.PhoneNumber
+		}
+		if !isBotJID(jid) {
+			admins = append(admins, jid.ToNonAD())
+		}
+	}
+	return admins
+}
+
+// notifyGroupAdmins sends text to each admin of chat directly
+func notifyGroupAdmins(chat types.JID, text string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	info, err := client.GetGroupInfo(ctx, chat)
+	if err != nil {
+		fmt.Printf("Error listing admins of %s: %v\n", chat, err)
+		return
+	}
+	sendToAdmins(groupAdmins(info), text)
+}
+
+// sendToAdmins sends text to each of admins
+func sendToAdmins(admins []types.JID, text string) {
+	for _, admin := range admins {
+		if err := sendText(admin, text); err != nil {
+			fmt.Printf("Error messaging group admin %s: %v\n", admin, err)
+		}
+	}
+}
+
+// reportGroupScan scans a group on joining it or when its description
+// changes, and sends the findings to its admins if anything was flagged
+func reportGroupScan(chat types.JID) {
+	info := types.MessageInfo{MessageSource: types.MessageSource{Chat: chat, IsGroup: true}}
+	if !access.isPermitted(info) || isShadowChat(chat) || botStore.getChatSettings(chat).Mode == modeOff {
+		return
+	}
+	scan, err := scanGroup(chat)
+	if err != nil {
+		fmt.Printf("Error scanning group %s: %v\n", chat, err)
+		return
+	}
+	if !scan.flagged() {
+		return
+	}
+	metrics.inc("group_scan_flagged")
+	sendToAdmins(scan.admins, formatGroupScan(scan, botStore.getChatSettings(chat).Language))
+}
+
+// scanHistory checks a group's last n kept messages, reusing the verdicts of
+// messages already analyzed. Newly checked messages are added to the
+// analysis history like any other.
+func scanHistory(chat types.JID, n int) (*HistoryScan, error) {
+	messages, err := botStore.keptMessages(chat, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load message history: %w", err)
+	}
+	metrics.inc("history_scan")
+
+	scan := &HistoryScan{Scanned: len(messages)}
+	for _, m := range messages {
+		flagged, summary, checked, err := botStore.messageVerdict(chat, m.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up message: %w", err)
+		}
+		if !checked {
+			if backendBreaker.isOpen() {
+				scan.Truncated = true
+				break
+			}
+			result, err := scanKeptMessage(chat, m)
+			if err != nil {
+				fmt.Printf("Error scanning message %s: %v\n", m.ID, err)
+				scan.Failed++
+				continue
+			}
+			flagged, summary = result.IsNews && result.IsMisinformation, result.Summary
+		}
+		scan.Checked++
+		if flagged {
+			scan.Flagged = append(scan.Flagged, HistoryFinding{Snippet: shortSnippet(m.Text), Summary: summary})
+		}
+	}
+	return scan, nil
+}
+
+// scanKeptMessage analyzes a kept message like an incoming one: scam links
+// first, then known hoaxes, then the backend
+func scanKeptMessage(chat types.JID, m KeptMessage) (*AnalyzeResponse, error) {
+	sender, _ := types.ParseJID(m.Sender)
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: chat, Sender: sender, IsGroup: true},
+		ID:            m.ID,
+	}
+	if config.LinkCheck {
+		if threats := checkLinks(extractLinks(m.Text)); len(threats) > 0 {
+			var evidence []string
+			for _, t := range threats {
+				evidence = append(evidence, t.String())
+			}
+			botStore.recordAnalysis(info, "link", "", &AnalyzeResponse{
+				IsMisinformation: true,
+				Confidence:       1,
+				IsNews:           true,
+				Evidence:         evidence,
+				MessageType:      "scam_link",
+			})
+			return &AnalyzeResponse{IsNews: true, IsMisinformation: true, Summary: strings.Join(evidence, "; ")}, nil
+		}
+	}
+
+	language := detectLanguage(m.Text)
+	result := matchHoax(m.Text)
+	if result == nil {
+		backendText := m.Text
+		if config.ScrubPII {
+			backendText = scrubPII(m.Text)
+		}
+		var err error
+		result, err = analyzeTextCached(m.Text, backendText, language, "scan:"+chat.User+":"+m.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	botStore.recordAnalysis(info, "text", language, result)
+	return result, nil
+}
+
+// shortSnippet shortens a message for quoting in a scan report
+func shortSnippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) > scanSnippetLength {
+		return string(runes[:scanSnippetLength]) + "…"
+	}
+	return text
+}
+
+// formatHistoryScan renders a history scan's findings. Senders aren't named,
+// as the report is posted in the group.
+func formatHistoryScan(scan *HistoryScan) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🔎 *Scan of the last %d messages*\n\n%d checked, %d flagged", scan.Scanned, scan.Checked, len(scan.Flagged))
+	if scan.Failed > 0 {
+		fmt.Fprintf(&sb, ", %d could not be checked", scan.Failed)
+	}
+	for _, f := range scan.Flagged {
+		fmt.Fprintf(&sb, "\n\n🚩 _%s_", f.Snippet)
+		if f.Summary != "" {
+			sb.WriteString("\n" + f.Summary)
+		}
+	}
+	if scan.Truncated {
+		sb.WriteString("\n\n_The analysis service is unavailable, so the scan stopped early. Please try again later._")
+	}
+	if scan.Scanned > 0 && len(scan.Flagged) == 0 && scan.Failed == 0 && !scan.Truncated {
+		sb.WriteString("\n\n✅ Nothing misleading found.")
+	}
+	return sb.String()
+}
+
+func cmdScan(evt *events.Message, args []string) {
+	if !evt.Info.IsGroup {
+		sendMessage(evt, "Usage: send /scan in a group to check its description and pinned messages.")
+		return
+	}
+	if !canManageChat(evt.Info) {
+		sendMessage(evt, "⛔ Only group admins can scan the group.")
+		return
+	}
+	if len(args) > 0 {
+		cmdScanHistory(evt, args)
+		return
+	}
+	scan, err := scanGroup(evt.Info.Chat)
+	if err != nil {
+		fmt.Printf("Error scanning group: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not scan the group. Please try again.")
+		return
+	}
+	sendMessage(evt, formatGroupScan(scan, botStore.getChatSettings(evt.Info.Chat).Language))
+}
+
+func cmdScanHistory(evt *events.Message, args []string) {
+	if len(args) != 2 || strings.ToLower(args[0]) != "last" {
+		sendMessage(evt, "Usage: /scan last <n>")
+		return
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n <= 0 {
+		sendMessage(evt, "Usage: /scan last <n>")
+		return
+	}
+	if n > config.HistoryScanMax {
+		sendMessage(evt, fmt.Sprintf("❌ I keep at most the last %d messages.", config.HistoryScanMax))
+		return
+	}
+	if !botStore.getChatSettings(evt.Info.Chat).History {
+		sendMessage(evt, "ℹ️ This group doesn't keep message history. Turn it on with /settings history on; messages from then on can be scanned.")
+		return
+	}
+
+	// Checking many messages takes a while; don't hold up a worker meanwhile
+	sendMessage(evt, fmt.Sprintf("⏳ Scanning the last %d messages…", n))
+	go func() {
+		scan, err := scanHistory(evt.Info.Chat, n)
+		if err != nil {
+			fmt.Printf("Error scanning message history: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not scan the message history. Please try again.")
+			return
+		}
+		if scan.Scanned == 0 {
+			sendMessage(evt, "ℹ️ No messages kept yet. Messages that look like claims are kept from when history was turned on.")
+			return
+		}
+		sendMessage(evt, formatHistoryScan(scan))
+	}()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// recordAnalysis saves the outcome of an analysis to the history table. The
+// message itself isn't stored, only the verdict and its claim key.
+func (s *Store) recordAnalysis(info types.MessageInfo, kind, language string, result *AnalyzeResponse) {
+	_, err := s.db.Exec(
+		`INSERT INTO analysis_history
+			(chat, sender, message_id, kind, claim_key, language, is_news, is_misinformation, confidence, summary, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		info.Chat.ToNonAD().String(), info.Sender.ToNonAD().String(), info.ID, kind, result.claimKey,
+		language, result.IsNews, result.IsMisinformation, result.Confidence, result.Summary, time.Now().Unix(),
+	)
+	if err != nil {
+		fmt.Printf("Error recording analysis history: %v\n", err)
+	}
+}
+
+// pruneHistory deletes history older than the retention period
+func (s *Store) pruneHistory(retention time.Duration) {
+	res, err := s.db.Exec(`DELETE FROM analysis_history WHERE created_at < ?`, time.Now().Add(-retention).Unix())
+	if err != nil {
+		fmt.Printf("Error pruning analysis history: %v\n", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		fmt.Printf("Pruned %d old history records\n", n)
+	}
+	if _, err := s.db.Exec(`DELETE FROM trend_alerts WHERE alerted_at < ?`, time.Now().Add(-retention).Unix()); err != nil {
+		fmt.Printf("Error pruning trend alerts: %v\n", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM verdict_messages WHERE created_at < ?`, time.Now().Add(-retention).Unix()); err != nil {
+		fmt.Printf("Error pruning verdict messages: %v\n", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM observations WHERE hour < ?`, time.Now().Add(-retention).Unix()); err != nil {
+		fmt.Printf("Error pruning observations: %v\n", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM canary_results WHERE created_at < ?`, time.Now().Add(-retention).Unix()); err != nil {
+		fmt.Printf("Error pruning canary results: %v\n", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM message_history WHERE created_at < ?`, time.Now().Add(-retention).Unix()); err != nil {
+		fmt.Printf("Error pruning message history: %v\n", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM synced_messages WHERE sent_at < ?`, time.Now().Add(-retention).Unix()); err != nil {
+		fmt.Printf("Error pruning synced messages: %v\n", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM shared_verdicts WHERE created_at < ?`, time.Now().Add(-retention).Unix()); err != nil {
+		fmt.Printf("Error pruning shared verdicts: %v\n", err)
+	}
+}
+
+// runHistoryPruner enforces the history retention period in the background
+func runHistoryPruner() {
+	if config.HistoryRetention <= 0 {
+		return
+	}
+	for {
+		if ownsJob("history-pruner") {
+			botStore.pruneHistory(config.HistoryRetention)
+		}
+		time.Sleep(time.Hour)
+	}
+}
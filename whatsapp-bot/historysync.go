@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// historySyncing processes history syncs one at a time, in the order they
+// arrive, off the event goroutine
+var historySyncing sync.Mutex
+
+// handleHistorySync records which messages of groups with history on were
+// in the recent history the phone sends after linking: who sent them and
+// when, never their content. Messages recorded this way are skipped if
+// they're delivered again, so the bot doesn't answer days-old claims as if
+// they had just arrived. Nothing is analyzed or answered, and media isn't
+// downloaded.
+func handleHistorySync(evt *events.HistorySync) {
+	if !config.HistorySync {
+		return
+	}
+	switch evt.Data.GetSyncType() {
+	case waHistorySync.HistorySync_INITIAL_BOOTSTRAP, waHistorySync.HistorySync_RECENT:
+	default:
+		return
+	}
+	go func() {
+		historySyncing.Lock()
+		defer historySyncing.Unlock()
+		processHistorySync(evt.Data)
+	}()
+}
+
+// processHistorySync records the messages of one history sync
+func processHistorySync(data *waHistorySync.HistorySync) {
+	var cutoff time.Time
+	if config.HistoryRetention > 0 {
+		cutoff = time.Now().Add(-config.HistoryRetention)
+	}
+	synced, groups := 0, 0
+	for _, conv := range data.GetConversations() {
+		chat, err := types.ParseJID(conv.GetID())
+		if err != nil || chat.Server != types.GroupServer || !servesChat(chat) {
+			continue
+		}
+		settings := botStore.getChatSettings(chat)
+		if !settings.History || settings.Mode == modeObserve || isDisappearingChat(chat) {
+			continue
+		}
+
+		var messages []types.MessageInfo
+		for _, item := range conv.GetMessages() {
+			msg, err := client.ParseWebMessage(chat, item.GetMessage())
+			if err != nil || msg.Info.IsFromMe || msg.Info.Timestamp.Before(cutoff) || !access.isPermitted(msg.Info) {
+				continue
+			}
+			messages = append(messages, msg.Info)
+		}
+		// Syncs list the newest first; keep the chat's most recent ones
+		sort.Slice(messages, func(i, j int) bool { return messages[i].Timestamp.Before(messages[j].Timestamp) })
+		if len(messages) > config.HistoryScanMax {
+			messages = messages[len(messages)-config.HistoryScanMax:]
+		}
+
+		n, err := botStore.recordSyncedMessages(chat, messages)
+		if err != nil {
+			fmt.Printf("Error recording history sync of %s: %v\n", chat, err)
+			continue
+		}
+		if n > 0 {
+			synced += n
+			groups++
+		}
+	}
+	if synced > 0 {
+		metrics.add("history_sync_messages", int64(synced))
+		fmt.Printf("Recorded %d messages in %d groups from history sync (%s)\n", synced, groups, data.GetSyncType())
+	}
+}
+
+// recordSyncedMessages stores the metadata of messages of chat from a
+// history sync in one transaction, keeping only the chat's last
+// HistoryScanMax, and returns how many were new
+func (s *Store) recordSyncedMessages(chat types.JID, messages []types.MessageInfo) (int, error) {
+	if len(messages) == 0 {
+		return 0, nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	key := chat.ToNonAD().String()
+	n := 0
+	for _, info := range messages {
+		res, err := tx.Exec(
+			`INSERT INTO synced_messages (chat, message_id, sender, sent_at) VALUES (?, ?, ?, ?)
+			 ON CONFLICT (chat, message_id) DO NOTHING`,
+			key, info.ID, info.Sender.ToNonAD().String(), info.Timestamp.Unix(),
+		)
+		if err != nil {
+			return 0, err
+		}
+		if added, _ := res.RowsAffected(); added > 0 {
+			n++
+		}
+	}
+	_, err = tx.Exec(
+		`DELETE FROM synced_messages WHERE chat = ? AND message_id NOT IN
+			(SELECT message_id FROM synced_messages WHERE chat = ? ORDER BY sent_at DESC LIMIT ?)`,
+		key, key, config.HistoryScanMax,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// isSyncedMessage reports whether a message of chat was recorded from a
+// history sync, and so has been seen already
+func (s *Store) isSyncedMessage(chat types.JID, id types.MessageID) bool {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM synced_messages WHERE chat = ? AND message_id = ?`, chat.ToNonAD().String(), id).Scan(&n)
+	return err == nil && n > 0
+}
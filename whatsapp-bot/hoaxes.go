@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hoax is a known viral claim with a canned verdict, matched locally before
+// any backend call
+type Hoax struct {
+	Phrases          []string `json:"phrases"` // matched case-insensitively anywhere in the message
+	IsMisinformation bool     `json:"is_misinformation"`
+	Confidence       float64  `json:"confidence"`
+	Summary          string   `json:"summary"`
+	Evidence         []string `json:"evidence"`
+	Sources          []Source `json:"sources"`
+	Recommendation   string   `json:"recommendation"`
+}
+
+// hoaxList is the loaded hoax file, reloaded whenever the file changes
+var hoaxList struct {
+	sync.Mutex
+	hoaxes  []Hoax
+	modTime time.Time
+	checked time.Time
+}
+
+// hoaxReloadInterval is how often the hoax file is checked for changes
+const hoaxReloadInterval = 30 * time.Second
+
+// loadHoaxes reads the hoax file, keeping the current list when it's missing or invalid
+func loadHoaxes() {
+	if config.HoaxListPath == "" {
+		return
+	}
+	info, err := os.Stat(config.HoaxListPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Error reading hoax list: %v\n", err)
+		}
+		return
+	}
+	if info.ModTime().Equal(hoaxList.modTime) {
+		return
+	}
+
+	data, err := os.ReadFile(config.HoaxListPath)
+	if err != nil {
+		fmt.Printf("Error reading hoax list: %v\n", err)
+		return
+	}
+	var hoaxes []Hoax
+	if err := json.Unmarshal(data, &hoaxes); err != nil {
+		fmt.Printf("Error parsing hoax list %s: %v\n", config.HoaxListPath, err)
+		return
+	}
+	for i := range hoaxes {
+		for j, p := range hoaxes[i].Phrases {
+			hoaxes[i].Phrases[j] = hoaxKey(p)
+		}
+	}
+	hoaxList.hoaxes = hoaxes
+	hoaxList.modTime = info.ModTime()
+	fmt.Printf("Loaded %d known hoaxes from %s\n", len(hoaxes), config.HoaxListPath)
+}
+
+// hoaxKey lowercases text and collapses whitespace for phrase matching
+func hoaxKey(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(prepareText(text))), " ")
+}
+
+// matchHoax returns the canned verdict of the first known hoax whose phrase
+// appears in text, or nil
+func matchHoax(text string) *AnalyzeResponse {
+	hoaxList.Lock()
+	defer hoaxList.Unlock()
+	if time.Since(hoaxList.checked) >= hoaxReloadInterval {
+		hoaxList.checked = time.Now()
+		loadHoaxes()
+	}
+
+	key := hoaxKey(text)
+	for _, h := range hoaxList.hoaxes {
+		for _, phrase := range h.Phrases {
+			if phrase != "" && strings.Contains(key, phrase) {
+				return &AnalyzeResponse{
+					IsMisinformation: h.IsMisinformation,
+					Confidence:       h.Confidence,
+					IsNews:           true,
+					Summary:          h.Summary,
+					Evidence:         h.Evidence,
+					SourcesChecked:   h.Sources,
+					Recommendation:   h.Recommendation,
+					MessageType:      "known_hoax",
+					claimKey:         "hoax:" + h.Phrases[0],
+				}
+			}
+		}
+	}
+	return nil
+}
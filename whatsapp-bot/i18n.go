@@ -0,0 +1,191 @@
+package main
+
+// Messages holds the user-facing strings of a verdict reply in one language
+type Messages struct {
+	LikelyMisinformation  string
+	PotentiallyMisleading string
+	AppearsCredible       string
+	Unverifiable          string
+	UnverifiableAdvice    string // recommendation when the backend gives none
+	Confidence            string
+	Summary               string
+	Claims                string
+	Evidence              string
+	Sources               string
+	Recommendation        string
+	Footer                string
+	Resources             string
+	SimilarityNote        string // formatted with the similarity percentage
+	MoreNote              string // formatted with the number of items left out
+	AnalysisRef           string
+	PartialNote           string // formatted with the analyzed and total seconds
+	NotNews               string
+	CouldNotVerify        string // sent when the backend returns an empty verdict
+	Satire                string
+	SatireFrom            string // formatted with the publisher
+	Opinion               string
+	Advertisement         string
+	Personal              string
+	TrendAlertTitle       string
+	TrendAlert            string // formatted with the chat count and window in hours
+	PollQuestion          string
+	PollBelieved          string
+	PollNotBelieved       string
+	PollUnsure            string
+	ScamLinkTitle         string
+	ScamLinkIntro         string
+	ScamLinkAdvice        string
+	LowCredibilityTitle   string
+	LowCredibilityNote    string // formatted with the domain
+	FullCheckPending      string
+	AlreadyChecked        string
+	RecheckTitle          string
+	RecheckNote           string // formatted with the earlier verdict
+	ShareLink             string // formatted with the link to the verdict's web page
+}
+
+var translations = map[string]*Messages{
+	"en": {
+		LikelyMisinformation:  "LIKELY MISINFORMATION",
+		PotentiallyMisleading: "POTENTIALLY MISLEADING",
+		AppearsCredible:       "APPEARS CREDIBLE",
+		Unverifiable:          "UNVERIFIABLE",
+		UnverifiableAdvice:    "There isn't enough reliable information to confirm or refute this yet. Don't share it until trusted sources report on it.",
+		Confidence:            "Confidence",
+		Summary:               "Summary",
+		Claims:                "Claims",
+		Evidence:              "Evidence",
+		Sources:               "Sources",
+		Recommendation:        "Recommendation",
+		Footer:                "Always verify important news from multiple credible sources.",
+		Resources:             "Official resources",
+		SimilarityNote:        "Matches an earlier-checked message (%.0f%% similar).",
+		MoreNote:              "%d more – reply /more to see them.",
+		AnalysisRef:           "Ref",
+		PartialNote:           "Only the first %d seconds of this %d-second recording were checked.",
+		NotNews:               "ℹ️ This doesn't look like a news claim, so there's nothing to fact-check.",
+		CouldNotVerify:        "❓ We couldn't verify this claim — treat it with caution and check trusted sources before sharing.",
+		Satire:                "🎭 This appears to be satire, not real news. It's meant as a joke, so please don't share it as fact.",
+		SatireFrom:            "🎭 This appears to be satire from %s, not real news. It's meant as a joke, so please don't share it as fact.",
+		Opinion:               "💬 This reads as opinion rather than a factual claim, so there's nothing to fact-check. Views are worth weighing against trusted reporting.",
+		Advertisement:         "📢 This looks like an advertisement. Check offers with the company's official website before paying or sharing details.",
+		Personal:              "👤 This looks like a personal message rather than a news claim, so there's nothing to fact-check.",
+		TrendAlertTitle:       "Misinformation alert",
+		TrendAlert:            "This false claim has been shared in %d chats in the last %d hours.",
+		PollQuestion:          "Did you find this believable before the check?",
+		PollBelieved:          "Yes",
+		PollNotBelieved:       "No",
+		PollUnsure:            "Not sure",
+		ScamLinkTitle:         "SCAM/PHISHING LINK",
+		ScamLinkIntro:         "This message links to a site reported as dangerous:",
+		ScamLinkAdvice:        "Don't open it or enter passwords, OTPs or payment details. Don't forward it.",
+		LowCredibilityTitle:   "Low-credibility source",
+		LowCredibilityNote:    "%s is known for unreliable reporting",
+		FullCheckPending:      "Checking the claim itself now…",
+		AlreadyChecked:        "Already checked above — verdict:",
+		RecheckTitle:          "Verdict updated",
+		RecheckNote:           "We checked this claim again. It was first rated %s; here is the latest:",
+		ShareLink:             "🔗 Share this fact-check: %s",
+	},
+	"hi": {
+		LikelyMisinformation:  "संभावित गलत सूचना",
+		PotentiallyMisleading: "भ्रामक हो सकता है",
+		AppearsCredible:       "विश्वसनीय प्रतीत होता है",
+		Unverifiable:          "पुष्टि नहीं हो सकी",
+		UnverifiableAdvice:    "अभी इसकी पुष्टि या खंडन के लिए पर्याप्त भरोसेमंद जानकारी नहीं है। भरोसेमंद स्रोतों की रिपोर्ट आने तक इसे साझा न करें।",
+		Confidence:            "विश्वास स्तर",
+		Summary:               "सारांश",
+		Claims:                "दावे",
+		Evidence:              "साक्ष्य",
+		Sources:               "स्रोत",
+		Recommendation:        "सुझाव",
+		Footer:                "महत्वपूर्ण खबरों की पुष्टि हमेशा कई विश्वसनीय स्रोतों से करें।",
+		Resources:             "आधिकारिक संसाधन",
+		SimilarityNote:        "पहले जाँचे गए संदेश से मेल खाता है (%.0f%% समान)।",
+		MoreNote:              "%d और – देखने के लिए /more लिखकर जवाब दें।",
+		AnalysisRef:           "संदर्भ",
+		PartialNote:           "इस %[2]d सेकंड की रिकॉर्डिंग के केवल पहले %[1]d सेकंड की जाँच की गई।",
+		NotNews:               "ℹ️ यह कोई समाचार दावा नहीं लगता, इसलिए इसकी जाँच की ज़रूरत नहीं है।",
+		CouldNotVerify:        "❓ हम इस दावे की पुष्टि नहीं कर सके — सावधानी बरतें और साझा करने से पहले भरोसेमंद स्रोतों से जाँच लें।",
+		Satire:                "🎭 यह व्यंग्य लगता है, असली खबर नहीं। यह मज़ाक के तौर पर लिखा गया है, कृपया इसे तथ्य के रूप में साझा न करें।",
+		SatireFrom:            "🎭 यह %s का व्यंग्य लगता है, असली खबर नहीं। यह मज़ाक के तौर पर लिखा गया है, कृपया इसे तथ्य के रूप में साझा न करें।",
+		Opinion:               "💬 यह तथ्यात्मक दावा नहीं बल्कि राय लगती है, इसलिए इसकी जाँच की ज़रूरत नहीं है। विचारों को भरोसेमंद खबरों से परखें।",
+		Advertisement:         "📢 यह एक विज्ञापन लगता है। भुगतान करने या जानकारी साझा करने से पहले कंपनी की आधिकारिक वेबसाइट पर ऑफ़र जाँच लें।",
+		Personal:              "👤 यह समाचार दावा नहीं बल्कि निजी संदेश लगता है, इसलिए इसकी जाँच की ज़रूरत नहीं है।",
+		TrendAlertTitle:       "गलत सूचना चेतावनी",
+		TrendAlert:            "यह झूठा दावा पिछले %[2]d घंटों में %[1]d चैट में साझा किया गया है।",
+		PollQuestion:          "क्या जाँच से पहले आपको यह विश्वसनीय लगा था?",
+		PollBelieved:          "हाँ",
+		PollNotBelieved:       "नहीं",
+		PollUnsure:            "पता नहीं",
+		ScamLinkTitle:         "धोखाधड़ी/फ़िशिंग लिंक",
+		ScamLinkIntro:         "इस संदेश में ऐसी साइट का लिंक है जिसे खतरनाक बताया गया है:",
+		ScamLinkAdvice:        "इसे न खोलें और पासवर्ड, OTP या भुगतान की जानकारी न डालें। इसे आगे न भेजें।",
+		LowCredibilityTitle:   "कम विश्वसनीय स्रोत",
+		LowCredibilityNote:    "%s अविश्वसनीय खबरों के लिए जाना जाता है",
+		FullCheckPending:      "अब दावे की जाँच की जा रही है…",
+		AlreadyChecked:        "ऊपर पहले ही जाँचा जा चुका है — नतीजा:",
+		RecheckTitle:          "नतीजा बदला",
+		RecheckNote:           "हमने इस दावे की फिर से जाँच की। पहले इसे %s माना गया था; ताज़ा नतीजा:",
+		ShareLink:             "🔗 यह फ़ैक्ट-चेक साझा करें: %s",
+	},
+	"mr": {
+		LikelyMisinformation:  "संभाव्य चुकीची माहिती",
+		PotentiallyMisleading: "दिशाभूल करणारे असू शकते",
+		AppearsCredible:       "विश्वासार्ह वाटते",
+		Unverifiable:          "पडताळणी होऊ शकली नाही",
+		UnverifiableAdvice:    "याची पुष्टी किंवा खंडन करण्यासाठी अद्याप पुरेशी विश्वासार्ह माहिती नाही. विश्वासार्ह स्रोतांनी वृत्त देईपर्यंत हे शेअर करू नका.",
+		Confidence:            "विश्वास पातळी",
+		Summary:               "सारांश",
+		Claims:                "दावे",
+		Evidence:              "पुरावे",
+		Sources:               "स्रोत",
+		Recommendation:        "शिफारस",
+		Footer:                "महत्त्वाच्या बातम्यांची खात्री नेहमी अनेक विश्वासार्ह स्रोतांकडून करा.",
+		Resources:             "अधिकृत संसाधने",
+		SimilarityNote:        "आधी तपासलेल्या संदेशाशी जुळते (%.0f%% समान).",
+		MoreNote:              "आणखी %d – पाहण्यासाठी /more लिहून उत्तर द्या.",
+		AnalysisRef:           "संदर्भ",
+		PartialNote:           "या %[2]d सेकंदांच्या रेकॉर्डिंगचे फक्त पहिले %[1]d सेकंद तपासले.",
+		NotNews:               "ℹ️ हा बातमीचा दावा वाटत नाही, त्यामुळे तपासण्यासारखे काही नाही.",
+		CouldNotVerify:        "❓ आम्ही या दाव्याची पडताळणी करू शकलो नाही — सावधगिरी बाळगा आणि शेअर करण्यापूर्वी विश्वासार्ह स्रोतांकडून तपासा.",
+		Satire:                "🎭 हे उपहासात्मक लेखन वाटते, खरी बातमी नाही. हे विनोद म्हणून लिहिले आहे, कृपया हे तथ्य म्हणून शेअर करू नका.",
+		SatireFrom:            "🎭 हे %s चे उपहासात्मक लेखन वाटते, खरी बातमी नाही. हे विनोद म्हणून लिहिले आहे, कृपया हे तथ्य म्हणून शेअर करू नका.",
+		Opinion:               "💬 हा तथ्यात्मक दावा नसून मत वाटते, त्यामुळे तपासण्यासारखे काही नाही. मतांची विश्वासार्ह बातम्यांशी तुलना करा.",
+		Advertisement:         "📢 ही जाहिरात वाटते. पैसे भरण्यापूर्वी किंवा माहिती शेअर करण्यापूर्वी कंपनीच्या अधिकृत वेबसाइटवर ऑफर तपासा.",
+		Personal:              "👤 हा बातमीचा दावा नसून वैयक्तिक संदेश वाटतो, त्यामुळे तपासण्यासारखे काही नाही.",
+		TrendAlertTitle:       "चुकीच्या माहितीचा इशारा",
+		TrendAlert:            "हा खोटा दावा गेल्या %[2]d तासांत %[1]d चॅटमध्ये शेअर झाला आहे.",
+		PollQuestion:          "तपासणीपूर्वी तुम्हाला हे विश्वासार्ह वाटले होते का?",
+		PollBelieved:          "हो",
+		PollNotBelieved:       "नाही",
+		PollUnsure:            "माहीत नाही",
+		ScamLinkTitle:         "फसवणूक/फिशिंग लिंक",
+		ScamLinkIntro:         "या संदेशात धोकादायक म्हणून नोंदवलेल्या साइटची लिंक आहे:",
+		ScamLinkAdvice:        "ती उघडू नका आणि पासवर्ड, OTP किंवा पेमेंटची माहिती टाकू नका. ती पुढे पाठवू नका.",
+		LowCredibilityTitle:   "कमी विश्वासार्ह स्रोत",
+		LowCredibilityNote:    "%s अविश्वसनीय बातम्यांसाठी ओळखले जाते",
+		FullCheckPending:      "आता दाव्याची तपासणी सुरू आहे…",
+		AlreadyChecked:        "वर आधीच तपासले आहे — निकाल:",
+		RecheckTitle:          "निकाल बदलला",
+		RecheckNote:           "आम्ही हा दावा पुन्हा तपासला. आधी तो %s ठरवला होता; नवीन निकाल:",
+		ShareLink:             "🔗 हा फॅक्ट-चेक शेअर करा: %s",
+	},
+}
+
+// messagesFor returns the strings for lang, falling back to English
+func messagesFor(lang string) *Messages {
+	if m, ok := translations[lang]; ok {
+		return m
+	}
+	return translations["en"]
+}
+
+// replyLanguage resolves the language replies should use for a chat's
+// setting and the detected language of the message being answered
+func replyLanguage(setting, detected string) string {
+	if setting != "" && setting != "auto" {
+		return setting
+	}
+	return detected
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+const (
+	// instanceHeartbeat is how often an instance announces itself in the
+	// shared database; one silent for instanceTimeout is considered gone
+	instanceHeartbeat = 30 * time.Second
+	instanceTimeout   = 3 * instanceHeartbeat
+	// ringReplicas is how many points each instance gets on the hash ring,
+	// so jobs spread evenly and move little when an instance comes or goes
+	ringReplicas = 64
+	// chatSeenInterval throttles how often an instance records that it
+	// serves a chat
+	chatSeenInterval = time.Hour
+)
+
+// cluster is this instance's view of the instances sharing the database.
+// With a single instance every job and chat is its own.
+var cluster = struct {
+	sync.RWMutex
+	live []string
+	ring []ringPoint
+}{}
+
+// ringPoint is one of an instance's points on the hash ring
+type ringPoint struct {
+	hash     uint32
+	instance string
+}
+
+// chatsSeen remembers when this instance last recorded serving each chat
+var chatsSeen = struct {
+	sync.Mutex
+	at map[string]time.Time
+}{at: map[string]time.Time{}}
+
+// defaultInstanceID names an instance after its host, which is unique per
+// container or machine
+func defaultInstanceID() string {
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return "aletheia"
+}
+
+// ringHash places a key or instance point on the hash ring
+func ringHash(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// heartbeat announces this instance and returns the instances alive now
+func (s *Store) heartbeat() ([]string, error) {
+	jid := ""
+	if client != nil && client.Store.ID != nil {
+		jid = client.Store.ID.ToNonAD().String()
+	}
+	now := time.Now()
+	_, err := s.db.Exec(
+		`INSERT INTO instances (id, jid, heartbeat_at) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET jid = excluded.jid, heartbeat_at = excluded.heartbeat_at`,
+		config.InstanceID, jid, now.Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT id FROM instances WHERE heartbeat_at >= ? ORDER BY id`, now.Add(-instanceTimeout).Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var live []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		live = append(live, id)
+	}
+	return live, rows.Err()
+}
+
+// refreshCluster sends a heartbeat and rebuilds the hash ring from the live
+// instances. Failures keep the previous view.
+func refreshCluster() {
+	live, err := botStore.heartbeat()
+	if err != nil {
+		fmt.Printf("Error sending instance heartbeat: %v\n", err)
+		return
+	}
+	ring := make([]ringPoint, 0, len(live)*ringReplicas)
+	for _, id := range live {
+		for i := 0; i < ringReplicas; i++ {
+			ring = append(ring, ringPoint{hash: ringHash(id + "#" + strconv.Itoa(i)), instance: id})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	cluster.Lock()
+	if len(live) != len(cluster.live) {
+		fmt.Printf("Instances sharing the database: %v\n", live)
+	}
+	cluster.live, cluster.ring = live, ring
+	cluster.Unlock()
+}
+
+// isClustered reports whether other instances share the database
+func isClustered() bool {
+	cluster.RLock()
+	defer cluster.RUnlock()
+	return len(cluster.live) > 1
+}
+
+// routeKey returns the instance that handles key: the first one clockwise
+// from it on the ring among candidates, or among all live instances when
+// candidates is empty
+func routeKey(key string, candidates map[string]bool) string {
+	cluster.RLock()
+	defer cluster.RUnlock()
+	if len(cluster.ring) == 0 {
+		return config.InstanceID
+	}
+	h := ringHash(key)
+	start := sort.Search(len(cluster.ring), func(i int) bool { return cluster.ring[i].hash >= h })
+	for i := 0; i < len(cluster.ring); i++ {
+		p := cluster.ring[(start+i)%len(cluster.ring)]
+		if len(candidates) == 0 || candidates[p.instance] {
+			return p.instance
+		}
+	}
+	return cluster.ring[start%len(cluster.ring)].instance
+}
+
+// ownsJob reports whether this instance runs a database-wide job like
+// pruning, which only one instance needs to do
+func ownsJob(name string) bool {
+	return !isClustered() || routeKey("job/"+name, nil) == config.InstanceID
+}
+
+// servesChat reports whether this instance sends scheduled messages, such
+// as alerts and broadcasts, to chat. A chat several instances' numbers are
+// in is routed to one of them, so it doesn't get each message twice.
+func servesChat(chat types.JID) bool {
+	if !isClustered() {
+		return true
+	}
+	candidates, err := botStore.chatInstances(chat)
+	if err != nil {
+		fmt.Printf("Error loading instances of %s: %v\n", chat, err)
+	}
+	cluster.RLock()
+	live := map[string]bool{}
+	for _, id := range cluster.live {
+		if candidates[id] {
+			live[id] = true
+		}
+	}
+	cluster.RUnlock()
+	// Chats no live instance has recorded go to whichever the ring picks
+	return routeKey("chat/"+chat.ToNonAD().String(), live) == config.InstanceID
+}
+
+// noteChatInstance records that this instance's number is in chat
+func noteChatInstance(chat types.JID) {
+	key := chat.ToNonAD().String()
+	chatsSeen.Lock()
+	if time.Since(chatsSeen.at[key]) < chatSeenInterval {
+		chatsSeen.Unlock()
+		return
+	}
+	chatsSeen.at[key] = time.Now()
+	chatsSeen.Unlock()
+
+	_, err := botStore.db.Exec(
+		`INSERT INTO chat_instances (chat, instance, seen_at) VALUES (?, ?, ?)
+		ON CONFLICT (chat, instance) DO UPDATE SET seen_at = excluded.seen_at`,
+		key, config.InstanceID, time.Now().Unix(),
+	)
+	if err != nil {
+		fmt.Printf("Error recording chat instance: %v\n", err)
+	}
+}
+
+// forgetChatInstance records that this instance left chat, reporting
+// whether another instance is still in it
+func forgetChatInstance(chat types.JID) bool {
+	key := chat.ToNonAD().String()
+	chatsSeen.Lock()
+	delete(chatsSeen.at, key)
+	chatsSeen.Unlock()
+
+	if _, err := botStore.db.Exec(`DELETE FROM chat_instances WHERE chat = ? AND instance = ?`, key, config.InstanceID); err != nil {
+		fmt.Printf("Error forgetting chat instance: %v\n", err)
+	}
+	others, err := botStore.chatInstances(chat)
+	if err != nil {
+		fmt.Printf("Error loading instances of %s: %v\n", chat, err)
+	}
+	return len(others) > 0
+}
+
+// chatInstances returns the instances whose numbers are in chat
+func (s *Store) chatInstances(chat types.JID) (map[string]bool, error) {
+	rows, err := s.db.Query(`SELECT instance FROM chat_instances WHERE chat = ?`, chat.ToNonAD().String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	instances := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		instances[id] = true
+	}
+	return instances, rows.Err()
+}
+
+// reloadSharedState picks up changes other instances made to state each
+// instance keeps in memory: access lists, roles, feature flags and crisis mode
+func reloadSharedState() {
+	if err := botStore.loadAccessLists(); err != nil {
+		fmt.Printf("Error reloading access lists: %v\n", err)
+	}
+	if err := botStore.loadRoles(); err != nil {
+		fmt.Printf("Error reloading roles: %v\n", err)
+	}
+	loadFeatureFlags()
+	refreshCrisisState()
+}
+
+// runInstanceHeartbeat keeps this instance's place in the cluster and, while
+// other instances share the database, its copy of their shared state
+func runInstanceHeartbeat() {
+	ticker := time.NewTicker(instanceHeartbeat)
+	defer ticker.Stop()
+	for range ticker.C {
+		refreshCluster()
+		if isClustered() {
+			reloadSharedState()
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// scriptRange maps a Unicode block to the language it most likely indicates
+type scriptRange struct {
+	lo, hi rune
+	lang   string
+}
+
+var scriptRanges = []scriptRange{
+	{0x0900, 0x097F, "hi"}, // Devanagari, refined to Marathi below
+	{0x0980, 0x09FF, "bn"},
+	{0x0A00, 0x0A7F, "pa"},
+	{0x0A80, 0x0AFF, "gu"},
+	{0x0B00, 0x0B7F, "or"},
+	{0x0B80, 0x0BFF, "ta"},
+	{0x0C00, 0x0C7F, "te"},
+	{0x0C80, 0x0CFF, "kn"},
+	{0x0D00, 0x0D7F, "ml"},
+	{0x0600, 0x06FF, "ur"},
+}
+
+// Common function words used to tell Marathi from Hindi, which share Devanagari
+var (
+	marathiMarkers = map[string]bool{
+		"आहे": true, "आहेत": true, "आणि": true, "नाही": true, "काय": true, "मध्ये": true,
+		"आता": true, "झाले": true, "करा": true, "तुम्ही": true, "आपल्या": true, "होते": true,
+		"केले": true, "सर्व": true, "पण": true, "म्हणून": true,
+	}
+	hindiMarkers = map[string]bool{
+		"है": true, "हैं": true, "और": true, "नहीं": true, "क्या": true, "में": true,
+		"का": true, "की": true, "के": true, "को": true, "से": true, "यह": true,
+		"था": true, "थे": true, "कि": true, "भी": true,
+	}
+)
+
+// detectLanguage guesses the ISO 639-1 language of text from its dominant
+// script, using function words to separate Hindi and Marathi. Returns "" when
+// the text has no letters to go on.
+func detectLanguage(text string) string {
+	counts := map[string]int{}
+	for _, r := range text {
+		if !unicode.IsLetter(r) && !unicode.IsMark(r) {
+			continue
+		}
+		lang := ""
+		if r < unicode.MaxLatin1 && unicode.IsLetter(r) {
+			lang = "en"
+		} else {
+			for _, sr := range scriptRanges {
+				if r >= sr.lo && r <= sr.hi {
+					lang = sr.lang
+					break
+				}
+			}
+		}
+		if lang != "" {
+			counts[lang]++
+		}
+	}
+
+	best, bestCount := "", 0
+	for lang, n := range counts {
+		if n > bestCount || (n == bestCount && lang < best) {
+			best, bestCount = lang, n
+		}
+	}
+
+	if best == "hi" && isMarathi(text) {
+		return "mr"
+	}
+	return best
+}
+
+// isMarathi reports whether Devanagari text reads more like Marathi than Hindi
+func isMarathi(text string) bool {
+	score := 0
+	// ळ is common in Marathi and essentially absent from Hindi
+	score += 2 * strings.Count(text, "ळ")
+	for _, w := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsMark(r)
+	}) {
+		if marathiMarkers[w] {
+			score++
+		}
+		if hindiMarkers[w] {
+			score--
+		}
+	}
+	return score > 0
+}
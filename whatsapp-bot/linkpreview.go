@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/jpeg"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// linkPreviewTTL is how long a fetched preview, or a failure to fetch
+	// one, is reused
+	linkPreviewTTL = 6 * time.Hour
+	// previewThumbnailSize is the longest side of preview thumbnails, in pixels
+	previewThumbnailSize = 300
+	maxPreviewPageBytes  = 512 << 10
+	maxPreviewImageBytes = 2 << 20
+	// maxPreviewImagePixels bounds the images decoded for thumbnails, as a
+	// small file can still decode to a huge picture
+	maxPreviewImagePixels = 4096 * 4096
+)
+
+// linkPreviewClient only connects to public addresses: the pages and images
+// it fetches are named by message content and the backend
+var linkPreviewClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: dialPublicOnly}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+var (
+	metaTagPattern  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttrPattern = regexp.MustCompile(`(?is)\b(property|name|content)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	titleTagPattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// LinkPreview is what a page says about itself for link previews
+type LinkPreview struct {
+	Title       string
+	Description string
+	Thumbnail   []byte // JPEG
+	Width       int
+	Height      int
+}
+
+var linkPreviews = struct {
+	sync.Mutex
+	byURL map[string]cachedPreview
+}{byURL: map[string]cachedPreview{}}
+
+type cachedPreview struct {
+	preview *LinkPreview
+	expires time.Time
+}
+
+// linkPreview returns the preview for link, fetching it unless it was fetched
+// recently. It returns nil when the page can't be fetched or says nothing.
+func linkPreview(link string) *LinkPreview {
+	now := time.Now()
+	linkPreviews.Lock()
+	cached, ok := linkPreviews.byURL[link]
+	linkPreviews.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.preview
+	}
+
+	preview, err := fetchLinkPreview(link)
+	if err != nil {
+		fmt.Printf("Error fetching link preview for %s: %v\n", link, err)
+		metrics.inc("link_preview_failed")
+	}
+	linkPreviews.Lock()
+	for key, c := range linkPreviews.byURL {
+		if now.After(c.expires) {
+			delete(linkPreviews.byURL, key)
+		}
+	}
+	linkPreviews.byURL[link] = cachedPreview{preview: preview, expires: now.Add(linkPreviewTTL)}
+	linkPreviews.Unlock()
+	return preview
+}
+
+// fetchLinkPreview reads a page's Open Graph title, description and image,
+// falling back to its <title>, and makes a thumbnail of the image
+func fetchLinkPreview(link string) (*LinkPreview, error) {
+	page, err := url.Parse(link)
+	if err != nil || (page.Scheme != "http" && page.Scheme != "https") {
+		return nil, fmt.Errorf("not a web link")
+	}
+	body, contentType, err := fetchPreviewPart(link, maxPreviewPageBytes, true)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(contentType, "html") {
+		return nil, nil
+	}
+
+	meta := map[string]string{}
+	for _, tag := range metaTagPattern.FindAllString(string(body), -1) {
+		var key, content string
+		for _, attr := range metaAttrPattern.FindAllStringSubmatch(tag, -1) {
+			value := attr[2] + attr[3]
+			if strings.EqualFold(attr[1], "content") {
+				content = value
+			} else {
+				key = strings.ToLower(value)
+			}
+		}
+		if key != "" && meta[key] == "" {
+			meta[key] = strings.TrimSpace(html.UnescapeString(content))
+		}
+	}
+
+	preview := &LinkPreview{
+		Title:       firstNonEmpty(meta["og:title"], meta["twitter:title"]),
+		Description: firstNonEmpty(meta["og:description"], meta["twitter:description"], meta["description"]),
+	}
+	if preview.Title == "" {
+		if m := titleTagPattern.FindSubmatch(body); m != nil {
+			preview.Title = strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+		}
+	}
+	if src := firstNonEmpty(meta["og:image"], meta["og:image:url"], meta["twitter:image"]); src != "" {
+		if ref, err := page.Parse(src); err == nil {
+			if err := preview.addThumbnail(ref.String()); err != nil {
+				fmt.Printf("Error fetching preview image for %s: %v\n", link, err)
+			}
+		}
+	}
+	if preview.Title == "" && preview.Description == "" && preview.Thumbnail == nil {
+		return nil, nil
+	}
+	return preview, nil
+}
+
+// addThumbnail fetches the image at link and keeps a JPEG thumbnail of it
+func (p *LinkPreview) addThumbnail(link string) error {
+	data, _, err := fetchPreviewPart(link, maxPreviewImageBytes, false)
+	if err != nil {
+		return err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPreviewImagePixels {
+		return fmt.Errorf("image of %dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	thumb := scaleDown(src, previewThumbnailSize)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 75}); err != nil {
+		return fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	p.Thumbnail = buf.Bytes()
+	p.Width, p.Height = thumb.Bounds().Dx(), thumb.Bounds().Dy()
+	return nil
+}
+
+// fetchPreviewPart downloads up to limit bytes of link and returns them with
+// its content type. Anything larger is cut off when truncate is set (pages
+// keep their preview tags up front) and refused otherwise.
+func fetchPreviewPart(link string, limit int64, truncate bool) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	// Some sites only serve Open Graph tags to known link preview crawlers
+	req.Header.Set("User-Agent", "WhatsApp/2 (aletheia link preview)")
+	resp, err := linkPreviewClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > limit {
+		if truncate {
+			return data[:limit], strings.ToLower(resp.Header.Get("Content-Type")), nil
+		}
+		return nil, "", fmt.Errorf("larger than %d bytes", limit)
+	}
+	return data, strings.ToLower(resp.Header.Get("Content-Type")), nil
+}
+
+// dialPublicOnly refuses connections to loopback, private, link-local and
+// other non-public addresses. It runs on the resolved address of every
+// connection, redirects included, so DNS can't point around it.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("refusing to connect to non-public address %s", ip)
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, private in all but name
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// firstNonEmpty returns the first of values that isn't empty
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// maxCheckedLinks caps the links checked per message
+const maxCheckedLinks = 5
+
+// linkCacheTTL is how long a link's safety result is reused
+const linkCacheTTL = time.Hour
+
+var (
+	linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"']+`)
+	linkClient  = &http.Client{Timeout: 10 * time.Second}
+)
+
+// LinkThreat is a link flagged as a scam or phishing site
+type LinkThreat struct {
+	URL    string
+	Threat string // e.g. phishing or malware
+	Source string // the list that flagged it
+}
+
+// String formats the threat as a reply bullet
+func (t LinkThreat) String() string {
+	return fmt.Sprintf("%s – %s (%s)", linkHost(t.URL), t.Threat, t.Source)
+}
+
+// extractLinks returns the distinct links in text, with a scheme added to
+// bare www. links
+func extractLinks(text string) []string {
+	seen := map[string]bool{}
+	var links []string
+	for _, link := range linkPattern.FindAllString(text, -1) {
+		link = strings.TrimRight(link, ".,;:!?)]}*_~")
+		if !strings.Contains(strings.ToLower(link), "://") {
+			link = "http://" + link
+		}
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return firstN(links, maxCheckedLinks)
+}
+
+// linkHost returns a link's lowercased host without a leading www.
+func linkHost(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// blockedDomains is the loaded local domain blocklist, reloaded whenever it changes
+var blockedDomains struct {
+	sync.Mutex
+	domains map[string]bool
+	modTime time.Time
+	checked time.Time
+}
+
+// loadBlockedDomains reads the blocklist: one domain per line with #
+// comments. The current list is kept when the file is missing or unreadable.
+func loadBlockedDomains() {
+	if config.BlockedDomainsPath == "" {
+		return
+	}
+	info, err := os.Stat(config.BlockedDomainsPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Error reading domain blocklist: %v\n", err)
+		}
+		return
+	}
+	if info.ModTime().Equal(blockedDomains.modTime) {
+		return
+	}
+
+	data, err := os.ReadFile(config.BlockedDomainsPath)
+	if err != nil {
+		fmt.Printf("Error reading domain blocklist: %v\n", err)
+		return
+	}
+	domains := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if domain := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(line)), "www."); domain != "" {
+			domains[domain] = true
+		}
+	}
+	blockedDomains.domains = domains
+	blockedDomains.modTime = info.ModTime()
+	fmt.Printf("Loaded %d blocked domains from %s\n", len(domains), config.BlockedDomainsPath)
+}
+
+// isBlockedDomain reports whether host or one of its parent domains is on the blocklist
+func isBlockedDomain(host string) bool {
+	blockedDomains.Lock()
+	defer blockedDomains.Unlock()
+	if time.Since(blockedDomains.checked) >= hoaxReloadInterval {
+		blockedDomains.checked = time.Now()
+		loadBlockedDomains()
+	}
+
+	for host != "" {
+		if blockedDomains.domains[host] {
+			return true
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok {
+			break
+		}
+		host = parent
+	}
+	return false
+}
+
+// checkSafeBrowsing looks links up in the Google Safe Browsing v4 API
+func checkSafeBrowsing(links []string) ([]LinkThreat, error) {
+	var entries []map[string]string
+	for _, link := range links {
+		entries = append(entries, map[string]string{"url": link})
+	}
+	body, err := json.Marshal(map[string]any{
+		"client": map[string]string{"clientId": "aletheia", "clientVersion": version},
+		"threatInfo": map[string]any{
+			"threatTypes":      []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"},
+			"platformTypes":    []string{"ANY_PLATFORM"},
+			"threatEntryTypes": []string{"URL"},
+			"threatEntries":    entries,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := linkClient.Post("https://safebrowsing.googleapis.com/v4/threatMatches:find?key="+url.QueryEscape(config.SafeBrowsingAPIKey.Get()),
+		"application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Safe Browsing: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Safe Browsing returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Matches []struct {
+			ThreatType string `json:"threatType"`
+			Threat     struct {
+				URL string `json:"url"`
+			} `json:"threat"`
+		} `json:"matches"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	var threats []LinkThreat
+	for _, m := range result.Matches {
+		threat := strings.ToLower(strings.ReplaceAll(m.ThreatType, "_", " "))
+		if m.ThreatType == "SOCIAL_ENGINEERING" {
+			threat = "phishing"
+		}
+		threats = append(threats, LinkThreat{URL: m.Threat.URL, Threat: threat, Source: "Google Safe Browsing"})
+	}
+	return threats, nil
+}
+
+// checkPhishTank reports whether link is a verified phish in PhishTank
+func checkPhishTank(link string) (bool, error) {
+	form := url.Values{}
+	form.Set("url", link)
+	form.Set("format", "json")
+	if config.PhishTankAppKey.Get() != "" {
+		form.Set("app_key", config.PhishTankAppKey.Get())
+	}
+
+	req, err := http.NewRequest("POST", "https://checkurl.phishtank.com/checkurl/", strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// PhishTank asks clients to identify themselves
+	req.Header.Set("User-Agent", "phishtank/aletheia")
+
+	resp, err := linkClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to call PhishTank: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("PhishTank returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Results struct {
+			InDatabase bool `json:"in_database"`
+			Verified   bool `json:"verified"`
+			Valid      bool `json:"valid"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.Results.InDatabase && result.Results.Verified && result.Results.Valid, nil
+}
+
+// linkResults caches each link's threat (nil when it's safe) for linkCacheTTL
+var linkResults = struct {
+	sync.Mutex
+	byURL map[string]linkResult
+}{byURL: map[string]linkResult{}}
+
+type linkResult struct {
+	threat  *LinkThreat
+	expires time.Time
+}
+
+// checkLinks returns the links flagged by the local blocklist, Safe Browsing
+// or PhishTank. Lookup failures are logged and the link is treated as safe.
+func checkLinks(links []string) []LinkThreat {
+	var unknown []string
+	found := map[string]*LinkThreat{}
+
+	linkResults.Lock()
+	for _, link := range links {
+		if cached, ok := linkResults.byURL[link]; ok && time.Now().Before(cached.expires) {
+			found[link] = cached.threat
+			continue
+		}
+		unknown = append(unknown, link)
+	}
+	linkResults.Unlock()
+
+	var remote []string
+	for _, link := range unknown {
+		if isBlockedDomain(linkHost(link)) {
+			found[link] = &LinkThreat{URL: link, Threat: "scam", Source: "local blocklist"}
+		} else {
+			found[link] = nil
+			remote = append(remote, link)
+		}
+	}
+	if config.SafeBrowsingAPIKey.Get() != "" && len(remote) > 0 {
+		matches, err := checkSafeBrowsing(remote)
+		if err != nil {
+			fmt.Printf("Error checking links: %v\n", err)
+			metrics.fail("link_check_error", err)
+		}
+		for i := range matches {
+			found[matches[i].URL] = &matches[i]
+		}
+	}
+	if config.PhishTank {
+		for _, link := range remote {
+			if found[link] != nil {
+				continue
+			}
+			phish, err := checkPhishTank(link)
+			if err != nil {
+				fmt.Printf("Error checking links: %v\n", err)
+				metrics.fail("link_check_error", err)
+				continue
+			}
+			if phish {
+				found[link] = &LinkThreat{URL: link, Threat: "phishing", Source: "PhishTank"}
+			}
+		}
+	}
+
+	linkResults.Lock()
+	for _, link := range unknown {
+		linkResults.byURL[link] = linkResult{threat: found[link], expires: time.Now().Add(linkCacheTTL)}
+	}
+	linkResults.Unlock()
+
+	var flagged []LinkThreat
+	for _, link := range links {
+		if t := found[link]; t != nil {
+			fmt.Printf("Flagged link (%s):%s\n", t.Threat, logContent(link))
+			flagged = append(flagged, *t)
+		}
+	}
+	return flagged
+}
+
+// formatLinkWarning renders the scam/phishing link reply, which is separate
+// from the misinformation verdict format
+func formatLinkWarning(threats []LinkThreat, lang string) string {
+	m := messagesFor(lang)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "⚠️ *%s*\n\n%s\n", m.ScamLinkTitle, m.ScamLinkIntro)
+	for _, t := range threats {
+		sb.WriteString("\n• " + t.String())
+	}
+	fmt.Fprintf(&sb, "\n\n_%s_", m.ScamLinkAdvice)
+	return sb.String()
+}
+
+// handleScamLinks checks the links in text and, when any is flagged, replies
+// with a link warning instead of a verdict. It reports whether it did.
+func handleScamLinks(evt *events.Message, text string, settings *ChatSettings, explicit bool) bool {
+	if !config.LinkCheck {
+		return false
+	}
+	links := extractLinks(text)
+	if len(links) == 0 {
+		return false
+	}
+	threats := checkLinks(links)
+	if len(threats) == 0 {
+		return false
+	}
+	metrics.inc("scam_link")
+
+	var evidence []string
+	for _, t := range threats {
+		evidence = append(evidence, t.String())
+	}
+	botStore.recordAnalysis(evt.Info, "link", "", &AnalyzeResponse{
+		IsMisinformation: true,
+		Confidence:       1,
+		IsNews:           true,
+		Evidence:         evidence,
+		MessageType:      "scam_link",
+	})
+
+	lang := replyLanguage(settings.Language, detectLanguage(text))
+	warning := formatLinkWarning(threats, lang)
+	if muted(evt, settings, explicit) {
+		fmt.Printf("[shadow] Link warning for %s not sent:%s\n", evt.Info.Chat, logContent(warning))
+		return true
+	}
+	sendMessage(evt, warning)
+	return true
+}
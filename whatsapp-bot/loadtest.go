@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func init() {
+	registerSubcommand("loadtest", &Subcommand{
+		Usage:   "loadtest [-rate N] [-duration D] [-workers N] [-backend URL] ...",
+		Help:    "Feed synthetic messages through the pipeline and report throughput and latency",
+		Offline: true,
+		Run:     runLoadTest,
+	})
+}
+
+// loadClaimParts are the pieces synthetic claims are made of. Claims that
+// share only a piece or two don't look alike to the near-duplicate check, so
+// only the ones meant to repeat are answered from the verdict cache.
+var loadClaimParts = [][]string{
+	{"BREAKING: the government", "Doctors at AIIMS", "The RBI", "The Election Commission", "WHO scientists", "Police officials", "The railway ministry", "A NASA report"},
+	{"has confirmed that", "will announce tonight that", "secretly admitted that", "warned today that", "leaked a letter saying"},
+	{"all 500 rupee notes will be banned", "hot water every hour cures viral fever", "savings accounts under 10000 will be closed", "voting is moved to next month", "5G towers spread the new virus", "every student gets a free laptop", "petrol will be free for two wheelers", "schools stay shut for three months"},
+	{"in Mumbai", "across Maharashtra", "in Delhi and Noida", "in every state", "in Chennai", "near Pune"},
+	{"from midnight", "starting Monday", "before Friday", "by the end of the month", "this weekend"},
+	{"forward to everyone!", "share with your family", "send this to 10 groups", "please forward urgently"},
+}
+
+// loadChatter is group talk the prefilter and backend should let pass quietly
+var loadChatter = []string{
+	"good morning everyone 🌞",
+	"ok",
+	"haha 😂😂",
+	"happy birthday!! 🎂",
+	"where are we meeting tomorrow?",
+	"thanks",
+}
+
+// loadMessenger stands in for WhatsApp, timing each reply against the
+// message it quotes
+type loadMessenger struct {
+	mu        sync.Mutex
+	sentAt    map[types.MessageID]time.Time
+	latencies []time.Duration
+	sends     int
+}
+
+func (m *loadMessenger) received(id types.MessageID) {
+	m.mu.Lock()
+	m.sentAt[id] = time.Now()
+	m.mu.Unlock()
+}
+
+func (m *loadMessenger) SendMessage(ctx context.Context, to types.JID, msg *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	quoted := msg.GetExtendedTextMessage().GetContextInfo().GetStanzaID()
+	if key := msg.GetReactionMessage().GetKey(); key != nil {
+		quoted = key.GetID()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sends++
+	// The first reply to a message is the one its sender waited for
+	if at, ok := m.sentAt[quoted]; ok {
+		m.latencies = append(m.latencies, time.Since(at))
+		delete(m.sentAt, quoted)
+	}
+	return whatsmeow.SendResponse{ID: types.MessageID(fmt.Sprintf("LOAD%d", m.sends)), Timestamp: time.Now()}, nil
+}
+
+func (m *loadMessenger) Upload(ctx context.Context, data []byte, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	return whatsmeow.UploadResponse{URL: "load://upload", DirectPath: "/load", FileLength: uint64(len(data))}, nil
+}
+
+func (m *loadMessenger) Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	return nil, fmt.Errorf("load tests send no media")
+}
+
+// loadBackend answers analyses after a simulated model latency: claims as
+// misinformation, anything else as not news
+type loadBackend struct {
+	latency time.Duration
+	jitter  time.Duration
+	calls   atomic.Int64
+}
+
+func (b *loadBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/health" {
+		w.Write([]byte(`{"status": "ok"}`))
+		return
+	}
+	b.calls.Add(1)
+	delay := b.latency
+	if b.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(b.jitter)))
+	}
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+
+	var req AnalyzeRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	result := AnalyzeResponse{IsNews: false, Confidence: 0.5}
+	if text := strings.ToLower(req.Text); strings.Contains(text, "forward") || strings.Contains(text, "share") || strings.Contains(text, "send this") {
+		result = AnalyzeResponse{
+			IsMisinformation: true,
+			Confidence:       0.9,
+			IsNews:           true,
+			Summary:          "Synthetic verdict from the load test backend.",
+			Recommendation:   "Nothing to do; this is a load test.",
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// loadTraffic generates the synthetic messages of a run
+type loadTraffic struct {
+	chats   []types.JID
+	groups  map[types.JID]bool
+	chatter float64
+	repeat  float64
+	n       int
+	claims  []string
+}
+
+func newLoadTraffic(chats int, groupShare, chatter, repeat float64) *loadTraffic {
+	t := &loadTraffic{groups: map[types.JID]bool{}, chatter: chatter, repeat: repeat}
+	for i := 0; i < chats; i++ {
+		if float64(i) < groupShare*float64(chats) {
+			chat := types.NewJID(fmt.Sprintf("1203630000%08d", i), types.GroupServer)
+			t.chats = append(t.chats, chat)
+			t.groups[chat] = true
+		} else {
+			t.chats = append(t.chats, types.NewJID(fmt.Sprintf("9198%08d", i), types.DefaultUserServer))
+		}
+	}
+	return t
+}
+
+// next returns the next synthetic message
+func (t *loadTraffic) next() *events.Message {
+	t.n++
+	chat := t.chats[rand.Intn(len(t.chats))]
+	sender := chat
+	if t.groups[chat] {
+		sender = types.NewJID(fmt.Sprintf("9197%08d", rand.Intn(1000)), types.DefaultUserServer)
+	}
+
+	var text string
+	switch {
+	case t.groups[chat] && rand.Float64() < t.chatter:
+		text = loadChatter[rand.Intn(len(loadChatter))]
+	case len(t.claims) > 0 && rand.Float64() < t.repeat:
+		// The same forward again, as in a surge
+		text = t.claims[rand.Intn(len(t.claims))]
+	default:
+		parts := make([]string, len(loadClaimParts))
+		for i, options := range loadClaimParts {
+			parts[i] = options[rand.Intn(len(options))]
+		}
+		text = strings.Join(parts, " ")
+		t.claims = append(t.claims, text)
+	}
+
+	return &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: sender, IsGroup: t.groups[chat]},
+			ID:            types.MessageID(fmt.Sprintf("LOADTEST%d", t.n)),
+			PushName:      "Load Test",
+			Timestamp:     time.Now(),
+		},
+		Message: &waE2E.Message{Conversation: &text},
+	}
+}
+
+// runLoadTest implements the loadtest subcommand:
+//
+//	whatsapp-bot loadtest [-rate 20] [-duration 30s] [-workers N] [-backend URL] ...
+//
+// Synthetic messages go through the event handler, the message queue, the
+// workers and the send queue as real ones do, on a throwaway database; only
+// WhatsApp is left out. Without -backend, analyses are answered by a mock
+// backend taking -backend-latency.
+func runLoadTest(args []string) int {
+	flags := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	rate := flags.Float64("rate", 20, "messages per second to inject")
+	duration := flags.Duration("duration", 30*time.Second, "how long to inject messages for")
+	workers := flags.Int("workers", config.Workers, "workers handling messages")
+	chats := flags.Int("chats", 100, "chats the messages are spread over")
+	groupShare := flags.Float64("groups", 0.8, "share of the chats that are groups")
+	chatter := flags.Float64("chatter", 0.5, "share of group messages that are chit-chat rather than claims")
+	repeat := flags.Float64("repeat", 0.3, "share of claims that repeat an earlier one")
+	backendURL := flags.String("backend", "", "analyze against this backend instead of a mock one")
+	latency := flags.Duration("backend-latency", 500*time.Millisecond, "mock backend's time per analysis")
+	jitter := flags.Duration("backend-jitter", 250*time.Millisecond, "random extra mock backend time, up to this")
+	drain := flags.Duration("drain", time.Minute, "how long to wait for queued messages after injecting stops")
+	sendRate := flags.Float64("send-rate", config.SendRate, "messages per second sent to WhatsApp, as SEND_RATE; 0 sends without any pacing")
+	maxP99 := flags.Duration("max-p99", 0, "exit with 1 if the 99th percentile reply latency is over this")
+	verbose := flags.Bool("verbose", false, "show the bot's log while the test runs")
+	flags.Parse(args)
+	if *rate <= 0 || *duration <= 0 || *workers < 1 || *chats < 1 {
+		fmt.Println("Usage: whatsapp-bot loadtest [-rate N] [-duration D] [-workers N] [-chats N] [-backend URL] ...")
+		return 2
+	}
+
+	if err := loadResponseTemplates(config.ResponseTemplateDir); err != nil {
+		fmt.Printf("Failed to load response templates: %v\n", err)
+		return 1
+	}
+	dir, err := os.MkdirTemp("", "aletheia-loadtest-")
+	if err != nil {
+		fmt.Printf("Failed to create temp dir: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	if botStore, err = openStore(filepath.Join(dir, "bot.db")); err != nil {
+		fmt.Printf("Failed to open bot database: %v\n", err)
+		return 1
+	}
+	defer botStore.Close()
+	if err := botStore.loadAccessLists(); err != nil {
+		fmt.Printf("Failed to load access lists: %v\n", err)
+		return 1
+	}
+	loadFeatureFlags()
+	verdictCache = newVerdictCache(config.CacheTTL, config.CacheMaxEntries)
+
+	config.DryRun = false
+	config.GoogleFactCheckAPIKey.Set("")
+	if config.SendRate = *sendRate; *sendRate == 0 {
+		config.SendChatInterval, config.SendJitter = 0, 0
+	}
+	var backend *loadBackend
+	if *backendURL != "" {
+		config.BackendURL = *backendURL
+	} else {
+		backend = &loadBackend{latency: *latency, jitter: *jitter}
+		server := httptest.NewServer(backend)
+		defer server.Close()
+		config.BackendURL = server.URL
+		config.TranslationProvider = translateNone
+	}
+
+	traffic := newLoadTraffic(*chats, *groupShare, *chatter, *repeat)
+	// Synthetic groups have no metadata on WhatsApp to fetch
+	groupMeta.Lock()
+	for chat := range traffic.groups {
+		groupMeta.byChat[chat.String()] = &GroupMeta{
+			Name:         "Load test " + chat.User,
+			Participants: 50,
+			admins:       map[string]bool{},
+			members:      map[string]bool{},
+			fetched:      time.Now().Add(*duration + *drain),
+		}
+	}
+	groupMeta.Unlock()
+
+	client = whatsmeow.NewClient(&store.Device{ID: &replayBotJID}, nil)
+	recorder := &loadMessenger{sentAt: map[types.MessageID]time.Time{}}
+	outbox = outboxMessenger{pacedMessenger{recorder}}
+	messenger = disappearingMessenger{outbox}
+
+	fmt.Printf("Load test: %.1f messages/s for %s over %d chats with %d workers, sending %.1f/s, backend %s\n",
+		*rate, *duration, *chats, *workers, *sendRate, config.BackendURL)
+	stdout := os.Stdout
+	if !*verbose {
+		if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+			os.Stdout = devNull
+			defer devNull.Close()
+		}
+	}
+	before := metrics.snapshot()
+	startWorkers(*workers)
+
+	// Inject at the rate, catching up after slow ticks
+	var depths []int
+	started := time.Now()
+	injected := 0
+	ticker := time.NewTicker(10 * time.Millisecond)
+	for now := range ticker.C {
+		elapsed := now.Sub(started)
+		if elapsed >= *duration {
+			break
+		}
+		for due := int(elapsed.Seconds() * *rate); injected < due; injected++ {
+			evt := traffic.next()
+			recorder.received(evt.Info.ID)
+			eventHandler(evt)
+		}
+		priority, passive := messageQueue.depth()
+		depths = append(depths, priority+passive)
+	}
+	injecting := time.Since(started)
+
+	// Then wait for the queue and workers to finish
+	deadline := time.Now().Add(*drain)
+	for range ticker.C {
+		priority, passive := messageQueue.depth()
+		depths = append(depths, priority+passive)
+		handling.Lock()
+		busy := len(handling.started)
+		handling.Unlock()
+		if (priority+passive == 0 && busy == 0 && sendQueue.depth() == 0) || time.Now().After(deadline) {
+			break
+		}
+	}
+	ticker.Stop()
+	total := time.Since(started)
+	os.Stdout = stdout
+
+	after := metrics.snapshot()
+	delta := func(name string) int64 { return after[name] - before[name] }
+	priority, passive := messageQueue.depth()
+	handled := delta("message_received")
+
+	recorder.mu.Lock()
+	latencies := slices.Clone(recorder.latencies)
+	sends := recorder.sends
+	recorder.mu.Unlock()
+	slices.Sort(latencies)
+
+	fmt.Printf("\nInjected   %d messages in %s (%.1f/s)\n", injected, injecting.Round(time.Millisecond), float64(injected)/injecting.Seconds())
+	fmt.Printf("Handled    %d in %s (%.1f/s)", handled, total.Round(time.Millisecond), float64(handled)/total.Seconds())
+	if left := priority + passive; left > 0 {
+		fmt.Printf(", %d still queued after %s", left, *drain)
+	}
+	fmt.Println()
+	fmt.Printf("Replies    %d to %d messages, %d dropped from a full queue\n", len(latencies), injected, delta("queue_dropped"))
+	fmt.Printf("Sending    %d sends, %d held back by pacing\n", sends, delta("send_paced"))
+	if len(latencies) > 0 {
+		fmt.Printf("Latency    p50 %s  p90 %s  p99 %s  max %s (message to first reply)\n",
+			percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), latencies[len(latencies)-1].Round(time.Millisecond))
+	}
+	if len(depths) > 0 {
+		sum := 0
+		for _, d := range depths {
+			sum += d
+		}
+		fmt.Printf("Queue      max %d, mean %.1f messages waiting\n", slices.Max(depths), float64(sum)/float64(len(depths)))
+	}
+	fmt.Printf("Analysis   %d texts analyzed, %d prefiltered, %d backend errors, %d rate limited",
+		delta("analyzed_text"), delta("prefiltered"), delta("backend_error"), delta("backend_rate_limited"))
+	if backend != nil {
+		fmt.Printf(", %d backend calls", backend.calls.Load())
+	}
+	fmt.Println()
+
+	if *maxP99 > 0 && len(latencies) > 0 && percentile(latencies, 99) > *maxP99 {
+		fmt.Printf("\n❌ p99 latency %s is over -max-p99 %s\n", percentile(latencies, 99), *maxP99)
+		return 1
+	}
+	return 0
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	return sorted[max(0, min(i, len(sorted)-1))].Round(time.Millisecond)
+}
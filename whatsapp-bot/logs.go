@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+const (
+	logsDefaultLines = 50
+	// logsInlineLength is the longest tail sent as a message; longer ones
+	// are sent as a file
+	logsInlineLength = 3500
+)
+
+// contentPrefix starts every log line holding message content (texts,
+// questions, unsent verdicts), so the log tail can scrub them
+const contentPrefix = "  | "
+
+// logContent formats text for a log line, one prefixed line per line of text
+func logContent(text string) string {
+	return "\n" + contentPrefix + strings.ReplaceAll(text, "\n", "\n"+contentPrefix)
+}
+
+// logRing keeps the most recent scrubbed log lines for /logs
+var logRing = struct {
+	sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}{}
+
+// logCapture is the pipe stdout is redirected to, and closed when all of it
+// has been copied out
+var logCapture struct {
+	w      *os.File
+	stdout *os.File
+	done   chan struct{}
+}
+
+func init() {
+	registerCommand("logs", &Command{
+		Usage:   "/logs tail [lines]",
+		Help:    "Send yourself the most recent log lines, without message content",
+		Role:    roleOwner,
+		Handler: cmdLogs,
+	})
+}
+
+// captureLogs tees stdout through a pipe so the last config.LogBufferLines
+// lines can be sent with /logs, and so they can be written out as JSON
+func captureLogs() {
+	if config.LogBufferLines <= 0 && config.LogFormat != logFormatJSON {
+		return
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		fmt.Printf("Error capturing logs: %v\n", err)
+		return
+	}
+	logRing.lines = make([]string, max(config.LogBufferLines, 0))
+	logCapture.w, logCapture.stdout, logCapture.done = w, os.Stdout, make(chan struct{})
+	os.Stdout = w
+	go func() {
+		teeLogs(r, logCapture.stdout)
+		close(logCapture.done)
+	}()
+}
+
+// stopLogCapture restores stdout once everything logged so far is written out
+func stopLogCapture() {
+	if logCapture.w == nil {
+		return
+	}
+	os.Stdout = logCapture.stdout
+	logCapture.w.Close()
+	<-logCapture.done
+}
+
+// teeLogs copies the captured output to the real stdout and into the ring,
+// replacing each run of message content lines with one placeholder
+func teeLogs(r io.Reader, stdout io.Writer) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	inContent := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if config.LogFormat == logFormatJSON {
+			writeJSONLog(stdout, line)
+		} else {
+			fmt.Fprintln(stdout, line)
+		}
+		if len(logRing.lines) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(line, contentPrefix) {
+			if inContent {
+				continue
+			}
+			line = contentPrefix + "[message content removed]"
+		}
+		inContent = strings.HasPrefix(line, contentPrefix)
+		if !utf8.ValidString(line) {
+			line = strings.ToValidUTF8(line, "�")
+		}
+		logRing.Lock()
+		logRing.lines[logRing.next] = line
+		logRing.next = (logRing.next + 1) % len(logRing.lines)
+		logRing.full = logRing.full || logRing.next == 0
+		logRing.Unlock()
+	}
+}
+
+// writeJSONLog writes a log line as a JSON object for log collectors. Lines
+// of message content keep their own objects, marked as content.
+func writeJSONLog(w io.Writer, line string) {
+	entry := struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		Msg     string `json:"msg"`
+		Content bool   `json:"content,omitempty"`
+	}{Time: time.Now().UTC().Format(time.RFC3339Nano), Level: "info", Msg: line}
+	if msg, ok := strings.CutPrefix(line, contentPrefix); ok {
+		entry.Msg, entry.Content = msg, true
+	} else if strings.HasPrefix(line, "Error") || strings.HasPrefix(line, "Failed") || strings.Contains(line, " ERROR] ") {
+		entry.Level = "error"
+	} else if strings.Contains(line, " WARN] ") {
+		entry.Level = "warn"
+	}
+	data, _ := json.Marshal(entry)
+	w.Write(append(data, '\n'))
+}
+
+// tailLogs returns the last n captured lines, oldest first
+func tailLogs(n int) []string {
+	logRing.Lock()
+	defer logRing.Unlock()
+	ordered := logRing.lines[:logRing.next]
+	if logRing.full {
+		ordered = append(append([]string{}, logRing.lines[logRing.next:]...), logRing.lines[:logRing.next]...)
+	}
+	if n < len(ordered) {
+		ordered = ordered[len(ordered)-n:]
+	}
+	return append([]string(nil), ordered...)
+}
+
+func cmdLogs(evt *events.Message, args []string) {
+	if len(args) == 0 || args[0] != "tail" {
+		sendMessage(evt, "Usage: /logs tail [lines]")
+		return
+	}
+	n := logsDefaultLines
+	if len(args) > 1 {
+		parsed, err := strconv.Atoi(args[1])
+		if err != nil || parsed <= 0 {
+			sendMessage(evt, fmt.Sprintf("❌ Invalid number of lines %q", args[1]))
+			return
+		}
+		n = parsed
+	}
+	if config.LogBufferLines <= 0 {
+		sendMessage(evt, "ℹ️ Logs aren't captured. Set LOG_BUFFER_LINES to enable /logs.")
+		return
+	}
+	lines := tailLogs(n)
+	if len(lines) == 0 {
+		sendMessage(evt, "📭 No log lines yet.")
+		return
+	}
+
+	// Logs go to the operator privately, even when asked for in a group
+	dm := evt.Info.Sender.ToNonAD()
+	text := strings.Join(lines, "\n")
+	var err error
+	if len(text) > logsInlineLength {
+		err = sendDocument(dm, []byte(text+"\n"), "aletheia-logs.txt", "text/plain",
+			fmt.Sprintf("📜 Last %d log lines", len(lines)))
+	} else {
+		err = sendText(dm, fmt.Sprintf("📜 *Last %d log lines*\n\n```%s```", len(lines), text))
+	}
+	if err != nil {
+		fmt.Printf("Error sending logs: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not send the logs.")
+		return
+	}
+	if evt.Info.IsGroup {
+		sendMessage(evt, "📜 Sent the logs as a private message.")
+	}
+}
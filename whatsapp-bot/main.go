@@ -3,55 +3,620 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
+	_ "time/tzdata"
 
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/mdp/qrterminal/v3"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
 	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
-	waLog "go.mau.fi/whatsmeow/util/log"
 	"google.golang.org/protobuf/proto"
 )
 
 // Config holds the bot configuration
 type Config struct {
 	BackendURL string
+	BotDBPath  string
+	// Copy the SQLite bot database aside before migrating its schema
+	MigrateBackup bool
+	// SessionDBPath is the WhatsApp session database
+	SessionDBPath string
+	// DataDir holds the databases and archive when their paths are relative
+	DataDir string
+	// Where login puts the QR code without a terminal: a PNG file and a web page
+	LoginQRFile   string
+	LoginQRAddr   string
+	DatabaseURL   *Secret
+	InstanceID    string
+	OwnerJIDs     []types.JID
+	AdminJIDs     []types.JID
+	ModeratorJIDs []types.JID
+	AllowlistJIDs []types.JID
+	BlocklistJIDs []types.JID
+	TimeZone      *time.Location
+	QuietHours    *QuietHours
+
+	// Defaults for chats that haven't changed their /settings
+	DefaultLanguage   string
+	DefaultVerbosity  string
+	DefaultThreshold  float64
+	DefaultMode       string
+	DefaultCooldown   time.Duration
+	DefaultFormat     string
+	DefaultConfidence string
+	DefaultHistory    bool
+
+	// Text preprocessing applied before text is sent to the backend
+	NormalizeText bool
+	ScrubPII      bool
+	ScrubNames    bool
+
+	// Prefilter for automatic analysis: messages shorter than MinTextLength
+	// characters, pure greetings, replies to the bot and (optionally) chit-chat
+	// picked out by a local heuristic are never sent to the backend
+	MinTextLength  int
+	SkipGreetings  bool
+	SkipBotReplies bool
+	ChitChatFilter bool
+
+	// Verdict cache for repeated and near-duplicate messages
+	CacheTTL                   time.Duration
+	CacheMaxEntries            int
+	CacheStore                 string
+	RedisURL                   string
+	RedisPassword              *Secret
+	RedisPrefix                string
+	SimHashMaxDistance         int
+	NearDuplicateMinSimilarity float64
+
+	// Reply translation: "backend" (/translate endpoint), "google" or "none"
+	TranslationProvider   string
+	GoogleTranslateAPIKey *Secret
+
+	// Directory with full.tmpl/short.tmpl overriding the built-in reply templates
+	ResponseTemplateDir string
+
+	// Send verdicts as a shareable image card with a short caption
+	VerdictCardImage bool
+
+	// Attach a link preview for the top source to full verdict replies
+	SourceLinkPreview bool
+
+	// Replies longer than MaxReplyLength characters are split into numbered
+	// parts, or sent in the short format when ReplyOverflow is "short"
+	MaxReplyLength int
+	ReplyOverflow  string
+
+	// How long replies to a verdict are treated as follow-up questions (0 disables)
+	FollowUpTTL time.Duration
+
+	// Google Fact Check Tools API key; when set, matching published
+	// fact-checks are added to verdict evidence
+	GoogleFactCheckAPIKey *Secret
+
+	// JSON file of known hoax phrases with canned verdicts
+	HoaxListPath string
+	// Phone numbers reported for scams, flagged when shared as contacts
+	ScamNumbersPath string
+
+	// Links are checked against a local domain blocklist and, when
+	// configured, Google Safe Browsing and PhishTank
+	LinkCheck          bool
+	BlockedDomainsPath string
+	SafeBrowsingAPIKey *Secret
+	PhishTank          bool
+	PhishTankAppKey    *Secret
+	// News domain credibility tiers imported at startup; /domain edits them
+	DomainReputationPath string
+	// JSON file of per-topic authoritative resources and helplines
+	ResourcesPath string
+	// YouTube, Instagram and X links are analyzed by the backend from the
+	// video or post they point to
+	SocialAnalysis bool
+
+	// Analysis history is kept for HistoryRetention (0 keeps it forever)
+	HistoryRetention time.Duration
+
+	// Trending misinformation alerts for chats subscribed to "alerts"
+	TrendsSource       string // "local" (history) or "off"
+	TrendsWindow       time.Duration
+	TrendsMinChats     int
+	TrendsPollInterval time.Duration
+
+	// Crisis mode (/crisis on) for elections and disasters: every chat gets
+	// short verdicts, a threshold of at most CrisisThreshold and a cooldown
+	// of at most CrisisCooldown; CrisisWorkers extra workers are started and
+	// trend alerts go to all active chats every CrisisTrendsPollInterval
+	CrisisThreshold          float64
+	CrisisCooldown           time.Duration
+	CrisisWorkers            int
+	CrisisTrendsPollInterval time.Duration
+
+	// Delay between messages when broadcasting announcements
+	BroadcastInterval time.Duration
+
+	// Pacing of every outgoing message: overall rate per second, spacing
+	// within a chat and random jitter added to each
+	SendRate         float64
+	SendChatInterval time.Duration
+	SendJitter       time.Duration
+
+	// Ban-risk monitoring: BanRiskFailures failed sends or receipts within
+	// BanRiskWindow slow sending by BanRiskSlowdown for BanRiskThrottle
+	BanRiskFailures int
+	BanRiskWindow   time.Duration
+	BanRiskThrottle time.Duration
+	BanRiskSlowdown float64
+	// How long a send that never reached the server waits for a reconnection
+	// before it's retried once
+	SendRetryWait time.Duration
+	// Messages held in the outbox longer than this are dropped, not sent
+	OutboxMaxAge time.Duration
+	// Outgoing messages are held after KeepAliveHoldAfter keepalive pings in
+	// a row fail (0 never holds), and the connection is dropped and remade
+	// once they've failed for KeepAliveMaxFail
+	KeepAliveHoldAfter int
+	KeepAliveMaxFail   time.Duration
+	// Ask the bot's phone for messages that couldn't be decrypted
+	PhoneRerequest bool
+	// Mark the bot available to follow whether its phone is online; phones
+	// get no notifications while a linked device is available
+	PhonePresence bool
+
+	// Where secrets come from besides the environment: files (one per
+	// secret in SecretsDir), vault (VaultSecretPath) or aws (AWSSecretID
+	// in Secrets Manager). They're re-read on SIGHUP.
+	SecretsProvider string
+	SecretsDir      string
+	VaultAddr       string
+	VaultToken      string
+	VaultSecretPath string
+	AWSSecretID     string
+	AWSRegion       string
+
+	// Secret used to pseudonymize chats and senders in /export
+	ExportSalt *Secret
+
+	// Key the session and bot databases are encrypted with (SQLCipher
+	// builds only), or a file holding it
+	DBEncryptionKey     *Secret
+	DBEncryptionKeyFile string
+
+	// Operator dashboard; disabled unless both are set
+	DashboardAddr  string
+	DashboardToken *Secret
+	// Group admins reach the dashboard at DashboardURL with a /link code,
+	// valid for LinkCodeTTL, and stay signed in for DashboardSessionTTL
+	DashboardURL        string
+	LinkCodeTTL         time.Duration
+	DashboardSessionTTL time.Duration
+
+	// Verdict replies link to a public page for the verdict under
+	// ShareBaseURL; ShareAddr is where this instance serves those pages
+	ShareBaseURL string
+	ShareAddr    string
+
+	// jid=base32key pairs of operators who confirm destructive commands with
+	// an authenticator code
+	AdminTOTPSecrets *Secret
+
+	// Serve pprof and /debug/state on the dashboard server
+	DebugEndpoints bool
+
+	// How many recent log lines /logs can return; 0 disables capturing them
+	LogBufferLines int
+	// LogFormat is text, or json for one JSON object per line
+	LogFormat string
+
+	// Run the full pipeline everywhere but never send verdicts, alerts or broadcasts
+	DryRun bool
+
+	// Backend circuit breaker: consecutive failures that open it, and how
+	// long to wait before probing the backend again
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// How long to pause after a 429 without a usable Retry-After, and the
+	// longest Retry-After honored
+	BackendRetryAfter    time.Duration
+	BackendMaxRetryAfter time.Duration
+
+	// Gzip JSON request bodies from this size (0 never), and refuse backend
+	// responses over BackendMaxResponseBytes
+	BackendGzipOver         int
+	BackendMaxResponseBytes int64
+
+	// Wire format for analyses: json, or protobuf per proto/aletheia.proto
+	BackendWireFormat string
+
+	// Automatic-reply confidence thresholds by sender type, overriding the
+	// chat's threshold for business, broadcast and bot senders
+	SenderThresholds map[string]float64
+
+	// How long a backend set with /backend set is health-checked, and
+	// reverted if it keeps failing
+	BackendSwitchWatch time.Duration
+
+	// Shadow-call a second backend for a share of analyses and record where
+	// its verdict differs from production's
+	CanaryBackendURL      string
+	CanaryPercent         int
+	CanaryConfidenceDelta float64
+
+	// Extra attempts for a failed backend call before it's dead-lettered
+	BackendRetries int
+
+	// Messages handled concurrently, and how many may wait for a worker
+	Workers   int
+	QueueSize int
+	// Group metadata cache lifetime, and the group size from which automatic
+	// verdicts are sent as reactions only
+	GroupInfoTTL   time.Duration
+	LargeGroupSize int
+	// Scan a group's description and pinned messages on joining it and
+	// when the description changes, reporting findings to its admins
+	GroupScan bool
+	// Messages kept per chat that turned on /settings history, and so the
+	// most /scan last can check
+	HistoryScanMax int
+	// Record which messages the history WhatsApp sends after linking holds,
+	// so they aren't answered if delivered again
+	HistorySync bool
+	// How long to wait for the rest of an album's images before analyzing it
+	AlbumWait time.Duration
+
+	// Voice notes, audio and video: only the first MediaMaxSeconds are
+	// analyzed, and recordings over MediaMaxBytes aren't downloaded at all
+	MediaAnalysis   bool
+	MediaMaxSeconds int
+	MediaMaxBytes   int
+	FFmpegPath      string
+	// How long to wait for expired media to be uploaded again before telling
+	// the sender it couldn't be downloaded; 0 doesn't ask for it
+	MediaRetryTimeout time.Duration
+	// TempDir holds recordings while ffmpeg clips them; the system's by default
+	TempDir string
+
+	// With AsyncAnalysis, recordings are submitted as backend jobs and the
+	// reply is sent when the backend posts the result to CallbackURL, served
+	// on CallbackAddr; jobs with no callback after AsyncJobTimeout fail
+	AsyncAnalysis   bool
+	CallbackAddr    string
+	CallbackURL     string
+	AsyncJobTimeout time.Duration
+
+	// Recordings over MediaUploadOver bytes are uploaded to the S3 bucket and
+	// the backend fetches them from a presigned URL valid for MediaUploadURLTTL
+	MediaUploadOver   int
+	MediaUploadURLTTL time.Duration
+
+	// Flagged images, audio and video are archived (hash, thumbnail and
+	// verdict, plus the file itself with ArchiveOriginals) to ArchiveDir or
+	// an S3-compatible bucket for fact-checkers to review, for ArchiveRetention
+	ArchiveMedia     bool
+	ArchiveOriginals bool
+	ArchiveStorage   string
+	ArchiveDir       string
+	ArchiveRetention time.Duration
+	S3Endpoint       string
+	S3Bucket         string
+	S3Region         string
+	S3AccessKey      *Secret
+	S3SecretKey      *Secret
+
+	// A claim reposted within RepostWindow of its verdict gets a short
+	// "already checked above" reply instead of a new verdict
+	RepostWindow time.Duration
+
+	// Verdicts on developing stories or below RecheckBelowConfidence are
+	// analyzed again after RecheckAfter, with an update reply if they changed
+	RecheckAfter           time.Duration
+	RecheckBelowConfidence float64
+
+	// Follow verdicts with a "did you believe this?" poll
+	VerdictPoll bool
+	// Response format experiment: chats are split evenly across the variants
+	ExperimentName     string
+	ExperimentVariants []string
+
+	// Percentage of chats each feature flag starts out enabled in
+	FeatureFlags map[string]int
 }
 
 // AnalyzeRequest is the request body for the backend API
 type AnalyzeRequest struct {
-	Text string `json:"text"`
+	Text        string   `json:"text"`
+	Language    string   `json:"language,omitempty"`
+	SenderTypes []string `json:"sender_types,omitempty"` // see senderTypes
 }
 
 // AnalyzeResponse is the response from the backend API
 type AnalyzeResponse struct {
 	IsMisinformation bool     `json:"is_misinformation"`
+	Verdict          string   `json:"verdict,omitempty"` // credible, misinformation or unverifiable
 	Confidence       float64  `json:"confidence"`
 	IsNews           bool     `json:"is_news"`
 	Summary          string   `json:"summary"`
 	Evidence         []string `json:"evidence"`
-	SourcesChecked   []string `json:"sources_checked"`
+	SourcesChecked   []Source `json:"sources_checked"`
 	Recommendation   string   `json:"recommendation"`
 	MessageType      string   `json:"message_type"`
+
+	// Claims is the per-claim breakdown for messages mixing several statements
+	Claims []Claim `json:"claims,omitempty"`
+	// Social describes the video or post for YouTube, Instagram and X links
+	Social *SocialContext `json:"social,omitempty"`
+	// Developing marks breaking stories whose verdict may still change
+	Developing bool `json:"developing,omitempty"`
+	// Topic is the subject area (health, elections, disasters), used to
+	// point readers to the matching authoritative resources
+	Topic string `json:"topic,omitempty"`
+
+	// Metadata identifying the backend run, for tracing and disputes
+	ModelVersion   string  `json:"model_version,omitempty"`
+	AnalysisID     string  `json:"analysis_id,omitempty"`
+	ProcessingTime float64 `json:"processing_time,omitempty"` // seconds
+	// SchemaVersion of the response, checked by validateAnalysis
+	SchemaVersion int `json:"schema_version,omitempty"`
+	// Publisher is the outlet satire or opinion comes from, named in the reply
+	Publisher string `json:"publisher,omitempty"`
+
+	// similarity is set when the result was reused from a near-duplicate message
+	similarity float64
+	// claimKey identifies the claim across exact and near-duplicate copies
+	claimKey string
+	// analyzedSeconds of totalSeconds were checked when a recording was cut short
+	analyzedSeconds, totalSeconds int
+}
+
+// Messenger is the part of the WhatsApp client the message pipeline uses to
+// send and fetch media, so replay mode can substitute a recorder
+type Messenger interface {
+	SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+	Upload(ctx context.Context, plaintext []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error)
+	Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error)
 }
 
 var (
-	client *whatsmeow.Client
-	config Config
+	messenger Messenger
+	client    *whatsmeow.Client
+	config    Config
+	startedAt = time.Now()
 )
 
 func init() {
 	config = Config{
-		BackendURL: getEnv("BACKEND_URL", "http://localhost:8000"),
+		BackendURL:    getEnv("BACKEND_URL", "http://localhost:8000"),
+		BotDBPath:     dataPath(getEnv("BOT_DB_PATH", "aletheia_bot.db")),
+		MigrateBackup: getEnvBool("MIGRATE_BACKUP", true),
+		SessionDBPath: dataPath(getEnv("SESSION_DB_PATH", "whatsapp_session.db")),
+		DataDir:       os.Getenv("DATA_DIR"),
+		LoginQRFile:   dataPath(os.Getenv("LOGIN_QR_FILE")),
+		LoginQRAddr:   os.Getenv("LOGIN_QR_ADDR"),
+		DatabaseURL:   envSecret("DATABASE_URL"),
+		InstanceID:    getEnv("INSTANCE_ID", defaultInstanceID()),
+		OwnerJIDs:     getEnvJIDs("OWNER_JIDS"),
+		AdminJIDs:     getEnvJIDs("ADMIN_JIDS"),
+		ModeratorJIDs: getEnvJIDs("MODERATOR_JIDS"),
+		AllowlistJIDs: getEnvJIDs("ALLOWLIST_JIDS"),
+		BlocklistJIDs: getEnvJIDs("BLOCKLIST_JIDS"),
+		TimeZone:      time.UTC,
+
+		DefaultLanguage:   getEnv("DEFAULT_LANGUAGE", "auto"),
+		DefaultVerbosity:  getEnv("DEFAULT_VERBOSITY", verbosityFull),
+		DefaultThreshold:  getEnvFloat("DEFAULT_THRESHOLD", 0),
+		DefaultMode:       getEnv("DEFAULT_MODE", modeAuto),
+		DefaultCooldown:   getEnvDuration("DEFAULT_COOLDOWN", 0),
+		DefaultFormat:     getEnv("DEFAULT_FORMAT", formatRich),
+		DefaultConfidence: getEnv("DEFAULT_CONFIDENCE", confidenceBar),
+		DefaultHistory:    getEnvBool("DEFAULT_HISTORY", false),
+
+		NormalizeText: getEnvBool("NORMALIZE_TEXT", true),
+		ScrubPII:      getEnvBool("PII_SCRUB", true),
+		ScrubNames:    getEnvBool("PII_SCRUB_NAMES", false),
+
+		MinTextLength:  getEnvInt("PREFILTER_MIN_LENGTH", 10),
+		SkipGreetings:  getEnvBool("PREFILTER_SKIP_GREETINGS", true),
+		SkipBotReplies: getEnvBool("PREFILTER_SKIP_BOT_REPLIES", true),
+		ChitChatFilter: getEnvBool("PREFILTER_CHITCHAT", false),
+
+		CacheTTL:                   getEnvDuration("CACHE_TTL", 6*time.Hour),
+		CacheMaxEntries:            getEnvInt("CACHE_MAX_ENTRIES", 5000),
+		CacheStore:                 getEnv("CACHE_STORE", cacheStoreMemory),
+		RedisURL:                   getEnv("REDIS_URL", "redis://localhost:6379/0"),
+		RedisPassword:              envSecret("REDIS_PASSWORD"),
+		RedisPrefix:                getEnv("REDIS_PREFIX", "aletheia:"),
+		SimHashMaxDistance:         getEnvInt("SIMHASH_MAX_DISTANCE", 16),
+		NearDuplicateMinSimilarity: getEnvFloat("NEAR_DUPLICATE_MIN_SIMILARITY", 0.8),
+
+		TranslationProvider:   getEnv("TRANSLATION_PROVIDER", translateBackend),
+		GoogleTranslateAPIKey: envSecret("GOOGLE_TRANSLATE_API_KEY"),
+
+		ResponseTemplateDir: os.Getenv("RESPONSE_TEMPLATE_DIR"),
+
+		VerdictCardImage:  getEnvBool("VERDICT_CARD_IMAGE", false),
+		SourceLinkPreview: getEnvBool("SOURCE_LINK_PREVIEW", false),
+
+		MaxReplyLength: getEnvInt("MAX_REPLY_LENGTH", 4000),
+		ReplyOverflow:  getEnv("REPLY_OVERFLOW", overflowSplit),
+
+		FollowUpTTL: getEnvDuration("FOLLOWUP_TTL", 15*time.Minute),
+
+		GoogleFactCheckAPIKey: envSecret("GOOGLE_FACTCHECK_API_KEY"),
+
+		HoaxListPath:    getEnv("HOAX_LIST_PATH", "hoaxes.json"),
+		ScamNumbersPath: getEnv("SCAM_NUMBERS_PATH", "scam_numbers.txt"),
+
+		LinkCheck:          getEnvBool("LINK_CHECK", true),
+		BlockedDomainsPath: getEnv("BLOCKED_DOMAINS_PATH", "blocked_domains.txt"),
+		SafeBrowsingAPIKey: envSecret("SAFE_BROWSING_API_KEY"),
+		PhishTank:          getEnvBool("PHISHTANK", false),
+		PhishTankAppKey:    envSecret("PHISHTANK_APP_KEY"),
+
+		DomainReputationPath: getEnv("DOMAIN_REPUTATION_PATH", "domain_reputation.txt"),
+		ResourcesPath:        getEnv("RESOURCES_PATH", "resources.json"),
+		SocialAnalysis:       getEnvBool("SOCIAL_ANALYSIS", true),
+
+		HistoryRetention: getEnvDuration("HISTORY_RETENTION", 90*24*time.Hour),
+
+		TrendsSource:       getEnv("TRENDS_SOURCE", trendsLocal),
+		TrendsWindow:       getEnvDuration("TRENDS_WINDOW", 6*time.Hour),
+		TrendsMinChats:     getEnvInt("TRENDS_MIN_CHATS", 3),
+		TrendsPollInterval: getEnvDuration("TRENDS_POLL_INTERVAL", 15*time.Minute),
+
+		CrisisThreshold:          getEnvFloat("CRISIS_THRESHOLD", 0.5),
+		CrisisCooldown:           getEnvDuration("CRISIS_COOLDOWN", 0),
+		CrisisWorkers:            getEnvInt("CRISIS_WORKERS", 8),
+		CrisisTrendsPollInterval: getEnvDuration("CRISIS_TRENDS_POLL_INTERVAL", 5*time.Minute),
+
+		BroadcastInterval: getEnvDuration("BROADCAST_INTERVAL", 3*time.Second),
+
+		SendRate:         getEnvFloat("SEND_RATE", 2),
+		SendChatInterval: getEnvDuration("SEND_CHAT_INTERVAL", time.Second),
+		SendJitter:       getEnvDuration("SEND_JITTER", 500*time.Millisecond),
+
+		BanRiskFailures: getEnvInt("BAN_RISK_FAILURES", 10),
+		BanRiskWindow:   getEnvDuration("BAN_RISK_WINDOW", 10*time.Minute),
+		BanRiskThrottle: getEnvDuration("BAN_RISK_THROTTLE", time.Hour),
+		BanRiskSlowdown: getEnvFloat("BAN_RISK_SLOWDOWN", 4),
+		SendRetryWait:   getEnvDuration("SEND_RETRY_WAIT", 30*time.Second),
+		OutboxMaxAge:    getEnvDuration("OUTBOX_MAX_AGE", 6*time.Hour),
+
+		KeepAliveHoldAfter: getEnvInt("KEEPALIVE_HOLD_AFTER", 2),
+		KeepAliveMaxFail:   getEnvDuration("KEEPALIVE_MAX_FAIL", 3*time.Minute),
+		PhoneRerequest:     getEnvBool("PHONE_REREQUEST", true),
+		PhonePresence:      getEnvBool("PHONE_PRESENCE", false),
+
+		SecretsProvider: getEnv("SECRETS_PROVIDER", secretsEnv),
+		SecretsDir:      getEnv("SECRETS_DIR", "/run/secrets"),
+		VaultAddr:       getEnv("VAULT_ADDR", "http://127.0.0.1:8200"),
+		VaultToken:      os.Getenv("VAULT_TOKEN"),
+		VaultSecretPath: getEnv("VAULT_SECRET_PATH", "secret/data/aletheia"),
+		AWSSecretID:     os.Getenv("AWS_SECRET_ID"),
+		AWSRegion:       getEnv("AWS_REGION", "us-east-1"),
+
+		ExportSalt: envSecret("EXPORT_SALT"),
+
+		DBEncryptionKey:     envSecret("DB_ENCRYPTION_KEY"),
+		DBEncryptionKeyFile: os.Getenv("DB_ENCRYPTION_KEY_FILE"),
+
+		DashboardAddr:  os.Getenv("DASHBOARD_ADDR"),
+		DashboardToken: envSecret("DASHBOARD_TOKEN"),
+
+		DashboardURL:        strings.TrimRight(os.Getenv("DASHBOARD_URL"), "/"),
+		LinkCodeTTL:         getEnvDuration("LINK_CODE_TTL", 10*time.Minute),
+		DashboardSessionTTL: getEnvDuration("DASHBOARD_SESSION_TTL", 7*24*time.Hour),
+
+		ShareBaseURL: strings.TrimRight(os.Getenv("SHARE_BASE_URL"), "/"),
+		ShareAddr:    os.Getenv("SHARE_ADDR"),
+
+		AdminTOTPSecrets: envSecret("ADMIN_TOTP_SECRETS"),
+
+		DebugEndpoints: getEnvBool("DEBUG_ENDPOINTS", false),
+
+		LogBufferLines: getEnvInt("LOG_BUFFER_LINES", 1000),
+		LogFormat:      strings.ToLower(getEnv("LOG_FORMAT", logFormatText)),
+
+		DryRun: getEnvBool("DRY_RUN", false),
+
+		BreakerThreshold: getEnvInt("BREAKER_THRESHOLD", 5),
+		BreakerCooldown:  getEnvDuration("BREAKER_COOLDOWN", 30*time.Second),
+
+		BackendRetryAfter:    getEnvDuration("BACKEND_RETRY_AFTER", 30*time.Second),
+		BackendMaxRetryAfter: getEnvDuration("BACKEND_MAX_RETRY_AFTER", 5*time.Minute),
+
+		BackendGzipOver:         getEnvInt("BACKEND_GZIP_OVER", 4096),
+		BackendMaxResponseBytes: int64(getEnvInt("BACKEND_MAX_RESPONSE_BYTES", 2<<20)),
+
+		BackendWireFormat: getEnv("BACKEND_WIRE_FORMAT", wireJSON),
+
+		SenderThresholds: parseSenderThresholds(getEnv("SENDER_THRESHOLDS", "")),
+
+		BackendSwitchWatch: getEnvDuration("BACKEND_SWITCH_WATCH", 10*time.Minute),
+
+		CanaryBackendURL:      strings.TrimRight(os.Getenv("CANARY_BACKEND_URL"), "/"),
+		CanaryPercent:         getEnvInt("CANARY_PERCENT", 0),
+		CanaryConfidenceDelta: getEnvFloat("CANARY_CONFIDENCE_DELTA", 0.2),
+
+		BackendRetries: getEnvInt("BACKEND_RETRIES", 2),
+
+		Workers:   getEnvInt("WORKERS", 4),
+		QueueSize: getEnvInt("QUEUE_SIZE", 1000),
+
+		GroupInfoTTL:   getEnvDuration("GROUP_INFO_TTL", 10*time.Minute),
+		LargeGroupSize: getEnvInt("LARGE_GROUP_SIZE", 500),
+		GroupScan:      getEnvBool("GROUP_SCAN", true),
+		HistoryScanMax: getEnvInt("HISTORY_SCAN_MAX", 500),
+		HistorySync:    getEnvBool("HISTORY_SYNC", false),
+
+		AlbumWait: getEnvDuration("ALBUM_WAIT", 5*time.Second),
+
+		MediaAnalysis:     getEnvBool("MEDIA_ANALYSIS", true),
+		MediaMaxSeconds:   getEnvInt("MEDIA_MAX_SECONDS", 90),
+		MediaMaxBytes:     getEnvInt("MEDIA_MAX_BYTES", 64<<20),
+		FFmpegPath:        getEnv("FFMPEG_PATH", "ffmpeg"),
+		MediaRetryTimeout: getEnvDuration("MEDIA_RETRY_TIMEOUT", 2*time.Minute),
+		TempDir:           os.Getenv("TEMP_DIR"),
+		AsyncAnalysis:     getEnvBool("ASYNC_ANALYSIS", false),
+		CallbackAddr:      getEnv("CALLBACK_ADDR", ":8091"),
+		CallbackURL:       os.Getenv("CALLBACK_URL"),
+		AsyncJobTimeout:   getEnvDuration("ASYNC_JOB_TIMEOUT", 30*time.Minute),
+
+		MediaUploadOver:   getEnvInt("MEDIA_UPLOAD_OVER", 0),
+		MediaUploadURLTTL: getEnvDuration("MEDIA_UPLOAD_URL_TTL", 15*time.Minute),
+
+		ArchiveMedia:     getEnvBool("ARCHIVE_MEDIA", false),
+		ArchiveOriginals: getEnvBool("ARCHIVE_ORIGINALS", false),
+		ArchiveStorage:   getEnv("ARCHIVE_STORAGE", storageDisk),
+		ArchiveDir:       dataPath(getEnv("ARCHIVE_DIR", "archive")),
+		ArchiveRetention: getEnvDuration("ARCHIVE_RETENTION", 30*24*time.Hour),
+		S3Endpoint:       os.Getenv("S3_ENDPOINT"),
+		S3Bucket:         os.Getenv("S3_BUCKET"),
+		S3Region:         getEnv("S3_REGION", "us-east-1"),
+		S3AccessKey:      envSecret("S3_ACCESS_KEY"),
+		S3SecretKey:      envSecret("S3_SECRET_KEY"),
+
+		RepostWindow: getEnvDuration("REPOST_WINDOW", 2*time.Hour),
+
+		RecheckAfter:           getEnvDuration("RECHECK_AFTER", 6*time.Hour),
+		RecheckBelowConfidence: getEnvFloat("RECHECK_BELOW_CONFIDENCE", 0.6),
+
+		VerdictPoll: getEnvBool("VERDICT_POLL", false),
+
+		ExperimentName:     getEnv("EXPERIMENT_NAME", "format"),
+		ExperimentVariants: parseVariants(os.Getenv("EXPERIMENT_VARIANTS")),
+
+		FeatureFlags: parseFeatureFlags(os.Getenv("FEATURE_FLAGS")),
+	}
+
+	if tz, err := time.LoadLocation(getEnv("BOT_TIMEZONE", "Asia/Kolkata")); err == nil {
+		config.TimeZone = tz
+	} else {
+		fmt.Printf("Invalid BOT_TIMEZONE, using UTC: %v\n", err)
+	}
+
+	if spec := os.Getenv("QUIET_HOURS"); spec != "" {
+		q, err := parseQuietHours(spec, os.Getenv("QUIET_MODE"))
+		if err != nil {
+			fmt.Printf("Ignoring invalid QUIET_HOURS: %v\n", err)
+		} else {
+			config.QuietHours = q
+		}
 	}
 }
 
@@ -62,331 +627,1067 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvFloat parses a float environment variable, falling back to defaultValue
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		fmt.Printf("Ignoring invalid %s %q: %v\n", key, value, err)
+		return defaultValue
+	}
+	return f
+}
+
+// getEnvInt parses an integer environment variable, falling back to defaultValue
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Printf("Ignoring invalid %s %q: %v\n", key, value, err)
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvDuration parses a duration environment variable like "30s" or "6h"
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Printf("Ignoring invalid %s %q: %v\n", key, value, err)
+		return defaultValue
+	}
+	return d
+}
+
+// getEnvBool parses a boolean environment variable, falling back to defaultValue
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		fmt.Printf("Ignoring invalid %s %q: %v\n", key, value, err)
+		return defaultValue
+	}
+	return b
+}
+
+// getEnvJIDs parses a comma-separated list of JIDs or phone numbers
+func getEnvJIDs(key string) []types.JID {
+	var jids []types.JID
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		jid, err := parseJIDArg(item)
+		if err != nil {
+			fmt.Printf("Ignoring invalid JID %q in %s: %v\n", item, key, err)
+			continue
+		}
+		jids = append(jids, jid)
+	}
+	return jids
+}
+
+// idempotencyKey identifies a message to the backend without revealing its
+// WhatsApp ID, so retries of the same analysis can be recognized and logs correlated
+func idempotencyKey(info types.MessageInfo) string {
+	sum := sha256.Sum256([]byte(info.Chat.String() + "/" + string(info.ID)))
+	return hex.EncodeToString(sum[:16])
+}
+
 // analyzeText calls the backend API to analyze text for misinformation
-func analyzeText(text string) (*AnalyzeResponse, error) {
-	reqBody := AnalyzeRequest{Text: text}
-	jsonBody, err := json.Marshal(reqBody)
+func analyzeText(text, language, key string, senders []string) (*AnalyzeResponse, error) {
+	result, err := analyzeTextAt(backendURL(), text, language, key, senders)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
 	}
+	logAnalysis(result)
+	shadowCanary("text", key, result, func(base string) (*AnalyzeResponse, error) {
+		return analyzeTextAt(base, text, language, key, senders)
+	})
+	return result, nil
+}
 
-	resp, err := http.Post(
-		fmt.Sprintf("%s/analyze/text", config.BackendURL),
-		"application/json",
-		bytes.NewBuffer(jsonBody),
-	)
+// analyzeTextAt analyzes text with the backend at base
+func analyzeTextAt(base, text, language, key string, senders []string) (*AnalyzeResponse, error) {
+	reqBody := &AnalyzeRequest{Text: text, Language: language, SenderTypes: senders}
+	resp, err := postAnalyzeText(base, reqBody, key, useProtobuf())
+	if err == nil && useProtobuf() &&
+		(resp.StatusCode == http.StatusUnsupportedMediaType || resp.StatusCode == http.StatusUnprocessableEntity) {
+		// A backend that predates protobuf support rejects the body
+		resp.Body.Close()
+		fmt.Printf("Backend %s rejected protobuf, retrying with JSON\n", base)
+		resp, err = postAnalyzeText(base, reqBody, key, false)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to call backend: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if err := checkRateLimit(resp); err != nil {
+		return nil, err
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("backend returned status %d", resp.StatusCode)
 	}
 
 	var result AnalyzeResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeAnalysis(resp, &result); err != nil {
+		return nil, err
 	}
-
 	return &result, nil
 }
 
-// formatResponse formats the analysis result for WhatsApp
-func formatResponse(result *AnalyzeResponse) string {
-	var emoji, status string
-	
-	if result.IsMisinformation {
-		if result.Confidence > 0.7 {
-			emoji = "🚨"
-			status = "LIKELY MISINFORMATION"
-		} else {
-			emoji = "⚠️"
-			status = "POTENTIALLY MISLEADING"
-		}
+// postAnalyzeText sends reqBody to the backend's /analyze/text as protobuf or JSON
+func postAnalyzeText(base string, reqBody *AnalyzeRequest, key string, protobuf bool) (*http.Response, error) {
+	var req *http.Request
+	var err error
+	url := fmt.Sprintf("%s/analyze/text", base)
+	if protobuf {
+		req, err = newRequest(url, contentTypeProtobuf, marshalAnalyzeRequest(reqBody))
 	} else {
-		emoji = "✅"
-		status = "APPEARS CREDIBLE"
-	}
-
-	// Create confidence bar
-	filled := int(result.Confidence * 10)
-	bar := ""
-	for i := 0; i < 10; i++ {
-		if i < filled {
-			bar += "█"
-		} else {
-			bar += "░"
+		var jsonBody []byte
+		if jsonBody, err = json.Marshal(reqBody); err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
 		}
+		req, err = newJSONRequest(url, jsonBody)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if protobuf {
+		req.Header.Set("Accept", contentTypeProtobuf+", application/json")
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
 	}
 
-	response := fmt.Sprintf("%s *%s*\n\n*Confidence:* [%s] %.0f%%\n",
-		emoji, status, bar, result.Confidence*100)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call backend: %w", err)
+	}
+	return resp, nil
+}
 
-	if result.Summary != "" {
-		response += fmt.Sprintf("\n*Summary:*\n%s\n", result.Summary)
+// logAnalysis logs the backend run behind a result so it can be traced
+func logAnalysis(result *AnalyzeResponse) {
+	if result.AnalysisID == "" {
+		return
 	}
+	fmt.Printf("Backend analysis %s (model %s) took %.2fs\n", result.AnalysisID, result.ModelVersion, result.ProcessingTime)
+}
 
-	if len(result.Evidence) > 0 {
-		response += "\n*Evidence:*\n"
-		for i, e := range result.Evidence {
-			if i >= 3 {
-				break
-			}
-			response += fmt.Sprintf("• %s\n", e)
-		}
+// verdictEmoji returns the emoji reacted with for an analysis result. Satire
+// and empty verdicts get their note's emoji rather than a verdict's.
+func verdictEmoji(result *AnalyzeResponse) string {
+	switch {
+	case result.isSatire():
+		return "🎭"
+	case isHollowVerdict(result):
+		return "❓"
 	}
+	emoji, _ := verdictStatus(result, messagesFor(""))
+	return emoji
+}
 
-	if len(result.SourcesChecked) > 0 {
-		response += "\n*Sources:*\n"
-		for i, s := range result.SourcesChecked {
-			if i >= 3 {
-				break
-			}
-			response += fmt.Sprintf("• %s\n", s)
+// verdictStatus returns the emoji and headline for an analysis result
+func verdictStatus(result *AnalyzeResponse, m *Messages) (string, string) {
+	if result.isUnverifiable() {
+		return "🟡", m.Unverifiable
+	}
+	if result.IsMisinformation {
+		if result.Confidence > 0.7 {
+			return "🚨", m.LikelyMisinformation
 		}
+		return "⚠️", m.PotentiallyMisleading
 	}
+	return "✅", m.AppearsCredible
+}
 
-	if result.Recommendation != "" {
-		response += fmt.Sprintf("\n*Recommendation:*\n%s\n", result.Recommendation)
+// analyzeImage calls the backend API to analyze an image, with its caption
+// and quoted-message text, for misinformation
+func analyzeImage(imageData []byte, caption, quotedText, key string, senders []string) (*AnalyzeResponse, error) {
+	result, err := analyzeImageAt(backendURL(), imageData, caption, quotedText, key, senders)
+	if err != nil {
+		return nil, err
 	}
-
-	response += "\n_Always verify important news from multiple credible sources._"
-
-	return response
+	logAnalysis(result)
+	shadowCanary("image", key, result, func(base string) (*AnalyzeResponse, error) {
+		return analyzeImageAt(base, imageData, caption, quotedText, key, senders)
+	})
+	return result, nil
 }
 
-// analyzeImage calls the backend API to analyze an image for misinformation
-func analyzeImage(imageData []byte) (*AnalyzeResponse, error) {
+// analyzeImageAt analyzes an image with the backend at base
+func analyzeImageAt(base string, imageData []byte, caption, quotedText, key string, senders []string) (*AnalyzeResponse, error) {
 	// Create multipart form
 	var buf bytes.Buffer
 	writer := multipart.NewWriter(&buf)
-	
+
+	// The caption or the message the image replies to often carries the claim
+	fields := map[string]string{"caption": caption, "context": quotedText, "sender_types": strings.Join(senders, ",")}
+	for field, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(field, value); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", field, err)
+		}
+	}
+
 	part, err := writer.CreateFormFile("file", "image.jpg")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create form file: %w", err)
 	}
-	
+
 	_, err = part.Write(imageData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to write image data: %w", err)
 	}
-	
+
 	err = writer.Close()
 	if err != nil {
 		return nil, fmt.Errorf("failed to close writer: %w", err)
 	}
-	
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/analyze/image", config.BackendURL), &buf)
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/analyze/image", base), &buf)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	
+	if useProtobuf() {
+		req.Header.Set("Accept", contentTypeProtobuf+", application/json")
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
 	httpClient := &http.Client{}
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call backend: %w", err)
 	}
 	defer resp.Body.Close()
-	
+
+	if err := checkRateLimit(resp); err != nil {
+		return nil, err
+	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("backend returned status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("backend returned status %d: %s", resp.StatusCode, errorBody(resp))
 	}
-	
+
 	var result AnalyzeResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeAnalysis(resp, &result); err != nil {
+		return nil, err
 	}
-	
 	return &result, nil
 }
 
 // handleMessage processes incoming messages
 func handleMessage(evt *events.Message) {
 	msg := evt.Message
-	
-	// Check for image message
-	if msg.GetImageMessage() != nil {
-		handleImageMessage(evt)
+	metrics.inc("message_received")
+	noteChatInstance(evt.Info.Chat)
+
+	// Messages a history sync already delivered are old, however late they arrive
+	if config.HistorySync && evt.Info.IsGroup && botStore.isSyncedMessage(evt.Info.Chat, evt.Info.ID) {
+		metrics.inc("skipped_synced")
 		return
 	}
-	
-	// Get the message text
-	text := ""
 
-	if msg.GetConversation() != "" {
-		text = msg.GetConversation()
-	} else if msg.GetExtendedTextMessage() != nil {
-		text = msg.GetExtendedTextMessage().GetText()
+	// Operators can always run commands, even in chats the bot otherwise ignores
+	text := extractText(msg)
+	if roleOf(evt.Info) > roleNone && handleCommand(evt, text) {
+		return
 	}
 
-	// Ignore empty or very short messages
-	if len(text) < 10 {
+	if !access.isPermitted(evt.Info) {
 		return
 	}
 
-	fmt.Printf("Received message from %s: %s\n", evt.Info.Sender.String(), text)
+	// Observer groups are analyzed for aggregate statistics only; just the
+	// people who manage the group can still run commands, to leave the mode
+	if botStore.getChatSettings(evt.Info.Chat).Mode == modeObserve {
+		if !canManageChat(evt.Info) || !handleCommand(evt, text) {
+			observeMessage(evt, text)
+		}
+		return
+	}
 
-	// Analyze the message
-	result, err := analyzeText(text)
-	if err != nil {
-		fmt.Printf("Error analyzing message: %v\n", err)
-		sendMessage(evt, "❌ *Error*\n\nCould not connect to the analysis backend. Please try again later.")
+	if handlePollVote(evt) || handlePin(evt) {
+		return
+	}
+
+	// Greet new users the first time they message the bot directly
+	if !evt.Info.IsGroup {
+		onboardChat(evt.Info.Chat)
+	}
+
+	if handleCommand(evt, text) {
+		return
+	}
+
+	settings := botStore.getChatSettings(evt.Info.Chat)
+	if settings.History && evt.Info.IsGroup {
+		botStore.keepMessage(evt, text)
+	}
+
+	// Replies to a recent verdict are follow-up questions about it
+	if handleFollowUp(evt, text, settings) {
+		return
+	}
+
+	if settings.Mode != modeAuto && settings.Mode != modeShadow {
+		return
+	}
+
+	if item := mediaItemFrom(msg); item != nil {
+		if config.MediaAnalysis {
+			handleMediaMessage(evt, item, settings, false)
+		}
+		return
+	}
+
+	if contacts := sharedContacts(msg); len(contacts) > 0 {
+		handleContactMessage(evt, contacts, settings, false)
+		return
+	}
+	if isLocation(msg) {
+		fmt.Println("Location message, ignoring")
+		metrics.inc("skipped_location")
+		return
+	}
+
+	// Images sent together as an album get one combined verdict
+	if collectAlbum(evt, settings) {
 		return
 	}
 
+	// Check for image message
+	if imgMsg := msg.GetImageMessage(); imgMsg != nil {
+		handleImageMessage(evt, imgMsg, settings, false)
+		return
+	}
+
+	// Scam and phishing links get a link warning instead of a verdict
+	if handleScamLinks(evt, text, settings, false) {
+		return
+	}
+
+	// Skip messages that obviously aren't claims without calling the backend
+	text = prepareText(text)
+	if reason := prefilterReason(evt, text); reason != "" {
+		metrics.inc("prefiltered")
+		if reason != "too short" {
+			fmt.Printf("Skipping message %s: %s\n", evt.Info.ID, reason)
+		}
+		return
+	}
+
+	handleTextMessage(evt, text, settings, false)
+}
+
+// extractText returns the plain text of a text message
+func extractText(msg *waE2E.Message) string {
+	if msg.GetConversation() != "" {
+		return msg.GetConversation()
+	}
+	return msg.GetExtendedTextMessage().GetText()
+}
+
+// prepareText normalizes message text (when enabled) so obfuscated copies of
+// a claim look the same to the cache and the backend
+func prepareText(text string) string {
+	if !config.NormalizeText {
+		return strings.TrimSpace(text)
+	}
+	return normalizeText(text)
+}
+
+// handleTextMessage analyzes text and replies with the verdict. Explicit
+// checks (via /check) always get a reply; automatic ones stay silent for
+// non-news and below the chat's confidence threshold.
+func handleTextMessage(evt *events.Message, text string, settings *ChatSettings, explicit bool) {
+	fmt.Printf("Received message from %s:%s\n", evt.Info.Sender.String(), logContent(text))
+
+	// Tell the backend which language the message is in and reply in it
+	language := detectLanguage(text)
+	local := *settings
+	local.Language = replyLanguage(settings.Language, language)
+	settings = &local
+
+	// Known hoaxes get an instant canned verdict without calling the backend
+	result := matchHoax(text)
+	if result != nil {
+		fmt.Println("Matched a known hoax locally")
+		metrics.inc("local_match")
+	} else {
+		// Mask personal data before the text leaves the bot
+		backendText := text
+		if config.ScrubPII {
+			backendText = scrubPII(text, evt.Info.PushName)
+		}
+
+		// Flag low-credibility links now; the full verdict follows
+		noteLowCredibilityLinks(evt, text, settings, explicit)
+
+		// Analyze the message
+		var err error
+		key := idempotencyKey(evt.Info)
+		fmt.Printf("Analyzing message %s (idempotency key %s)\n", evt.Info.ID, key)
+		if link := socialLink(text); link != "" && config.SocialAnalysis {
+			fmt.Printf("Analyzing social link:%s\n", logContent(link))
+			result, err = analyzeSocialCached(link, text, backendText, language, key)
+		} else {
+			result, err = analyzeTextCached(text, backendText, language, key, senderTypes(evt.Info))
+		}
+		if err != nil {
+			fmt.Printf("Error analyzing message: %v\n", err)
+			if delayRateLimited(evt, err) {
+				return
+			}
+			metrics.fail("backend_error", err)
+			if backendBreaker.isOpen() {
+				deferMessage(evt)
+				return
+			}
+			botStore.deadLetter(evt, err)
+			sendError(evt, "❌ *Error*\n\nCould not connect to the analysis backend. Please try again later.")
+			return
+		}
+	}
+	metrics.inc("analyzed_text")
+	botStore.recordAnalysis(evt.Info, "text", language, result)
+	go notifyWatchers(evt, text, result)
+
 	// If not news, silently ignore
 	if !result.IsNews {
-		fmt.Printf("Not news, ignoring: %s\n", text)
+		fmt.Printf("Not news, ignoring:%s\n", logContent(text))
+		if explicit {
+			sendMessage(evt, notNewsReply(result, settings.Language))
+		}
 		return
 	}
 
 	// Send the response
-	response := formatResponse(result)
-	sendMessage(evt, response)
+	sendVerdict(evt, result, settings, explicit)
+}
+
+// imageContext returns an image's caption and the text of the message it
+// replies to, prepared like message text
+func imageContext(imgMsg *waE2E.ImageMessage) (string, string) {
+	caption := prepareText(imgMsg.GetCaption())
+	quotedText := ""
+	if quoted := imgMsg.GetContextInfo().GetQuotedMessage(); quoted != nil {
+		quotedText = extractText(quoted)
+		if quotedText == "" {
+			quotedText = quoted.GetImageMessage().GetCaption()
+		}
+		quotedText = prepareText(quotedText)
+	}
+	return caption, quotedText
 }
 
 // handleImageMessage processes incoming image messages
-func handleImageMessage(evt *events.Message) {
+func handleImageMessage(evt *events.Message, imgMsg *waE2E.ImageMessage, settings *ChatSettings, explicit bool) {
 	fmt.Printf("Received image from %s\n", evt.Info.Sender.String())
-	
-	imgMsg := evt.Message.GetImageMessage()
-	if imgMsg == nil {
-		return
-	}
-	
+
 	// Download the image
-	data, err := client.Download(context.Background(), imgMsg)
+	data, err := messenger.Download(context.Background(), imgMsg)
 	if err != nil {
 		fmt.Printf("Error downloading image: %v\n", err)
-		sendMessage(evt, "❌ *Error*\n\nCould not download the image. Please try again.")
+		metrics.fail("download_error", err)
+		failure := "❌ *Error*\n\nCould not download the image. Please try again."
+		if !retryMediaDownload(evt, imgMsg, err, failure) {
+			sendError(evt, failure)
+		}
 		return
 	}
-	
+
 	// Analyze the image
-	result, err := analyzeImage(data)
+	caption, quotedText := imageContext(imgMsg)
+	if config.ScrubPII {
+		caption, quotedText = scrubPII(caption, evt.Info.PushName), scrubPII(quotedText, evt.Info.PushName)
+	}
+
+	key := idempotencyKey(evt.Info)
+	fmt.Printf("Analyzing image %s (idempotency key %s)\n", evt.Info.ID, key)
+	result, err := analyzeImageCached(data, caption, quotedText, key, senderTypes(evt.Info))
 	if err != nil {
 		fmt.Printf("Error analyzing image: %v\n", err)
-		sendMessage(evt, "❌ *Error*\n\nCould not analyze the image. Please try again later.")
+		if delayRateLimited(evt, err) {
+			return
+		}
+		metrics.fail("backend_error", err)
+		if backendBreaker.isOpen() {
+			deferMessage(evt)
+			return
+		}
+		botStore.deadLetter(evt, err)
+		sendError(evt, "❌ *Error*\n\nCould not analyze the image. Please try again later.")
 		return
 	}
-	
+	metrics.inc("analyzed_image")
+	botStore.recordAnalysis(evt.Info, "image", "", result)
+	go archiveMedia(evt.Info, "image", sha256Hex(data), data, imgMsg.GetJPEGThumbnail(), imgMsg.GetMimetype(), result)
+
 	// If not news image, silently ignore
 	if !result.IsNews {
 		fmt.Println("Not news image, ignoring")
+		if explicit {
+			sendMessage(evt, notNewsReply(result, settings.Language))
+		}
 		return
 	}
-	
+
 	// Send the response
-	response := formatResponse(result)
-	sendMessage(evt, response)
+	sendVerdict(evt, result, settings, explicit)
+}
+
+// sendVerdict replies with the formatted analysis, respecting the chat's
+// verbosity, confidence threshold and quiet hours
+func sendVerdict(evt *events.Message, result *AnalyzeResponse, settings *ChatSettings, explicit bool) {
+	if threshold := senderThreshold(senderTypes(evt.Info), settings.Threshold); !explicit && result.Confidence < threshold {
+		fmt.Printf("Confidence %.2f below threshold %.2f, not replying\n", result.Confidence, threshold)
+		return
+	}
+
+	// The card is drawn from the untranslated result since its fonts are Latin-only
+	original := result
+	result = translateResult(result, settings.Language)
+
+	// Shadow chats get the full pipeline but only a log line; explicit checks still answer
+	if config.DryRun || (settings.Mode == modeShadow && !explicit) {
+		fmt.Printf("[shadow] Verdict for %s not sent:%s\n", evt.Info.Chat, logContent(formatResponse(result, settings.Language, settings.confidenceStyle())))
+		metrics.inc("shadow_verdict")
+		return
+	}
+	// Satire gets said as much instead of a verdict that would call it false,
+	// and an empty verdict a cautionary note instead of a half-empty reply.
+	// Either is sent like a verdict from here on.
+	note := ""
+	if original.isSatire() {
+		fmt.Printf("Satire in %s, sending the satire note\n", evt.Info.Chat)
+		metrics.inc("satire")
+		note = contentTypeReply(original, settings.Language)
+	} else if isHollowVerdict(original) {
+		fmt.Printf("Backend returned an empty verdict for %s, sending the cautionary reply\n", evt.Info.Chat)
+		metrics.inc("empty_verdict")
+		note = messagesFor(settings.Language).CouldNotVerify
+	}
+	// Groups arguing by reposting claims get at most one automatic verdict per cooldown
+	if !explicit && !takeCooldown(evt.Info.Chat, settings) {
+		fmt.Printf("Chat %s is on cooldown, not replying\n", evt.Info.Chat)
+		metrics.inc("cooldown_skipped")
+		return
+	}
+	// A claim reposted soon after its verdict gets a pointer to that verdict
+	if earlier, ok := earlierVerdict(evt.Info.Chat, original.claimKey); ok && !explicit {
+		fmt.Printf("Claim already checked in %s, pointing to %s\n", evt.Info.Chat, earlier.id)
+		metrics.inc("repost")
+		sendAlreadyChecked(evt, earlier, result, settings.Language)
+		return
+	}
+	// Chats in a format experiment get their variant's format for automatic verdicts
+	variant := ""
+	if !explicit && note == "" {
+		variant = experimentVariant(evt.Info.Chat)
+	}
+	if variant != "" {
+		recordExperimentEvent(evt.Info.Chat, experimentVerdict)
+		local := *settings
+		switch variant {
+		case variantFull:
+			local.Verbosity = verbosityFull
+		case variantShort:
+			local.Verbosity = verbosityShort
+		}
+		settings = &local
+	}
+
+	// In very large groups a reply would notify hundreds of people, and in
+	// announcement groups only admins can post; react instead
+	readOnly := cannotPost(evt.Info.Chat)
+	if variant == variantReaction || readOnly || (!explicit && isLargeGroup(evt.Info.Chat)) {
+		react(evt.Info.Chat, evt.Info.Sender, evt.Info.ID, verdictEmoji(result))
+		// Replying /more to the reacted message shows the details
+		if note == "" {
+			botStore.recordReactedVerdict(evt.Info.Chat, evt.Info.ID, original, settings.Language)
+		}
+		// The admin who posted a flagged announcement hears why, privately,
+		// since a /more in the group couldn't be answered there
+		if readOnly && (explicit || result.IsMisinformation || note != "") {
+			details := note
+			if details == "" {
+				details = formatResponse(result, settings.Language, settings.confidenceStyle())
+			}
+			if err := sendText(evt.Info.Sender.ToNonAD(), details); err != nil {
+				fmt.Printf("Error sending announcement verdict: %v\n", err)
+			}
+		}
+		return
+	}
+	if note != "" {
+		sendNote(evt, original, note, settings)
+		return
+	}
+	rememberVerdict(evt.Info.Chat, checkedText(evt), original, settings.Language)
+
+	// The card is an image of text screen readers can't read
+	if (config.VerdictCardImage || variant == variantCard) && !inQuietHours(evt.Info.Chat) && settings.Format != formatPlain {
+		card, err := renderVerdictCard(original)
+		if err == nil {
+			caption := withShareLink(formatShortResponse(result, settings.Language, settings.confidenceStyle()), evt.Info.Chat, result, settings.Language)
+			var id types.MessageID
+			id, err = sendQuotedImage(evt.Info.Chat, evt.Info.ID, evt.Info.Sender.String(), evt.Message, card, caption)
+			if err == nil {
+				botStore.recordVerdictMessage(evt.Info.Chat, id, original, settings.Language, maxListedItems, 0)
+				recordPostedVerdict(evt.Info.Chat, original.claimKey, id, caption)
+				botStore.scheduleRecheck(evt, id, caption, original, settings.Language)
+				sendVerdictPoll(evt, original, settings.Language)
+				return
+			}
+		}
+		fmt.Printf("Error sending verdict card, falling back to text: %v\n", err)
+	}
+
+	// shown is how many evidence items and sources the reply lists, for /more
+	response, shown := formatResponse(result, settings.Language, settings.confidenceStyle()), maxListedItems
+	if settings.Verbosity == verbosityShort || (tooLong(response) && config.ReplyOverflow == overflowShort) {
+		response, shown = formatShortResponse(result, settings.Language, settings.confidenceStyle()), 0
+	}
+	response = withShareLink(response, evt.Info.Chat, result, settings.Language)
+
+	if q := settings.QuietHours; q != nil && q.Contains(time.Now()) {
+		deferReply(evt, result, response, q)
+		return
+	}
+
+	// Attach a preview card for the top listed source when the reply shows sources
+	var preview *Source
+	if config.SourceLinkPreview && shown > 0 {
+		preview = previewSource(firstN(result.SourcesChecked, maxListedItems))
+	}
+	id, err := sendQuotedTextWithPreview(evt.Info.Chat, evt.Info.ID, evt.Info.Sender.String(), evt.Message, response, preview)
+	if err != nil {
+		fmt.Printf("Error sending message: %v\n", err)
+		metrics.fail("send_error", err)
+		return
+	}
+	botStore.recordVerdictMessage(evt.Info.Chat, id, original, settings.Language, shown, shown)
+	recordPostedVerdict(evt.Info.Chat, original.claimKey, id, response)
+	botStore.scheduleRecheck(evt, id, response, original, settings.Language)
+	sendVerdictPoll(evt, original, settings.Language)
+}
+
+// sendNote replies with the note sent in place of a verdict, queueing it in
+// quiet hours like a verdict. Reposts of the claim point back to it.
+func sendNote(evt *events.Message, result *AnalyzeResponse, note string, settings *ChatSettings) {
+	if q := settings.QuietHours; q != nil && q.Contains(time.Now()) {
+		deferReply(evt, result, note, q)
+		return
+	}
+	id, err := sendQuotedTextWithPreview(evt.Info.Chat, evt.Info.ID, evt.Info.Sender.String(), evt.Message, note, nil)
+	if err != nil {
+		fmt.Printf("Error sending message: %v\n", err)
+		metrics.fail("send_error", err)
+		return
+	}
+	recordPostedVerdict(evt.Info.Chat, result.claimKey, id, note)
+}
+
+// muted reports whether an automatic notice for evt must not be sent because
+// of dry-run, shadow mode or quiet hours; explicit checks are always answered
+func muted(evt *events.Message, settings *ChatSettings, explicit bool) bool {
+	return !explicit && (config.DryRun || settings.Mode == modeShadow || inQuietHours(evt.Info.Chat))
+}
+
+// sendError replies with an error notice unless the chat is in quiet hours or shadow mode
+func sendError(evt *events.Message, text string) {
+	if inQuietHours(evt.Info.Chat) || isShadowChat(evt.Info.Chat) {
+		return
+	}
+	sendMessage(evt, text)
 }
 
 // sendMessage sends a reply to the specific message
 func sendMessage(evt *events.Message, text string) {
+	var err error
+	if evt.Info.IsGroup && cannotPost(evt.Info.Chat) {
+		// Admins run commands in announcement groups the bot can't post in
+		err = sendText(evt.Info.Sender.ToNonAD(), text)
+	} else {
+		err = sendQuotedText(evt.Info.Chat, evt.Info.ID, evt.Info.Sender.String(), evt.Message, text)
+	}
+	if err != nil {
+		fmt.Printf("Error sending message: %v\n", err)
+		metrics.fail("send_error", err)
+	}
+}
+
+// sendText sends a standalone (non-reply) text message to chat
+func sendText(chat types.JID, text string) error {
+	if isPlainChat(chat) {
+		text = plainText(text)
+	}
+	msg := &waE2E.Message{
+		Conversation: proto.String(text),
+	}
+	_, err := messenger.SendMessage(context.Background(), chat, msg)
+	return err
+}
+
+// sendDocument uploads data and sends it to chat as a file attachment
+func sendDocument(chat types.JID, data []byte, fileName, mimeType, caption string) error {
+	uploaded, err := messenger.Upload(context.Background(), data, whatsmeow.MediaDocument)
+	if err != nil {
+		return fmt.Errorf("failed to upload document: %w", err)
+	}
+
+	msg := &waE2E.Message{
+		DocumentMessage: &waE2E.DocumentMessage{
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			Mimetype:      proto.String(mimeType),
+			FileName:      proto.String(fileName),
+			Caption:       proto.String(caption),
+		},
+	}
+	_, err = messenger.SendMessage(context.Background(), chat, msg)
+	return err
+}
+
+// sendQuotedImage uploads a PNG and sends it to chat with a caption, quoting
+// the given message, and returns the sent message's ID
+func sendQuotedImage(chat types.JID, stanzaID, participant string, quoted *waE2E.Message, data []byte, caption string) (types.MessageID, error) {
+	uploaded, err := messenger.Upload(context.Background(), data, whatsmeow.MediaImage)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload image: %w", err)
+	}
+
+	msg := &waE2E.Message{
+		ImageMessage: &waE2E.ImageMessage{
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			Mimetype:      proto.String("image/png"),
+			Caption:       proto.String(caption),
+			ContextInfo: &waE2E.ContextInfo{
+				StanzaID:      proto.String(stanzaID),
+				Participant:   proto.String(participant),
+				QuotedMessage: quoted,
+			},
+		},
+	}
+	resp, err := messenger.SendMessage(context.Background(), chat, msg)
+	return resp.ID, err
+}
+
+// sendQuotedText sends text to chat as a reply quoting the given message
+func sendQuotedText(chat types.JID, stanzaID, participant string, quoted *waE2E.Message, text string) error {
+	_, err := sendQuotedTextWithPreview(chat, stanzaID, participant, quoted, text, nil)
+	return err
+}
+
+// sendQuotedTextWithPreview is sendQuotedText with a link preview for source
+// attached; the source URL must appear in text for clients to show it. It
+// returns the ID of the first (quoting) message sent.
+func sendQuotedTextWithPreview(chat types.JID, stanzaID, participant string, quoted *waE2E.Message, text string, source *Source) (types.MessageID, error) {
 	// Create context info to quote/reply to the original message
 	contextInfo := &waE2E.ContextInfo{
-		StanzaID:      proto.String(evt.Info.ID),
-		Participant:   proto.String(evt.Info.Sender.String()),
-		QuotedMessage: evt.Message,
+		StanzaID:      proto.String(stanzaID),
+		Participant:   proto.String(participant),
+		QuotedMessage: quoted,
 	}
 
+	if isPlainChat(chat) {
+		text = plainText(text)
+	}
+	// Replies over the length limit go out as numbered parts; only the first quotes
+	parts := splitReply(text)
 	msg := &waE2E.Message{
 		ExtendedTextMessage: &waE2E.ExtendedTextMessage{
-			Text:        proto.String(text),
+			Text:        proto.String(parts[0]),
 			ContextInfo: contextInfo,
 		},
 	}
+	if source != nil && strings.Contains(parts[0], source.URL) {
+		// The page's own title, summary and image, where it has them
+		title, description := source.Label(), source.Host()
+		ext := msg.ExtendedTextMessage
+		if page := linkPreview(source.URL); page != nil {
+			title = firstNonEmpty(page.Title, title)
+			description = firstNonEmpty(page.Description, description)
+			if page.Thumbnail != nil {
+				ext.JPEGThumbnail = page.Thumbnail
+				ext.ThumbnailWidth = proto.Uint32(uint32(page.Width))
+				ext.ThumbnailHeight = proto.Uint32(uint32(page.Height))
+				ext.PreviewType = waE2E.ExtendedTextMessage_IMAGE.Enum()
+			}
+		}
+		ext.MatchedText = proto.String(source.URL)
+		ext.Title = proto.String(title)
+		ext.Description = proto.String(description)
+	}
 
-	_, err := client.SendMessage(context.Background(), evt.Info.Chat, msg)
+	resp, err := messenger.SendMessage(context.Background(), chat, msg)
 	if err != nil {
-		fmt.Printf("Error sending message: %v\n", err)
+		return "", err
+	}
+	for _, part := range parts[1:] {
+		if err := sendText(chat, part); err != nil {
+			return resp.ID, err
+		}
 	}
+	return resp.ID, nil
 }
 
 // eventHandler handles all WhatsApp events
 func eventHandler(evt interface{}) {
 	switch v := evt.(type) {
 	case *events.Message:
+		// Timer changes count from any device, including the bot's own phone
+		noteDisappearing(v)
 		// Only handle messages from others (not our own)
 		if !v.Info.IsFromMe {
-			handleMessage(v)
+			messageQueue.push(v)
 		}
+	case *events.JoinedGroup:
+		handleJoinedGroup(v)
+	case *events.GroupInfo:
+		handleGroupInfo(v)
 	case *events.Connected:
 		fmt.Println("✅ Connected to WhatsApp!")
+		sdNotify("READY=1\nSTATUS=Connected")
+		handleConnected()
+		sendPendingBanAlert()
+		go outbox.flush()
+	case *events.HistorySync:
+		handleHistorySync(v)
+	case *events.MediaRetry:
+		handleMediaRetry(v)
+	case *events.Receipt:
+		handleReceipt(v)
+	case *events.TemporaryBan:
+		handleTemporaryBan(v)
+	case *events.ClientOutdated:
+		handleClientOutdated()
 	case *events.Disconnected:
 		fmt.Println("❌ Disconnected from WhatsApp")
+		sdNotify("STATUS=Disconnected, reconnecting")
+		handleDisconnected()
+	case *events.KeepAliveTimeout:
+		handleKeepAliveTimeout(v)
+	case *events.KeepAliveRestored:
+		handleKeepAliveRestored()
+	case *events.OfflineSyncPreview:
+		handleOfflineSync(v)
+	case *events.UndecryptableMessage:
+		handleUndecryptable(v)
+	case *events.Presence:
+		handlePresence(v)
 	case *events.LoggedOut:
-		fmt.Println("🚪 Logged out from WhatsApp")
+		fmt.Printf("🚪 Logged out from WhatsApp (%s)\n", v.Reason)
+		// Restarting can't help until someone links the bot again
+		stopBot(exitAuth)
 	}
 }
 
 func main() {
-	fmt.Println("🤖 Aletheia WhatsApp Bot - Fake News Detection")
-	fmt.Println("================================================")
+	os.Exit(runCLI(os.Args[1:]))
+}
 
-	// Set up database for session storage
-	dbLog := waLog.Stdout("Database", "WARN", true)
+// openDevice opens the WhatsApp session database and returns its device,
+// which has no ID until the bot is logged in
+func openDevice() (*store.Device, error) {
+	dbLog := waLogger("Database")
 	ctx := context.Background()
-	
-	container, err := sqlstore.New(ctx, "sqlite3", "file:whatsapp_session.db?_foreign_keys=on", dbLog)
+
+	sessionDB, err := openDatabase("file:" + config.SessionDBPath + "?_foreign_keys=on")
 	if err != nil {
-		fmt.Printf("Failed to create database: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to open session database: %w", err)
+	}
+	container := sqlstore.NewWithDB(sessionDB, "sqlite3", dbLog)
+	if err := container.Upgrade(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create database: %w", err)
 	}
-
-	// Get device store
 	deviceStore, err := container.GetFirstDevice(ctx)
 	if err != nil {
-		fmt.Printf("Failed to get device: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to get device: %w", err)
 	}
+	return deviceStore, nil
+}
 
-	// Create client
-	clientLog := waLog.Stdout("Client", "WARN", true)
-	client = whatsmeow.NewClient(deviceStore, clientLog)
-	client.AddEventHandler(eventHandler)
+// openBotStore opens the bot's own database. Instances sharing a Postgres
+// database through DATABASE_URL each keep their own session database, since
+// each is a different WhatsApp number.
+func openBotStore() error {
+	dbPath := config.BotDBPath
+	if url := config.DatabaseURL.Get(); url != "" {
+		dbPath = url
+	}
+	var err error
+	botStore, err = openStore(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open bot database: %w", err)
+	}
+	return nil
+}
 
-	// Check if we need to login
-	if client.Store.ID == nil {
-		// New login - show QR code
-		qrChan, _ := client.GetQRChannel(context.Background())
-		err = client.Connect()
-		if err != nil {
-			fmt.Printf("Failed to connect: %v\n", err)
-			os.Exit(1)
-		}
+// setupBot loads everything the bot needs before it connects: resources,
+// templates, the cache, the bot database and what is kept in it
+func setupBot() error {
+	if err := loadResources(config.ResourcesPath); err != nil {
+		return fmt.Errorf("failed to load resources: %w", err)
+	}
+	if err := loadResponseTemplates(config.ResponseTemplateDir); err != nil {
+		return fmt.Errorf("failed to load response templates: %w", err)
+	}
+	if err := openCacheStore(); err != nil {
+		return fmt.Errorf("failed to open cache store: %w", err)
+	}
+	if err := openBotStore(); err != nil {
+		return err
+	}
+	if err := botStore.loadAccessLists(); err != nil {
+		return fmt.Errorf("failed to load access lists: %w", err)
+	}
+	if err := botStore.loadRoles(); err != nil {
+		return fmt.Errorf("failed to load roles: %w", err)
+	}
+	loadFeatureFlags()
+	if err := botStore.importDomainReputation(config.DomainReputationPath); err != nil {
+		return fmt.Errorf("failed to load domain ratings: %w", err)
+	}
+	if err := openMediaUploads(); err != nil {
+		return fmt.Errorf("failed to set up media uploads: %w", err)
+	}
+	if err := openArchive(); err != nil {
+		return fmt.Errorf("failed to open media archive: %w", err)
+	}
+	return nil
+}
 
-		fmt.Println("\n📱 Scan this QR code with WhatsApp to login:")
-		fmt.Println("   (WhatsApp > Settings > Linked Devices > Link a Device)")
-		fmt.Println()
+// runBot is the run subcommand: it connects the logged-in bot and answers
+// messages until interrupted
+func runBot(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	onceLogin := flags.Bool("once-login", false, "link the bot if it isn't yet, then exit instead of running")
+	flags.Parse(args)
+	go runSecretsReloader()
 
-		for evt := range qrChan {
-			if evt.Event == "code" {
-				qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stdout)
-			} else {
-				fmt.Println("Login event:", evt.Event)
-			}
+	// Every return flushes the pipe, so startup failures still reach stdout
+	captureLogs()
+	defer stopLogCapture()
+
+	fmt.Println("🤖 Aletheia WhatsApp Bot - Fake News Detection")
+	fmt.Println("================================================")
+	fmt.Printf("Version %s (%s)\n", version, commit)
+
+	deviceStore, err := openDevice()
+	if err != nil {
+		fmt.Printf("Failed to start: %v\n", err)
+		return 1
+	}
+	if deviceStore.ID == nil {
+		// Without a terminal to log in from, a container can be linked on its
+		// first start through the QR code file or page
+		if config.LoginQRFile == "" && config.LoginQRAddr == "" && !*onceLogin {
+			fmt.Println("Not logged in to WhatsApp. Link the bot first with: whatsapp-bot login")
+			return exitAuth
 		}
-	} else {
-		// Already logged in
-		err = client.Connect()
-		if err != nil {
-			fmt.Printf("Failed to connect: %v\n", err)
-			os.Exit(1)
+		sdNotify("STATUS=Waiting for the QR code to be scanned")
+		if err := linkDevice(deviceStore, "", config.LoginQRFile, config.LoginQRAddr); err != nil {
+			fmt.Printf("Login failed: %v\n", err)
+			return 1
 		}
+		fmt.Printf("✅ Logged in as %s\n", deviceStore.ID.ToNonAD())
+	}
+	if *onceLogin {
+		return 0
 	}
+	if err := setupBot(); err != nil {
+		fmt.Printf("Failed to start: %v\n", err)
+		return 1
+	}
+	defer botStore.Close()
+
+	clientLog := waLogger("Client")
+	client = whatsmeow.NewClient(deviceStore, clientLog)
+	// Messages that can't be decrypted, as when the sender's device is
+	// offline, are asked for from the bot's phone as well
+	client.AutomaticMessageRerequestFromPhone = config.PhoneRerequest
+	whatsmeow.KeepAliveMaxFailTime = config.KeepAliveMaxFail
+	outbox = outboxMessenger{pacedMessenger{client}}
+	messenger = disappearingMessenger{outbox}
+	client.AddEventHandler(eventHandler)
+	if err := client.Connect(); err != nil {
+		fmt.Printf("Failed to connect: %v\n", err)
+		return 1
+	}
+
+	refreshCluster()
+	go runInstanceHeartbeat()
+	go runQuietHoursFlusher()
+	go runHistoryPruner()
+	go runTrendAlerts()
+	go runBroadcastScheduler()
+	go runBackendProbe()
+	go runRechecker()
+	go runArchivePruner()
+	startWorkers(config.Workers)
+	loadCrisisState()
+	startDashboard()
+	startShareServer()
+	startCallbackServer()
 
 	fmt.Println("\n✅ Bot is running! Send any message to analyze it for misinformation.")
-	fmt.Println("   Press Ctrl+C to stop.\n")
+	fmt.Println("   Press Ctrl+C to stop.")
+	fmt.Println()
 
-	// Wait for interrupt signal
+	go runWatchdog()
+
+	// Wait for interrupt signal, or for the bot to stop itself
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
+	code := 0
+	select {
+	case <-c:
+	case code = <-stopRequests:
+	}
 
 	fmt.Println("\n👋 Shutting down...")
+	sdNotify("STOPPING=1")
 	client.Disconnect()
+	return code
+}
+
+// stopRequests carries the exit code of a bot that stops itself
+var stopRequests = make(chan int, 1)
+
+// stopBot makes run shut down and exit with code; only the first request counts
+func stopBot(code int) {
+	select {
+	case stopRequests <- code:
+	default:
+	}
 }
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// maxUnclippedUpload is the largest recording sent as-is when it can't be
+// clipped; the backend's transcription limit is 25 MB
+const maxUnclippedUpload = 24 << 20
+
+// mediaItem is an audio or video message to analyze
+type mediaItem struct {
+	kind     string // audio or video
+	msg      whatsmeow.DownloadableMessage
+	seconds  int
+	length   uint64
+	mimetype string
+	caption  string
+	thumb    []byte
+}
+
+// mediaItemFrom returns the audio or video in msg, or nil if it has neither
+func mediaItemFrom(msg *waE2E.Message) *mediaItem {
+	if audio := msg.GetAudioMessage(); audio != nil {
+		return &mediaItem{kind: "audio", msg: audio, seconds: int(audio.GetSeconds()),
+			length: audio.GetFileLength(), mimetype: audio.GetMimetype()}
+	}
+	if video := msg.GetVideoMessage(); video != nil {
+		return &mediaItem{kind: "video", msg: video, seconds: int(video.GetSeconds()),
+			length: video.GetFileLength(), mimetype: video.GetMimetype(), caption: video.GetCaption(),
+			thumb: video.GetJPEGThumbnail()}
+	}
+	return nil
+}
+
+// clipMedia extracts the audio of the first seconds of a recording with
+// ffmpeg, as a small mono MP3 the backend can transcribe
+func clipMedia(data []byte, seconds int) ([]byte, error) {
+	in, err := os.CreateTemp(config.TempDir, "aletheia-media-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(in.Name())
+	if _, err := in.Write(data); err != nil {
+		in.Close()
+		return nil, err
+	}
+	in.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	var out, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, config.FFmpegPath, "-hide_banner", "-loglevel", "error",
+		"-i", in.Name(), "-t", strconv.Itoa(seconds), "-vn", "-ac", "1", "-ar", "16000", "-b:a", "48k", "-f", "mp3", "pipe:1")
+	cmd.Stdout, cmd.Stderr = &out, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out.Bytes(), nil
+}
+
+// mediaUploads is the bucket large recordings are uploaded to, when
+// MEDIA_UPLOAD_OVER is set
+var mediaUploads *s3BlobStore
+
+// openMediaUploads sets up the upload bucket when MEDIA_UPLOAD_OVER is set
+func openMediaUploads() error {
+	if config.MediaUploadOver <= 0 {
+		return nil
+	}
+	store, err := newS3BlobStore()
+	if err != nil {
+		return err
+	}
+	mediaUploads = store
+	return nil
+}
+
+// analyzeMedia calls the backend API to transcribe and analyze a recording.
+// analyzed is how many seconds of it data covers.
+func analyzeMedia(item *mediaItem, data []byte, fileName string, analyzed int, caption, key string) (*AnalyzeResponse, error) {
+	resp, err := postMedia(item, data, fileName, analyzed, caption, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result AnalyzeResponse
+	if err := decodeAnalysis(resp, &result); err != nil {
+		return nil, err
+	}
+	logAnalysis(&result)
+	return &result, nil
+}
+
+// postMedia sends a recording to the backend with any extra fields,
+// returning the successful response for the caller to read. Recordings over
+// MEDIA_UPLOAD_OVER go through object storage instead of the request body.
+func postMedia(item *mediaItem, data []byte, fileName string, analyzed int, caption, key string, extra map[string]string) (*http.Response, error) {
+	if mediaUploads != nil && len(data) > config.MediaUploadOver {
+		return postMediaURL(item, data, fileName, analyzed, caption, key, extra)
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	fields := map[string]string{
+		"kind":             item.kind,
+		"duration":         strconv.Itoa(item.seconds),
+		"analyzed_seconds": strconv.Itoa(analyzed),
+		"caption":          caption,
+	}
+	for field, value := range extra {
+		fields[field] = value
+	}
+	for field, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(field, value); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", field, err)
+		}
+	}
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to write media data: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close writer: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/analyze/media", backendURL()), &buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	return doMediaRequest(req)
+}
+
+// doMediaRequest sends a media request, failing on any non-2xx status
+func doMediaRequest(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call backend: %w", err)
+	}
+	if err := checkRateLimit(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("backend returned status %d: %s", resp.StatusCode, errorBody(resp))
+	}
+	return resp, nil
+}
+
+// postMediaURL uploads a recording to the bucket and has the backend fetch
+// it from a presigned URL. The upload is deleted once the backend answers.
+func postMediaURL(item *mediaItem, data []byte, fileName string, analyzed int, caption, key string, extra map[string]string) (*http.Response, error) {
+	object := "uploads/" + sha256Hex(data) + "-" + fileName
+	if err := mediaUploads.Put(object, data, item.mimetype); err != nil {
+		return nil, fmt.Errorf("failed to upload %s: %w", item.kind, err)
+	}
+	defer func() {
+		if err := mediaUploads.Delete(object); err != nil {
+			fmt.Printf("Error deleting uploaded %s: %v\n", item.kind, err)
+		}
+	}()
+	link, err := mediaUploads.PresignGet(object, config.MediaUploadURLTTL)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Uploaded %s of %d bytes for analysis\n", item.kind, len(data))
+
+	body := map[string]any{
+		"url":              link,
+		"kind":             item.kind,
+		"file_name":        fileName,
+		"duration":         item.seconds,
+		"analyzed_seconds": analyzed,
+		"caption":          caption,
+	}
+	for field, value := range extra {
+		body[field] = value
+	}
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := newJSONRequest(fmt.Sprintf("%s/analyze/media-url", backendURL()), jsonBody)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	return doMediaRequest(req)
+}
+
+// analyzeMediaCached returns a cached verdict for an identical clip with the
+// same caption, or calls the backend
+func analyzeMediaCached(item *mediaItem, data []byte, fileName string, analyzed int, caption, idempotency string) (*AnalyzeResponse, error) {
+	key := mediaResultKey(item, data, caption)
+	if result, ok := verdictCache.Get(key); ok {
+		fmt.Printf("Cache hit for %s\n", item.kind)
+		return result, nil
+	}
+
+	result, err := callBackend(func() (*AnalyzeResponse, error) {
+		return analyzeMedia(item, data, fileName, analyzed, caption, idempotency)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cacheMediaResult(key, caption, result)
+	return result, nil
+}
+
+// mediaResultKey is the cache key of a clip's verdict: the clip, and the
+// caption it came with
+func mediaResultKey(item *mediaItem, data []byte, caption string) string {
+	key := mediaCacheKey(item.kind, data)
+	if caption != "" {
+		key = mediaCacheKey(item.kind+"+text", []byte(key+"\x00"+caption))
+	}
+	return key
+}
+
+// cacheMediaResult adds published fact-checks and source ratings to a fresh
+// media verdict and caches it under key
+func cacheMediaResult(key, caption string, result *AnalyzeResponse) {
+	enrichWithFactChecks(result, caption, "")
+	rateSources(result)
+	result.claimKey = key
+	verdictCache.Put(key, nil, result)
+}
+
+// handleMediaMessage analyzes a voice note, audio or video message. Long
+// recordings are cut to their first config.MediaMaxSeconds and the verdict
+// says so; recordings too big to download are skipped.
+func handleMediaMessage(evt *events.Message, item *mediaItem, settings *ChatSettings, explicit bool) {
+	fmt.Printf("Received %s (%ds) from %s\n", item.kind, item.seconds, evt.Info.Sender.String())
+
+	if item.kind == "video" && !featureEnabled(flagVideo, evt.Info.Chat) {
+		fmt.Println("Video analysis is not enabled in this chat, ignoring")
+		if explicit {
+			sendMessage(evt, "ℹ️ I can't check videos in this chat yet.")
+		}
+		return
+	}
+
+	if config.MediaMaxBytes > 0 && item.length > uint64(config.MediaMaxBytes) {
+		fmt.Printf("Skipping %s of %d bytes, over MEDIA_MAX_BYTES\n", item.kind, item.length)
+		metrics.inc("media_too_large")
+		if explicit {
+			sendMessage(evt, fmt.Sprintf("ℹ️ This %s is too large for me to check (%d MB).", item.kind, item.length>>20))
+		}
+		return
+	}
+
+	data, err := messenger.Download(context.Background(), item.msg)
+	if err != nil {
+		fmt.Printf("Error downloading %s: %v\n", item.kind, err)
+		metrics.fail("download_error", err)
+		failure := fmt.Sprintf("❌ *Error*\n\nCould not download the %s. Please try again.", item.kind)
+		if !retryMediaDownload(evt, item.msg, err, failure) {
+			sendError(evt, failure)
+		}
+		return
+	}
+
+	// Only the start of long recordings is analyzed
+	original := data
+	analyzed, fileName := item.seconds, item.kind
+	clipped, err := clipMedia(data, config.MediaMaxSeconds)
+	switch {
+	case err == nil:
+		data, fileName = clipped, item.kind+".mp3"
+		if item.seconds > config.MediaMaxSeconds {
+			analyzed = config.MediaMaxSeconds
+		}
+	case len(data) > maxUnclippedUpload:
+		fmt.Printf("Error clipping %s: %v\n", item.kind, err)
+		if explicit {
+			sendMessage(evt, fmt.Sprintf("ℹ️ This %s is too long for me to check.", item.kind))
+		}
+		return
+	default:
+		fmt.Printf("Could not clip %s, sending it whole: %v\n", item.kind, err)
+	}
+
+	caption := prepareText(item.caption)
+	if config.ScrubPII {
+		caption = scrubPII(caption, evt.Info.PushName)
+	}
+	key := idempotencyKey(evt.Info)
+	hash := sha256Hex(original)
+	if config.AsyncAnalysis {
+		if _, cached := verdictCache.Get(mediaResultKey(item, data, caption)); !cached {
+			err := submitMediaJob(evt, item, data, fileName, analyzed, caption, key, hash, explicit)
+			if err == nil || delayRateLimited(evt, err) {
+				return
+			}
+			fmt.Printf("Error submitting %s job, analyzing it directly: %v\n", item.kind, err)
+		}
+	}
+	fmt.Printf("Analyzing %s %s (idempotency key %s)\n", item.kind, evt.Info.ID, key)
+	result, err := analyzeMediaCached(item, data, fileName, analyzed, caption, key)
+	if err != nil {
+		failMedia(evt, item, err)
+		return
+	}
+	finishMedia(evt, item, hash, original, analyzed, result, settings, explicit)
+}
+
+// failMedia reports a recording that couldn't be analyzed, holding it for
+// later while the backend is down
+func failMedia(evt *events.Message, item *mediaItem, err error) {
+	fmt.Printf("Error analyzing %s: %v\n", item.kind, err)
+	if delayRateLimited(evt, err) {
+		return
+	}
+	metrics.fail("backend_error", err)
+	if backendBreaker.isOpen() {
+		deferMessage(evt)
+		return
+	}
+	botStore.deadLetter(evt, err)
+	sendError(evt, fmt.Sprintf("❌ *Error*\n\nCould not analyze the %s. Please try again later.", item.kind))
+}
+
+// finishMedia records a recording's verdict and replies with it. original is
+// the downloaded file when it's still at hand, for the archive.
+func finishMedia(evt *events.Message, item *mediaItem, hash string, original []byte, analyzed int, result *AnalyzeResponse, settings *ChatSettings, explicit bool) {
+	metrics.inc("analyzed_" + item.kind)
+	botStore.recordAnalysis(evt.Info, item.kind, "", result)
+	go archiveMedia(evt.Info, item.kind, hash, original, item.thumb, item.mimetype, result)
+
+	if !result.IsNews {
+		fmt.Printf("Not news %s, ignoring\n", item.kind)
+		if explicit {
+			sendMessage(evt, notNewsReply(result, settings.Language))
+		}
+		return
+	}
+
+	if analyzed < item.seconds {
+		partial := *result
+		partial.analyzedSeconds, partial.totalSeconds = analyzed, item.seconds
+		result = &partial
+	}
+	sendVerdict(evt, result, settings, explicit)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waMmsRetry"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// WhatsApp's media servers drop files after a while, so downloading media
+// from an older message fails. The sender's phone (or the bot's, for its
+// own messages) can upload it again when asked with a retry receipt; the
+// message is then handled again with the new path.
+
+// mediaRetry is a message waiting for its media to be uploaded again
+type mediaRetry struct {
+	evt     *events.Message
+	media   whatsmeow.DownloadableMessage
+	failure string // told to the sender if the upload never comes
+	done    bool   // the phone answered; the message isn't retried again
+}
+
+var mediaRetries = struct {
+	sync.Mutex
+	byID map[types.MessageID]*mediaRetry
+}{byID: make(map[types.MessageID]*mediaRetry)}
+
+// expiredMedia reports whether a download failed because the file is no
+// longer on WhatsApp's media servers
+func expiredMedia(err error) bool {
+	return errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith403) ||
+		errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) ||
+		errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith410)
+}
+
+// retryMediaDownload asks for the media of evt to be uploaded again when its
+// download failed for having expired, and reports whether it did. The
+// message is handled again once it's uploaded; if it isn't by
+// MEDIA_RETRY_TIMEOUT, the sender is told failure, unless it's empty.
+func retryMediaDownload(evt *events.Message, media whatsmeow.DownloadableMessage, err error, failure string) bool {
+	if config.MediaRetryTimeout <= 0 || !expiredMedia(err) {
+		return false
+	}
+	info := mediaMessageInfo(evt)
+	mediaRetries.Lock()
+	if _, ok := mediaRetries.byID[info.ID]; ok {
+		// Already asked once: the upload didn't help
+		mediaRetries.Unlock()
+		return false
+	}
+	retry := &mediaRetry{evt: evt, media: media, failure: failure}
+	mediaRetries.byID[info.ID] = retry
+	mediaRetries.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := client.SendMediaRetryReceipt(ctx, &info, media.GetMediaKey()); err != nil {
+		fmt.Printf("Error requesting media retry for %s: %v\n", info.ID, err)
+		metrics.fail("media_retry_error", err)
+		mediaRetries.Lock()
+		delete(mediaRetries.byID, info.ID)
+		mediaRetries.Unlock()
+		return false
+	}
+	metrics.inc("media_retry_requested")
+	fmt.Printf("Media of %s expired, asked the phone to upload it again\n", info.ID)
+
+	time.AfterFunc(config.MediaRetryTimeout, func() {
+		mediaRetries.Lock()
+		delete(mediaRetries.byID, info.ID)
+		answered := retry.done
+		mediaRetries.Unlock()
+		if !answered {
+			fmt.Printf("No media retry for %s within %s\n", info.ID, config.MediaRetryTimeout)
+			metrics.inc("media_retry_timeout")
+			if retry.failure != "" {
+				sendError(retry.evt, retry.failure)
+			}
+		}
+	})
+	return true
+}
+
+// mediaMessageInfo returns the message whose media evt handles: evt itself,
+// or the message it quotes, as /check does
+func mediaMessageInfo(evt *events.Message) types.MessageInfo {
+	quote := evt.Message.GetExtendedTextMessage().GetContextInfo()
+	if quote.GetQuotedMessage() == nil {
+		return evt.Info
+	}
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: evt.Info.Chat, IsGroup: evt.Info.IsGroup},
+		ID:            quote.GetStanzaID(),
+	}
+	if sender, err := types.ParseJID(quote.GetParticipant()); err == nil {
+		info.Sender = sender
+		info.IsFromMe = isBotJID(sender)
+	}
+	return info
+}
+
+// handleMediaRetry handles the phone's answer to a media retry request,
+// handling the message again if the media was uploaded
+func handleMediaRetry(evt *events.MediaRetry) {
+	mediaRetries.Lock()
+	retry, ok := mediaRetries.byID[evt.MessageID]
+	if ok {
+		if retry.done {
+			ok = false
+		}
+		retry.done = true
+	}
+	mediaRetries.Unlock()
+	if !ok {
+		return
+	}
+
+	notification, err := whatsmeow.DecryptMediaRetryNotification(evt, retry.media.GetMediaKey())
+	if err == nil && notification.GetResult() != waMmsRetry.MediaRetryNotification_SUCCESS {
+		err = fmt.Errorf("phone answered %s", notification.GetResult())
+	}
+	if err == nil && !setDirectPath(retry.media, notification.GetDirectPath()) {
+		err = fmt.Errorf("unsupported media type %T", retry.media)
+	}
+	if err != nil {
+		fmt.Printf("Media retry for %s failed: %v\n", evt.MessageID, err)
+		metrics.fail("media_retry_failed", err)
+		if retry.failure != "" {
+			sendError(retry.evt, retry.failure)
+		}
+		return
+	}
+	metrics.inc("media_retry_succeeded")
+	fmt.Printf("Media of %s uploaded again, handling it again\n", evt.MessageID)
+	messageQueue.push(retry.evt)
+}
+
+// setDirectPath points media at its new upload
+func setDirectPath(media whatsmeow.DownloadableMessage, path string) bool {
+	switch m := media.(type) {
+	case *waE2E.ImageMessage:
+		m.DirectPath = &path
+	case *waE2E.AudioMessage:
+		m.DirectPath = &path
+	case *waE2E.VideoMessage:
+		m.DirectPath = &path
+	case *waE2E.DocumentMessage:
+		m.DirectPath = &path
+	case *waE2E.StickerMessage:
+		m.DirectPath = &path
+	default:
+		return false
+	}
+	return true
+}
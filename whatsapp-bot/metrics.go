@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// maxRecentErrors is how many errors Metrics remembers for /debug/state
+const maxRecentErrors = 20
+
+// Metrics holds in-process event counters, reset on restart
+type Metrics struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	errors   []RecentError // newest last
+}
+
+// RecentError is an error remembered for debugging
+type RecentError struct {
+	Time    time.Time `json:"time"`
+	Counter string    `json:"counter"`
+	Error   string    `json:"error"`
+}
+
+var metrics = &Metrics{counters: map[string]int64{}}
+
+func init() {
+	registerCommand("stats", &Command{
+		Usage:   "/stats",
+		Help:    "Show bot counters since startup",
+		Role:    roleAdmin,
+		Handler: cmdStats,
+	})
+}
+
+// inc increments the named counter
+func (m *Metrics) inc(name string) {
+	m.add(name, 1)
+}
+
+// add adds n to the named counter
+func (m *Metrics) add(name string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] += n
+}
+
+// fail increments the named error counter and remembers err
+func (m *Metrics) fail(name string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name]++
+	m.errors = append(m.errors, RecentError{Time: time.Now(), Counter: name, Error: err.Error()})
+	if len(m.errors) > maxRecentErrors {
+		m.errors = m.errors[len(m.errors)-maxRecentErrors:]
+	}
+}
+
+// recentErrors returns the remembered errors, newest first
+func (m *Metrics) recentErrors() []RecentError {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]RecentError, len(m.errors))
+	for i, e := range m.errors {
+		out[len(m.errors)-1-i] = e
+	}
+	return out
+}
+
+// snapshot returns a copy of all counters
+func (m *Metrics) snapshot() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]int64, len(m.counters))
+	for k, v := range m.counters {
+		out[k] = v
+	}
+	return out
+}
+
+func cmdStats(evt *events.Message, args []string) {
+	counters := metrics.snapshot()
+	if len(counters) == 0 {
+		sendMessage(evt, "📊 No activity recorded since startup.")
+		return
+	}
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("📊 *Counters since startup*\n")
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("\n%s: %d", name, counters[name]))
+	}
+	sendMessage(evt, sb.String())
+}
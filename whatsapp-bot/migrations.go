@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// migration is one versioned change to the bot database's schema. Migrations
+// run in version order, each once; whatever they do must be safe to repeat,
+// since a migration interrupted before it's recorded runs again.
+type migration struct {
+	Version int
+	Name    string
+	Up      func(db *storeDB) error
+}
+
+// migrations lists every schema change, oldest first. Add new tables and
+// columns as a new migration at the end, never by editing an applied one.
+var migrations = []migration{
+	{1, "create tables", createTables},
+	{2, "move quiet hours into chat settings", migrateQuietHours},
+	{3, "add chat settings columns", func(db *storeDB) error {
+		for _, col := range []string{"cooldown INTEGER", "format TEXT", "confidence TEXT", "history INTEGER"} {
+			name, decl, _ := strings.Cut(col, " ")
+			if err := addColumn(db, "chat_settings", name, decl); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	// Delivery and read receipts for verdict replies, which reactions don't get
+	{4, "add verdict receipt columns", func(db *storeDB) error {
+		for _, col := range [][2]string{
+			{"delivered_at", "INTEGER"},
+			{"read_at", "INTEGER"},
+			{"read_count", "INTEGER NOT NULL DEFAULT 0"},
+			{"reaction", "INTEGER NOT NULL DEFAULT 0"},
+		} {
+			if err := addColumn(db, "verdict_messages", col[0], col[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	// Work queued for later is done by the instance that queued it, whose
+	// number the chat knows; rows from before instances existed have none
+	{5, "add instance to queued work", func(db *storeDB) error {
+		for _, table := range []string{"pending_replies", "deferred_messages", "rechecks", "async_jobs"} {
+			if err := addColumn(db, table, "instance", "TEXT NOT NULL DEFAULT ''"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{6, "add community links", execAll(
+		`CREATE TABLE IF NOT EXISTS community_groups (
+			chat         TEXT PRIMARY KEY,
+			community    TEXT NOT NULL,
+			announcement INTEGER NOT NULL DEFAULT 0,
+			updated_at   INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS community_groups_community ON community_groups (community)`,
+	)},
+	// Which messages a history sync delivered, without their content
+	{7, "add synced messages", execAll(
+		`CREATE TABLE IF NOT EXISTS synced_messages (
+			chat       TEXT NOT NULL,
+			message_id TEXT NOT NULL,
+			sender     TEXT NOT NULL,
+			sent_at    INTEGER NOT NULL,
+			PRIMARY KEY (chat, message_id)
+		)`,
+	)},
+	// Who sent archived media, so /forgetme finds what they sent in groups
+	{8, "add sender to archived media", func(db *storeDB) error {
+		return addColumn(db, "archived_media", "sender", "TEXT NOT NULL DEFAULT ''")
+	}},
+	// Queued work from before instances is claimed by the instance that
+	// migrates, so each item is done once rather than by every instance
+	{9, "claim queued work without an instance", func(db *storeDB) error {
+		for _, table := range []string{"pending_replies", "deferred_messages", "rechecks", "async_jobs", "outbox"} {
+			if _, err := db.Exec(`UPDATE `+table+` SET instance = ? WHERE instance = ''`, config.InstanceID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+}
+
+// execAll returns a migration that runs SQL statements in order
+func execAll(stmts ...string) func(db *storeDB) error {
+	return func(db *storeDB) error {
+		for _, stmt := range stmts {
+			if _, err := db.Exec(db.ddl(stmt)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// migrationLockID is the Postgres advisory lock instances take while they
+// migrate, so only one of them changes a shared database at a time
+const migrationLockID = 0x616c6574
+
+// createTables creates the baseline tables in schemaV1. Postgres gets its
+// own audit log triggers instead of SQLite's.
+func createTables(db *storeDB) error {
+	stmts := schemaV1
+	if db.postgres {
+		stmts = nil
+		for _, stmt := range schemaV1 {
+			if !strings.HasPrefix(stmt, "CREATE TRIGGER") {
+				stmts = append(stmts, stmt)
+			}
+		}
+		stmts = append(stmts, postgresAuditTriggersV1...)
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(db.ddl(stmt)); err != nil {
+			return fmt.Errorf("failed to create bot tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// migrate brings the database at path up to the newest schema version,
+// backing a SQLite file up first when it has data to lose. Databases from
+// before versioning start at version 0 and take every migration, which
+// skip what's already there.
+func migrate(db *storeDB, path string) error {
+	if db.postgres {
+		ctx := context.Background()
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+			return fmt.Errorf("failed to lock for migrations: %w", err)
+		}
+		defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+	}
+
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	var pending []migration
+	for _, m := range migrations {
+		if m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if !db.postgres && config.MigrateBackup {
+		if err := backupBeforeMigrate(db, path, current); err != nil {
+			return err
+		}
+	}
+	for _, m := range pending {
+		if err := m.Up(db); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		_, err := db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.Version, m.Name, time.Now().Unix())
+		if err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+		}
+		if current > 0 {
+			fmt.Printf("Migrated bot database to version %d: %s\n", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// schemaVersion returns the newest migration applied to the database
+func schemaVersion(db *storeDB) (int, error) {
+	var version int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// backupBeforeMigrate copies a SQLite database next to itself before it's
+// migrated from version, unless it has no tables yet. Postgres databases
+// are backed up by their operators.
+func backupBeforeMigrate(db *storeDB, path string, version int) error {
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name != 'schema_migrations'`).Scan(&tables); err != nil {
+		return fmt.Errorf("failed to inspect database: %w", err)
+	}
+	if tables == 0 {
+		return nil
+	}
+	backup := fmt.Sprintf("%s.v%d-%s.bak", path, version, time.Now().UTC().Format("20060102T150405Z"))
+	if _, err := db.Exec(`VACUUM INTO ` + quoteSQL(backup)); err != nil {
+		return fmt.Errorf("failed to back up database before migrating: %w", err)
+	}
+	fmt.Printf("Backed up bot database to %s before migrating\n", backup)
+	return nil
+}
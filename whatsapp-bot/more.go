@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func init() {
+	registerCommand("more", &Command{
+		Usage:   "/more",
+		Help:    "Reply to a verdict to see all its evidence and sources",
+		Handler: cmdMore,
+	})
+}
+
+// recordVerdictMessage stores the full verdict behind a sent reply, with how
+// many evidence items and sources the reply listed, so /more can show the rest
+func (s *Store) recordVerdictMessage(chat types.JID, id types.MessageID, verdict *AnalyzeResponse, language string, evidenceShown, sourcesShown int) {
+	if id == "" {
+		return
+	}
+	data, err := json.Marshal(verdict)
+	if err != nil {
+		fmt.Printf("Error encoding verdict: %v\n", err)
+		return
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO verdict_messages (message_id, chat, verdict, language, evidence_shown, sources_shown, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (message_id) DO UPDATE SET chat = excluded.chat, verdict = excluded.verdict, language = excluded.language,
+			evidence_shown = excluded.evidence_shown, sources_shown = excluded.sources_shown, created_at = excluded.created_at`,
+		id, chat.String(), string(data), language, evidenceShown, sourcesShown, time.Now().Unix(),
+	)
+	if err != nil {
+		fmt.Printf("Error recording verdict message: %v\n", err)
+	}
+}
+
+// recordReactedVerdict stores the verdict behind an emoji reaction on message
+// id, which /more can expand but which gets no receipts of its own
+func (s *Store) recordReactedVerdict(chat types.JID, id types.MessageID, verdict *AnalyzeResponse, language string) {
+	s.recordVerdictMessage(chat, id, verdict, language, 0, 0)
+	if _, err := s.db.Exec(`UPDATE verdict_messages SET reaction = 1 WHERE message_id = ?`, id); err != nil {
+		fmt.Printf("Error recording verdict message: %v\n", err)
+	}
+}
+
+// verdictMessage loads the verdict behind the bot's reply id in chat
+func (s *Store) verdictMessage(chat types.JID, id string) (*AnalyzeResponse, string, int, int, error) {
+	var (
+		data                        []byte
+		language                    string
+		evidenceShown, sourcesShown int
+	)
+	err := s.db.QueryRow(
+		`SELECT verdict, language, evidence_shown, sources_shown FROM verdict_messages WHERE message_id = ? AND chat = ?`,
+		id, chat.String(),
+	).Scan(&data, &language, &evidenceShown, &sourcesShown)
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+	var verdict AnalyzeResponse
+	if err := json.Unmarshal(data, &verdict); err != nil {
+		return nil, "", 0, 0, fmt.Errorf("failed to decode verdict: %w", err)
+	}
+	return &verdict, language, evidenceShown, sourcesShown, nil
+}
+
+// formatMore lists the evidence and sources a verdict reply left out
+func formatMore(result *AnalyzeResponse, language string, evidenceShown, sourcesShown int) string {
+	m := messagesFor(language)
+	var sb strings.Builder
+	if len(result.Evidence) > evidenceShown {
+		sb.WriteString(fmt.Sprintf("*%s:*", m.Evidence))
+		for _, e := range result.Evidence[evidenceShown:] {
+			sb.WriteString("\n• " + e)
+		}
+	}
+	if len(result.SourcesChecked) > sourcesShown {
+		if sb.Len() > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString(fmt.Sprintf("*%s:*", m.Sources))
+		for _, src := range result.SourcesChecked[sourcesShown:] {
+			line := "\n• "
+			if emoji := src.CredibilityEmoji(); emoji != "" {
+				line += emoji + " "
+			}
+			line += src.Label()
+			if src.URL != "" && src.URL != src.Label() {
+				line += "\n  " + src.URL
+			}
+			sb.WriteString(line)
+		}
+	}
+	return sb.String()
+}
+
+func cmdMore(evt *events.Message, args []string) {
+	var (
+		verdict                     *AnalyzeResponse
+		language                    string
+		evidenceShown, sourcesShown int
+	)
+
+	// Prefer the verdict being replied to, else the chat's latest one
+	if quotedID := evt.Message.GetExtendedTextMessage().GetContextInfo().GetStanzaID(); quotedID != "" {
+		var err error
+		verdict, language, evidenceShown, sourcesShown, err = botStore.verdictMessage(evt.Info.Chat, quotedID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			fmt.Printf("Error loading verdict: %v\n", err)
+		}
+	}
+	if verdict == nil {
+		if conv, ok := activeConversation(evt.Info.Chat); ok {
+			verdict, language = conv.verdict, conv.language
+			evidenceShown, sourcesShown = maxListedItems, maxListedItems
+		}
+	}
+	if verdict == nil {
+		sendMessage(evt, "ℹ️ Reply /more to one of my verdicts to see all of its evidence and sources.")
+		return
+	}
+
+	// A verdict given as a reaction showed nothing yet, so send it in full
+	if !isReplyToBot(evt.Message) && evidenceShown == 0 && sourcesShown == 0 {
+		recordExperimentEvent(evt.Info.Chat, experimentMore)
+		confidence := botStore.getChatSettings(evt.Info.Chat).confidenceStyle()
+		sendMessage(evt, formatResponse(translateResult(verdict, language), language, confidence))
+		return
+	}
+
+	more := formatMore(translateResult(verdict, language), language, evidenceShown, sourcesShown)
+	if more == "" {
+		sendMessage(evt, "ℹ️ That verdict already listed all of its evidence and sources.")
+		return
+	}
+	recordExperimentEvent(evt.Info.Chat, experimentMore)
+	sendMessage(evt, "🔎 "+more)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// leetMap maps characters commonly substituted for letters in obfuscated
+// forwards ("c0vid", "v@ccine"). Only applied between two letters so numbers
+// like "5G" or "COVID-19" are left alone.
+var leetMap = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'@': 'a',
+	'$': 's',
+}
+
+// homoglyphMap maps Cyrillic and Greek lookalikes to Latin letters. Only
+// applied inside words that also contain Latin letters.
+var homoglyphMap = map[rune]rune{
+	'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P', 'С': 'C', 'Т': 'T', 'Х': 'X',
+	'ο': 'o', 'α': 'a', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ρ': 'p', 'τ': 't', 'υ': 'u',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Χ': 'X',
+}
+
+// spacedLetters matches words spelled out with separators, e.g. "f.a.k.e" or "F-A-K-E"
+var spacedLetters = regexp.MustCompile(`\b(?:\pL[.\-_*]){2,}\pL\b`)
+
+// normalizeText canonicalizes message text before it is hashed or sent for
+// analysis: NFKC (folds fullwidth and "fancy" Unicode letters), zero-width
+// and emoji removal, de-obfuscation of lookalike characters and spaced-out
+// words, and whitespace collapsing. Email addresses and links are left as
+// they are, so the PII scrubber still recognizes them afterwards.
+func normalizeText(text string) string {
+	text = norm.NFKC.String(text)
+	text = stripInvisibleAndEmoji(text)
+
+	words := strings.Fields(text)
+	for i, w := range words {
+		if emailPattern.MatchString(w) || linkPattern.MatchString(w) {
+			continue
+		}
+		w = spacedLetters.ReplaceAllStringFunc(w, func(s string) string {
+			return strings.Map(func(r rune) rune {
+				if unicode.IsLetter(r) {
+					return r
+				}
+				return -1
+			}, s)
+		})
+		words[i] = deobfuscateWord(w)
+	}
+	return strings.Join(words, " ")
+}
+
+// stripInvisibleAndEmoji removes zero-width characters and emoji. ZWJ/ZWNJ are
+// kept after Indic letters, where they change how conjuncts are written.
+func stripInvisibleAndEmoji(text string) string {
+	var sb strings.Builder
+	sb.Grow(len(text))
+	var prev rune
+	for _, r := range text {
+		switch {
+		case r == '\u200c' || r == '\u200d':
+			if !isIndic(prev) {
+				continue
+			}
+		case r == '\u200b' || r == '\u2060' || r == '\ufeff' || r == '\u00ad' || r == '\u180e':
+			continue
+		case isEmoji(r):
+			// Replace with a space so "fake🚨news" doesn't fuse into one word
+			r = ' '
+		}
+		sb.WriteRune(r)
+		prev = r
+	}
+	return sb.String()
+}
+
+// isEmoji reports whether r is a pictograph, emoji modifier, or variation selector
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF, // pictographs, emoticons, transport, flags
+		r >= 0x2600 && r <= 0x27BF,   // misc symbols and dingbats
+		r >= 0x2B00 && r <= 0x2BFF,   // arrows, stars
+		r >= 0xFE00 && r <= 0xFE0F,   // variation selectors
+		r >= 0xE0020 && r <= 0xE007F, // tag sequences
+		r == 0x20E3:                  // combining keycap
+		return true
+	}
+	return false
+}
+
+// isIndic reports whether r belongs to one of the Indic script blocks
+func isIndic(r rune) bool {
+	return r >= 0x0900 && r <= 0x0DFF
+}
+
+// deobfuscateWord undoes homoglyph and leetspeak substitutions within one word
+func deobfuscateWord(word string) string {
+	runes := []rune(word)
+
+	hasLatin := false
+	for _, r := range runes {
+		if r < unicode.MaxASCII && unicode.IsLetter(r) {
+			hasLatin = true
+			break
+		}
+	}
+	if hasLatin {
+		for i, r := range runes {
+			if l, ok := homoglyphMap[r]; ok {
+				runes[i] = l
+			}
+		}
+	}
+
+	for i := 1; i < len(runes)-1; i++ {
+		if l, ok := leetMap[runes[i]]; ok && isLatinLetter(runes[i-1]) && isLatinLetter(runes[i+1]) {
+			runes[i] = l
+		}
+	}
+	return string(runes)
+}
+
+func isLatinLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
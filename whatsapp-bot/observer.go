@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// observerTopClaims is how many of the most widely spread claims /observer shows
+const observerTopClaims = 5
+
+func init() {
+	registerCommand("observer", &Command{
+		Usage:   "/observer [csv]",
+		Help:    "Show aggregate statistics from observer-mode groups",
+		Role:    roleOwner,
+		Handler: cmdObserver,
+	})
+}
+
+// observeMessage analyzes a message in an observer chat without replying.
+// Only hashes and verdict flags are kept: no text, sender or message ID.
+func observeMessage(evt *events.Message, text string) {
+	var (
+		kind   string
+		result *AnalyzeResponse
+		err    error
+	)
+	key := idempotencyKey(evt.Info)
+	if imgMsg := evt.Message.GetImageMessage(); imgMsg != nil {
+		kind = "image"
+		var data []byte
+		data, err = messenger.Download(context.Background(), imgMsg)
+		if err == nil {
+			caption, quotedText := imageContext(imgMsg)
+			result, err = analyzeImageCached(data, scrubPII(caption, evt.Info.PushName), scrubPII(quotedText, evt.Info.PushName), key, senderTypes(evt.Info))
+		}
+	} else {
+		kind = "text"
+		text = prepareText(text)
+		if reason := prefilterReason(evt, text); reason != "" {
+			metrics.inc("prefiltered")
+			return
+		}
+		if result = matchHoax(text); result == nil {
+			result, err = analyzeTextCached(text, scrubPII(text, evt.Info.PushName), detectLanguage(text), key, senderTypes(evt.Info))
+		}
+	}
+	if err != nil && kind == "image" && retryMediaDownload(evt, evt.Message.GetImageMessage(), err, "") {
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error observing %s: %v\n", kind, err)
+		metrics.fail("backend_error", err)
+		return
+	}
+	metrics.inc("observed_" + kind)
+	botStore.recordObservation(evt.Info.Chat, kind, result)
+}
+
+// recordObservation stores the hashed chat and claim of an observed verdict,
+// bucketed by hour
+func (s *Store) recordObservation(chat types.JID, kind string, result *AnalyzeResponse) {
+	hour := time.Now().Truncate(time.Hour).Unix()
+	_, err := s.db.Exec(
+		`INSERT INTO observations (chat_hash, claim_key, kind, is_news, is_misinformation, hour) VALUES (?, ?, ?, ?, ?, ?)`,
+		pseudonym(chat.ToNonAD().String()), pseudonym(result.claimKey), kind, result.IsNews, result.IsMisinformation, hour,
+	)
+	if err != nil {
+		fmt.Printf("Error recording observation: %v\n", err)
+	}
+}
+
+// observerStats are the aggregate counts /observer reports
+type observerStats struct {
+	chats, messages, news, misinformation int
+	claims                                []observedClaim
+}
+
+// observedClaim is a claim's spread: how many chats it reached and when
+type observedClaim struct {
+	key                 string
+	chats, messages     int
+	firstSeen, lastSeen time.Time
+}
+
+// observerStats aggregates the observations, with the claims that reached
+// the most chats first
+func (s *Store) observerStats(topClaims int) (*observerStats, error) {
+	var stats observerStats
+	err := s.db.QueryRow(
+		`SELECT COUNT(DISTINCT chat_hash), COUNT(*), COALESCE(SUM(is_news), 0), COALESCE(SUM(is_misinformation), 0) FROM observations`,
+	).Scan(&stats.chats, &stats.messages, &stats.news, &stats.misinformation)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.observedClaims(`HAVING MAX(is_misinformation) = 1 ORDER BY COUNT(DISTINCT chat_hash) DESC, COUNT(*) DESC LIMIT ?`, topClaims)
+	if err != nil {
+		return nil, err
+	}
+	stats.claims = claims
+	return &stats, nil
+}
+
+// observedClaims returns per-claim spread, grouped and filtered by tail
+func (s *Store) observedClaims(tail string, args ...any) ([]observedClaim, error) {
+	rows, err := s.db.Query(
+		`SELECT claim_key, COUNT(DISTINCT chat_hash), COUNT(*), MIN(hour), MAX(hour) FROM observations
+		 WHERE is_news = 1 GROUP BY claim_key `+tail, args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []observedClaim
+	for rows.Next() {
+		var (
+			c           observedClaim
+			first, last int64
+		)
+		if err := rows.Scan(&c.key, &c.chats, &c.messages, &first, &last); err != nil {
+			return nil, err
+		}
+		c.firstSeen, c.lastSeen = time.Unix(first, 0), time.Unix(last, 0)
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// writeObservationsCSV writes hourly per-claim counts for research use
+func (s *Store) writeObservationsCSV(buf *bytes.Buffer) (int, error) {
+	rows, err := s.db.Query(
+		`SELECT hour, claim_key, kind, MAX(is_news), MAX(is_misinformation), COUNT(DISTINCT chat_hash), COUNT(*)
+		 FROM observations GROUP BY hour, claim_key, kind ORDER BY hour, claim_key`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	w := csv.NewWriter(buf)
+	w.Write([]string{"hour", "claim", "kind", "is_news", "is_misinformation", "chats", "messages"})
+	n := 0
+	for rows.Next() {
+		var (
+			hour              int64
+			claim, kind       string
+			isNews, isMisinfo bool
+			chats, messages   int
+		)
+		if err := rows.Scan(&hour, &claim, &kind, &isNews, &isMisinfo, &chats, &messages); err != nil {
+			return n, err
+		}
+		w.Write([]string{time.Unix(hour, 0).UTC().Format(time.RFC3339), claim, kind,
+			strconv.FormatBool(isNews), strconv.FormatBool(isMisinfo), strconv.Itoa(chats), strconv.Itoa(messages)})
+		n++
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return n, err
+	}
+	return n, rows.Err()
+}
+
+func cmdObserver(evt *events.Message, args []string) {
+	if len(args) > 0 && strings.ToLower(args[0]) == "csv" {
+		var buf bytes.Buffer
+		n, err := botStore.writeObservationsCSV(&buf)
+		if err != nil {
+			fmt.Printf("Error exporting observations: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not export the observations.")
+			return
+		}
+		caption := fmt.Sprintf("🔬 %d hourly claim counts from observer groups", n)
+		if err := sendDocument(evt.Info.Chat, buf.Bytes(), "observations.csv", "text/csv", caption); err != nil {
+			fmt.Printf("Error sending observations: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not send the export.")
+		}
+		return
+	}
+
+	stats, err := botStore.observerStats(observerTopClaims)
+	if err != nil {
+		fmt.Printf("Error loading observer stats: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not load the observer statistics.")
+		return
+	}
+	if stats.messages == 0 {
+		sendMessage(evt, "ℹ️ Nothing has been observed yet. Group admins enable it with /settings mode observe.")
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🔬 *Observer statistics*\n\n")
+	fmt.Fprintf(&sb, "*Groups:* %d\n*Messages analyzed:* %d\n", stats.chats, stats.messages)
+	fmt.Fprintf(&sb, "*News:* %d (%.0f%%)\n", stats.news, percent(stats.news, stats.messages))
+	fmt.Fprintf(&sb, "*Misinformation:* %d (%.0f%% of news)\n", stats.misinformation, percent(stats.misinformation, stats.news))
+	if len(stats.claims) > 0 {
+		sb.WriteString("\n*Most widespread false claims*")
+		for _, c := range stats.claims {
+			fmt.Fprintf(&sb, "\n• %s: %d groups, %d messages over %s", c.key[:8], c.chats, c.messages,
+				c.lastSeen.Add(time.Hour).Sub(c.firstSeen).Round(time.Hour))
+		}
+	}
+	sb.WriteString("\n\n_/observer csv exports hourly counts._")
+	sendMessage(evt, sb.String())
+}
+
+// percent is part as a percentage of whole, or 0 when whole is 0
+func percent(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(whole)
+}
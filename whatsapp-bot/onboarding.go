@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// onboardingTemplate introduces the bot the first time it appears in a
+// chat; %s is what it says about the data sent for analysis
+const onboardingTemplate = `👋 *Hi, I'm Aletheia* — a fact-checking assistant.
+
+*What I do:* I read messages and images shared here and reply when something looks like a news claim, with a verdict on whether it appears credible or misleading.
+
+*What I send for analysis:* the text or image of messages in this chat goes to the Aletheia analysis service. %s
+
+*How to opt out:*
+• Send /settings mode off to stop automatic checks (you can still use /check)
+• Send /settings mode command to only check messages when asked
+• Remove me from the group at any time
+
+Send /help to see everything I can do.`
+
+// onboardingMessage returns the intro, which only promises phone numbers
+// stay out of what's analyzed when PII_SCRUB masks them
+func onboardingMessage() string {
+	sent := "Phone numbers and names of senders are not sent."
+	if !config.ScrubPII {
+		sent = "Names and numbers of senders are not sent, but phone numbers written in messages are."
+	}
+	return fmt.Sprintf(onboardingTemplate, sent)
+}
+
+func init() {
+	registerCommand("about", &Command{
+		Usage:   "/about",
+		Help:    "What this bot does and what data it uses",
+		Handler: func(evt *events.Message, args []string) { sendMessage(evt, onboardingMessage()) },
+	})
+}
+
+// markOnboarded records that a chat has been greeted, reporting whether it is new
+func (s *Store) markOnboarded(chat types.JID) (bool, error) {
+	res, err := s.db.Exec(
+		`INSERT INTO onboarded_chats (chat, onboarded_at) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+		chat.ToNonAD().String(), time.Now().Unix(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// onboardChat sends the intro message to chat unless it has been greeted before
+func onboardChat(chat types.JID) {
+	// Stay unannounced while shadowing; the chat is greeted once it goes live
+	if isShadowChat(chat) {
+		return
+	}
+	isNew, err := botStore.markOnboarded(chat)
+	if err != nil {
+		fmt.Printf("Error recording onboarding for %s: %v\n", chat, err)
+		return
+	}
+	if !isNew {
+		return
+	}
+	if err := sendText(chat, onboardingMessage()); err != nil {
+		fmt.Printf("Error sending onboarding message to %s: %v\n", chat, err)
+	}
+}
+
+// setGroupActive records whether the bot is currently a member of group chat
+func (s *Store) setGroupActive(chat types.JID, active bool) error {
+	_, err := s.db.Exec(
+		`INSERT INTO group_membership (chat, active, changed_at) VALUES (?, ?, ?)
+		ON CONFLICT (chat) DO UPDATE SET active = excluded.active, changed_at = excluded.changed_at`,
+		chat.String(), active, time.Now().Unix(),
+	)
+	return err
+}
+
+// purgeChat drops everything queued for a chat the bot can no longer post in,
+// and forgets it was greeted so it's introduced again if the bot is re-added
+func (s *Store) purgeChat(chat types.JID) error {
+	for _, stmt := range []string{
+		`DELETE FROM pending_replies WHERE chat = ?`,
+		`DELETE FROM deferred_messages WHERE chat = ?`,
+		`DELETE FROM rechecks WHERE chat = ?`,
+		`DELETE FROM async_jobs WHERE chat = ?`,
+		`DELETE FROM outbox WHERE chat = ?`,
+		`DELETE FROM dashboard_links WHERE chat = ?`,
+		`DELETE FROM dashboard_sessions WHERE chat = ?`,
+		`DELETE FROM subscriptions WHERE chat = ?`,
+		`DELETE FROM onboarded_chats WHERE chat = ?`,
+		`DELETE FROM pinned_messages WHERE chat = ?`,
+		`DELETE FROM message_history WHERE chat = ?`,
+		`DELETE FROM synced_messages WHERE chat = ?`,
+		`DELETE FROM disappearing_chats WHERE chat = ?`,
+		`DELETE FROM community_groups WHERE chat = ?`,
+	} {
+		if _, err := s.db.Exec(stmt, chat.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeChatInstance drops what this instance queued for a chat it left while
+// other instances' numbers are still in it
+func (s *Store) purgeChatInstance(chat types.JID) error {
+	for _, table := range []string{"pending_replies", "deferred_messages", "rechecks", "async_jobs", "outbox"} {
+		if _, err := s.db.Exec(`DELETE FROM `+table+` WHERE chat = ? AND instance = ?`, chat.String(), config.InstanceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleJoinedGroup registers and greets a group the bot has just been added to
+func handleJoinedGroup(evt *events.JoinedGroup) {
+	fmt.Printf("Joined group %s (%s)\n", evt.JID, evt.GroupName.Name)
+	if err := botStore.setGroupActive(evt.JID, true); err != nil {
+		fmt.Printf("Error registering group %s: %v\n", evt.JID, err)
+	}
+	noteChatInstance(evt.JID)
+	noteGroupEphemeral(evt.JID, evt.GroupEphemeral)
+	info := types.MessageInfo{MessageSource: types.MessageSource{Chat: evt.JID, IsGroup: true}}
+	if !access.isPermitted(info) {
+		return
+	}
+	onboardChat(evt.JID)
+	if config.GroupScan {
+		go reportGroupScan(evt.JID)
+	}
+}
+
+// handleLeftGroup marks a group the bot was removed from as inactive and
+// drops its queued replies, held messages and subscriptions
+func handleLeftGroup(chat types.JID) {
+	fmt.Printf("Removed from group %s\n", chat)
+	if forgetChatInstance(chat) {
+		// The group stays active for the other instances still in it
+		if err := botStore.purgeChatInstance(chat); err != nil {
+			fmt.Printf("Error purging group %s: %v\n", chat, err)
+		}
+		forgetConversation(chat)
+		forgetGroupInfo(chat)
+		return
+	}
+	if err := botStore.setGroupActive(chat, false); err != nil {
+		fmt.Printf("Error marking group %s inactive: %v\n", chat, err)
+	}
+	if err := botStore.purgeChat(chat); err != nil {
+		fmt.Printf("Error purging group %s: %v\n", chat, err)
+	}
+	forgetConversation(chat)
+	forgetGroupInfo(chat)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// outboxMessenger writes every outgoing message to the outbox before sending
+// it and clears it once WhatsApp has it. A message that can't go out for lack
+// of a connection, or while sending is paused, stays there and is sent after
+// the next reconnection instead of being dropped. It keeps the ID it was
+// first given, so a message that did reach the server before the connection
+// broke isn't posted twice.
+type outboxMessenger struct {
+	Messenger
+}
+
+// outbox is the live client's outbox; replays have none
+var outbox outboxMessenger
+
+// outboxFlushing keeps reconnections in quick succession from sending the
+// same outbox twice at once
+var outboxFlushing sync.Mutex
+
+func (m outboxMessenger) SendMessage(ctx context.Context, to types.JID, msg *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	req := sendRequest(extra)
+	queued := botStore.queueOutgoing(req.ID, to, msg)
+	resp, err := m.Messenger.SendMessage(ctx, to, msg, req)
+	if !queued {
+		return resp, err
+	}
+	if err != nil && worthHolding(err) {
+		fmt.Printf("Holding message %s to %s in the outbox until reconnected: %v\n", req.ID, to, err)
+		metrics.inc("outbox_held")
+		// Callers carry on as if it was sent; it will be, under this ID
+		return whatsmeow.SendResponse{ID: req.ID}, nil
+	}
+	botStore.clearOutgoing(req.ID)
+	return resp, err
+}
+
+// flush sends the messages held in the outbox, oldest first, dropping those
+// older than OUTBOX_MAX_AGE. It stops at the first that still can't go out.
+func (m outboxMessenger) flush() {
+	if m.Messenger == nil || !outboxFlushing.TryLock() {
+		return
+	}
+	defer outboxFlushing.Unlock()
+
+	held, err := botStore.outgoingMessages()
+	if err != nil {
+		fmt.Printf("Error loading outbox: %v\n", err)
+		return
+	}
+	sent := 0
+	for _, o := range held {
+		if config.OutboxMaxAge > 0 && time.Since(o.createdAt) > config.OutboxMaxAge {
+			fmt.Printf("Dropping message %s to %s held in the outbox since %s\n", o.id, o.chat, o.createdAt.Format(time.RFC3339))
+			metrics.inc("outbox_expired")
+			botStore.clearOutgoing(o.id)
+			continue
+		}
+		_, err := m.Messenger.SendMessage(context.Background(), o.chat, o.msg, whatsmeow.SendRequestExtra{ID: o.id})
+		if err != nil && worthHolding(err) {
+			fmt.Printf("Outbox still can't send, %d messages held: %v\n", len(held), err)
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error sending held message %s to %s: %v\n", o.id, o.chat, err)
+			metrics.fail("outbox_failed", err)
+		} else {
+			metrics.inc("outbox_sent")
+			sent++
+		}
+		botStore.clearOutgoing(o.id)
+	}
+	if sent > 0 {
+		fmt.Printf("📤 Sent %d messages held in the outbox\n", sent)
+	}
+}
+
+// worthHolding reports whether a failed send should wait in the outbox until
+// the connection is back or working again
+func worthHolding(err error) bool {
+	return errors.Is(err, errSendingPaused) || errors.Is(err, errConnectionDegraded) || neverReachedServer(err)
+}
+
+// queueOutgoing writes a message to the outbox under id, reporting whether it
+// was written; messages that can't be are still sent, just not kept
+func (s *Store) queueOutgoing(id types.MessageID, to types.JID, msg *waE2E.Message) bool {
+	raw, err := proto.Marshal(msg)
+	if err != nil {
+		fmt.Printf("Error encoding outgoing message: %v\n", err)
+		return false
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO outbox (message_id, chat, message, instance, created_at) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (message_id) DO NOTHING`,
+		id, to.String(), raw, config.InstanceID, time.Now().Unix(),
+	)
+	if err != nil {
+		fmt.Printf("Error queueing outgoing message: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// clearOutgoing removes a message from the outbox
+func (s *Store) clearOutgoing(id types.MessageID) {
+	if _, err := s.db.Exec(`DELETE FROM outbox WHERE message_id = ?`, id); err != nil {
+		fmt.Printf("Error clearing outgoing message: %v\n", err)
+	}
+}
+
+// outgoingMessage is a message held in the outbox
+type outgoingMessage struct {
+	id        types.MessageID
+	chat      types.JID
+	msg       *waE2E.Message
+	createdAt time.Time
+}
+
+// outgoingMessages loads this instance's outbox, oldest first. Messages that
+// can't be read back are dropped.
+func (s *Store) outgoingMessages() ([]outgoingMessage, error) {
+	rows, err := s.db.Query(
+		`SELECT message_id, chat, message, created_at FROM outbox WHERE instance = ? ORDER BY id`,
+		config.InstanceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out, bad []outgoingMessage
+	for rows.Next() {
+		var (
+			id, chat  string
+			raw       []byte
+			createdAt int64
+		)
+		if err := rows.Scan(&id, &chat, &raw, &createdAt); err != nil {
+			return nil, err
+		}
+		o := outgoingMessage{id: id, msg: &waE2E.Message{}, createdAt: time.Unix(createdAt, 0)}
+		jid, err := types.ParseJID(chat)
+		if err == nil {
+			err = proto.Unmarshal(raw, o.msg)
+		}
+		if err != nil {
+			fmt.Printf("Dropping unreadable outgoing message %s: %v\n", id, err)
+			bad = append(bad, o)
+			continue
+		}
+		o.chat = jid
+		out = append(out, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, o := range bad {
+		s.clearOutgoing(o.id)
+	}
+	return out, nil
+}
+
+// countOutgoing returns how many messages this instance holds in the outbox
+func (s *Store) countOutgoing() int {
+	var n int
+	s.db.QueryRow(`SELECT COUNT(*) FROM outbox WHERE instance = ?`, config.InstanceID).Scan(&n)
+	return n
+}
+
+// deleteQuotingOutgoing removes held messages that quote one of jids, as
+// verdicts replying in groups do, so their text goes with the rest of a
+// user's data. Messages to the user's own chat are covered by userDataTables.
+func deleteQuotingOutgoing(tx *storeTx, jids []string) (int64, error) {
+	rows, err := tx.Query(`SELECT message_id, message FROM outbox`)
+	if err != nil {
+		return 0, err
+	}
+	var quoting []string
+	for rows.Next() {
+		var (
+			id  string
+			raw []byte
+		)
+		if err := rows.Scan(&id, &raw); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		var msg waE2E.Message
+		if proto.Unmarshal(raw, &msg) != nil {
+			continue
+		}
+		for _, participant := range []string{
+			msg.GetExtendedTextMessage().GetContextInfo().GetParticipant(),
+			msg.GetImageMessage().GetContextInfo().GetParticipant(),
+			msg.GetReactionMessage().GetKey().GetParticipant(),
+		} {
+			if jid, err := types.ParseJID(participant); err == nil && participant != "" && slices.Contains(jids, jid.ToNonAD().String()) {
+				quoting = append(quoting, id)
+				break
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range quoting {
+		if _, err := tx.Exec(`DELETE FROM outbox WHERE message_id = ?`, id); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(quoting)), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// phonePattern matches runs of digits with optional separators; candidates
+	// are checked for a plausible digit count before masking
+	phonePattern = regexp.MustCompile(`\+?\(?\d[\d\s\-().]{6,}\d`)
+	// mentionPattern matches WhatsApp @mentions, which embed the phone number or LID
+	mentionPattern = regexp.MustCompile(`@\d{6,}`)
+	// namePattern matches names introduced by honorifics or "my name is"
+	namePattern = regexp.MustCompile(`\b((?i:mr|mrs|ms|dr|shri|smt|my name is)\.?\s+)([A-Z][a-z]+(?:\s+[A-Z][a-z]+)?)`)
+)
+
+const (
+	maskEmail = "[EMAIL]"
+	maskPhone = "[PHONE]"
+	maskName  = "[NAME]"
+)
+
+// scrubPII masks phone numbers and email addresses in text before it leaves
+// the bot. With name scrubbing enabled it also masks names after honorifics
+// and any knownNames (e.g. the sender's push name). Name scrubbing is off by
+// default because claims about public figures need their names to be checked.
+func scrubPII(text string, knownNames ...string) string {
+	text = emailPattern.ReplaceAllString(text, maskEmail)
+	text = mentionPattern.ReplaceAllString(text, "@"+maskPhone)
+	text = phonePattern.ReplaceAllStringFunc(text, func(match string) string {
+		digits := 0
+		for _, r := range match {
+			if unicode.IsDigit(r) {
+				digits++
+			}
+		}
+		// Phone numbers have 10-13 digits; shorter runs are usually dates or amounts
+		if digits < 10 || digits > 13 {
+			return match
+		}
+		return maskPhone
+	})
+
+	if config.ScrubNames {
+		text = namePattern.ReplaceAllStringFunc(text, func(match string) string {
+			// Only mask the name itself, keeping the honorific for context
+			return namePattern.FindStringSubmatch(match)[1] + maskName
+		})
+		for _, name := range knownNames {
+			name = strings.TrimSpace(name)
+			if len([]rune(name)) < 3 {
+				continue
+			}
+			re, err := regexp.Compile(`(?i)\b` + regexp.QuoteMeta(name) + `\b`)
+			if err != nil {
+				continue
+			}
+			text = re.ReplaceAllString(text, maskName)
+		}
+	}
+	return text
+}
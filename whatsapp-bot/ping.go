@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func init() {
+	registerCommand("ping", &Command{
+		Usage:   "/ping",
+		Help:    "Check how quickly the bot responds",
+		Handler: cmdPing,
+	})
+}
+
+// cmdPing replies "Pong" and then edits the reply to show how long each hop took
+func cmdPing(evt *events.Message, args []string) {
+	// WhatsApp timestamps have second resolution, so this is approximate
+	handlerDelay := time.Since(evt.Info.Timestamp)
+
+	start := time.Now()
+	resp, err := messenger.SendMessage(context.Background(), evt.Info.Chat, &waE2E.Message{
+		Conversation: proto.String("🏓 Pong"),
+	})
+	if err != nil {
+		fmt.Printf("Error sending message: %v\n", err)
+		metrics.fail("send_error", err)
+		return
+	}
+	sendLatency := time.Since(start)
+
+	report := fmt.Sprintf("🏓 *Pong*\n\n*Message to bot:* ~%d ms\n*Send:* %d ms",
+		handlerDelay.Milliseconds(), sendLatency.Milliseconds())
+	if latency, err := pingBackend(); err != nil {
+		report += "\n*Backend:* unreachable"
+		fmt.Printf("Error pinging backend: %v\n", err)
+	} else {
+		report += fmt.Sprintf("\n*Backend:* %d ms", latency.Milliseconds())
+	}
+
+	edit := client.BuildEdit(evt.Info.Chat, resp.ID, &waE2E.Message{Conversation: proto.String(report)})
+	if _, err := messenger.SendMessage(context.Background(), evt.Info.Chat, edit); err != nil {
+		fmt.Printf("Error editing message: %v\n", err)
+		metrics.fail("send_error", err)
+	}
+}
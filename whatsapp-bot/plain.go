@@ -0,0 +1,64 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+const (
+	formatRich  = "rich"
+	formatPlain = "plain" // no emoji, confidence bar or markdown, for screen readers and old phones
+)
+
+var (
+	// plainBar matches the block-character confidence bar and its brackets
+	plainBar = regexp.MustCompile(`\[[█░]+\]\s*`)
+	// plainBold and plainItalic match WhatsApp *bold* and _italic_ spans;
+	// italics must start and end at a word boundary so URLs keep underscores
+	plainBold   = regexp.MustCompile(`\*([^*\n]+)\*`)
+	plainItalic = regexp.MustCompile(`(^|[\s(])_([^_\n]+)_([\s).,:;!?]|$)`)
+	plainSpaces = regexp.MustCompile(` {2,}`)
+)
+
+// isPlainChat reports whether chat asked for plain formatting
+func isPlainChat(chat types.JID) bool {
+	return botStore != nil && botStore.getChatSettings(chat).Format == formatPlain
+}
+
+// plainText rewrites a reply for the plain format: emoji and the confidence
+// bar are dropped, bullets become dashes and bold/italic markers are removed
+func plainText(text string) string {
+	text = plainBar.ReplaceAllString(text, "")
+	text = plainBold.ReplaceAllString(text, "$1")
+	text = plainItalic.ReplaceAllString(text, "$1$2$3")
+
+	var sb strings.Builder
+	sb.Grow(len(text))
+	dropped := false
+	for _, r := range text {
+		switch {
+		case isEmoji(r) || isPlainSymbol(r) || (r == '\u200d' && dropped):
+			dropped = true
+			continue
+		case r == '•':
+			r = '-'
+		}
+		dropped = false
+		sb.WriteRune(r)
+	}
+
+	lines := strings.Split(sb.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(plainSpaces.ReplaceAllString(line, " "))
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// isPlainSymbol reports whether r is one of the symbols outside isEmoji's
+// ranges the bot's replies use as emoji, such as ℹ️, ⏳ and ⏱️
+func isPlainSymbol(r rune) bool {
+	return r == 0x2139 || r == 0x2122 || (r >= 0x2190 && r <= 0x21FF) || (r >= 0x2300 && r <= 0x23FF) ||
+		(r >= 0x25A0 && r <= 0x25FF)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Poll options, stored by index so results are comparable across languages
+const (
+	pollBelieved = iota
+	pollNotBelieved
+	pollUnsure
+)
+
+// maxListedPollClaims is how many claims /polls shows
+const maxListedPollClaims = 10
+
+func init() {
+	registerCommand("polls", &Command{
+		Usage:   "/polls",
+		Help:    "Show how believable people found recently checked claims",
+		Role:    roleAdmin,
+		Handler: cmdPolls,
+	})
+}
+
+// pollOptions returns the poll's option names in index order
+func pollOptions(m *Messages) []string {
+	return []string{m.PollBelieved, m.PollNotBelieved, m.PollUnsure}
+}
+
+// sendVerdictPoll follows a verdict with a poll asking whether the claim
+// seemed believable before the check, remembering which claim it's about
+func sendVerdictPoll(evt *events.Message, result *AnalyzeResponse, language string) {
+	if !config.VerdictPoll || !featureEnabled(flagPolls, evt.Info.Chat) {
+		return
+	}
+	m := messagesFor(language)
+	poll := client.BuildPollCreation(m.PollQuestion, pollOptions(m), 1)
+	resp, err := messenger.SendMessage(context.Background(), evt.Info.Chat, poll)
+	if err != nil {
+		fmt.Printf("Error sending verdict poll: %v\n", err)
+		metrics.fail("send_error", err)
+		return
+	}
+	_, err = botStore.db.Exec(
+		`INSERT INTO verdict_polls (poll_id, chat, claim_key, language, is_misinformation, confidence, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		resp.ID, evt.Info.Chat.String(), result.claimKey, language, result.IsMisinformation, result.Confidence, time.Now().Unix(),
+	)
+	if err != nil {
+		fmt.Printf("Error recording verdict poll: %v\n", err)
+	}
+}
+
+// handlePollVote records a vote on one of the bot's verdict polls, reporting
+// whether evt was a poll vote at all
+func handlePollVote(evt *events.Message) bool {
+	update := evt.Message.GetPollUpdateMessage()
+	if update == nil {
+		return false
+	}
+	pollID := update.GetPollCreationMessageKey().GetID()
+
+	var language, pollChat string
+	err := botStore.db.QueryRow(`SELECT language, chat FROM verdict_polls WHERE poll_id = ?`, pollID).Scan(&language, &pollChat)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true
+	}
+	if err != nil {
+		fmt.Printf("Error loading poll %s: %v\n", pollID, err)
+		return true
+	}
+
+	vote, err := client.DecryptPollVote(context.Background(), evt)
+	if err != nil {
+		fmt.Printf("Error decrypting poll vote: %v\n", err)
+		return true
+	}
+
+	voter := evt.Info.Sender.ToNonAD().String()
+	if len(vote.GetSelectedOptions()) == 0 {
+		// The vote was withdrawn
+		botStore.db.Exec(`DELETE FROM poll_votes WHERE poll_id = ? AND voter = ?`, pollID, voter)
+		return true
+	}
+	hashes := whatsmeow.HashPollOptions(pollOptions(messagesFor(language)))
+	for option, hash := range hashes {
+		if !bytes.Equal(vote.GetSelectedOptions()[0], hash) {
+			continue
+		}
+		_, err := botStore.db.Exec(
+			`INSERT INTO poll_votes (poll_id, voter, option, voted_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (poll_id, voter) DO UPDATE SET option = excluded.option, voted_at = excluded.voted_at`,
+			pollID, voter, option, time.Now().Unix(),
+		)
+		if err != nil {
+			fmt.Printf("Error recording poll vote: %v\n", err)
+		}
+		metrics.inc("poll_vote")
+		if chat, err := types.ParseJID(pollChat); err == nil {
+			recordExperimentEvent(chat, experimentPollVote)
+		}
+		break
+	}
+	return true
+}
+
+// PollResult is the aggregated poll outcome for one claim
+type PollResult struct {
+	ClaimKey         string
+	IsMisinformation bool
+	Believed         int
+	NotBelieved      int
+	Unsure           int
+}
+
+// pollResults aggregates votes per claim across every poll about it, most voted first
+func (s *Store) pollResults(limit int) ([]PollResult, error) {
+	rows, err := s.db.Query(`
+		SELECT p.claim_key, MAX(p.is_misinformation),
+			SUM(CASE WHEN v.option = ? THEN 1 ELSE 0 END), SUM(CASE WHEN v.option = ? THEN 1 ELSE 0 END),
+			SUM(CASE WHEN v.option = ? THEN 1 ELSE 0 END)
+		FROM verdict_polls p JOIN poll_votes v ON v.poll_id = p.poll_id
+		GROUP BY p.claim_key ORDER BY COUNT(*) DESC LIMIT ?`,
+		pollBelieved, pollNotBelieved, pollUnsure, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []PollResult
+	for rows.Next() {
+		var r PollResult
+		if err := rows.Scan(&r.ClaimKey, &r.IsMisinformation, &r.Believed, &r.NotBelieved, &r.Unsure); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// claimSummary returns the most recent summary recorded for a claim
+func (s *Store) claimSummary(claimKey string) string {
+	var summary sql.NullString
+	s.db.QueryRow(`SELECT summary FROM analysis_history WHERE claim_key = ? ORDER BY id DESC LIMIT 1`, claimKey).Scan(&summary)
+	return summary.String
+}
+
+func cmdPolls(evt *events.Message, args []string) {
+	results, err := botStore.pollResults(maxListedPollClaims)
+	if err != nil {
+		fmt.Printf("Error loading poll results: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not load poll results.")
+		return
+	}
+	if len(results) == 0 {
+		sendMessage(evt, "📭 No poll votes yet.")
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("📊 *Believed before the check?*\n")
+	for _, r := range results {
+		verdict := "✅ credible"
+		if r.IsMisinformation {
+			verdict = "🚨 misinformation"
+		}
+		summary := []rune(botStore.claimSummary(r.ClaimKey))
+		if len(summary) > 60 {
+			summary = append(summary[:60], '…')
+		}
+		if len(summary) == 0 {
+			summary = []rune(r.ClaimKey)
+		}
+		sb.WriteString(fmt.Sprintf("\n%s: %s\n   yes %d · no %d · not sure %d",
+			verdict, string(summary), r.Believed, r.NotBelieved, r.Unsure))
+	}
+	sendMessage(evt, sb.String())
+}
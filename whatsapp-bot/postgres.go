@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// storeDB is the bot database: SQLite by default, or Postgres when several
+// instances share one through DATABASE_URL. Queries are written for SQLite
+// with ? placeholders and portable upserts; for Postgres the placeholders
+// are renumbered and booleans stored as the integers SQLite would keep.
+type storeDB struct {
+	*sql.DB
+	postgres bool
+}
+
+// storeTx is a transaction on a storeDB
+type storeTx struct {
+	*sql.Tx
+	db *storeDB
+}
+
+// isPostgresURL reports whether dsn names a Postgres database rather than a
+// SQLite file
+func isPostgresURL(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// postgresConnector opens each new connection with the current DSN, so a
+// rotated DATABASE_URL password is used without a restart
+type postgresConnector struct {
+	dsn func() string
+}
+
+func (c postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	connector, err := pq.NewConnector(c.dsn())
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (c postgresConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// openPostgres connects to the shared Postgres database at url
+func openPostgres(url string) (*storeDB, error) {
+	dsn := func() string { return url }
+	if url == config.DatabaseURL.Get() {
+		dsn = config.DatabaseURL.Get
+	}
+	if _, err := pq.NewConnector(url); err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(postgresConnector{dsn: dsn})
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot reach Postgres: %w", err)
+	}
+	return &storeDB{DB: db, postgres: true}, nil
+}
+
+func (d *storeDB) Exec(query string, args ...any) (sql.Result, error) {
+	return d.DB.Exec(d.rebind(query), d.args(args)...)
+}
+
+func (d *storeDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return d.DB.Query(d.rebind(query), d.args(args)...)
+}
+
+func (d *storeDB) QueryRow(query string, args ...any) *sql.Row {
+	return d.DB.QueryRow(d.rebind(query), d.args(args)...)
+}
+
+func (d *storeDB) Begin() (*storeTx, error) {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &storeTx{Tx: tx, db: d}, nil
+}
+
+func (t *storeTx) Exec(query string, args ...any) (sql.Result, error) {
+	return t.Tx.Exec(t.db.rebind(query), t.db.args(args)...)
+}
+
+func (t *storeTx) Query(query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.Query(t.db.rebind(query), t.db.args(args)...)
+}
+
+func (t *storeTx) QueryRow(query string, args ...any) *sql.Row {
+	return t.Tx.QueryRow(t.db.rebind(query), t.db.args(args)...)
+}
+
+// rebind turns ? placeholders into Postgres's $1, $2, …, leaving question
+// marks inside string literals alone
+func (d *storeDB) rebind(query string) string {
+	if !d.postgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var sb strings.Builder
+	n, quoted := 0, false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// args stores booleans as 0 or 1 in Postgres, whose integer columns won't
+// take them the way SQLite's do
+func (d *storeDB) args(args []any) []any {
+	if !d.postgres {
+		return args
+	}
+	converted := make([]any, len(args))
+	for i, arg := range args {
+		converted[i] = arg
+		if b, ok := arg.(bool); ok {
+			converted[i] = 0
+			if b {
+				converted[i] = 1
+			}
+		}
+	}
+	return converted
+}
+
+var (
+	pgAutoincrement = regexp.MustCompile(`\bINTEGER PRIMARY KEY AUTOINCREMENT\b`)
+	pgInteger       = regexp.MustCompile(`\bINTEGER\b`)
+	pgReal          = regexp.MustCompile(`\bREAL\b`)
+	pgBlob          = regexp.MustCompile(`\bBLOB\b`)
+)
+
+// ddl translates a schema statement for this database. SQLite integers are
+// 64-bit, so every INTEGER becomes a BIGINT in Postgres.
+func (d *storeDB) ddl(stmt string) string {
+	if !d.postgres {
+		return stmt
+	}
+	stmt = pgAutoincrement.ReplaceAllString(stmt, "BIGSERIAL PRIMARY KEY")
+	stmt = pgInteger.ReplaceAllString(stmt, "BIGINT")
+	stmt = pgReal.ReplaceAllString(stmt, "DOUBLE PRECISION")
+	return pgBlob.ReplaceAllString(stmt, "BYTEA")
+}
+
+// postgresAuditTriggersV1 keep the audit log append-only in Postgres, in
+// place of the SQLite triggers in schemaV1. Frozen like schemaV1.
+var postgresAuditTriggersV1 = []string{
+	`CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+	 BEGIN RAISE EXCEPTION 'audit_log is append-only'; END $$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS audit_log_no_change ON audit_log`,
+	`CREATE TRIGGER audit_log_no_change BEFORE UPDATE OR DELETE ON audit_log
+	 FOR EACH ROW EXECUTE FUNCTION audit_log_append_only()`,
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// greetingWords are the words pure greetings and pleasantries are made of
+var greetingWords = map[string]bool{
+	"hi": true, "hii": true, "hello": true, "hey": true, "hola": true, "gm": true, "gn": true,
+	"good": true, "morning": true, "afternoon": true, "evening": true, "night": true, "day": true,
+	"have": true, "a": true, "nice": true, "great": true, "happy": true, "birthday": true,
+	"anniversary": true, "diwali": true, "holi": true, "eid": true, "new": true, "year": true,
+	"thanks": true, "thank": true, "you": true, "ty": true, "welcome": true, "congrats": true,
+	"congratulations": true, "ok": true, "okay": true, "k": true, "yes": true, "no": true,
+	"lol": true, "haha": true, "hahaha": true, "hehe": true, "bye": true, "see": true,
+	"everyone": true, "all": true, "friends": true, "dear": true, "guys": true, "sir": true,
+	"ji": true, "bhai": true, "to": true, "and": true, "very": true, "much": true, "same": true,
+	"namaste": true, "namaskar": true, "shubh": true, "prabhat": true, "ratri": true, "dhanyavad": true,
+	"नमस्ते": true, "नमस्कार": true, "सुप्रभात": true, "शुभ": true, "प्रभात": true, "रात्रि": true,
+	"धन्यवाद": true, "शुभेच्छा": true, "जी": true, "सभी": true, "को": true, "सर्वांना": true,
+}
+
+// newsMarkers are words that make a short message worth checking anyway
+var newsMarkers = map[string]bool{
+	"breaking": true, "news": true, "alert": true, "urgent": true, "government": true, "govt": true,
+	"minister": true, "police": true, "court": true, "ban": true, "banned": true, "rbi": true,
+	"vaccine": true, "virus": true, "death": true, "died": true, "killed": true, "election": true,
+	"forward": true, "share": true, "viral": true, "fake": true, "true": true, "confirmed": true,
+	"सरकार": true, "खबर": true, "समाचार": true, "बंद": true, "पुलिस": true, "मौत": true, "बातमी": true,
+}
+
+var (
+	prefilterURL    = regexp.MustCompile(`https?://|www\.`)
+	prefilterDigits = regexp.MustCompile(`\d`)
+)
+
+// prefilterReason returns why text shouldn't be sent to the backend for
+// automatic analysis, or "" when it should be analyzed
+func prefilterReason(evt *events.Message, text string) string {
+	if utf8.RuneCountInString(text) < config.MinTextLength {
+		return "too short"
+	}
+	if !strings.ContainsFunc(text, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) {
+		return "no text"
+	}
+	if config.SkipBotReplies && isReplyToBot(evt.Message) {
+		return "reply to the bot"
+	}
+
+	words := prefilterWords(text)
+	if config.SkipGreetings && isGreeting(words) {
+		return "greeting"
+	}
+	if config.ChitChatFilter && isChitChat(text, words) {
+		return "chit-chat"
+	}
+	return ""
+}
+
+// prefilterWords splits text into lowercase words, dropping punctuation and emoji
+func prefilterWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	})
+}
+
+// isGreeting reports whether words are nothing but greetings and pleasantries
+func isGreeting(words []string) bool {
+	if len(words) == 0 {
+		return false
+	}
+	for _, w := range words {
+		if !greetingWords[w] {
+			return false
+		}
+	}
+	return true
+}
+
+// isChitChat is a tiny heuristic classifier for obvious conversation: short
+// messages with no link, number or news vocabulary, or questions to the group
+func isChitChat(text string, words []string) bool {
+	if prefilterURL.MatchString(text) || prefilterDigits.MatchString(text) {
+		return false
+	}
+	for _, w := range words {
+		if newsMarkers[w] {
+			return false
+		}
+	}
+	if len(words) <= 6 {
+		return true
+	}
+	// A short question ("anyone coming tonight?") is rarely a claim
+	return len(words) <= 12 && strings.HasSuffix(strings.TrimSpace(text), "?")
+}
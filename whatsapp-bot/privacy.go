@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// confirmationTTL is how long a destructive command waits for its "confirm" follow-up
+const confirmationTTL = 5 * time.Minute
+
+// userDataTable describes where a user's personal data lives in the bot database.
+// Tables added by later features must be registered here so /mydata and
+// /forgetme stay complete.
+type userDataTable struct {
+	Table  string
+	Column string
+	// Extra narrows which rows count as the user's, e.g. excluding blocklist entries
+	Extra string
+	// Keep marks rows that are exported but not deleted by /forgetme
+	Keep bool
+}
+
+var userDataTables = []userDataTable{
+	{Table: "access_list", Column: "jid", Extra: "list = 'allow'"},
+	{Table: "access_list", Column: "jid", Extra: "list = 'block'", Keep: true},
+	{Table: "access_list", Column: "added_by"},
+	{Table: "chat_settings", Column: "chat"},
+	{Table: "onboarded_chats", Column: "chat"},
+	{Table: "group_membership", Column: "chat"},
+	{Table: "experiment_events", Column: "chat"},
+	{Table: "pending_replies", Column: "sender"},
+	{Table: "analysis_history", Column: "sender"},
+	{Table: "subscriptions", Column: "chat"},
+	{Table: "subscriptions", Column: "created_by"},
+	{Table: "dashboard_links", Column: "created_by"},
+	{Table: "dashboard_sessions", Column: "created_by"},
+	{Table: "trend_alerts", Column: "chat"},
+	{Table: "scheduled_broadcasts", Column: "created_by", Keep: true},
+	{Table: "deferred_messages", Column: "sender"},
+	{Table: "dead_letters", Column: "sender"},
+	{Table: "poll_votes", Column: "voter"},
+	{Table: "rechecks", Column: "sender"},
+	{Table: "watches", Column: "watcher"},
+	{Table: "async_jobs", Column: "sender"},
+	{Table: "archived_media", Column: "chat"},
+	{Table: "archived_media", Column: "sender"},
+	{Table: "outbox", Column: "chat"},
+	{Table: "message_history", Column: "sender"},
+	{Table: "synced_messages", Column: "sender"},
+	{Table: "pinned_messages", Column: "pinned_by"},
+	{Table: "roles", Column: "jid", Keep: true},
+	{Table: "roles", Column: "granted_by", Keep: true},
+	{Table: "audit_log", Column: "actor", Keep: true},
+	{Table: "domain_reputation", Column: "updated_by", Keep: true},
+}
+
+// confirmations tracks pending "are you sure?" prompts keyed by sender and action
+var confirmations = struct {
+	sync.Mutex
+	pending map[string]time.Time
+}{pending: map[string]time.Time{}}
+
+func init() {
+	registerCommand("mydata", &Command{
+		Usage:   "/mydata [confirm]",
+		Help:    "Export everything the bot has stored about you",
+		Handler: cmdMyData,
+	})
+	registerCommand("forgetall", &Command{
+		Usage:   "/forgetall",
+		Help:    "Delete everything the bot has stored about every user",
+		Role:    roleOwner,
+		Confirm: confirmAlways("This permanently deletes the stored data of *every* user: history, settings, subscriptions and archived media."),
+		Handler: cmdForgetAll,
+	})
+	registerCommand("forgetme", &Command{
+		Usage:   "/forgetme [confirm]",
+		Help:    "Delete everything the bot has stored about you",
+		Handler: cmdForgetMe,
+	})
+	registerSubcommand("purge", &Subcommand{
+		Usage: "purge -yes (-user JID,... | -chat JID | -all)",
+		Help:  "Delete stored data of users, of a chat, or of everyone",
+		Run:   runPurge,
+	})
+}
+
+// requestConfirmation starts a confirmation window for sender and action
+func requestConfirmation(sender types.JID, action string) {
+	confirmations.Lock()
+	defer confirmations.Unlock()
+	confirmations.pending[sender.ToNonAD().String()+"|"+action] = time.Now().Add(confirmationTTL)
+}
+
+// consumeConfirmation reports whether sender has an unexpired prompt for action, clearing it
+func consumeConfirmation(sender types.JID, action string) bool {
+	confirmations.Lock()
+	defer confirmations.Unlock()
+	key := sender.ToNonAD().String() + "|" + action
+	expires, ok := confirmations.pending[key]
+	delete(confirmations.pending, key)
+	return ok && time.Now().Before(expires)
+}
+
+// userJIDs returns every identifier the sender may be stored under (phone number and LID)
+func userJIDs(info types.MessageInfo) []string {
+	jids := []string{info.Sender.ToNonAD().String()}
+	if !info.SenderAlt.IsEmpty() {
+		jids = append(jids, info.SenderAlt.ToNonAD().String())
+	}
+	return jids
+}
+
+// userDataWhere builds the WHERE clause selecting a user's rows in t
+func userDataWhere(t userDataTable, jids []string) (string, []any) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(jids)), ", ")
+	where := fmt.Sprintf("%s IN (%s)", t.Column, placeholders)
+	if t.Extra != "" {
+		where += " AND " + t.Extra
+	}
+	args := make([]any, len(jids))
+	for i, jid := range jids {
+		args[i] = jid
+	}
+	return where, args
+}
+
+// exportUserData collects every row stored about the given JIDs, grouped by table
+func (s *Store) exportUserData(jids []string) (map[string][]map[string]any, error) {
+	export := map[string][]map[string]any{}
+	for _, t := range userDataTables {
+		where, args := userDataWhere(t, jids)
+		rows, err := s.db.Query(fmt.Sprintf("SELECT * FROM %s WHERE %s", t.Table, where), args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", t.Table, err)
+		}
+		columns, err := rows.Columns()
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		for rows.Next() {
+			values := make([]any, len(columns))
+			ptrs := make([]any, len(columns))
+			for i := range values {
+				ptrs[i] = &values[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			row := make(map[string]any, len(columns))
+			for i, column := range columns {
+				// Store blobs (e.g. quoted messages) as text so the export stays readable
+				if b, ok := values[i].([]byte); ok {
+					values[i] = string(b)
+				}
+				row[column] = values[i]
+			}
+			export[t.Table] = append(export[t.Table], row)
+		}
+		rows.Close()
+	}
+	return export, nil
+}
+
+// deleteUserData removes every deletable row stored about the given JIDs,
+// and the archived files of their media
+func (s *Store) deleteUserData(jids []string) (int64, error) {
+	if err := s.deleteUserArchive(jids); err != nil {
+		return 0, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var total int64
+	for _, t := range userDataTables {
+		if t.Keep {
+			continue
+		}
+		where, args := userDataWhere(t, jids)
+		res, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", t.Table, where), args...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete from %s: %w", t.Table, err)
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	n, err := deleteQuotingOutgoing(tx, jids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete from outbox: %w", err)
+	}
+	return total + n, tx.Commit()
+}
+
+// deleteAllUserData removes every deletable row of user data for everyone.
+// The access lists are the operators' configuration, so they are kept.
+func (s *Store) deleteAllUserData() (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var total int64
+	for _, t := range userDataTables {
+		if t.Keep || t.Table == "access_list" {
+			continue
+		}
+		query := "DELETE FROM " + t.Table
+		if t.Extra != "" {
+			query += " WHERE " + t.Extra
+		}
+		res, err := tx.Exec(query)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete from %s: %w", t.Table, err)
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, tx.Commit()
+}
+
+// countUserData returns how many rows are stored about the given JIDs
+func countUserData(export map[string][]map[string]any) int {
+	n := 0
+	for _, rows := range export {
+		n += len(rows)
+	}
+	return n
+}
+
+func cmdMyData(evt *events.Message, args []string) {
+	if len(args) == 0 || args[0] != "confirm" {
+		requestConfirmation(evt.Info.Sender, "mydata")
+		sendMessage(evt, "📦 I'll send you a file with everything stored about you, as a private message.\n\nReply */mydata confirm* within 5 minutes to continue.")
+		return
+	}
+	if !consumeConfirmation(evt.Info.Sender, "mydata") {
+		sendMessage(evt, "⌛ No pending request. Send /mydata first.")
+		return
+	}
+
+	export, err := botStore.exportUserData(userJIDs(evt.Info))
+	if err != nil {
+		fmt.Printf("Error exporting user data: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not export your data. Please try again later.")
+		return
+	}
+	doc, err := json.MarshalIndent(map[string]any{
+		"user":        userJIDs(evt.Info),
+		"exported_at": time.Now().UTC().Format(time.RFC3339),
+		"data":        export,
+	}, "", "  ")
+	if err != nil {
+		fmt.Printf("Error encoding user data: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not export your data. Please try again later.")
+		return
+	}
+
+	caption := fmt.Sprintf("📦 Your Aletheia data (%d records)", countUserData(export))
+	if err := sendDocument(evt.Info.Sender.ToNonAD(), doc, "aletheia-mydata.json", "application/json", caption); err != nil {
+		fmt.Printf("Error sending user data export: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not send your data export. Please try again later.")
+		return
+	}
+	if evt.Info.IsGroup {
+		sendMessage(evt, "📦 Sent your data export as a private message.")
+	}
+}
+
+func cmdForgetMe(evt *events.Message, args []string) {
+	if len(args) == 0 || args[0] != "confirm" {
+		requestConfirmation(evt.Info.Sender, "forgetme")
+		sendMessage(evt, "🗑️ This will permanently delete everything the bot has stored about you, including your chat settings.\n\nReply */forgetme confirm* within 5 minutes to continue.")
+		return
+	}
+	if !consumeConfirmation(evt.Info.Sender, "forgetme") {
+		sendMessage(evt, "⌛ No pending request. Send /forgetme first.")
+		return
+	}
+
+	if !evt.Info.IsGroup {
+		forgetConversation(evt.Info.Chat)
+	}
+	n, err := botStore.deleteUserData(userJIDs(evt.Info))
+	if err != nil {
+		fmt.Printf("Error deleting user data: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not delete your data. Please try again later.")
+		return
+	}
+	fmt.Printf("Deleted %d records for %s on request\n", n, evt.Info.Sender)
+	sendMessage(evt, fmt.Sprintf("✅ Deleted %d records stored about you.", n))
+}
+
+func cmdForgetAll(evt *events.Message, args []string) {
+	// Delete archived files first; their rows go with the rest below
+	if archiveStore != nil {
+		botStore.pruneArchive(0)
+	}
+	n, err := botStore.deleteAllUserData()
+	if err != nil {
+		fmt.Printf("Error deleting all user data: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not delete the stored data. Please try again later.")
+		return
+	}
+	conversations.Lock()
+	conversations.byChat = map[string]*conversation{}
+	conversations.Unlock()
+	fmt.Printf("Deleted %d records of all users on request of %s\n", n, evt.Info.Sender)
+	sendMessage(evt, fmt.Sprintf("✅ Deleted %d records.", n))
+}
+
+// runPurge deletes data from the command line, for erasure requests that
+// arrive outside WhatsApp
+func runPurge(args []string) int {
+	flags := flag.NewFlagSet("purge", flag.ExitOnError)
+	users := flags.String("user", "", "comma-separated JIDs or phone numbers whose data to delete")
+	chat := flags.String("chat", "", "JID of a chat whose queued messages, subscriptions and history to delete")
+	all := flags.Bool("all", false, "delete the stored data of every user")
+	yes := flags.Bool("yes", false, "confirm the deletion")
+	flags.Parse(args)
+
+	targets := 0
+	for _, set := range []bool{*users != "", *chat != "", *all} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		fmt.Fprintln(os.Stderr, "Give exactly one of -user, -chat or -all")
+		return 2
+	}
+	if !*yes {
+		fmt.Fprintln(os.Stderr, "This permanently deletes data; run again with -yes to confirm")
+		return 2
+	}
+	var jids []string
+	for _, arg := range strings.Split(*users, ",") {
+		if strings.TrimSpace(arg) == "" {
+			continue
+		}
+		jid, err := parseJIDArg(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid JID %q: %v\n", arg, err)
+			return 2
+		}
+		jids = append(jids, jid.ToNonAD().String())
+	}
+	var chatJID types.JID
+	if *chat != "" {
+		var err error
+		if chatJID, err = parseJIDArg(*chat); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid JID %q: %v\n", *chat, err)
+			return 2
+		}
+	}
+
+	if err := openBotStore(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer botStore.Close()
+
+	switch {
+	case *users != "":
+		if err := openArchive(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening media archive: %v\n", err)
+			return 1
+		}
+		n, err := botStore.deleteUserData(jids)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error deleting user data: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Deleted %d records for %s\n", n, strings.Join(jids, ", "))
+	case *chat != "":
+		if err := botStore.purgeChat(chatJID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error purging chat: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Purged %s\n", chatJID)
+	case *all:
+		if err := openArchive(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening media archive: %v\n", err)
+			return 1
+		}
+		if archiveStore != nil {
+			botStore.pruneArchive(0)
+		}
+		n, err := botStore.deleteAllUserData()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error deleting all user data: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Deleted %d records\n", n)
+	}
+	return 0
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Starvation protection: a passive job is taken after this many priority
+// jobs in a row, or as soon as it has waited maxPassiveWait
+const (
+	maxPriorityStreak = 4
+	maxPassiveWait    = 30 * time.Second
+)
+
+// queuedMessage is a message waiting for a worker
+type queuedMessage struct {
+	evt      *events.Message
+	enqueued time.Time
+}
+
+// MessageQueue feeds incoming messages to the worker pool, serving direct
+// messages and commands before passive group auto-analysis
+type MessageQueue struct {
+	mu       sync.Mutex
+	ready    *sync.Cond
+	priority []queuedMessage
+	passive  []queuedMessage
+	streak   int
+}
+
+var messageQueue = newMessageQueue()
+
+func newMessageQueue() *MessageQueue {
+	q := &MessageQueue{}
+	q.ready = sync.NewCond(&q.mu)
+	return q
+}
+
+// isPriority reports whether evt is a DM or an explicit command, which
+// someone is actively waiting on
+func isPriority(evt *events.Message) bool {
+	return !evt.Info.IsGroup || strings.HasPrefix(strings.TrimSpace(extractText(evt.Message)), "/")
+}
+
+// push queues evt, dropping it when a full queue has no room for it
+func (q *MessageQueue) push(evt *events.Message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.priority)+len(q.passive) >= config.QueueSize {
+		// Make room by shedding the newest passive job rather than a request
+		if !isPriority(evt) || len(q.passive) == 0 {
+			fmt.Printf("Message queue full, dropping message %s\n", evt.Info.ID)
+			metrics.inc("queue_dropped")
+			return
+		}
+		dropped := q.passive[len(q.passive)-1]
+		q.passive = q.passive[:len(q.passive)-1]
+		fmt.Printf("Message queue full, dropping message %s\n", dropped.evt.Info.ID)
+		metrics.inc("queue_dropped")
+	}
+
+	item := queuedMessage{evt: evt, enqueued: time.Now()}
+	if isPriority(evt) {
+		q.priority = append(q.priority, item)
+	} else {
+		q.passive = append(q.passive, item)
+	}
+	q.ready.Signal()
+}
+
+// pop blocks until a message is queued and returns the next one to handle
+func (q *MessageQueue) pop() queuedMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.priority) == 0 && len(q.passive) == 0 {
+		q.ready.Wait()
+	}
+
+	starved := len(q.passive) > 0 &&
+		(q.streak >= maxPriorityStreak || time.Since(q.passive[0].enqueued) >= maxPassiveWait)
+	if len(q.priority) > 0 && !starved {
+		item := q.priority[0]
+		q.priority = q.priority[1:]
+		q.streak++
+		return item
+	}
+	item := q.passive[0]
+	q.passive = q.passive[1:]
+	q.streak = 0
+	return item
+}
+
+// snapshot returns the waiting messages in roughly the order they'll be
+// handled: priority messages first, then passive ones
+func (q *MessageQueue) snapshot() []queuedMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := append([]queuedMessage{}, q.priority...)
+	return append(out, q.passive...)
+}
+
+// depth returns how many priority and passive messages are waiting
+func (q *MessageQueue) depth() (int, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.priority), len(q.passive)
+}
+
+// startWorkers runs the pool of goroutines that handle queued messages
+func startWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		go runWorker(nil)
+	}
+}
+
+// runningWorkers counts the workers currently taking messages
+var runningWorkers atomic.Int32
+
+// runWorker handles queued messages for as long as keep reports true, or
+// forever when keep is nil
+func runWorker(keep func() bool) {
+	runningWorkers.Add(1)
+	defer runningWorkers.Add(-1)
+	for keep == nil || keep() {
+		item := messageQueue.pop()
+		if wait := time.Since(item.enqueued); wait > 5*time.Second {
+			fmt.Printf("Message %s waited %s in the queue\n", item.evt.Info.ID, wait.Round(time.Second))
+		}
+		// Hold off while the backend has asked for a pause
+		waitForBackend()
+		started := time.Now()
+		startHandling(item.evt, started)
+		handleMessage(item.evt)
+		doneHandling(item.evt, time.Since(started))
+	}
+}
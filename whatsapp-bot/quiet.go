@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	quietModeQueue = "queue"
+	quietModeReact = "react"
+)
+
+// QuietHours is a daily window, in minutes after midnight, during which the
+// bot holds back its replies. The window may wrap past midnight (23:00–07:00).
+type QuietHours struct {
+	Start int
+	End   int
+	Mode  string
+}
+
+func init() {
+	registerCommand("quiet", &Command{
+		Usage:   "/quiet [HH:MM-HH:MM [queue|react] | off]",
+		Help:    "Show or set quiet hours for this chat",
+		Handler: cmdQuiet,
+	})
+}
+
+// parseQuietHours parses "23:00-07:00" into a window using the given mode
+func parseQuietHours(spec, mode string) (*QuietHours, error) {
+	start, end, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, fmt.Errorf("expected HH:MM-HH:MM, got %q", spec)
+	}
+	startMin, err := parseClock(start)
+	if err != nil {
+		return nil, err
+	}
+	endMin, err := parseClock(end)
+	if err != nil {
+		return nil, err
+	}
+	if startMin == endMin {
+		return nil, fmt.Errorf("quiet hours must not start and end at the same time")
+	}
+	switch mode {
+	case "":
+		mode = quietModeQueue
+	case quietModeQueue, quietModeReact:
+	default:
+		return nil, fmt.Errorf("unknown quiet mode %q (use queue or react)", mode)
+	}
+	return &QuietHours{Start: startMin, End: endMin, Mode: mode}, nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	hour, err := strconv.Atoi(h)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("invalid hour in %q", s)
+	}
+	minute, err := strconv.Atoi(m)
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid minute in %q", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// Contains reports whether t (in the configured time zone) falls inside the window
+func (q *QuietHours) Contains(t time.Time) bool {
+	t = t.In(config.TimeZone)
+	now := t.Hour()*60 + t.Minute()
+	if q.Start < q.End {
+		return now >= q.Start && now < q.End
+	}
+	return now >= q.Start || now < q.End
+}
+
+func (q *QuietHours) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", q.Start/60, q.Start%60, q.End/60, q.End%60)
+}
+
+// quietHoursFor returns the active quiet hours for a chat; nil means none
+func quietHoursFor(chat types.JID) *QuietHours {
+	return botStore.getChatSettings(chat).QuietHours
+}
+
+// inQuietHours reports whether the chat is currently in its quiet window
+func inQuietHours(chat types.JID) bool {
+	q := quietHoursFor(chat)
+	return q != nil && q.Contains(time.Now())
+}
+
+// deferReply handles a verdict that arrives during quiet hours, either queueing
+// it for later or reacting to the original message without notifying anyone
+func deferReply(evt *events.Message, result *AnalyzeResponse, text string, q *QuietHours) {
+	if q.Mode == quietModeReact {
+		react(evt.Info.Chat, evt.Info.Sender, evt.Info.ID, verdictEmoji(result))
+		return
+	}
+
+	quoted, err := proto.Marshal(evt.Message)
+	if err != nil {
+		fmt.Printf("Error encoding quoted message: %v\n", err)
+		return
+	}
+	_, err = botStore.db.Exec(
+		`INSERT INTO pending_replies (chat, message_id, sender, quoted, text, created_at, instance) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		evt.Info.Chat.String(), evt.Info.ID, evt.Info.Sender.String(), quoted, text, time.Now().Unix(), config.InstanceID,
+	)
+	if err != nil {
+		fmt.Printf("Error queueing reply: %v\n", err)
+		return
+	}
+	fmt.Printf("Quiet hours in %s, queued reply to %s\n", evt.Info.Chat, evt.Info.ID)
+}
+
+// flushPendingReplies sends every queued reply whose chat has left quiet hours
+func flushPendingReplies() {
+	rows, err := botStore.db.Query(
+		`SELECT id, chat, message_id, sender, quoted, text FROM pending_replies WHERE instance = ? ORDER BY id`,
+		config.InstanceID,
+	)
+	if err != nil {
+		fmt.Printf("Error loading queued replies: %v\n", err)
+		return
+	}
+
+	type pending struct {
+		id                      int64
+		chat, messageID, sender string
+		quoted                  []byte
+		text                    string
+	}
+	var due []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.chat, &p.messageID, &p.sender, &p.quoted, &p.text); err != nil {
+			fmt.Printf("Error scanning queued reply: %v\n", err)
+			continue
+		}
+		due = append(due, p)
+	}
+	rows.Close()
+
+	for _, p := range due {
+		chat, err := types.ParseJID(p.chat)
+		if err != nil {
+			fmt.Printf("Dropping queued reply %d with invalid chat %q\n", p.id, p.chat)
+			botStore.db.Exec(`DELETE FROM pending_replies WHERE id = ?`, p.id)
+			continue
+		}
+		if inQuietHours(chat) {
+			continue
+		}
+		var quoted waE2E.Message
+		if err := proto.Unmarshal(p.quoted, &quoted); err != nil {
+			fmt.Printf("Error decoding quoted message for reply %d: %v\n", p.id, err)
+		}
+		if err := sendQuotedText(chat, p.messageID, p.sender, &quoted, p.text); err != nil {
+			fmt.Printf("Error sending queued reply %d: %v\n", p.id, err)
+			continue
+		}
+		botStore.db.Exec(`DELETE FROM pending_replies WHERE id = ?`, p.id)
+	}
+}
+
+// runQuietHoursFlusher periodically posts replies held back during quiet hours
+func runQuietHoursFlusher() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		if client.IsConnected() {
+			flushPendingReplies()
+		}
+	}
+}
+
+func cmdQuiet(evt *events.Message, args []string) {
+	if len(args) == 0 {
+		q := quietHoursFor(evt.Info.Chat)
+		if q == nil {
+			sendMessage(evt, "🔔 Quiet hours are off for this chat.")
+			return
+		}
+		sendMessage(evt, fmt.Sprintf("🌙 Quiet hours: *%s* (%s), mode: *%s*", q, config.TimeZone, q.Mode))
+		return
+	}
+
+	if !canManageChat(evt.Info) {
+		sendMessage(evt, "⛔ Only group admins can change quiet hours in groups.")
+		return
+	}
+
+	values, err := parseSetting("quiet", args)
+	if err != nil {
+		sendMessage(evt, fmt.Sprintf("❌ %v", err))
+		return
+	}
+	if err := botStore.updateChatSettings(evt.Info.Chat, values, actorOf(evt.Info)); err != nil {
+		fmt.Printf("Error saving quiet hours: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not save quiet hours. Please try again.")
+		return
+	}
+
+	q := quietHoursFor(evt.Info.Chat)
+	if q == nil {
+		sendMessage(evt, "🔔 Quiet hours turned off for this chat.")
+		return
+	}
+	sendMessage(evt, fmt.Sprintf("🌙 Quiet hours set to *%s* (%s), mode: *%s*", q, config.TimeZone, q.Mode))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// maxRateLimitDelays is how many times a message is put back for a rate
+// limit before it fails like any other backend error
+const maxRateLimitDelays = 3
+
+// rateLimitError is returned when the backend answers 429 Too Many Requests
+type rateLimitError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("backend is rate limiting, retry after %s", e.retryAfter)
+}
+
+// backendPauseKey is the limiter key holding the workers back after a 429.
+// With a shared limiter every instance pauses, since they share the backend.
+const backendPauseKey = "backend-pause"
+
+// rateLimitDelays counts how often each message was put back for a rate
+// limit, and when it last was
+var rateLimitDelays = struct {
+	sync.Mutex
+	byID map[string]rateLimitDelay
+}{byID: map[string]rateLimitDelay{}}
+
+type rateLimitDelay struct {
+	count int
+	last  time.Time
+}
+
+// checkRateLimit returns a rateLimitError for a 429 response, else nil
+func checkRateLimit(resp *http.Response) error {
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	return &rateLimitError{retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+}
+
+// parseRetryAfter reads a Retry-After header, in seconds or as an HTTP date,
+// falling back to BACKEND_RETRY_AFTER and capping at BACKEND_MAX_RETRY_AFTER
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	wait := config.BackendRetryAfter
+	if seconds, err := strconv.Atoi(strings.TrimSpace(header)); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(header); err == nil {
+		wait = at.Sub(now)
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+	if config.BackendMaxRetryAfter > 0 && wait > config.BackendMaxRetryAfter {
+		wait = config.BackendMaxRetryAfter
+	}
+	return wait
+}
+
+// pauseBackend holds the workers back for d
+func pauseBackend(d time.Duration) {
+	if limiter.Pause(backendPauseKey, time.Now().Add(d)) {
+		fmt.Printf("Backend asked to slow down, pausing workers for %s\n", d.Round(time.Second))
+		metrics.inc("backend_rate_limited")
+	}
+}
+
+// waitForBackend blocks while the backend has asked the bot to pause
+func waitForBackend() {
+	for {
+		wait := limiter.PausedFor(backendPauseKey)
+		if wait <= 0 {
+			return
+		}
+		time.Sleep(wait)
+	}
+}
+
+// delayRateLimited puts evt back in the queue once a rate limit has passed,
+// telling the sender about the short delay, and reports whether err was a
+// rate limit it handled. Messages delayed too often are left to fail.
+func delayRateLimited(evt *events.Message, err error) bool {
+	var limited *rateLimitError
+	if !errors.As(err, &limited) {
+		return false
+	}
+	id := evt.Info.Chat.String() + "/" + string(evt.Info.ID)
+	rateLimitDelays.Lock()
+	for key, d := range rateLimitDelays.byID {
+		if time.Since(d.last) > time.Hour {
+			delete(rateLimitDelays.byID, key)
+		}
+	}
+	delay := rateLimitDelays.byID[id]
+	delay.count++
+	delay.last = time.Now()
+	rateLimitDelays.byID[id] = delay
+	rateLimitDelays.Unlock()
+	if delay.count > maxRateLimitDelays {
+		return false
+	}
+
+	// Someone waiting on a DM or a command is told once; passive checks in
+	// groups just get a reaction
+	reacted := false
+	if !isShadowChat(evt.Info.Chat) && !inQuietHours(evt.Info.Chat) {
+		if isPriority(evt) && delay.count == 1 {
+			sendMessage(evt, fmt.Sprintf("⏳ The analysis service is busy. I'll check this in about %s.", limited.retryAfter.Round(time.Second)))
+		} else {
+			react(evt.Info.Chat, evt.Info.Sender, evt.Info.ID, "🕐")
+			reacted = true
+		}
+	}
+	go func() {
+		time.Sleep(limited.retryAfter)
+		if reacted {
+			react(evt.Info.Chat, evt.Info.Sender, evt.Info.ID, "")
+		}
+		messageQueue.push(evt)
+	}()
+	return true
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// handleReceipt records delivery and read receipts for the bot's verdict
+// replies, and counts failed deliveries as a ban-risk signal. Receipts from
+// the bot's own devices say nothing about reach.
+func handleReceipt(evt *events.Receipt) {
+	if evt.IsFromMe {
+		return
+	}
+	switch evt.Type {
+	case types.ReceiptTypeRetry, types.ReceiptTypeServerError:
+		metrics.inc("receipt_failed")
+		noteDeliveryFailure("messages are not being delivered")
+	case types.ReceiptTypeDelivered:
+		botStore.recordReceipt(evt.MessageIDs, evt.Timestamp, false)
+	case types.ReceiptTypeRead, types.ReceiptTypePlayed:
+		botStore.recordReceipt(evt.MessageIDs, evt.Timestamp, true)
+	}
+}
+
+// recordReceipt notes when verdict replies among ids were first delivered
+// and read, and how many read receipts each got. In groups every member who
+// reads a reply sends one, unless they've turned read receipts off. Replies
+// are matched by ID alone, since receipts may come from a member's LID rather
+// than the chat the reply was sent to.
+func (s *Store) recordReceipt(ids []types.MessageID, at time.Time, read bool) {
+	for _, id := range ids {
+		if res, err := s.db.Exec(
+			`UPDATE verdict_messages SET delivered_at = ? WHERE message_id = ? AND reaction = 0 AND delivered_at IS NULL`,
+			at.Unix(), id,
+		); err != nil {
+			fmt.Printf("Error recording receipt: %v\n", err)
+			continue
+		} else if n, _ := res.RowsAffected(); n > 0 {
+			metrics.inc("verdict_delivered")
+		}
+		if !read {
+			continue
+		}
+		if _, err := s.db.Exec(
+			`UPDATE verdict_messages SET read_at = COALESCE(read_at, ?), read_count = read_count + 1 WHERE message_id = ? AND reaction = 0`,
+			at.Unix(), id,
+		); err != nil {
+			fmt.Printf("Error recording receipt: %v\n", err)
+			continue
+		}
+		var chat string
+		var count int
+		if err := s.db.QueryRow(`SELECT chat, read_count FROM verdict_messages WHERE message_id = ?`, id).Scan(&chat, &count); err != nil || count != 1 {
+			continue
+		}
+		metrics.inc("verdict_read")
+		if jid, err := types.ParseJID(chat); err == nil {
+			recordExperimentEvent(jid, experimentRead)
+		}
+	}
+}
+
+// neverReachedServer reports whether a send failed before WhatsApp's server
+// accepted the message, so sending it again can't post it twice
+func neverReachedServer(err error) bool {
+	var disconnected *whatsmeow.DisconnectedError
+	return errors.Is(err, whatsmeow.ErrNotConnected) || errors.Is(err, whatsmeow.ErrIQTimedOut) || errors.As(err, &disconnected)
+}
+
+// waitForConnection waits up to d for the client to be connected again
+func waitForConnection(ctx context.Context, d time.Duration) bool {
+	deadline := time.Now().Add(d)
+	for !client.IsConnected() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Second):
+		}
+	}
+	return true
+}
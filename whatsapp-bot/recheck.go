@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// Recheck is a verdict scheduled to be analyzed again
+type Recheck struct {
+	ID       int64
+	Chat     types.JID
+	ReplyID  types.MessageID // the bot's verdict reply
+	Reply    string
+	Text     string // the checked text, scrubbed as it was sent to the backend
+	Language string
+	ClaimKey string
+	Verdict  *AnalyzeResponse
+}
+
+// needsRecheck reports whether a verdict is uncertain enough to analyze again
+// later: the backend marked the story as developing, or confidence was low
+func needsRecheck(result *AnalyzeResponse) bool {
+	if config.RecheckAfter <= 0 || result.MessageType != "text" {
+		return false
+	}
+	return result.Developing || result.Confidence < config.RecheckBelowConfidence
+}
+
+// scheduleRecheck stores the verdict reply replyID so its claim is analyzed
+// again after config.RecheckAfter
+func (s *Store) scheduleRecheck(evt *events.Message, replyID types.MessageID, reply string, result *AnalyzeResponse, language string) {
+	if replyID == "" || !needsRecheck(result) {
+		return
+	}
+	text := checkedText(evt)
+	if config.ScrubPII {
+		text = scrubPII(text, evt.Info.PushName)
+	}
+	verdict, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("Error encoding verdict: %v\n", err)
+		return
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO rechecks (chat, sender, reply_id, reply, text, language, claim_key, verdict, due_at, instance) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		evt.Info.Chat.String(), evt.Info.Sender.ToNonAD().String(), replyID, reply, text, language, result.claimKey, string(verdict),
+		time.Now().Add(config.RecheckAfter).Unix(), config.InstanceID,
+	)
+	if err != nil {
+		fmt.Printf("Error scheduling recheck: %v\n", err)
+		return
+	}
+	fmt.Printf("Scheduled a recheck of %s in %s\n", replyID, config.RecheckAfter)
+}
+
+// dueRechecks returns the rechecks whose time has come
+func (s *Store) dueRechecks() ([]Recheck, error) {
+	rows, err := s.db.Query(
+		`SELECT id, chat, reply_id, reply, text, language, claim_key, verdict FROM rechecks WHERE due_at <= ? AND instance = ? ORDER BY due_at`,
+		time.Now().Unix(), config.InstanceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Recheck
+	for rows.Next() {
+		var (
+			r       Recheck
+			chat    string
+			verdict []byte
+		)
+		if err := rows.Scan(&r.ID, &chat, &r.ReplyID, &r.Reply, &r.Text, &r.Language, &r.ClaimKey, &verdict); err != nil {
+			return nil, err
+		}
+		if r.Chat, err = types.ParseJID(chat); err != nil {
+			continue
+		}
+		r.Verdict = &AnalyzeResponse{}
+		if err := json.Unmarshal(verdict, r.Verdict); err != nil {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// deleteRecheck drops a recheck once it has been handled
+func (s *Store) deleteRecheck(id int64) {
+	if _, err := s.db.Exec(`DELETE FROM rechecks WHERE id = ?`, id); err != nil {
+		fmt.Printf("Error deleting recheck: %v\n", err)
+	}
+}
+
+// verdictChanged reports whether the headline of a verdict differs between two results
+func verdictChanged(before, after *AnalyzeResponse) bool {
+	m := messagesFor("en")
+	_, was := verdictStatus(before, m)
+	_, is := verdictStatus(after, m)
+	return was != is
+}
+
+// runRecheck analyzes a scheduled claim again and, when the verdict changed,
+// replies to the earlier verdict with the update
+func runRecheck(r Recheck) {
+	// Chats that asked for silence get the update once quiet hours end
+	if inQuietHours(r.Chat) {
+		return
+	}
+	defer botStore.deleteRecheck(r.ID)
+
+	result, err := callBackend(func() (*AnalyzeResponse, error) {
+		return analyzeText(r.Text, r.Language, fmt.Sprintf("recheck-%d", r.ID), nil)
+	})
+	if err != nil {
+		fmt.Printf("Error rechecking %s: %v\n", r.ReplyID, err)
+		metrics.fail("backend_error", err)
+		return
+	}
+	metrics.inc("rechecked")
+	verdictCache.Replace(r.ClaimKey, result)
+	if !result.IsNews || !verdictChanged(r.Verdict, result) {
+		fmt.Printf("Recheck of %s: verdict unchanged\n", r.ReplyID)
+		return
+	}
+	metrics.inc("recheck_changed")
+
+	m := messagesFor(r.Language)
+	_, was := verdictStatus(r.Verdict, m)
+	translated := translateResult(result, r.Language)
+	confidence := botStore.getChatSettings(r.Chat).confidenceStyle()
+	text := fmt.Sprintf("🔄 *%s*\n_%s_\n\n%s", m.RecheckTitle, fmt.Sprintf(m.RecheckNote, was), formatShortResponse(translated, r.Language, confidence))
+	if isShadowChat(r.Chat) {
+		fmt.Printf("[shadow] Recheck update for %s not sent:%s\n", r.Chat, logContent(text))
+		return
+	}
+
+	participant := ""
+	if client.Store.ID != nil {
+		participant = client.Store.ID.ToNonAD().String()
+	}
+	quoted := &waE2E.Message{Conversation: proto.String(r.Reply)}
+	id, err := sendQuotedTextWithPreview(r.Chat, r.ReplyID, participant, quoted, text, nil)
+	if err != nil {
+		fmt.Printf("Error sending recheck update: %v\n", err)
+		metrics.fail("send_error", err)
+		return
+	}
+	botStore.recordVerdictMessage(r.Chat, id, result, r.Language, 0, 0)
+}
+
+// runRechecker analyzes scheduled rechecks in the background
+func runRechecker() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !client.IsConnected() {
+			continue
+		}
+		due, err := botStore.dueRechecks()
+		if err != nil {
+			fmt.Printf("Error loading rechecks: %v\n", err)
+			continue
+		}
+		for _, r := range due {
+			runRecheck(r)
+		}
+	}
+}
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// redisTimeout bounds each command, so a stuck Redis slows messages down
+	// rather than stalling them
+	redisTimeout = 2 * time.Second
+	// redisMaxIdle is how many connections are kept open between commands
+	redisMaxIdle = 8
+)
+
+// redisError is an error reply from Redis, after which the connection is
+// still usable
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// redisClient speaks just enough of the Redis protocol for the shared cache
+// and rate limits, over a small pool of connections
+type redisClient struct {
+	addr     string
+	host     string // for TLS verification
+	tls      bool
+	username string
+	password string
+	db       int
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// newRedisClient connects to the Redis server at rawURL, like
+// redis://[user:password@]host:6379/0 or rediss:// for TLS
+func newRedisClient(rawURL string) (*redisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("invalid REDIS_URL: scheme must be redis or rediss")
+	}
+	c := &redisClient{addr: u.Host, host: u.Hostname(), tls: u.Scheme == "rediss"}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL database %q", db)
+		}
+	}
+	if _, err := c.do("PING"); err != nil {
+		return nil, fmt.Errorf("cannot reach Redis: %w", err)
+	}
+	return c, nil
+}
+
+// dial opens and authenticates a new connection. REDIS_PASSWORD, read on
+// every connection so rotations apply, overrides a password in the URL.
+func (c *redisClient) dial() (*redisConn, error) {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	if c.tls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{ServerName: c.host})
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{Conn: conn, r: bufio.NewReader(conn)}
+
+	password := c.password
+	if p := config.RedisPassword.Get(); p != "" {
+		password = p
+	}
+	var setup [][]any
+	if password != "" {
+		if c.username != "" {
+			setup = append(setup, []any{"AUTH", c.username, password})
+		} else {
+			setup = append(setup, []any{"AUTH", password})
+		}
+	}
+	if c.db != 0 {
+		setup = append(setup, []any{"SELECT", c.db})
+	}
+	for _, cmd := range setup {
+		if _, err := rc.do(cmd); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// do runs a command and returns its reply: a string, an int64, nil or a
+// []any of those
+func (c *redisClient) do(args ...any) (any, error) {
+	c.mu.Lock()
+	var conn *redisConn
+	if n := len(c.idle); n > 0 {
+		conn, c.idle = c.idle[n-1], c.idle[:n-1]
+	}
+	c.mu.Unlock()
+	if conn == nil {
+		var err error
+		if conn, err = c.dial(); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := conn.do(args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// The connection may be half way through a reply
+		conn.Close()
+		return nil, err
+	}
+	c.mu.Lock()
+	if len(c.idle) < redisMaxIdle {
+		c.idle = append(c.idle, conn)
+		conn = nil
+	}
+	c.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	return reply, err
+}
+
+// str runs a command whose reply is a string, returning "" for nil
+func (c *redisClient) str(args ...any) (string, error) {
+	reply, err := c.do(args...)
+	if err != nil {
+		return "", err
+	}
+	s, _ := reply.(string)
+	return s, nil
+}
+
+// integer runs a command whose reply is an integer
+func (c *redisClient) integer(args ...any) (int64, error) {
+	reply, err := c.do(args...)
+	if err != nil {
+		return 0, err
+	}
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("redis: unexpected reply %T", reply)
+}
+
+// list runs a command whose reply is a list of strings, with "" for nils
+func (c *redisClient) list(args ...any) ([]string, error) {
+	reply, err := c.do(args...)
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]any)
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i], _ = item.(string)
+	}
+	return out, nil
+}
+
+func (rc *redisConn) do(args []any) (any, error) {
+	rc.SetDeadline(time.Now().Add(redisTimeout))
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var s string
+		switch v := arg.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case int:
+			s = strconv.Itoa(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		case uint64:
+			s = strconv.FormatUint(v, 10)
+		default:
+			s = fmt.Sprint(v)
+		}
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(s), s)
+	}
+	if _, err := io.WriteString(rc, sb.String()); err != nil {
+		return nil, err
+	}
+	return rc.read()
+}
+
+// read parses one RESP2 reply
+func (rc *redisConn) read() (any, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		var itemErr error
+		for i := range items {
+			// Keep reading past error items so the connection stays in step
+			if items[i], err = rc.read(); err != nil {
+				var replyErr redisError
+				if !errors.As(err, &replyErr) {
+					return nil, err
+				}
+				itemErr = err
+			}
+		}
+		return items, itemErr
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+const (
+	cacheStoreMemory = "memory"
+	cacheStoreRedis  = "redis"
+)
+
+// openCacheStore sets up the verdict cache and limiter CACHE_STORE selects
+func openCacheStore() error {
+	switch config.CacheStore {
+	case cacheStoreMemory:
+		verdictCache = newVerdictCache(config.CacheTTL, config.CacheMaxEntries)
+		limiter = newMemoryLimiter()
+		return nil
+	case cacheStoreRedis:
+		redis, err := newRedisClient(config.RedisURL)
+		if err != nil {
+			return err
+		}
+		verdictCache = &redisCache{client: redis, prefix: config.RedisPrefix, ttl: config.CacheTTL, max: config.CacheMaxEntries}
+		limiter = &redisLimiter{client: redis, prefix: config.RedisPrefix}
+		return nil
+	}
+	return fmt.Errorf("unknown cache store %q (use memory or redis)", config.CacheStore)
+}
+
+// redisCache is the Cache kept in Redis. Each verdict is its own key expiring
+// after the TTL; an index sorted by age bounds the entries and lists them,
+// with the signatures of text verdicts in two hashes for FindSimilar.
+type redisCache struct {
+	client *redisClient
+	prefix string
+	ttl    time.Duration
+	max    int
+}
+
+// redisCacheEntry is a cached verdict as stored, with the fields JSON
+// wouldn't carry
+type redisCacheEntry struct {
+	Result          *AnalyzeResponse `json:"result"`
+	ClaimKey        string           `json:"claim_key"`
+	AnalyzedSeconds int              `json:"analyzed_seconds,omitempty"`
+	TotalSeconds    int              `json:"total_seconds,omitempty"`
+}
+
+// redisTrimCache drops index entries older than the cutoff in ARGV[1] and
+// the oldest beyond ARGV[2] of them, with their signatures and verdicts
+const redisTrimCache = `
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[1])
+local extra = redis.call('ZCARD', KEYS[1]) - #expired - tonumber(ARGV[2])
+if extra > 0 then
+	for _, k in ipairs(redis.call('ZRANGE', KEYS[1], #expired, #expired + extra - 1)) do
+		table.insert(expired, k)
+	end
+end
+for _, k in ipairs(expired) do
+	redis.call('ZREM', KEYS[1], k)
+	redis.call('HDEL', KEYS[2], k)
+	redis.call('HDEL', KEYS[3], k)
+	redis.call('DEL', ARGV[3] .. k)
+end
+return #expired`
+
+func (c *redisCache) verdictKey(key string) string { return c.prefix + "verdict:" + key }
+
+func (c *redisCache) Get(key string) (*AnalyzeResponse, bool) {
+	data, err := c.client.str("GET", c.verdictKey(key))
+	if err != nil {
+		fmt.Printf("Error reading cached verdict: %v\n", err)
+		return nil, false
+	}
+	if data == "" {
+		return nil, false
+	}
+	var entry redisCacheEntry
+	if err := json.Unmarshal([]byte(data), &entry); err != nil || entry.Result == nil {
+		fmt.Printf("Error decoding cached verdict: %v\n", err)
+		return nil, false
+	}
+	result := entry.Result
+	result.claimKey = entry.ClaimKey
+	result.analyzedSeconds, result.totalSeconds = entry.AnalyzedSeconds, entry.TotalSeconds
+	return result, true
+}
+
+func (c *redisCache) FindSimilar(sig *TextSignature, maxDistance int, minSimilarity float64) (*AnalyzeResponse, float64, bool) {
+	if sig == nil {
+		return nil, 0, false
+	}
+	pairs, err := c.client.list("HGETALL", c.prefix+"simhash")
+	if err != nil {
+		fmt.Printf("Error reading cached signatures: %v\n", err)
+		return nil, 0, false
+	}
+	var candidates []any
+	for i := 0; i+1 < len(pairs); i += 2 {
+		hash, err := strconv.ParseUint(pairs[i+1], 10, 64)
+		if err == nil && bits.OnesCount64(hash^sig.SimHash) <= maxDistance {
+			candidates = append(candidates, pairs[i])
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, 0, false
+	}
+	words, err := c.client.list(append([]any{"HMGET", c.prefix + "words"}, candidates...)...)
+	if err != nil {
+		fmt.Printf("Error reading cached signatures: %v\n", err)
+		return nil, 0, false
+	}
+
+	best, bestSimilarity := "", 0.0
+	for i, list := range words {
+		set := map[string]struct{}{}
+		for _, w := range strings.Fields(list) {
+			set[w] = struct{}{}
+		}
+		if sim := jaccard(set, sig.Words); sim >= minSimilarity && sim > bestSimilarity {
+			best, bestSimilarity = candidates[i].(string), sim
+		}
+	}
+	if best == "" {
+		return nil, 0, false
+	}
+	result, ok := c.Get(best)
+	return result, bestSimilarity, ok
+}
+
+func (c *redisCache) Put(key string, sig *TextSignature, result *AnalyzeResponse) {
+	if isHollowVerdict(result) {
+		return
+	}
+	if err := c.store(key, result, "PX", c.ttl.Milliseconds()); err != nil {
+		fmt.Printf("Error caching verdict: %v\n", err)
+		return
+	}
+	now := time.Now()
+	cmds := [][]any{{"ZADD", c.prefix + "verdicts", now.UnixMilli(), key}}
+	if sig != nil {
+		words := make([]string, 0, len(sig.Words))
+		for w := range sig.Words {
+			words = append(words, w)
+		}
+		cmds = append(cmds,
+			[]any{"HSET", c.prefix + "simhash", key, sig.SimHash},
+			[]any{"HSET", c.prefix + "words", key, strings.Join(words, " ")},
+		)
+	}
+	cmds = append(cmds, []any{"EVAL", redisTrimCache, 3, c.prefix + "verdicts", c.prefix + "simhash", c.prefix + "words",
+		now.Add(-c.ttl).UnixMilli(), c.max, c.prefix + "verdict:"})
+	for _, cmd := range cmds {
+		if _, err := c.client.do(cmd...); err != nil {
+			fmt.Printf("Error indexing cached verdict: %v\n", err)
+			return
+		}
+	}
+}
+
+func (c *redisCache) Replace(key string, result *AnalyzeResponse) {
+	result.claimKey = key
+	if err := c.store(key, result, "XX", "KEEPTTL"); err != nil {
+		fmt.Printf("Error replacing cached verdict: %v\n", err)
+	}
+}
+
+// store writes result under key with the given SET options
+func (c *redisCache) store(key string, result *AnalyzeResponse, options ...any) error {
+	data, err := json.Marshal(redisCacheEntry{
+		Result:          result,
+		ClaimKey:        result.claimKey,
+		AnalyzedSeconds: result.analyzedSeconds,
+		TotalSeconds:    result.totalSeconds,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.client.do(append([]any{"SET", c.verdictKey(key), data}, options...)...)
+	return err
+}
+
+func (c *redisCache) Len() int {
+	n, err := c.client.integer("ZCOUNT", c.prefix+"verdicts", time.Now().Add(-c.ttl).UnixMilli(), "+inf")
+	if err != nil {
+		fmt.Printf("Error counting cached verdicts: %v\n", err)
+	}
+	return int(n)
+}
+
+// redisLimiter is the Limiter kept in Redis. Keys hold the time in
+// milliseconds a cooldown started or a pause ends.
+type redisLimiter struct {
+	client *redisClient
+	prefix string
+}
+
+// redisTake starts the cooldown in KEYS[1] at ARGV[1] unless the last one,
+// ARGV[2] milliseconds long, is still running
+const redisTake = `
+local last = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tonumber(ARGV[1]) - last < tonumber(ARGV[2]) then return 0 end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+return 1`
+
+// redisPause moves the pause in KEYS[1] to end at ARGV[1] if that's later
+const redisPause = `
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tonumber(ARGV[1]) <= current then return 0 end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1`
+
+// limiterKeyTTL is how long a cooldown is remembered at least, since chats
+// can lengthen their cooldown after it started
+const limiterKeyTTL = 24 * time.Hour
+
+func (l *redisLimiter) Take(key string, cooldown time.Duration) bool {
+	took, err := l.client.integer("EVAL", redisTake, 1, l.prefix+key, time.Now().UnixMilli(), cooldown.Milliseconds(),
+		max(cooldown, limiterKeyTTL).Milliseconds())
+	if err != nil {
+		// Rather an extra reply than none while Redis is down
+		fmt.Printf("Error taking cooldown: %v\n", err)
+		return true
+	}
+	return took == 1
+}
+
+func (l *redisLimiter) Cooling(key string, cooldown time.Duration) bool {
+	last, err := l.client.integer("GET", l.prefix+key)
+	if err != nil {
+		fmt.Printf("Error reading cooldown: %v\n", err)
+		return false
+	}
+	return time.Now().UnixMilli()-last < cooldown.Milliseconds()
+}
+
+func (l *redisLimiter) Pause(key string, until time.Time) bool {
+	ttl := time.Until(until).Milliseconds()
+	if ttl <= 0 {
+		return false
+	}
+	paused, err := l.client.integer("EVAL", redisPause, 1, l.prefix+key, until.UnixMilli(), ttl)
+	if err != nil {
+		fmt.Printf("Error pausing %s: %v\n", key, err)
+		return false
+	}
+	return paused == 1
+}
+
+func (l *redisLimiter) PausedFor(key string) time.Duration {
+	until, err := l.client.integer("GET", l.prefix+key)
+	if err != nil {
+		fmt.Printf("Error reading pause: %v\n", err)
+		return 0
+	}
+	return time.Until(time.UnixMilli(until))
+}
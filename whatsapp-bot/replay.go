@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// replayBotJID is the bot's own number while replaying
+var replayBotJID = types.NewJID("10000000000", types.DefaultUserServer)
+
+// Fixture is a recorded conversation fed through the pipeline by replay
+type Fixture struct {
+	Name     string           `json:"name"`
+	Messages []FixtureMessage `json:"messages"`
+	Expected []ReplayOutput   `json:"expected"`
+}
+
+// FixtureMessage is one incoming message of a fixture
+type FixtureMessage struct {
+	Chat       string `json:"chat"`
+	Sender     string `json:"sender"`
+	PushName   string `json:"push_name,omitempty"`
+	Text       string `json:"text,omitempty"`
+	Image      string `json:"image,omitempty"` // path relative to the fixture file
+	Caption    string `json:"caption,omitempty"`
+	QuotedText string `json:"quoted_text,omitempty"`
+	ReplyToBot bool   `json:"reply_to_bot,omitempty"` // the quoted message is the bot's own
+	// Backend is the mock backend's response to this message's analysis
+	Backend json.RawMessage `json:"backend,omitempty"`
+}
+
+// ReplayOutput is a message the bot sent while replaying
+type ReplayOutput struct {
+	Chat string `json:"chat"`
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+// replayMessenger records sent messages instead of delivering them and
+// serves image downloads from fixture files
+type replayMessenger struct {
+	mu      sync.Mutex
+	dir     string
+	outputs []ReplayOutput
+}
+
+func (m *replayMessenger) SendMessage(ctx context.Context, to types.JID, msg *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	out := ReplayOutput{Chat: to.String()}
+	switch {
+	case msg.GetConversation() != "":
+		out.Kind, out.Text = "text", msg.GetConversation()
+	case msg.GetExtendedTextMessage() != nil:
+		out.Kind, out.Text = "text", msg.GetExtendedTextMessage().GetText()
+	case msg.GetImageMessage() != nil:
+		out.Kind, out.Text = "image", msg.GetImageMessage().GetCaption()
+	case msg.GetDocumentMessage() != nil:
+		out.Kind, out.Text = "document", msg.GetDocumentMessage().GetFileName()
+	case msg.GetReactionMessage() != nil:
+		out.Kind, out.Text = "reaction", msg.GetReactionMessage().GetText()
+	default:
+		out.Kind = "other"
+	}
+	m.mu.Lock()
+	m.outputs = append(m.outputs, out)
+	m.mu.Unlock()
+	return whatsmeow.SendResponse{ID: types.MessageID(fmt.Sprintf("REPLAY%d", len(m.outputs))), Timestamp: time.Now()}, nil
+}
+
+func (m *replayMessenger) Upload(ctx context.Context, data []byte, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	return whatsmeow.UploadResponse{URL: "replay://upload", DirectPath: "/replay", FileLength: uint64(len(data))}, nil
+}
+
+func (m *replayMessenger) Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	img, ok := msg.(*waE2E.ImageMessage)
+	if !ok {
+		return nil, fmt.Errorf("replay can only download fixture images")
+	}
+	return os.ReadFile(filepath.Join(m.dir, img.GetURL()))
+}
+
+// mockBackend answers analysis requests with the current fixture message's response
+type mockBackend struct {
+	mu       sync.Mutex
+	response json.RawMessage
+}
+
+func (b *mockBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/analyze/text" && r.URL.Path != "/analyze/image" {
+		http.NotFound(w, r)
+		return
+	}
+	b.mu.Lock()
+	response := b.response
+	b.mu.Unlock()
+	if len(response) == 0 {
+		response = json.RawMessage(`{"is_news": false}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// fixtureEvent builds the WhatsApp event for a fixture message
+func fixtureEvent(m FixtureMessage, n int) (*events.Message, error) {
+	chat, err := types.ParseJID(m.Chat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chat %q: %w", m.Chat, err)
+	}
+	sender := chat
+	if m.Sender != "" {
+		if sender, err = types.ParseJID(m.Sender); err != nil {
+			return nil, fmt.Errorf("invalid sender %q: %w", m.Sender, err)
+		}
+	}
+
+	msg := &waE2E.Message{}
+	if m.Image != "" {
+		msg.ImageMessage = &waE2E.ImageMessage{URL: proto.String(m.Image), Caption: proto.String(m.Caption)}
+	} else if m.QuotedText != "" {
+		participant := sender.String()
+		if m.ReplyToBot {
+			participant = replayBotJID.String()
+		}
+		msg.ExtendedTextMessage = &waE2E.ExtendedTextMessage{
+			Text: proto.String(m.Text),
+			ContextInfo: &waE2E.ContextInfo{
+				StanzaID:      proto.String(fmt.Sprintf("QUOTED%d", n)),
+				Participant:   proto.String(participant),
+				QuotedMessage: &waE2E.Message{Conversation: proto.String(m.QuotedText)},
+			},
+		}
+	} else {
+		msg.Conversation = proto.String(m.Text)
+	}
+
+	return &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: sender, IsGroup: chat.Server == types.GroupServer},
+			ID:            types.MessageID(fmt.Sprintf("FIXTURE%d", n)),
+			PushName:      m.PushName,
+			Timestamp:     time.Now(),
+		},
+		Message: msg,
+	}, nil
+}
+
+// replayFixture runs one fixture through a fresh bot state and returns what the bot sent
+func replayFixture(path string, backend *mockBackend) ([]ReplayOutput, *Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, nil, fmt.Errorf("invalid fixture: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "aletheia-replay-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+	if botStore, err = openStore(filepath.Join(dir, "bot.db")); err != nil {
+		return nil, nil, err
+	}
+	defer botStore.Close()
+	if err := botStore.loadAccessLists(); err != nil {
+		return nil, nil, err
+	}
+	loadFeatureFlags()
+	verdictCache = newVerdictCache(config.CacheTTL, config.CacheMaxEntries)
+	conversations.Lock()
+	conversations.byChat = map[string]*conversation{}
+	conversations.Unlock()
+
+	recorder := &replayMessenger{dir: filepath.Dir(path)}
+	messenger = disappearingMessenger{recorder}
+	for i, m := range fixture.Messages {
+		evt, err := fixtureEvent(m, i)
+		if err != nil {
+			return nil, nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		if backend != nil {
+			backend.mu.Lock()
+			backend.response = m.Backend
+			backend.mu.Unlock()
+		}
+		noteDisappearing(evt)
+		handleMessage(evt)
+	}
+	return recorder.outputs, &fixture, nil
+}
+
+// diffOutputs describes how actual differs from expected, or returns "" when they match
+func diffOutputs(expected, actual []ReplayOutput) string {
+	var sb strings.Builder
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		switch {
+		case i >= len(actual):
+			sb.WriteString(fmt.Sprintf("  #%d missing:\n%s\n", i+1, indent("- ", expected[i])))
+		case i >= len(expected):
+			sb.WriteString(fmt.Sprintf("  #%d unexpected:\n%s\n", i+1, indent("+ ", actual[i])))
+		case expected[i] != actual[i]:
+			sb.WriteString(fmt.Sprintf("  #%d differs:\n%s\n%s\n", i+1, indent("- ", expected[i]), indent("+ ", actual[i])))
+		}
+	}
+	return sb.String()
+}
+
+func indent(prefix string, out ReplayOutput) string {
+	lines := strings.Split(fmt.Sprintf("[%s to %s] %s", out.Kind, out.Chat, out.Text), "\n")
+	for i := range lines {
+		lines[i] = "    " + prefix + lines[i]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func init() {
+	registerSubcommand("replay", &Subcommand{
+		Usage:   "replay [-backend URL] [-update] FIXTURE...",
+		Help:    "Replay recorded conversations and compare the bot's replies",
+		Offline: true,
+		Run:     runReplay,
+	})
+}
+
+// runReplay implements the replay subcommand:
+//
+//	whatsapp-bot replay [-backend URL] [-update] fixture.json...
+//
+// Without -backend, analysis requests are answered from each message's
+// "backend" field. With -update, fixtures are rewritten with the actual output.
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	backendURL := flags.String("backend", "", "analyze against this backend instead of the fixtures' mock responses")
+	update := flags.Bool("update", false, "rewrite each fixture's expected output with the actual output")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		fmt.Println("Usage: whatsapp-bot replay [-backend URL] [-update] fixture.json...")
+		return 2
+	}
+
+	if err := loadResponseTemplates(config.ResponseTemplateDir); err != nil {
+		fmt.Printf("Failed to load response templates: %v\n", err)
+		return 1
+	}
+
+	// Keep replays deterministic and offline unless a real backend was asked for
+	config.DryRun = false
+	config.GoogleFactCheckAPIKey.Set("")
+	var backend *mockBackend
+	if *backendURL != "" {
+		config.BackendURL = *backendURL
+	} else {
+		backend = &mockBackend{}
+		server := httptest.NewServer(backend)
+		defer server.Close()
+		config.BackendURL = server.URL
+		config.TranslationProvider = translateNone
+	}
+	client = whatsmeow.NewClient(&store.Device{ID: &replayBotJID}, nil)
+
+	failed := 0
+	for _, path := range flags.Args() {
+		actual, fixture, err := replayFixture(path, backend)
+		if err != nil {
+			fmt.Printf("ERROR %s: %v\n", path, err)
+			failed++
+			continue
+		}
+		if *update {
+			fixture.Expected = actual
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "  ")
+			err := enc.Encode(fixture)
+			if err == nil {
+				err = os.WriteFile(path, buf.Bytes(), 0o644)
+			}
+			if err != nil {
+				fmt.Printf("ERROR %s: %v\n", path, err)
+				failed++
+				continue
+			}
+			fmt.Printf("UPDATED %s (%d outputs)\n", path, len(actual))
+			continue
+		}
+		if diff := diffOutputs(fixture.Expected, actual); diff != "" {
+			fmt.Printf("FAIL %s %s\n%s", path, fixture.Name, diff)
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s %s\n", path, fixture.Name)
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%d of %d fixtures failed\n", failed, flags.NArg())
+		return 1
+	}
+	return 0
+}
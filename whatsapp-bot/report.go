@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// reportPeriods maps /report arguments to the window they cover
+var reportPeriods = map[string]time.Duration{
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+}
+
+// maxReportSenders is how many top senders of flagged content a report lists
+const maxReportSenders = 3
+
+func init() {
+	registerCommand("report", &Command{
+		Usage:   "/report [daily|weekly|monthly]",
+		Help:    "Fact-check activity report for this chat",
+		Handler: cmdReport,
+	})
+}
+
+// ChatReport summarizes a chat's analysis history over a period
+type ChatReport struct {
+	Checked   int // messages analyzed
+	News      int // of which were news claims
+	Flagged   int // of which were flagged as misinformation
+	Languages []reportCount
+	Senders   []int // flagged message counts of the top senders, highest first
+	Replies   int   // verdict replies sent, not counting reactions
+	Delivered int   // of which reached the chat
+	Read      int   // of which someone read
+	Reads     int   // read receipts across all replies
+}
+
+type reportCount struct {
+	Name  string
+	Count int
+}
+
+// chatReport builds the report for chat over the last period
+func (s *Store) chatReport(chat types.JID, period time.Duration) (*ChatReport, error) {
+	since := time.Now().Add(-period).Unix()
+	key := chat.ToNonAD().String()
+	report := &ChatReport{}
+
+	err := s.db.QueryRow(
+		`SELECT COUNT(*), COALESCE(SUM(is_news), 0), COALESCE(SUM(CASE WHEN is_news = 1 AND is_misinformation = 1 THEN 1 ELSE 0 END), 0)
+		FROM analysis_history WHERE chat = ? AND created_at >= ?`,
+		key, since,
+	).Scan(&report.Checked, &report.News, &report.Flagged)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.QueryRow(
+		`SELECT COUNT(*), COUNT(delivered_at), COUNT(read_at), COALESCE(SUM(read_count), 0)
+		FROM verdict_messages WHERE chat = ? AND created_at >= ? AND reaction = 0`,
+		key, since,
+	).Scan(&report.Replies, &report.Delivered, &report.Read, &report.Reads)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(
+		`SELECT COALESCE(NULLIF(language, ''), '?'), COUNT(*) AS n
+		FROM analysis_history WHERE chat = ? AND created_at >= ?
+		GROUP BY 1 ORDER BY n DESC`,
+		key, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c reportCount
+		if err := rows.Scan(&c.Name, &c.Count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.Languages = append(report.Languages, c)
+	}
+	rows.Close()
+
+	// Senders are only counted, never named, so the report can be shared in the group
+	rows, err = s.db.Query(
+		`SELECT COUNT(*) AS n FROM analysis_history
+		WHERE chat = ? AND created_at >= ? AND is_news = 1 AND is_misinformation = 1
+		GROUP BY sender ORDER BY n DESC LIMIT ?`,
+		key, since, maxReportSenders,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n int
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		report.Senders = append(report.Senders, n)
+	}
+	return report, rows.Err()
+}
+
+// languageNames labels the language codes detectLanguage produces
+var languageNames = map[string]string{
+	"en": "English", "hi": "Hindi", "mr": "Marathi", "bn": "Bengali", "pa": "Punjabi",
+	"gu": "Gujarati", "or": "Odia", "ta": "Tamil", "te": "Telugu", "kn": "Kannada",
+	"ml": "Malayalam", "ur": "Urdu", "?": "Unknown",
+}
+
+// formatReport renders a report as a WhatsApp message
+func formatReport(r *ChatReport, period string) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📊 *%s fact-check report*\n", strings.ToUpper(period[:1])+period[1:]))
+
+	if r.Checked == 0 {
+		sb.WriteString("\nNo messages were checked in this period.")
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("\n*Messages checked:* %d", r.Checked))
+	sb.WriteString(fmt.Sprintf("\n*News claims:* %d", r.News))
+	flaggedPct := 0.0
+	if r.News > 0 {
+		flaggedPct = float64(r.Flagged) / float64(r.News) * 100
+	}
+	sb.WriteString(fmt.Sprintf("\n*Flagged as misinformation:* %d (%.0f%% of claims)", r.Flagged, flaggedPct))
+	if r.Replies > 0 {
+		sb.WriteString(fmt.Sprintf("\n*Replies delivered:* %d of %d", r.Delivered, r.Replies))
+		sb.WriteString(fmt.Sprintf("\n*Replies read:* %d (%d reads)", r.Read, r.Reads))
+		sb.WriteString("\n_Reads only count members with read receipts on._")
+	}
+
+	if len(r.Languages) > 0 {
+		sb.WriteString("\n\n*Languages:*")
+		for _, l := range r.Languages {
+			name := languageNames[l.Name]
+			if name == "" {
+				name = l.Name
+			}
+			sb.WriteString(fmt.Sprintf("\n• %s: %.0f%%", name, float64(l.Count)/float64(r.Checked)*100))
+		}
+	}
+
+	if len(r.Senders) > 0 {
+		sb.WriteString("\n\n*Top sharers of flagged content:*")
+		for i, n := range r.Senders {
+			sb.WriteString(fmt.Sprintf("\n• Member %c: %d", 'A'+i, n))
+		}
+		sb.WriteString("\n_Members are anonymized._")
+	}
+	return sb.String()
+}
+
+func cmdReport(evt *events.Message, args []string) {
+	if !canManageChat(evt.Info) {
+		sendMessage(evt, "⛔ Only group admins can request reports in groups.")
+		return
+	}
+
+	period := "weekly"
+	if len(args) > 0 {
+		period = strings.ToLower(args[0])
+	}
+	window, ok := reportPeriods[period]
+	if !ok {
+		sendMessage(evt, "Usage: /report [daily|weekly|monthly]")
+		return
+	}
+
+	report, err := botStore.chatReport(evt.Info.Chat, window)
+	if err != nil {
+		fmt.Printf("Error building report: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not build the report. Please try again later.")
+		return
+	}
+	sendMessage(evt, formatReport(report, period))
+}
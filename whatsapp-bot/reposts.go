@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// postedVerdict is a verdict reply the bot sent in a chat
+type postedVerdict struct {
+	id     types.MessageID
+	text   string
+	sentAt time.Time
+}
+
+// postedVerdicts holds the recent verdict replies per chat by claim key, in memory only
+var postedVerdicts = struct {
+	sync.Mutex
+	byChat map[string]map[string]postedVerdict
+}{byChat: map[string]map[string]postedVerdict{}}
+
+// recordPostedVerdict remembers the verdict reply id sent about claimKey in chat
+func recordPostedVerdict(chat types.JID, claimKey string, id types.MessageID, text string) {
+	if config.RepostWindow <= 0 || claimKey == "" || id == "" {
+		return
+	}
+	postedVerdicts.Lock()
+	defer postedVerdicts.Unlock()
+	key := chat.ToNonAD().String()
+	claims := postedVerdicts.byChat[key]
+	if claims == nil {
+		claims = map[string]postedVerdict{}
+		postedVerdicts.byChat[key] = claims
+	}
+	for k, p := range claims {
+		if time.Since(p.sentAt) >= config.RepostWindow {
+			delete(claims, k)
+		}
+	}
+	claims[claimKey] = postedVerdict{id: id, text: text, sentAt: time.Now()}
+}
+
+// earlierVerdict returns the verdict reply sent about claimKey in chat within
+// the repost window, if any
+func earlierVerdict(chat types.JID, claimKey string) (postedVerdict, bool) {
+	if config.RepostWindow <= 0 || claimKey == "" {
+		return postedVerdict{}, false
+	}
+	postedVerdicts.Lock()
+	defer postedVerdicts.Unlock()
+	p, ok := postedVerdicts.byChat[chat.ToNonAD().String()][claimKey]
+	if !ok || time.Since(p.sentAt) >= config.RepostWindow {
+		return postedVerdict{}, false
+	}
+	return p, true
+}
+
+// sendAlreadyChecked answers a repost with a one-line pointer to the earlier
+// verdict, quoting it so members can tap through to the full reply
+func sendAlreadyChecked(evt *events.Message, earlier postedVerdict, result *AnalyzeResponse, lang string) {
+	m := messagesFor(lang)
+	emoji, status := verdictStatus(result, m)
+	text := fmt.Sprintf("☝️ %s %s *%s*", m.AlreadyChecked, emoji, status)
+	if result.isSatire() || isHollowVerdict(result) {
+		// The earlier reply was a note, which has no headline to repeat
+		text = fmt.Sprintf("☝️ %s %s", m.AlreadyChecked, verdictEmoji(result))
+	}
+
+	participant := ""
+	if client != nil && client.Store.ID != nil {
+		participant = client.Store.ID.ToNonAD().String()
+	}
+	quoted := &waE2E.Message{Conversation: proto.String(earlier.text)}
+	if err := sendQuotedText(evt.Info.Chat, earlier.id, participant, quoted, text); err != nil {
+		fmt.Printf("Error sending message: %v\n", err)
+		metrics.fail("send_error", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	topicHealth    = "health"
+	topicElections = "elections"
+	topicDisasters = "disasters"
+)
+
+// Resource is an authoritative source or helpline to point readers to
+type Resource struct {
+	Name    string `json:"name"`
+	Contact string `json:"contact"` // a URL or phone number
+}
+
+// topicResources maps backend topics to the resources appended to their
+// verdicts in place of the generic footer. The file at config.ResourcesPath
+// replaces the entries for the topics it lists.
+var topicResources = map[string][]Resource{
+	topicHealth: {
+		{Name: "World Health Organization", Contact: "https://www.who.int"},
+		{Name: "Health ministry helpline", Contact: "1075"},
+	},
+	topicElections: {
+		{Name: "Election Commission of India", Contact: "https://eci.gov.in"},
+		{Name: "Voter helpline", Contact: "1950"},
+	},
+	topicDisasters: {
+		{Name: "National Disaster Management Authority", Contact: "https://ndma.gov.in"},
+		{Name: "NDMA helpline", Contact: "1078"},
+		{Name: "Emergency", Contact: "112"},
+	},
+}
+
+// loadResources reads per-topic resources from path, a JSON object of topic
+// to resource list. A missing file keeps the built-in resources.
+func loadResources(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read resources %s: %w", path, err)
+	}
+	var custom map[string][]Resource
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return fmt.Errorf("failed to parse resources %s: %w", path, err)
+	}
+	for topic, resources := range custom {
+		topicResources[strings.ToLower(topic)] = resources
+	}
+	fmt.Printf("Loaded resources for %d topics from %s\n", len(custom), path)
+	return nil
+}
+
+// resourcesFor returns the resources for a verdict's topic, or nil
+func resourcesFor(result *AnalyzeResponse) []Resource {
+	return topicResources[strings.ToLower(result.Topic)]
+}
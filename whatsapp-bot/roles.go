@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Role is what an operator may do with the bot. Each role can do
+// everything the roles below it can.
+type Role int
+
+const (
+	roleNone      Role = iota
+	roleModerator      // pause and resume chats
+	roleAdmin          // run the bot day to day: access lists, domains, retries
+	roleOwner          // broadcast, change bot-wide config and grant roles
+)
+
+func (r Role) String() string {
+	switch r {
+	case roleModerator:
+		return "moderator"
+	case roleAdmin:
+		return "admin"
+	case roleOwner:
+		return "owner"
+	}
+	return "none"
+}
+
+// parseRole parses a role name
+func parseRole(name string) (Role, error) {
+	switch strings.ToLower(name) {
+	case "moderator", "mod":
+		return roleModerator, nil
+	case "admin":
+		return roleAdmin, nil
+	case "owner":
+		return roleOwner, nil
+	}
+	return roleNone, fmt.Errorf("unknown role %q (use owner, admin or moderator)", name)
+}
+
+// grants caches the roles granted at runtime with /grant, by JID
+var grants = struct {
+	sync.RWMutex
+	byJID map[string]Role
+}{byJID: map[string]Role{}}
+
+func init() {
+	registerCommand("grant", &Command{
+		Usage:   "/grant <jid> <owner|admin|moderator>",
+		Help:    "Give someone an operator role",
+		Role:    roleOwner,
+		Handler: cmdGrant,
+	})
+	registerCommand("revoke", &Command{
+		Usage:   "/revoke <jid>",
+		Help:    "Remove a role given with /grant",
+		Role:    roleOwner,
+		Handler: cmdRevoke,
+	})
+	registerCommand("roles", &Command{
+		Usage:   "/roles",
+		Help:    "List the bot's operators and their roles",
+		Role:    roleAdmin,
+		Handler: cmdRoles,
+	})
+	registerCommand("pause", &Command{
+		Usage:   "/pause [jid]",
+		Help:    "Stop the bot in a chat (defaults to this chat)",
+		Role:    roleModerator,
+		Handler: func(evt *events.Message, args []string) { cmdPause(evt, args, true) },
+	})
+	registerCommand("resume", &Command{
+		Usage:   "/resume [jid]",
+		Help:    "Let the bot answer in a paused chat again",
+		Role:    roleModerator,
+		Handler: func(evt *events.Message, args []string) { cmdPause(evt, args, false) },
+	})
+}
+
+// configRoles maps the JIDs in OWNER_JIDS, ADMIN_JIDS and MODERATOR_JIDS to
+// their roles. Without OWNER_JIDS the admins are owners, as they were before
+// roles existed.
+func configRoles() map[string]Role {
+	roles := map[string]Role{}
+	set := func(jids []types.JID, role Role) {
+		for _, jid := range jids {
+			key := jid.ToNonAD().String()
+			if role > roles[key] {
+				roles[key] = role
+			}
+		}
+	}
+	set(config.ModeratorJIDs, roleModerator)
+	if len(config.OwnerJIDs) == 0 {
+		set(config.AdminJIDs, roleOwner)
+	} else {
+		set(config.AdminJIDs, roleAdmin)
+		set(config.OwnerJIDs, roleOwner)
+	}
+	return roles
+}
+
+// roleOf returns the highest role the message sender has from the config or
+// a grant
+func roleOf(info types.MessageInfo) Role {
+	fromConfig := configRoles()
+	role := roleNone
+	grants.RLock()
+	defer grants.RUnlock()
+	for _, jid := range []types.JID{info.Sender, info.SenderAlt} {
+		if jid.IsEmpty() {
+			continue
+		}
+		key := jid.ToNonAD().String()
+		role = max(role, fromConfig[key], grants.byJID[key])
+	}
+	return role
+}
+
+// operatorsWith returns everyone with at least role, from the config or a
+// grant, sorted for stable output
+func operatorsWith(role Role) []types.JID {
+	roles := configRoles()
+	grants.RLock()
+	for jid, granted := range grants.byJID {
+		roles[jid] = max(roles[jid], granted)
+	}
+	grants.RUnlock()
+
+	var keys []string
+	for jid, r := range roles {
+		if r >= role {
+			keys = append(keys, jid)
+		}
+	}
+	sort.Strings(keys)
+	jids := make([]types.JID, 0, len(keys))
+	for _, key := range keys {
+		if jid, err := types.ParseJID(key); err == nil {
+			jids = append(jids, jid)
+		}
+	}
+	return jids
+}
+
+// loadRoles reads the granted roles into memory
+func (s *Store) loadRoles() error {
+	rows, err := s.db.Query(`SELECT jid, role FROM roles`)
+	if err != nil {
+		return fmt.Errorf("failed to load roles: %w", err)
+	}
+	defer rows.Close()
+
+	grants.Lock()
+	defer grants.Unlock()
+	grants.byJID = map[string]Role{}
+	for rows.Next() {
+		var jid, name string
+		if err := rows.Scan(&jid, &name); err != nil {
+			return fmt.Errorf("failed to scan roles: %w", err)
+		}
+		role, err := parseRole(name)
+		if err != nil {
+			fmt.Printf("Skipping role of %s: %v\n", jid, err)
+			continue
+		}
+		grants.byJID[jid] = role
+	}
+	return rows.Err()
+}
+
+// grantRole gives jid role, replacing any role granted before
+func (s *Store) grantRole(jid types.JID, role Role, grantedBy types.JID) error {
+	_, err := s.db.Exec(
+		`INSERT INTO roles (jid, role, granted_by, granted_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (jid) DO UPDATE SET role = excluded.role, granted_by = excluded.granted_by, granted_at = excluded.granted_at`,
+		jid.String(), role.String(), grantedBy.ToNonAD().String(), time.Now().Unix(),
+	)
+	if err != nil {
+		return err
+	}
+	grants.Lock()
+	old, had := grants.byJID[jid.String()]
+	grants.byJID[jid.String()] = role
+	grants.Unlock()
+	s.audit(grantedBy.ToNonAD().String(), types.JID{}, "grant", jid.String(), auditRole(old, had), role.String())
+	return nil
+}
+
+// revokeRole removes jid's granted role, reporting whether it had one
+func (s *Store) revokeRole(jid types.JID, revokedBy types.JID) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM roles WHERE jid = ?`, jid.String())
+	if err != nil {
+		return false, err
+	}
+	grants.Lock()
+	old, had := grants.byJID[jid.String()]
+	delete(grants.byJID, jid.String())
+	grants.Unlock()
+	if had {
+		s.audit(revokedBy.ToNonAD().String(), types.JID{}, "revoke", jid.String(), old.String(), nil)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// auditRole is the audit value of a granted role, nil when there was none
+func auditRole(role Role, granted bool) any {
+	if !granted {
+		return nil
+	}
+	return role.String()
+}
+
+func cmdGrant(evt *events.Message, args []string) {
+	if len(args) != 2 {
+		sendMessage(evt, "Usage: /grant <jid> <owner|admin|moderator>")
+		return
+	}
+	jid, err := parseJIDArg(args[0])
+	if err != nil {
+		sendMessage(evt, fmt.Sprintf("❌ %v", err))
+		return
+	}
+	role, err := parseRole(args[1])
+	if err != nil {
+		sendMessage(evt, fmt.Sprintf("❌ %v", err))
+		return
+	}
+	if err := botStore.grantRole(jid, role, evt.Info.Sender); err != nil {
+		fmt.Printf("Error granting role: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not grant the role. Please try again.")
+		return
+	}
+	sendMessage(evt, fmt.Sprintf("✅ `%s` is now %s.", jid.String(), role))
+}
+
+func cmdRevoke(evt *events.Message, args []string) {
+	if len(args) != 1 {
+		sendMessage(evt, "Usage: /revoke <jid>")
+		return
+	}
+	jid, err := parseJIDArg(args[0])
+	if err != nil {
+		sendMessage(evt, fmt.Sprintf("❌ %v", err))
+		return
+	}
+	revoked, err := botStore.revokeRole(jid, evt.Info.Sender)
+	switch {
+	case err != nil:
+		fmt.Printf("Error revoking role: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not revoke the role. Please try again.")
+	case configRoles()[jid.String()] != roleNone:
+		sendMessage(evt, fmt.Sprintf("ℹ️ `%s` keeps the %s role set in the bot's config.", jid.String(), configRoles()[jid.String()]))
+	case !revoked:
+		sendMessage(evt, fmt.Sprintf("ℹ️ `%s` has no granted role.", jid.String()))
+	default:
+		sendMessage(evt, fmt.Sprintf("✅ Revoked the role of `%s`.", jid.String()))
+	}
+}
+
+func cmdRoles(evt *events.Message, args []string) {
+	type operator struct {
+		jid, source string
+		role        Role
+	}
+	var operators []operator
+	for jid, role := range configRoles() {
+		operators = append(operators, operator{jid, "config", role})
+	}
+	grants.RLock()
+	for jid, role := range grants.byJID {
+		operators = append(operators, operator{jid, "granted", role})
+	}
+	grants.RUnlock()
+	if len(operators) == 0 {
+		sendMessage(evt, "ℹ️ No operators are configured.")
+		return
+	}
+	sort.Slice(operators, func(i, j int) bool {
+		if operators[i].role != operators[j].role {
+			return operators[i].role > operators[j].role
+		}
+		return operators[i].jid < operators[j].jid
+	})
+
+	var sb strings.Builder
+	sb.WriteString("👥 *Operators*\n")
+	for _, op := range operators {
+		fmt.Fprintf(&sb, "\n• %s `%s` (%s)", op.role, op.jid, op.source)
+	}
+	sendMessage(evt, sb.String())
+}
+
+// cmdPause turns the bot off in a chat, or back to its default mode
+func cmdPause(evt *events.Message, args []string, pause bool) {
+	chat := evt.Info.Chat
+	if len(args) > 0 {
+		jid, err := parseJIDArg(args[0])
+		if err != nil {
+			sendMessage(evt, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		chat = jid
+	}
+	var mode any
+	if pause {
+		mode = modeOff
+	}
+	if err := botStore.updateChatSettings(chat, map[string]any{"mode": mode}, actorOf(evt.Info)); err != nil {
+		fmt.Printf("Error updating chat settings: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not update the chat. Please try again.")
+		return
+	}
+	if pause {
+		sendMessage(evt, fmt.Sprintf("⏸️ Paused in `%s`. Only commands are answered there until /resume.", chat.String()))
+	} else {
+		sendMessage(evt, fmt.Sprintf("▶️ Resumed in `%s` with mode %s.", chat.String(), botStore.getChatSettings(chat).Mode))
+	}
+}
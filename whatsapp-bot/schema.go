@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+const (
+	verdictCredible       = "credible"
+	verdictMisinformation = "misinformation"
+	verdictUnverifiable   = "unverifiable"
+)
+
+// isUnverifiable reports whether the backend couldn't establish the claim
+// either way. Older backends only send is_misinformation and never say so.
+func (r *AnalyzeResponse) isUnverifiable() bool {
+	return r.Verdict == verdictUnverifiable
+}
+
+// responseSchemaVersion is the newest backend response schema the bot knows.
+// Responses without schema_version are version 1.
+const responseSchemaVersion = 1
+
+// warnedSchemas remembers the newer schema versions already logged
+var warnedSchemas sync.Map
+
+// validateAnalysis checks a backend verdict before it's used, fixing what can
+// be fixed in place and rejecting what would make a garbled reply: a missing
+// confidence, or a flagged message without a summary. Claims with verdicts
+// the bot doesn't know are dropped rather than shown as unverified.
+func validateAnalysis(result *AnalyzeResponse) error {
+	version := result.SchemaVersion
+	if version == 0 {
+		version = 1
+	}
+	if version > responseSchemaVersion {
+		// Newer backends only add fields; validate the ones this bot reads
+		if _, seen := warnedSchemas.LoadOrStore(version, true); !seen {
+			fmt.Printf("Backend sent response schema %d, newer than %d; ignoring fields this bot doesn't know\n", version, responseSchemaVersion)
+		}
+	}
+
+	switch result.Verdict = strings.ToLower(strings.TrimSpace(result.Verdict)); result.Verdict {
+	case "":
+	case verdictCredible, verdictMisinformation, verdictUnverifiable:
+		// The three-state verdict wins over the legacy flag
+		result.IsMisinformation = result.Verdict == verdictMisinformation
+	default:
+		return invalidResponse(fmt.Sprintf("unknown verdict %q", result.Verdict))
+	}
+	switch result.MessageType {
+	case contentSatire:
+		// Satire is answered as satire however false it is literally, and
+		// still reaches the reply when the backend calls it not news
+		result.IsNews, result.IsMisinformation = true, false
+	case contentOpinion, contentAdvertisement, contentPersonal:
+		// Nothing to fact-check; explicit checks get the tailored reply
+		result.IsNews = false
+	}
+	if math.IsNaN(result.Confidence) || math.IsInf(result.Confidence, 0) {
+		return invalidResponse("confidence is not a number")
+	}
+	result.Confidence = clampConfidence(result.Confidence)
+	result.Summary = strings.TrimSpace(result.Summary)
+	if result.IsMisinformation && result.Summary == "" {
+		return invalidResponse("flagged as misinformation without a summary")
+	}
+
+	claims := result.Claims[:0]
+	for _, c := range result.Claims {
+		if !knownClaimVerdict(c.Verdict) {
+			fmt.Printf("Dropping claim with unknown verdict %q\n", c.Verdict)
+			metrics.inc("schema_claim_dropped")
+			continue
+		}
+		if math.IsNaN(c.Confidence) {
+			c.Confidence = 0
+		}
+		c.Confidence = clampConfidence(c.Confidence)
+		claims = append(claims, c)
+	}
+	result.Claims = claims
+	return nil
+}
+
+// isHollowVerdict reports whether a news verdict came back with nothing to
+// show: no summary, evidence or claims. Such verdicts get a minimal
+// cautionary reply instead of a half-empty card, and aren't cached.
+func isHollowVerdict(result *AnalyzeResponse) bool {
+	return result.IsNews && strings.TrimSpace(result.Summary) == "" &&
+		len(result.Evidence) == 0 && len(result.Claims) == 0
+}
+
+// invalidResponse reports a backend response that failed validation
+func invalidResponse(reason string) error {
+	metrics.inc("schema_invalid")
+	return fmt.Errorf("invalid backend response: %s", reason)
+}
+
+// clampConfidence keeps a confidence within [0, 1]
+func clampConfidence(c float64) float64 {
+	return math.Max(0, math.Min(1, c))
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	secretsEnv   = "env"
+	secretsFiles = "files"
+	secretsVault = "vault"
+	secretsAWS   = "aws"
+)
+
+var secretsClient = &http.Client{Timeout: 10 * time.Second}
+
+// Secret is a config value that can come from a secrets manager and be
+// rotated while the bot runs
+type Secret struct {
+	value atomic.Pointer[string]
+}
+
+// Get returns the current value, or "" for an unset secret
+func (s *Secret) Get() string {
+	if s == nil {
+		return ""
+	}
+	if v := s.value.Load(); v != nil {
+		return *v
+	}
+	return ""
+}
+
+// Set replaces the value
+func (s *Secret) Set(v string) {
+	s.value.Store(&v)
+}
+
+// secrets holds every secret by its environment variable name
+var secrets = struct {
+	sync.Mutex
+	byName map[string]*Secret
+}{byName: map[string]*Secret{}}
+
+// envSecret registers the secret named key, starting from its environment
+// variable until a secrets manager provides it
+func envSecret(key string) *Secret {
+	s := &Secret{}
+	s.Set(os.Getenv(key))
+	secrets.Lock()
+	secrets.byName[key] = s
+	secrets.Unlock()
+	return s
+}
+
+// secretNames lists the registered secrets
+func secretNames() []string {
+	secrets.Lock()
+	defer secrets.Unlock()
+	names := make([]string, 0, len(secrets.byName))
+	for name := range secrets.byName {
+		names = append(names, name)
+	}
+	return names
+}
+
+// fetchSecrets reads the secrets from the configured provider
+func fetchSecrets() (map[string]string, error) {
+	switch config.SecretsProvider {
+	case secretsFiles:
+		return fileSecrets(config.SecretsDir)
+	case secretsVault:
+		return vaultSecrets()
+	case secretsAWS:
+		return awsSecrets()
+	}
+	return nil, fmt.Errorf("unknown secrets provider %q (use env, files, vault or aws)", config.SecretsProvider)
+}
+
+// loadSecrets replaces registered secrets with the provider's values.
+// Secrets the provider doesn't have keep their current value.
+func loadSecrets() error {
+	if config.SecretsProvider == "" || config.SecretsProvider == secretsEnv {
+		return nil
+	}
+	values, err := fetchSecrets()
+	if err != nil {
+		return err
+	}
+	loaded := 0
+	secrets.Lock()
+	for name, value := range values {
+		if s, ok := secrets.byName[name]; ok && value != "" {
+			s.Set(value)
+			loaded++
+		}
+	}
+	secrets.Unlock()
+	fmt.Printf("Loaded %d secrets from %s\n", loaded, config.SecretsProvider)
+	return nil
+}
+
+// fileSecrets reads one file per secret from dir, named like its variable
+// in upper or lower case, as Docker and Kubernetes mount them
+func fileSecrets(dir string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, name := range secretNames() {
+		for _, file := range []string{name, strings.ToLower(name)} {
+			data, err := os.ReadFile(filepath.Join(dir, file))
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			values[name] = strings.TrimSpace(string(data))
+			break
+		}
+	}
+	return values, nil
+}
+
+// vaultSecrets reads the secret at VAULT_SECRET_PATH, a KV v1 or v2 path
+// whose keys are the variable names
+func vaultSecrets() (map[string]string, error) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(config.VaultAddr, "/")+"/v1/"+strings.TrimPrefix(config.VaultSecretPath, "/"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", config.VaultToken)
+	resp, err := secretsClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Vault returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	// KV v2 nests the values one level deeper, next to their metadata
+	var v2 struct {
+		Data     map[string]string `json:"data"`
+		Metadata json.RawMessage   `json:"metadata"`
+	}
+	if err := json.Unmarshal(body.Data, &v2); err == nil && v2.Metadata != nil {
+		return v2.Data, nil
+	}
+	var v1 map[string]string
+	if err := json.Unmarshal(body.Data, &v1); err != nil {
+		return nil, fmt.Errorf("secret values must be strings: %w", err)
+	}
+	return v1, nil
+}
+
+// awsSecrets reads AWS_SECRET_ID from AWS Secrets Manager, a JSON object
+// whose keys are the variable names
+func awsSecrets() (map[string]string, error) {
+	body, err := json.Marshal(map[string]string{"SecretId": config.AWSSecretID})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", config.AWSRegion), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	awsCredentials{
+		region:       config.AWSRegion,
+		service:      "secretsmanager",
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}.sign(req, "/", body)
+
+	resp, err := secretsClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Secrets Manager: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Secrets Manager returned status %d", resp.StatusCode)
+	}
+
+	var secret struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	var values map[string]string
+	if err := json.Unmarshal([]byte(secret.SecretString), &values); err != nil {
+		return nil, fmt.Errorf("secret must be a JSON object of strings: %w", err)
+	}
+	return values, nil
+}
+
+// runSecretsReloader re-reads the secrets whenever the bot gets SIGHUP, so
+// rotated keys are picked up without a restart
+func runSecretsReloader() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		fmt.Println("SIGHUP received, reloading secrets")
+		if err := loadSecrets(); err != nil {
+			fmt.Printf("Error reloading secrets: %v\n", err)
+		}
+	}
+}
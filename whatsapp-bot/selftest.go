@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+var healthClient = &http.Client{Timeout: 10 * time.Second}
+
+func init() {
+	registerCommand("selftest", &Command{
+		Usage:   "/selftest",
+		Help:    "Check the backend, database, cache and media pipeline",
+		Role:    roleAdmin,
+		Handler: cmdSelfTest,
+	})
+}
+
+// pingBackend calls the backend's /health endpoint and returns its latency
+func pingBackend() (time.Duration, error) {
+	return pingURL(backendURL())
+}
+
+// checkWritable verifies the bot database accepts writes, without keeping them
+func (s *Store) checkWritable() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO onboarded_chats (chat, onboarded_at) VALUES ('selftest', 0)`)
+	return err
+}
+
+// checkMedia uploads a tiny image to the WhatsApp media servers and downloads it back
+func checkMedia() (time.Duration, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.White)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	uploaded, err := messenger.Upload(context.Background(), buf.Bytes(), whatsmeow.MediaImage)
+	if err != nil {
+		return 0, fmt.Errorf("upload failed: %w", err)
+	}
+	data, err := messenger.Download(context.Background(), &waE2E.ImageMessage{
+		URL:           proto.String(uploaded.URL),
+		DirectPath:    proto.String(uploaded.DirectPath),
+		MediaKey:      uploaded.MediaKey,
+		FileEncSHA256: uploaded.FileEncSHA256,
+		FileSHA256:    uploaded.FileSHA256,
+		FileLength:    proto.Uint64(uploaded.FileLength),
+		Mimetype:      proto.String("image/png"),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+	if !bytes.Equal(data, buf.Bytes()) {
+		return 0, fmt.Errorf("downloaded image doesn't match the upload")
+	}
+	return time.Since(start), nil
+}
+
+func cmdSelfTest(evt *events.Message, args []string) {
+	var sb strings.Builder
+	failures := 0
+	check := func(name string, detail string, err error) {
+		if err != nil {
+			failures++
+			sb.WriteString(fmt.Sprintf("\n❌ *%s:* %v", name, err))
+			return
+		}
+		sb.WriteString(fmt.Sprintf("\n✅ *%s:* %s", name, detail))
+	}
+
+	latency, err := pingBackend()
+	check("Backend", fmt.Sprintf("reachable in %d ms", latency.Milliseconds()), err)
+
+	check("Database", "writable", botStore.checkWritable())
+
+	check("Cache", fmt.Sprintf("%d verdicts cached (TTL %s)", verdictCache.Len(), config.CacheTTL), nil)
+
+	mediaLatency, err := checkMedia()
+	check("Media", fmt.Sprintf("upload and download in %d ms", mediaLatency.Milliseconds()), err)
+
+	check("WhatsApp", fmt.Sprintf("connected as %s", client.Store.GetJID().ToNonAD()), nil)
+
+	var riskErr error
+	if risk := banRiskState(); risk != "ok" {
+		riskErr = fmt.Errorf("%s", risk)
+	}
+	check("Ban risk", "no signs of restrictions", riskErr)
+
+	header := "🩺 *Self-test passed*"
+	if failures > 0 {
+		header = fmt.Sprintf("🩺 *Self-test: %d check(s) failed*", failures)
+	}
+	sendMessage(evt, header+"\n"+sb.String())
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Kinds of sender told to the backend as analysis context. A message can be
+// several at once, such as a business account's broadcast.
+const (
+	senderBusiness  = "business"  // a WhatsApp Business account with a verified name
+	senderBroadcast = "broadcast" // sent to a broadcast list rather than a chat
+	senderBot       = "bot"       // Meta AI or another bot account
+)
+
+// senderTypes describes who sent a message, or returns nil for an ordinary
+// person writing to a chat
+func senderTypes(info types.MessageInfo) []string {
+	var kinds []string
+	if info.VerifiedName != nil {
+		kinds = append(kinds, senderBusiness)
+	}
+	if info.Chat.IsBroadcastList() || !info.BroadcastListOwner.IsEmpty() {
+		kinds = append(kinds, senderBroadcast)
+	}
+	if info.Sender.IsBot() {
+		kinds = append(kinds, senderBot)
+	}
+	return kinds
+}
+
+// senderThreshold returns the confidence a sender needs before an automatic
+// reply: the lowest SENDER_THRESHOLDS entry among its kinds, since claims
+// pushed by businesses or broadcasts warrant stricter checking, or the
+// chat's threshold when none is configured
+func senderThreshold(kinds []string, chatThreshold float64) float64 {
+	threshold, found := 0.0, false
+	for _, kind := range kinds {
+		if t, ok := config.SenderThresholds[kind]; ok && (!found || t < threshold) {
+			threshold, found = t, true
+		}
+	}
+	if !found {
+		return chatThreshold
+	}
+	return threshold
+}
+
+// parseSenderThresholds parses SENDER_THRESHOLDS, like business=0.3,bot=0.8
+func parseSenderThresholds(spec string) map[string]float64 {
+	thresholds := map[string]float64{}
+	for _, item := range strings.Split(spec, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		kind, value, _ := strings.Cut(item, "=")
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		if kind != senderBusiness && kind != senderBroadcast && kind != senderBot {
+			fmt.Printf("Ignoring threshold for unknown sender type %q\n", kind)
+			continue
+		}
+		threshold, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || !(threshold >= 0 && threshold <= 1) {
+			fmt.Printf("Ignoring sender threshold %s: must be a number between 0 and 1\n", kind)
+			continue
+		}
+		thresholds[kind] = threshold
+	}
+	return thresholds
+}
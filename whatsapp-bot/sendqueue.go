@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// pacedMessenger sends every outgoing message through the send queue, so
+// bursts of replies go out at a pace WhatsApp doesn't take for spam
+type pacedMessenger struct {
+	Messenger
+}
+
+func (m pacedMessenger) SendMessage(ctx context.Context, to types.JID, msg *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	if _, paused := sendingPaused(); paused {
+		return whatsmeow.SendResponse{}, errSendingPaused
+	}
+	if connectionDegraded() {
+		return whatsmeow.SendResponse{}, errConnectionDegraded
+	}
+	req := sendRequest(extra)
+	if err := sendQueue.wait(ctx, to); err != nil {
+		return whatsmeow.SendResponse{}, err
+	}
+	resp, err := m.Messenger.SendMessage(ctx, to, msg, req)
+	if err != nil && neverReachedServer(err) && waitForConnection(ctx, config.SendRetryWait) {
+		fmt.Printf("Retrying message %s to %s after reconnecting\n", req.ID, to)
+		metrics.inc("send_retried")
+		resp, err = m.Messenger.SendMessage(ctx, to, msg, req)
+	}
+	if err != nil {
+		noteSendFailure(err)
+	}
+	return resp, err
+}
+
+// sendRequest returns the send options with a message ID filled in. A fixed
+// ID lets a send that never reached the server be repeated without risking a
+// duplicate.
+func sendRequest(extra []whatsmeow.SendRequestExtra) whatsmeow.SendRequestExtra {
+	req := whatsmeow.SendRequestExtra{}
+	if len(extra) > 0 {
+		req = extra[0]
+	}
+	if req.ID == "" {
+		req.ID = client.GenerateMessageID()
+	}
+	return req
+}
+
+// SendQueue hands out send times: at most SEND_RATE messages a second
+// overall, SEND_CHAT_INTERVAL apart in any one chat, each nudged by up to
+// SEND_JITTER so the rhythm doesn't look automated. A message held back for
+// its chat doesn't hold up others. While the number is at ban risk the
+// spacing stretches by BAN_RISK_SLOWDOWN.
+type SendQueue struct {
+	mu      sync.Mutex
+	booked  []time.Time          // send times handed out, soonest first
+	byChat  map[string]time.Time // when each chat may next get a message
+	waiting atomic.Int32
+}
+
+var sendQueue = &SendQueue{byChat: map[string]time.Time{}}
+
+// wait blocks until a message to chat may be sent, or ctx is done
+func (q *SendQueue) wait(ctx context.Context, chat types.JID) error {
+	at := q.reserve(chat.ToNonAD().String(), time.Now())
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+	metrics.inc("send_paced")
+	q.waiting.Add(1)
+	defer q.waiting.Add(-1)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve books the earliest send time for a message to chat
+func (q *SendQueue) reserve(chat string, now time.Time) time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	slowdown := sendSlowdown()
+	gap := time.Duration(0)
+	if config.SendRate > 0 {
+		gap = time.Duration(slowdown * float64(time.Second) / config.SendRate)
+	}
+	// Forget send times and chat spacing that are behind us
+	n := 0
+	for n < len(q.booked) && q.booked[n].Add(gap).Before(now) {
+		n++
+	}
+	q.booked = q.booked[n:]
+	for key, next := range q.byChat {
+		if next.Before(now) {
+			delete(q.byChat, key)
+		}
+	}
+
+	at := now
+	if next := q.byChat[chat]; next.After(at) {
+		at = next
+	}
+	if config.SendJitter > 0 {
+		at = at.Add(rand.N(config.SendJitter))
+	}
+	if gap > 0 {
+		// Take the first opening at least gap away from every booked time
+		for _, b := range q.booked {
+			if !b.Add(gap).After(at) {
+				continue
+			}
+			if !at.Add(gap).After(b) {
+				break
+			}
+			at = b.Add(gap)
+		}
+		i := sort.Search(len(q.booked), func(i int) bool { return q.booked[i].After(at) })
+		q.booked = append(q.booked, time.Time{})
+		copy(q.booked[i+1:], q.booked[i:])
+		q.booked[i] = at
+	}
+	if config.SendChatInterval > 0 {
+		q.byChat[chat] = at.Add(time.Duration(slowdown * float64(config.SendChatInterval)))
+	}
+	return at
+}
+
+// depth returns how many messages are waiting for their send time
+func (q *SendQueue) depth() int {
+	return int(q.waiting.Load())
+}
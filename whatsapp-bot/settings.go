@@ -0,0 +1,387 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const (
+	verbosityFull  = "full"
+	verbosityShort = "short"
+
+	modeAuto    = "auto"    // analyze every message
+	modeCommand = "command" // only analyze on /check
+	modeOff     = "off"     // ignore everything except commands
+	modeShadow  = "shadow"  // analyze every message and log verdicts, but never reply
+	modeObserve = "observe" // never reply and keep only hashed aggregate statistics
+)
+
+// ChatSettings holds the per-chat configuration. Unset values in the database
+// inherit the bot-wide defaults from Config.
+type ChatSettings struct {
+	Language   string
+	Verbosity  string
+	Threshold  float64
+	Mode       string
+	QuietHours *QuietHours
+	Cooldown   time.Duration // minimum time between automatic verdicts in a group
+	Format     string        // rich or plain
+	Confidence string        // bar, stars, percent or none
+	History    bool          // keep recent message text for /scan last
+}
+
+// settingKeys documents the keys accepted by /settings
+var settingKeys = []string{"language", "verbosity", "threshold", "mode", "quiet", "cooldown", "format", "confidence", "history"}
+
+func init() {
+	registerCommand("settings", &Command{
+		Usage:   "/settings [key value | reset]",
+		Help:    "Show or change this chat's settings",
+		Handler: cmdSettings,
+	})
+}
+
+// defaultChatSettings returns the bot-wide defaults
+func defaultChatSettings() *ChatSettings {
+	return &ChatSettings{
+		Language:   config.DefaultLanguage,
+		Verbosity:  config.DefaultVerbosity,
+		Threshold:  config.DefaultThreshold,
+		Mode:       config.DefaultMode,
+		QuietHours: config.QuietHours,
+		Cooldown:   config.DefaultCooldown,
+		Format:     config.DefaultFormat,
+		Confidence: config.DefaultConfidence,
+		History:    config.DefaultHistory,
+	}
+}
+
+// getChatSettings loads the effective settings for a chat: its own, then
+// its community's, then the bot-wide defaults
+func (s *Store) getChatSettings(chat types.JID) *ChatSettings {
+	settings := defaultChatSettings()
+	if community, _ := s.communityOf(chat); !community.IsEmpty() {
+		s.applyChatSettings(settings, community)
+	}
+	s.applyChatSettings(settings, chat)
+	applyCrisis(settings)
+	return settings
+}
+
+// applyChatSettings overrides settings with what chat has set
+func (s *Store) applyChatSettings(settings *ChatSettings, chat types.JID) {
+	var language, verbosity, mode, quietMode, format, confidence sql.NullString
+	var threshold sql.NullFloat64
+	var quietStart, quietEnd, cooldown sql.NullInt64
+	var history sql.NullBool
+	err := s.db.QueryRow(
+		`SELECT language, verbosity, threshold, mode, quiet_start, quiet_end, quiet_mode, cooldown, format, confidence, history
+		 FROM chat_settings WHERE chat = ?`, chat.ToNonAD().String(),
+	).Scan(&language, &verbosity, &threshold, &mode, &quietStart, &quietEnd, &quietMode, &cooldown, &format, &confidence, &history)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	} else if err != nil {
+		fmt.Printf("Error loading settings for %s: %v\n", chat, err)
+		return
+	}
+
+	if language.Valid {
+		settings.Language = language.String
+	}
+	if verbosity.Valid {
+		settings.Verbosity = verbosity.String
+	}
+	if threshold.Valid {
+		settings.Threshold = threshold.Float64
+	}
+	if mode.Valid {
+		settings.Mode = mode.String
+	}
+	if cooldown.Valid {
+		settings.Cooldown = time.Duration(cooldown.Int64) * time.Second
+	}
+	if format.Valid {
+		settings.Format = format.String
+	}
+	if confidence.Valid {
+		settings.Confidence = confidence.String
+	}
+	if history.Valid {
+		settings.History = history.Bool
+	}
+	switch {
+	case quietMode.String == modeOff:
+		settings.QuietHours = nil
+	case quietMode.Valid && quietStart.Valid && quietEnd.Valid:
+		settings.QuietHours = &QuietHours{
+			Start: int(quietStart.Int64),
+			End:   int(quietEnd.Int64),
+			Mode:  quietMode.String,
+		}
+	}
+}
+
+// updateChatSettings sets the given columns for a chat, creating its row if needed.
+// A nil value resets that column to the bot-wide default. The change is
+// recorded in the audit log under actor. Changes in a community's
+// announcement group apply to the whole community.
+func (s *Store) updateChatSettings(chat types.JID, values map[string]any, actor string) error {
+	chat = s.settingsChat(chat)
+	key := chat.ToNonAD().String()
+	now := time.Now().Unix()
+
+	sets := []string{"updated_at = ?"}
+	args := []any{now}
+	for column, value := range values {
+		sets = append(sets, column+" = ?")
+		args = append(args, value)
+	}
+	args = append(args, key)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := chatSettingsRow(tx, key)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO chat_settings (chat, updated_at) VALUES (?, ?) ON CONFLICT DO NOTHING`, key, now); err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`UPDATE chat_settings SET %s WHERE chat = ?`, strings.Join(sets, ", "))
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for column, value := range values {
+		s.audit(actor, chat, "setting", column, before[column], value)
+	}
+	return nil
+}
+
+// resetChatSettings drops all overrides for a chat
+func (s *Store) resetChatSettings(chat types.JID, actor string) error {
+	chat = s.settingsChat(chat)
+	key := chat.ToNonAD().String()
+	before, err := chatSettingsRow(s.db, key)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`DELETE FROM chat_settings WHERE chat = ?`, key); err != nil {
+		return err
+	}
+	if before != nil {
+		delete(before, "chat")
+		delete(before, "updated_at")
+		s.audit(actor, chat, "settings-reset", key, before, nil)
+	}
+	return nil
+}
+
+// chatSettingsRow returns the stored overrides of a chat by column, or nil
+// when it has none
+func chatSettingsRow(q interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}, key string) (map[string]any, error) {
+	rows, err := q.Query(`SELECT * FROM chat_settings WHERE chat = ?`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	row := make(map[string]any, len(columns))
+	for i, column := range columns {
+		if b, ok := values[i].([]byte); ok {
+			values[i] = string(b)
+		}
+		row[column] = values[i]
+	}
+	return row, nil
+}
+
+// parseSetting validates a /settings key and value, returning the columns to update
+func parseSetting(key string, args []string) (map[string]any, error) {
+	value := strings.ToLower(strings.Join(args, " "))
+	if value == "" {
+		return nil, fmt.Errorf("missing value for %s", key)
+	}
+	if value == "default" {
+		switch key {
+		case "quiet":
+			return map[string]any{"quiet_start": nil, "quiet_end": nil, "quiet_mode": nil}, nil
+		case "language", "verbosity", "threshold", "mode", "cooldown", "format", "confidence", "history":
+			return map[string]any{key: nil}, nil
+		}
+	}
+
+	switch key {
+	case "language":
+		if value != "auto" && (len(value) < 2 || len(value) > 3) {
+			return nil, fmt.Errorf("language must be auto or an ISO code like en, hi, mr")
+		}
+		return map[string]any{"language": value}, nil
+	case "verbosity":
+		if value != verbosityFull && value != verbosityShort {
+			return nil, fmt.Errorf("verbosity must be full or short")
+		}
+		return map[string]any{"verbosity": value}, nil
+	case "threshold":
+		number, percent := strings.CutSuffix(value, "%")
+		threshold, err := strconv.ParseFloat(number, 64)
+		if err != nil || math.IsNaN(threshold) || math.IsInf(threshold, 0) {
+			return nil, fmt.Errorf("threshold must be a number between 0 and 1, or a percentage like 70%%")
+		}
+		if percent {
+			threshold /= 100
+		}
+		if threshold < 0 || threshold > 1 {
+			return nil, fmt.Errorf("threshold must be a number between 0 and 1, or a percentage like 70%%")
+		}
+		return map[string]any{"threshold": threshold}, nil
+	case "mode":
+		if value != modeAuto && value != modeCommand && value != modeOff && value != modeShadow && value != modeObserve {
+			return nil, fmt.Errorf("mode must be auto, command, off, shadow or observe")
+		}
+		return map[string]any{"mode": value}, nil
+	case "format":
+		if value != formatRich && value != formatPlain {
+			return nil, fmt.Errorf("format must be rich or plain")
+		}
+		return map[string]any{"format": value}, nil
+	case "confidence":
+		if value != confidenceBar && value != confidenceStars && value != confidencePercent && value != confidenceNone {
+			return nil, fmt.Errorf("confidence must be bar, stars, percent or none")
+		}
+		return map[string]any{"confidence": value}, nil
+	case "history":
+		if value != "on" && value != modeOff {
+			return nil, fmt.Errorf("history must be on or off")
+		}
+		return map[string]any{"history": value == "on"}, nil
+	case "cooldown":
+		if value == modeOff || value == "0" {
+			return map[string]any{"cooldown": 0}, nil
+		}
+		cooldown, err := time.ParseDuration(value)
+		if err != nil || cooldown < 0 {
+			return nil, fmt.Errorf("cooldown must be a duration like 10m, or off")
+		}
+		return map[string]any{"cooldown": int64(cooldown / time.Second)}, nil
+	case "quiet":
+		if value == modeOff {
+			return map[string]any{"quiet_start": nil, "quiet_end": nil, "quiet_mode": modeOff}, nil
+		}
+		mode := ""
+		if len(args) > 1 {
+			mode = strings.ToLower(args[1])
+		}
+		q, err := parseQuietHours(args[0], mode)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"quiet_start": q.Start, "quiet_end": q.End, "quiet_mode": q.Mode}, nil
+	}
+	return nil, fmt.Errorf("unknown setting %q (available: %s)", key, strings.Join(settingKeys, ", "))
+}
+
+// formatSettings renders a chat's settings for display
+func formatSettings(s *ChatSettings) string {
+	quiet := "off"
+	if s.QuietHours != nil {
+		quiet = fmt.Sprintf("%s (%s, %s)", s.QuietHours, config.TimeZone, s.QuietHours.Mode)
+	}
+	cooldown := "off"
+	if s.Cooldown > 0 {
+		cooldown = s.Cooldown.String()
+	}
+	history := "off"
+	if s.History {
+		history = "on"
+	}
+	return fmt.Sprintf("⚙️ *Chat settings*\n\n"+
+		"*language:* %s\n"+
+		"*verbosity:* %s\n"+
+		"*threshold:* %.0f%%\n"+
+		"*mode:* %s\n"+
+		"*quiet:* %s\n"+
+		"*cooldown:* %s\n"+
+		"*format:* %s\n"+
+		"*confidence:* %s\n"+
+		"*history:* %s\n\n"+
+		"_Change with /settings <key> <value>, or /settings <key> default._",
+		s.Language, s.Verbosity, s.Threshold*100, s.Mode, quiet, cooldown, s.Format, s.Confidence, history)
+}
+
+func cmdSettings(evt *events.Message, args []string) {
+	if len(args) == 0 {
+		sendMessage(evt, formatSettings(botStore.getChatSettings(evt.Info.Chat))+communityNote(evt.Info.Chat))
+		return
+	}
+
+	if !canManageChat(evt.Info) {
+		sendMessage(evt, "⛔ Only group admins can change settings in groups.")
+		return
+	}
+
+	key := strings.ToLower(args[0])
+	if key == "reset" {
+		if err := botStore.resetChatSettings(evt.Info.Chat, actorOf(evt.Info)); err != nil {
+			fmt.Printf("Error resetting settings: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not reset settings. Please try again.")
+			return
+		}
+		botStore.forgetMessages(evt.Info.Chat)
+		sendMessage(evt, "✅ Settings reset to defaults.\n\n"+formatSettings(botStore.getChatSettings(evt.Info.Chat))+communityNote(evt.Info.Chat))
+		return
+	}
+
+	values, err := parseSetting(key, args[1:])
+	if err != nil {
+		sendMessage(evt, fmt.Sprintf("❌ %v", err))
+		return
+	}
+	if err := botStore.updateChatSettings(evt.Info.Chat, values, actorOf(evt.Info)); err != nil {
+		fmt.Printf("Error saving settings: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not save settings. Please try again.")
+		return
+	}
+	settings := botStore.getChatSettings(evt.Info.Chat)
+	if !settings.History {
+		botStore.forgetMessages(evt.Info.Chat)
+	}
+	sendMessage(evt, "✅ Settings updated.\n\n"+formatSettings(settings)+communityNote(evt.Info.Chat))
+}
+
+// isShadowChat reports whether the bot must stay silent in chat: in dry-run
+// mode, or when the chat is in shadow or observer mode
+func isShadowChat(chat types.JID) bool {
+	mode := botStore.getChatSettings(chat).Mode
+	return config.DryRun || mode == modeShadow || mode == modeObserve
+}
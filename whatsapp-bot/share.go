@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+//go:embed web/verdict.html
+var shareFS embed.FS
+
+var shareTemplate = template.Must(template.New("verdict.html").Funcs(template.FuncMap{
+	"percent": func(f float64) string { return fmt.Sprintf("%.0f%%", f*100) },
+}).ParseFS(shareFS, "web/verdict.html"))
+
+// shareVerdict stores a verdict for its public web page and returns the
+// page's link, or "" when share links are off or the chat's messages
+// disappear. The code is derived from the verdict, so the same verdict
+// shared again keeps its link. Pages say nothing about the chat or sender.
+func shareVerdict(chat types.JID, verdict *AnalyzeResponse, language string) string {
+	if config.ShareBaseURL == "" || isDisappearingChat(chat) {
+		return ""
+	}
+	data, err := json.Marshal(verdict)
+	if err != nil {
+		fmt.Printf("Error encoding shared verdict: %v\n", err)
+		return ""
+	}
+	sum := sha256.Sum256(append([]byte(language+"\n"), data...))
+	code := base64.RawURLEncoding.EncodeToString(sum[:8])
+	_, err = botStore.db.Exec(
+		`INSERT INTO shared_verdicts (code, verdict, language, created_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (code) DO UPDATE SET created_at = excluded.created_at`,
+		code, string(data), language, time.Now().Unix(),
+	)
+	if err != nil {
+		fmt.Printf("Error saving shared verdict: %v\n", err)
+		return ""
+	}
+	metrics.inc("verdict_shared")
+	return config.ShareBaseURL + "/v/" + code
+}
+
+// withShareLink appends the verdict's share link to a reply
+func withShareLink(text string, chat types.JID, verdict *AnalyzeResponse, language string) string {
+	link := shareVerdict(chat, verdict, language)
+	if link == "" {
+		return text
+	}
+	return text + "\n\n" + fmt.Sprintf(messagesFor(language).ShareLink, link)
+}
+
+// sharedVerdict loads the verdict behind a share code
+func (s *Store) sharedVerdict(code string) (*AnalyzeResponse, string, time.Time, error) {
+	var data, language string
+	var createdAt int64
+	err := s.db.QueryRow(`SELECT verdict, language, created_at FROM shared_verdicts WHERE code = ?`, code).Scan(&data, &language, &createdAt)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	var verdict AnalyzeResponse
+	if err := json.Unmarshal([]byte(data), &verdict); err != nil {
+		return nil, "", time.Time{}, err
+	}
+	return &verdict, language, time.Unix(createdAt, 0), nil
+}
+
+// ShareView is the template data for a verdict's web page
+type ShareView struct {
+	Verdict *AnalyzeResponse
+	M       *Messages
+	Lang    string
+	Emoji   string
+	Status  string
+	Class   string // ok, warn or bad
+	Checked time.Time
+}
+
+func handleSharedVerdict(w http.ResponseWriter, r *http.Request) {
+	verdict, language, checked, err := botStore.sharedVerdict(r.PathValue("code"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error loading shared verdict: %v\n", err)
+		http.Error(w, "failed to load", http.StatusInternalServerError)
+		return
+	}
+	m := messagesFor(language)
+	view := ShareView{Verdict: verdict, M: m, Lang: language, Checked: checked.In(config.TimeZone)}
+	if view.Lang == "" {
+		view.Lang = "en"
+	}
+	view.Emoji, view.Status = verdictStatus(verdict, m)
+	switch view.Emoji {
+	case "✅":
+		view.Class = "ok"
+	case "🟡", "⚠️":
+		view.Class = "warn"
+	default:
+		view.Class = "bad"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := shareTemplate.Execute(w, view); err != nil {
+		fmt.Printf("Error rendering shared verdict: %v\n", err)
+	}
+	metrics.inc("share_page_views")
+}
+
+// startShareServer serves verdict pages publicly on SHARE_ADDR; unlike the
+// dashboard it needs no token, so it serves nothing else. In a cluster one
+// instance can serve the pages every instance links to.
+func startShareServer() {
+	if config.ShareAddr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v/{code}", handleSharedVerdict)
+	go func() {
+		fmt.Printf("🔗 Share pages listening on %s\n", config.ShareAddr)
+		if err := http.ListenAndServe(config.ShareAddr, mux); err != nil {
+			fmt.Printf("Share server stopped: %v\n", err)
+		}
+	}()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	platformYouTube   = "youtube"
+	platformInstagram = "instagram"
+	platformX         = "x"
+)
+
+// socialHosts maps the hosts of the platforms the backend can pull content
+// from to the platform
+var socialHosts = map[string]string{
+	"youtube.com":        platformYouTube,
+	"m.youtube.com":      platformYouTube,
+	"youtu.be":           platformYouTube,
+	"instagram.com":      platformInstagram,
+	"x.com":              platformX,
+	"twitter.com":        platformX,
+	"mobile.twitter.com": platformX,
+}
+
+// SocialRequest is the request body for the backend /analyze/social endpoint
+type SocialRequest struct {
+	URL      string `json:"url"`
+	Text     string `json:"text,omitempty"` // the message the link was shared in
+	Language string `json:"language,omitempty"`
+}
+
+// SocialContext describes the video or post a social link points to
+type SocialContext struct {
+	Platform string `json:"platform"`
+	URL      string `json:"url"`
+	Title    string `json:"title,omitempty"`
+	Author   string `json:"author,omitempty"` // channel or account
+}
+
+// Emoji marks the platform in replies
+func (s *SocialContext) Emoji() string {
+	switch s.Platform {
+	case platformYouTube:
+		return "▶️"
+	case platformInstagram:
+		return "📸"
+	}
+	return "🔗"
+}
+
+// PlatformName is the platform's display name
+func (s *SocialContext) PlatformName() string {
+	switch s.Platform {
+	case platformYouTube:
+		return "YouTube"
+	case platformInstagram:
+		return "Instagram"
+	case platformX:
+		return "X"
+	}
+	return s.Platform
+}
+
+// socialLink returns the first YouTube, Instagram or X link in text, or ""
+func socialLink(text string) string {
+	for _, link := range extractLinks(text) {
+		if _, ok := socialHosts[linkHost(link)]; ok {
+			return link
+		}
+	}
+	return ""
+}
+
+// analyzeSocial calls the backend API to analyze a social link with the
+// content the backend pulls from it
+func analyzeSocial(link, text, language, key string) (*AnalyzeResponse, error) {
+	jsonBody, err := json.Marshal(SocialRequest{URL: link, Text: text, Language: language})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := newJSONRequest(fmt.Sprintf("%s/analyze/social", backendURL()), jsonBody)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call backend: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkRateLimit(resp); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("backend returned status %d", resp.StatusCode)
+	}
+
+	var result AnalyzeResponse
+	if err := decodeAnalysis(resp, &result); err != nil {
+		return nil, err
+	}
+
+	logAnalysis(&result)
+	return &result, nil
+}
+
+// analyzeSocialCached returns a cached verdict for the same link shared with
+// the same text, or calls the backend with backendText (the scrubbed text)
+func analyzeSocialCached(link, text, backendText, language, idempotency string) (*AnalyzeResponse, error) {
+	key := mediaCacheKey("social", []byte(link+"\x00"+text))
+	if result, ok := verdictCache.Get(key); ok {
+		fmt.Println("Cache hit for social link")
+		return result, nil
+	}
+
+	result, err := callBackend(func() (*AnalyzeResponse, error) {
+		return analyzeSocial(link, backendText, language, idempotency)
+	})
+	if err != nil {
+		return nil, err
+	}
+	enrichWithFactChecks(result, backendText, language)
+	rateSources(result)
+	result.claimKey = key
+	verdictCache.Put(key, nil, result)
+	return result, nil
+}
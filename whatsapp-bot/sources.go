@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	credibilityHigh   = "high"
+	credibilityMedium = "medium"
+	credibilityLow    = "low"
+)
+
+// Source is a source the backend consulted. The backend may send either a
+// bare string (a URL or a name) or an object with title, url and credibility.
+type Source struct {
+	Title       string `json:"title,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Credibility string `json:"credibility,omitempty"` // high, medium or low
+}
+
+// UnmarshalJSON accepts both the legacy string form and the structured form
+func (s *Source) UnmarshalJSON(data []byte) error {
+	var plain string
+	if err := json.Unmarshal(data, &plain); err == nil {
+		plain = strings.TrimSpace(plain)
+		if isURL(plain) {
+			*s = Source{URL: plain}
+		} else {
+			*s = Source{Title: plain}
+		}
+		return nil
+	}
+
+	var raw struct {
+		Title       string          `json:"title"`
+		URL         string          `json:"url"`
+		Credibility json.RawMessage `json:"credibility"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("source must be a string or an object: %w", err)
+	}
+	*s = Source{
+		Title:       strings.TrimSpace(raw.Title),
+		URL:         strings.TrimSpace(raw.URL),
+		Credibility: parseCredibility(raw.Credibility),
+	}
+	return nil
+}
+
+// parseCredibility normalizes a credibility label or a 0-1 score to high,
+// medium or low, returning "" when it's absent or unrecognized
+func parseCredibility(raw json.RawMessage) string {
+	var score float64
+	if err := json.Unmarshal(raw, &score); err == nil {
+		switch {
+		case score >= 0.7:
+			return credibilityHigh
+		case score >= 0.4:
+			return credibilityMedium
+		default:
+			return credibilityLow
+		}
+	}
+	var label string
+	if err := json.Unmarshal(raw, &label); err == nil {
+		switch label = strings.ToLower(strings.TrimSpace(label)); label {
+		case credibilityHigh, credibilityMedium, credibilityLow:
+			return label
+		}
+	}
+	return ""
+}
+
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Host returns the source URL's host without a leading www.
+func (s Source) Host() string {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// Label is the name to show for the source: its title, else its host
+func (s Source) Label() string {
+	if s.Title != "" {
+		return s.Title
+	}
+	if host := s.Host(); host != "" {
+		return host
+	}
+	return s.URL
+}
+
+// CredibilityEmoji marks the source's credibility with a colored dot
+func (s Source) CredibilityEmoji() string {
+	switch s.Credibility {
+	case credibilityHigh:
+		return "🟢"
+	case credibilityMedium:
+		return "🟡"
+	case credibilityLow:
+		return "🔴"
+	}
+	return ""
+}
+
+// String renders the source on one line, so custom templates that print
+// sources with {{.}} keep working
+func (s Source) String() string {
+	if s.URL == "" || s.Label() == s.URL {
+		return s.Label()
+	}
+	return s.Label() + " - " + s.URL
+}
+
+// previewSource picks the source to attach a link preview for: the first one
+// with a URL, preferring the most credible
+func previewSource(sources []Source) *Source {
+	var best *Source
+	rank := map[string]int{credibilityHigh: 3, credibilityMedium: 2, "": 1, credibilityLow: 0}
+	for i := range sources {
+		if sources[i].URL == "" {
+			continue
+		}
+		if best == nil || rank[sources[i].Credibility] > rank[best.Credibility] {
+			best = &sources[i]
+		}
+	}
+	return best
+}
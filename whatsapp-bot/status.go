@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func init() {
+	registerCommand("status", &Command{
+		Usage:   "/status",
+		Help:    "Show where your messages are in the queue (reply to one to ask about it)",
+		Handler: cmdStatus,
+	})
+}
+
+// durationAverage is a moving average of how long something takes
+type durationAverage struct {
+	sync.Mutex
+	avg time.Duration
+}
+
+// add folds d into the average, weighting recent samples more
+func (a *durationAverage) add(d time.Duration) {
+	a.Lock()
+	defer a.Unlock()
+	if a.avg == 0 {
+		a.avg = d
+		return
+	}
+	a.avg = (a.avg*4 + d) / 5
+}
+
+func (a *durationAverage) get() time.Duration {
+	a.Lock()
+	defer a.Unlock()
+	return a.avg
+}
+
+var (
+	// handleTime and jobTime are how long a queued message and an async
+	// backend job usually take, for /status estimates
+	handleTime durationAverage
+	jobTime    durationAverage
+)
+
+// handling holds the messages workers are handling right now, with when
+// they were started
+var handling = struct {
+	sync.Mutex
+	started map[*events.Message]time.Time
+}{started: map[*events.Message]time.Time{}}
+
+// startHandling marks evt as being handled by a worker
+func startHandling(evt *events.Message, started time.Time) {
+	handling.Lock()
+	defer handling.Unlock()
+	handling.started[evt] = started
+}
+
+// doneHandling clears evt's mark and records how long it took
+func doneHandling(evt *events.Message, took time.Duration) {
+	handling.Lock()
+	delete(handling.started, evt)
+	handling.Unlock()
+	handleTime.add(took)
+}
+
+// pendingMessage is one of a sender's messages the bot hasn't answered yet
+type pendingMessage struct {
+	id     types.MessageID
+	status string
+}
+
+// queueETA estimates how long until a message with ahead messages before it
+// is answered, or 0 when there's no estimate yet
+func queueETA(ahead int) time.Duration {
+	per := handleTime.get()
+	workers := int(runningWorkers.Load())
+	if per == 0 || workers == 0 {
+		return 0
+	}
+	return time.Duration(ahead/workers+1) * per
+}
+
+// roughly formats an estimate for people, in whole seconds or minutes
+func roughly(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", max(1, int(d.Seconds())))
+	}
+	return fmt.Sprintf("%dm", int(d.Round(time.Minute).Minutes()))
+}
+
+// pendingMessages lists sender's unanswered messages in chat: waiting in the
+// queue, being handled, running as a backend job or held while it's down
+func pendingMessages(chat, sender types.JID, self *events.Message) ([]pendingMessage, error) {
+	var out []pendingMessage
+	for i, item := range messageQueue.snapshot() {
+		info := item.evt.Info
+		if info.Chat != chat || info.Sender.User != sender.User {
+			continue
+		}
+		status := fmt.Sprintf("🔢 Waiting in the queue at position %d", i+1)
+		if eta := queueETA(i); eta > 0 {
+			status += ", about " + roughly(eta)
+		}
+		out = append(out, pendingMessage{id: info.ID, status: status})
+	}
+
+	handling.Lock()
+	for evt, started := range handling.started {
+		if evt != self && evt.Info.Chat == chat && evt.Info.Sender.User == sender.User {
+			out = append(out, pendingMessage{id: evt.Info.ID, status: fmt.Sprintf("⚙️ Being checked now (for %s)", roughly(time.Since(started)))})
+		}
+	}
+	handling.Unlock()
+
+	rows, err := botStore.db.Query(
+		`SELECT message_id, created_at, 'job' FROM async_jobs WHERE chat = ? AND sender = ?
+		 UNION ALL
+		 SELECT message_id, created_at, 'deferred' FROM deferred_messages WHERE chat = ? AND sender = ?`,
+		chat.String(), sender.String(), chat.String(), sender.String(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id        string
+			createdAt int64
+			kind      string
+		)
+		if err := rows.Scan(&id, &createdAt, &kind); err != nil {
+			return nil, err
+		}
+		since := roughly(time.Since(time.Unix(createdAt, 0)))
+		status := fmt.Sprintf("🕐 Held since the backend went down %s ago; it will be checked once it's back", since)
+		if kind == "job" {
+			status = fmt.Sprintf("⏳ In deep analysis for %s", since)
+			if typical := jobTime.get(); typical > 0 {
+				status += ", usually done in about " + roughly(typical)
+			}
+		}
+		out = append(out, pendingMessage{id: types.MessageID(id), status: status})
+	}
+	return out, rows.Err()
+}
+
+// cmdStatus tells the sender what is happening to their unanswered
+// messages, or to the one their /status replies to
+func cmdStatus(evt *events.Message, args []string) {
+	pending, err := pendingMessages(evt.Info.Chat, evt.Info.Sender, evt)
+	if err != nil {
+		fmt.Printf("Error loading pending messages: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not look up your messages.")
+		return
+	}
+
+	if quotedID := evt.Message.GetExtendedTextMessage().GetContextInfo().GetStanzaID(); quotedID != "" {
+		for _, p := range pending {
+			if p.id == quotedID {
+				sendMessage(evt, p.status+".")
+				return
+			}
+		}
+		sendMessage(evt, "ℹ️ That message isn't waiting to be checked. It has been answered already, or there was nothing to check in it.")
+		return
+	}
+
+	if len(pending) == 0 {
+		sendMessage(evt, "✅ None of your messages are waiting to be checked.")
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📋 *%d of your messages are waiting*\n", len(pending))
+	for _, p := range pending {
+		sb.WriteString("\n• " + p.status)
+	}
+	sb.WriteString("\n\n_Reply /status to one of them to ask about it._")
+	sendMessage(evt, sb.String())
+}
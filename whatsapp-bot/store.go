@@ -0,0 +1,410 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Store persists the bot's own state, separate from the WhatsApp session database
+type Store struct {
+	db *storeDB
+}
+
+// schemaV1 is the baseline schema the first migration creates, frozen as it
+// shipped: databases that already ran migration 1 never see an edit here,
+// so never edit it. Change tables with a new migration instead.
+var schemaV1 = []string{
+	`CREATE TABLE IF NOT EXISTS access_list (
+		jid      TEXT NOT NULL,
+		list     TEXT NOT NULL CHECK (list IN ('allow', 'block')),
+		added_by TEXT NOT NULL,
+		added_at INTEGER NOT NULL,
+		PRIMARY KEY (jid, list)
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_settings (
+		chat        TEXT PRIMARY KEY,
+		language    TEXT,
+		verbosity   TEXT,
+		threshold   REAL,
+		mode        TEXT,
+		quiet_start INTEGER,
+		quiet_end   INTEGER,
+		quiet_mode  TEXT,
+		cooldown    INTEGER,
+		updated_at  INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS onboarded_chats (
+		chat         TEXT PRIMARY KEY,
+		onboarded_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS pending_replies (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat       TEXT NOT NULL,
+		message_id TEXT NOT NULL,
+		sender     TEXT NOT NULL,
+		quoted     BLOB,
+		text       TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS analysis_history (
+		id                INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat              TEXT NOT NULL,
+		sender            TEXT NOT NULL,
+		message_id        TEXT NOT NULL,
+		kind              TEXT NOT NULL,
+		claim_key         TEXT NOT NULL,
+		language          TEXT,
+		is_news           INTEGER NOT NULL,
+		is_misinformation INTEGER NOT NULL,
+		confidence        REAL NOT NULL,
+		summary           TEXT,
+		created_at        INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS analysis_history_created ON analysis_history (created_at)`,
+	`CREATE INDEX IF NOT EXISTS analysis_history_chat ON analysis_history (chat, created_at)`,
+	`CREATE TABLE IF NOT EXISTS subscriptions (
+		chat       TEXT NOT NULL,
+		topic      TEXT NOT NULL,
+		created_by TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (chat, topic)
+	)`,
+	`CREATE TABLE IF NOT EXISTS trend_alerts (
+		trend_id   TEXT NOT NULL,
+		chat       TEXT NOT NULL,
+		alerted_at INTEGER NOT NULL,
+		PRIMARY KEY (trend_id, chat)
+	)`,
+	`CREATE TABLE IF NOT EXISTS scheduled_broadcasts (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		text       TEXT NOT NULL,
+		send_at    INTEGER NOT NULL,
+		created_by TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		sent_at    INTEGER
+	)`,
+	`CREATE TABLE IF NOT EXISTS deferred_messages (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat       TEXT NOT NULL,
+		sender     TEXT NOT NULL,
+		message_id TEXT NOT NULL,
+		push_name  TEXT NOT NULL,
+		message    BLOB NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS dashboard_links (
+		code       TEXT PRIMARY KEY,
+		chat       TEXT NOT NULL,
+		created_by TEXT NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS dashboard_sessions (
+		token      TEXT PRIMARY KEY,
+		chat       TEXT NOT NULL,
+		created_by TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS shared_verdicts (
+		code       TEXT PRIMARY KEY,
+		verdict    TEXT NOT NULL,
+		language   TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS outbox (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id TEXT NOT NULL UNIQUE,
+		chat       TEXT NOT NULL,
+		message    BLOB NOT NULL,
+		instance   TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS dead_letters (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat       TEXT NOT NULL,
+		sender     TEXT NOT NULL,
+		message_id TEXT NOT NULL,
+		push_name  TEXT NOT NULL,
+		message    BLOB NOT NULL,
+		error      TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS group_membership (
+		chat       TEXT PRIMARY KEY,
+		active     INTEGER NOT NULL,
+		changed_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS message_history (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat       TEXT NOT NULL,
+		message_id TEXT NOT NULL,
+		sender     TEXT NOT NULL,
+		text       TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS message_history_chat ON message_history (chat, id)`,
+	`CREATE TABLE IF NOT EXISTS disappearing_chats (
+		chat       TEXT PRIMARY KEY,
+		timer      INTEGER NOT NULL,
+		setting_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS pinned_messages (
+		chat       TEXT NOT NULL,
+		message_id TEXT NOT NULL,
+		pinned_by  TEXT NOT NULL,
+		pinned_at  INTEGER NOT NULL,
+		PRIMARY KEY (chat, message_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS verdict_polls (
+		poll_id           TEXT PRIMARY KEY,
+		chat              TEXT NOT NULL,
+		claim_key         TEXT NOT NULL,
+		language          TEXT NOT NULL,
+		is_misinformation INTEGER NOT NULL,
+		confidence        REAL NOT NULL,
+		created_at        INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS verdict_polls_claim ON verdict_polls (claim_key)`,
+	`CREATE TABLE IF NOT EXISTS poll_votes (
+		poll_id  TEXT NOT NULL,
+		voter    TEXT NOT NULL,
+		option   INTEGER NOT NULL,
+		voted_at INTEGER NOT NULL,
+		PRIMARY KEY (poll_id, voter)
+	)`,
+	`CREATE TABLE IF NOT EXISTS verdict_messages (
+		message_id     TEXT PRIMARY KEY,
+		chat           TEXT NOT NULL,
+		verdict        TEXT NOT NULL,
+		language       TEXT NOT NULL,
+		evidence_shown INTEGER NOT NULL,
+		sources_shown  INTEGER NOT NULL,
+		created_at     INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS experiment_events (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		experiment TEXT NOT NULL,
+		variant    TEXT NOT NULL,
+		chat       TEXT NOT NULL,
+		event      TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS experiment_events_experiment ON experiment_events (experiment, variant)`,
+	`CREATE TABLE IF NOT EXISTS rechecks (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat      TEXT NOT NULL,
+		sender    TEXT NOT NULL,
+		reply_id  TEXT NOT NULL,
+		reply     TEXT NOT NULL,
+		text      TEXT NOT NULL,
+		language  TEXT NOT NULL,
+		claim_key TEXT NOT NULL,
+		verdict   TEXT NOT NULL,
+		due_at    INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS watches (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		watcher    TEXT NOT NULL,
+		query      TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS bot_state (
+		key        TEXT PRIMARY KEY,
+		value      TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS async_jobs (
+		job_id     TEXT PRIMARY KEY,
+		token      TEXT NOT NULL,
+		chat       TEXT NOT NULL,
+		sender     TEXT NOT NULL,
+		message_id TEXT NOT NULL,
+		push_name  TEXT NOT NULL,
+		message    BLOB NOT NULL,
+		hash       TEXT NOT NULL,
+		caption    TEXT NOT NULL,
+		claim_key  TEXT NOT NULL,
+		analyzed   INTEGER NOT NULL,
+		explicit   INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS observations (
+		chat_hash         TEXT NOT NULL,
+		claim_key         TEXT NOT NULL,
+		kind              TEXT NOT NULL,
+		is_news           INTEGER NOT NULL,
+		is_misinformation INTEGER NOT NULL,
+		hour              INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS archived_media (
+		id            TEXT PRIMARY KEY,
+		chat          TEXT NOT NULL,
+		kind          TEXT NOT NULL,
+		sha256        TEXT NOT NULL,
+		thumbnail_key TEXT NOT NULL,
+		original_key  TEXT NOT NULL,
+		mimetype      TEXT NOT NULL,
+		verdict       TEXT NOT NULL,
+		created_at    INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS roles (
+		jid        TEXT PRIMARY KEY,
+		role       TEXT NOT NULL,
+		granted_by TEXT NOT NULL,
+		granted_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor      TEXT NOT NULL,
+		chat       TEXT NOT NULL,
+		action     TEXT NOT NULL,
+		target     TEXT NOT NULL,
+		old_value  TEXT,
+		new_value  TEXT,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_actor ON audit_log (actor)`,
+	// The audit log is append-only
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	 BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	 BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+	`CREATE TABLE IF NOT EXISTS canary_results (
+		id                        INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind                      TEXT NOT NULL,
+		analysis_key              TEXT NOT NULL,
+		reason                    TEXT NOT NULL,
+		production_model          TEXT NOT NULL,
+		canary_model              TEXT NOT NULL,
+		production_misinformation INTEGER NOT NULL,
+		canary_misinformation     INTEGER,
+		production_confidence     REAL NOT NULL,
+		canary_confidence         REAL,
+		error                     TEXT NOT NULL,
+		latency_ms                INTEGER NOT NULL,
+		created_at                INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS canary_results_created ON canary_results (created_at)`,
+	`CREATE TABLE IF NOT EXISTS domain_reputation (
+		domain     TEXT PRIMARY KEY,
+		tier       TEXT NOT NULL,
+		note       TEXT NOT NULL,
+		updated_by TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	// Instances sharing the database, and which chats each one's number is in
+	`CREATE TABLE IF NOT EXISTS instances (
+		id           TEXT PRIMARY KEY,
+		jid          TEXT NOT NULL,
+		heartbeat_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_instances (
+		chat     TEXT NOT NULL,
+		instance TEXT NOT NULL,
+		seen_at  INTEGER NOT NULL,
+		PRIMARY KEY (chat, instance)
+	)`,
+	`CREATE TABLE IF NOT EXISTS broadcast_deliveries (
+		broadcast_id INTEGER NOT NULL,
+		instance     TEXT NOT NULL,
+		sent_at      INTEGER NOT NULL,
+		PRIMARY KEY (broadcast_id, instance)
+	)`,
+}
+
+var botStore *Store
+
+// openStore opens (and creates if needed) the bot database: the SQLite file
+// at path, or the Postgres database when path is a postgres:// URL
+func openStore(path string) (*Store, error) {
+	var db *storeDB
+	if isPostgresURL(path) {
+		var err error
+		if db, err = openPostgres(path); err != nil {
+			return nil, fmt.Errorf("failed to open bot database: %w", err)
+		}
+	} else {
+		sqlite, err := openDatabase(fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open bot database: %w", err)
+		}
+		db = &storeDB{DB: sqlite}
+	}
+
+	if err := migrate(db, path); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// migrateQuietHours moves rows from the old quiet_hours table into
+// chat_settings. Postgres databases are newer than the table.
+func migrateQuietHours(db *storeDB) error {
+	if db.postgres {
+		return nil
+	}
+	var name string
+	err := db.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'quiet_hours'`).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to check for quiet_hours table: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT OR IGNORE INTO chat_settings (chat, quiet_start, quiet_end, quiet_mode, updated_at)
+		SELECT chat, start_min, end_min, CASE WHEN start_min IS NULL THEN 'off' ELSE mode END, strftime('%s', 'now')
+		FROM quiet_hours`)
+	if err != nil {
+		return fmt.Errorf("failed to migrate quiet hours: %w", err)
+	}
+	if _, err := tx.Exec(`DROP TABLE quiet_hours`); err != nil {
+		return fmt.Errorf("failed to drop quiet_hours table: %w", err)
+	}
+	return tx.Commit()
+}
+
+// addColumn adds a column to a table created by an older version of the bot
+func addColumn(db *storeDB, table, column, decl string) error {
+	if db.postgres {
+		if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s`, table, column, db.ddl(decl))); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", table, column, err)
+		}
+		return nil
+	}
+	rows, err := db.Query(fmt.Sprintf(`SELECT name FROM pragma_table_info('%s')`, table))
+	if err != nil {
+		return fmt.Errorf("failed to read %s columns: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl)); err != nil {
+		return fmt.Errorf("failed to add %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// Close closes the underlying database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
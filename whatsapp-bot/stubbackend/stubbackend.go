@@ -0,0 +1,163 @@
+// Package stubbackend is a scriptable stand-in for the Aletheia analysis
+// backend, for integration tests. Tests add rules over HTTP saying what to
+// answer for which requests, and read back the requests the bot made:
+//
+//	POST   /stub/rules     add a Rule
+//	DELETE /stub/rules     remove every rule and recorded request
+//	GET    /stub/requests  list the recorded requests
+//
+// Every other path is answered by the first rule matching its path and
+// body, or with {"is_news": false} (and 200 at /health) when none does.
+package stubbackend
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule is a scripted answer
+type Rule struct {
+	// Path is the request path it answers, like /analyze/text; empty matches any
+	Path string `json:"path,omitempty"`
+	// Contains must appear in the request body; empty matches any
+	Contains string `json:"contains,omitempty"`
+	// Status of the answer, 200 by default
+	Status int `json:"status,omitempty"`
+	// Body of the answer, sent as JSON
+	Body json.RawMessage `json:"body,omitempty"`
+	// Headers of the answer, like Retry-After
+	Headers map[string]string `json:"headers,omitempty"`
+	// DelayMS is how long to wait before answering, in milliseconds
+	DelayMS int `json:"delay_ms,omitempty"`
+	// Times the rule answers before it's removed; 0 is for good
+	Times int `json:"times,omitempty"`
+}
+
+// Request is a request the stub received
+type Request struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+}
+
+// Server is the stub backend
+type Server struct {
+	mu       sync.Mutex
+	rules    []*Rule
+	requests []Request
+}
+
+// New returns a stub backend without rules
+func New() *Server {
+	return &Server{}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/stub/rules" && r.Method == http.MethodPost:
+		var rule Rule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.AddRule(rule)
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/stub/rules" && r.Method == http.MethodDelete:
+		s.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/stub/requests":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Requests())
+	default:
+		s.answer(w, r)
+	}
+}
+
+// AddRule adds a rule after the existing ones
+func (s *Server) AddRule(rule Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, &rule)
+}
+
+// Reset removes every rule and recorded request
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = nil
+	s.requests = nil
+}
+
+// Requests returns the requests received since the last reset, oldest first
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// answer records r and answers it from the first matching rule
+func (s *Server) answer(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rule := s.match(r, string(body))
+
+	if rule == nil {
+		rule = &Rule{Body: json.RawMessage(`{"is_news": false}`)}
+		if r.URL.Path == "/health" {
+			rule.Body = json.RawMessage(`{"status": "ok"}`)
+		}
+	}
+	if rule.DelayMS > 0 {
+		select {
+		case <-time.After(time.Duration(rule.DelayMS) * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	for name, value := range rule.Headers {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	status := rule.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	if len(rule.Body) > 0 {
+		w.Write(rule.Body)
+	}
+}
+
+// match records a request and returns the rule answering it, if any,
+// using up one of its times
+func (s *Server) match(r *http.Request, body string) *Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.URL.Path != "/health" {
+		s.requests = append(s.requests, Request{
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			ContentType: r.Header.Get("Content-Type"),
+			Body:        body,
+		})
+	}
+	for i, rule := range s.rules {
+		if rule.Path != "" && rule.Path != r.URL.Path {
+			continue
+		}
+		if rule.Contains != "" && !strings.Contains(body, rule.Contains) {
+			continue
+		}
+		if rule.Times > 0 {
+			if rule.Times--; rule.Times == 0 {
+				s.rules = append(s.rules[:i:i], s.rules[i+1:]...)
+			}
+		}
+		return rule
+	}
+	return nil
+}
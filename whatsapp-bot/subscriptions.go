@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// subscriptionTopics lists what chats can subscribe to, with a description for /subscribe
+var subscriptionTopics = map[string]string{
+	"alerts": "alerts about misinformation spreading across chats",
+}
+
+func init() {
+	registerCommand("subscribe", &Command{
+		Usage:   "/subscribe [topic]",
+		Help:    "Receive proactive messages, e.g. /subscribe alerts",
+		Handler: cmdSubscribe,
+	})
+	registerCommand("unsubscribe", &Command{
+		Usage:   "/unsubscribe <topic>",
+		Help:    "Stop receiving proactive messages",
+		Handler: cmdUnsubscribe,
+	})
+}
+
+// subscribe adds chat to topic, reporting whether it was newly added
+func (s *Store) subscribe(chat types.JID, topic string, by types.JID) (bool, error) {
+	res, err := s.db.Exec(
+		`INSERT INTO subscriptions (chat, topic, created_by, created_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		chat.ToNonAD().String(), topic, by.ToNonAD().String(), time.Now().Unix(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// unsubscribe removes chat from topic, reporting whether it was subscribed
+func (s *Store) unsubscribe(chat types.JID, topic string) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM subscriptions WHERE chat = ? AND topic = ?`, chat.ToNonAD().String(), topic)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// subscribers returns the chats subscribed to topic
+func (s *Store) subscribers(topic string) ([]types.JID, error) {
+	rows, err := s.db.Query(`SELECT chat FROM subscriptions WHERE topic = ? ORDER BY created_at`, topic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chats []types.JID
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		jid, err := types.ParseJID(raw)
+		if err != nil {
+			fmt.Printf("Skipping invalid subscriber %q: %v\n", raw, err)
+			continue
+		}
+		chats = append(chats, jid)
+	}
+	return chats, rows.Err()
+}
+
+// chatTopics returns the topics chat is subscribed to
+func (s *Store) chatTopics(chat types.JID) ([]string, error) {
+	rows, err := s.db.Query(`SELECT topic FROM subscriptions WHERE chat = ? ORDER BY topic`, chat.ToNonAD().String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var topics []string
+	for rows.Next() {
+		var topic string
+		if err := rows.Scan(&topic); err != nil {
+			return nil, err
+		}
+		topics = append(topics, topic)
+	}
+	return topics, rows.Err()
+}
+
+// topicList formats the available topics for command replies
+func topicList() string {
+	names := make([]string, 0, len(subscriptionTopics))
+	for name := range subscriptionTopics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("\n• *%s*: %s", name, subscriptionTopics[name]))
+	}
+	return sb.String()
+}
+
+func cmdSubscribe(evt *events.Message, args []string) {
+	if len(args) == 0 {
+		topics, err := botStore.chatTopics(evt.Info.Chat)
+		if err != nil {
+			fmt.Printf("Error loading subscriptions: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not load subscriptions. Please try again.")
+			return
+		}
+		current := "none"
+		if len(topics) > 0 {
+			current = strings.Join(topics, ", ")
+		}
+		sendMessage(evt, fmt.Sprintf("🔔 Subscribed to: *%s*\n\nAvailable topics:%s", current, topicList()))
+		return
+	}
+
+	topic := strings.ToLower(args[0])
+	if _, ok := subscriptionTopics[topic]; !ok {
+		sendMessage(evt, fmt.Sprintf("❌ Unknown topic %q. Available topics:%s", args[0], topicList()))
+		return
+	}
+	if !canManageChat(evt.Info) {
+		sendMessage(evt, "⛔ Only group admins can change subscriptions in groups.")
+		return
+	}
+
+	added, err := botStore.subscribe(evt.Info.Chat, topic, evt.Info.Sender)
+	if err != nil {
+		fmt.Printf("Error saving subscription: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not save the subscription. Please try again.")
+		return
+	}
+	if !added {
+		sendMessage(evt, fmt.Sprintf("ℹ️ This chat is already subscribed to *%s*.", topic))
+		return
+	}
+	sendMessage(evt, fmt.Sprintf("✅ Subscribed to *%s*. Send /unsubscribe %s to stop.", topic, topic))
+}
+
+func cmdUnsubscribe(evt *events.Message, args []string) {
+	if len(args) == 0 {
+		sendMessage(evt, "Usage: /unsubscribe <topic>")
+		return
+	}
+	if !canManageChat(evt.Info) {
+		sendMessage(evt, "⛔ Only group admins can change subscriptions in groups.")
+		return
+	}
+
+	topic := strings.ToLower(args[0])
+	removed, err := botStore.unsubscribe(evt.Info.Chat, topic)
+	if err != nil {
+		fmt.Printf("Error removing subscription: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not remove the subscription. Please try again.")
+		return
+	}
+	if !removed {
+		sendMessage(evt, fmt.Sprintf("ℹ️ This chat isn't subscribed to *%s*.", topic))
+		return
+	}
+	sendMessage(evt, fmt.Sprintf("🔕 Unsubscribed from *%s*.", topic))
+}
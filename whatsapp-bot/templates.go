@@ -0,0 +1,175 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const (
+	templateFull  = "full"
+	templateShort = "short"
+)
+
+// maxListedItems is how many evidence bullets and sources a reply shows
+const maxListedItems = 3
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// responseTemplates holds the parsed verdict templates, keyed by name
+var responseTemplates = map[string]*template.Template{}
+
+// VerdictView is the data passed to verdict templates
+type VerdictView struct {
+	Emoji             string
+	Status            string
+	ConfidencePercent float64
+	ConfidenceBar     string
+	ConfidenceDisplay string // the confidence in the chat's style; "" when hidden
+	ConfidenceShort   string // the same for the short reply's headline
+	Summary           string
+	Claims            []ClaimView
+	Social            *SocialContext // the video or post a social link points to
+	Evidence          []string
+	Sources           []Source
+	Recommendation    string
+	Resources         []Resource // authoritative resources for the verdict's topic
+	SimilarityNote    string
+	MoreNote          string // set when evidence or sources were left out
+	PartialNote       string // set when only the start of a recording was checked
+	AnalysisID        string // the backend run, for tracing disputed verdicts
+	Language          string
+	M                 *Messages // localized labels
+	Result            *AnalyzeResponse
+}
+
+// loadResponseTemplates parses the built-in templates and overrides any that
+// exist as <name>.tmpl in dir, then validates them by rendering sample verdicts
+func loadResponseTemplates(dir string) error {
+	for _, name := range []string{templateFull, templateShort} {
+		source, err := defaultTemplates.ReadFile("templates/" + name + ".tmpl")
+		if err != nil {
+			return fmt.Errorf("missing built-in template %s: %w", name, err)
+		}
+		origin := "built-in"
+		if dir != "" {
+			path := filepath.Join(dir, name+".tmpl")
+			if custom, err := os.ReadFile(path); err == nil {
+				source, origin = custom, path
+			} else if !os.IsNotExist(err) {
+				return fmt.Errorf("failed to read template %s: %w", path, err)
+			}
+		}
+
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(string(source))
+		if err != nil {
+			return fmt.Errorf("invalid %s template (%s): %w", name, origin, err)
+		}
+		if err := validateTemplate(tmpl); err != nil {
+			return fmt.Errorf("invalid %s template (%s): %w", name, origin, err)
+		}
+		responseTemplates[name] = tmpl
+	}
+	return nil
+}
+
+// validateTemplate renders tmpl for sample verdicts in every language so that
+// references to missing fields fail at startup rather than on a live message
+func validateTemplate(tmpl *template.Template) error {
+	samples := []*AnalyzeResponse{
+		{IsMisinformation: true, Confidence: 0.9, IsNews: true, Summary: "Sample summary",
+			Evidence: []string{"a", "b", "c", "d"}, SourcesChecked: []Source{{Title: "x", URL: "https://example.com", Credibility: credibilityHigh}, {Title: "y"}}, Recommendation: "Sample", AnalysisID: "sample", Topic: topicHealth,
+			Social: &SocialContext{Platform: platformYouTube, URL: "https://youtu.be/x", Title: "Sample video", Author: "Sample channel"},
+			Claims: []Claim{{Text: "Claim one", Verdict: "false", Confidence: 0.9}, {Text: "Claim two", Verdict: "true", Confidence: 0.8}}},
+		{IsNews: true, Confidence: 0.4, similarity: 0.85},
+		{IsNews: true, Verdict: verdictUnverifiable, Confidence: 0.5, Summary: "Sample summary"},
+	}
+	for lang := range translations {
+		for _, sample := range samples {
+			var sb strings.Builder
+			for _, style := range []string{confidenceBar, confidenceNone} {
+				if err := tmpl.Execute(&sb, newVerdictView(sample, lang, style)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// newVerdictView prepares the template data for a result, showing its
+// confidence in the given style ("" for the bot-wide default)
+func newVerdictView(result *AnalyzeResponse, lang, confidence string) *VerdictView {
+	m := messagesFor(lang)
+	emoji, status := verdictStatus(result, m)
+	if confidence == "" {
+		confidence = config.DefaultConfidence
+	}
+
+	view := &VerdictView{
+		Emoji:             emoji,
+		Status:            status,
+		ConfidencePercent: result.Confidence * 100,
+		ConfidenceBar:     confidenceBarText(result.Confidence),
+		ConfidenceDisplay: confidenceDisplay(result.Confidence, confidence),
+		ConfidenceShort:   confidenceShort(result.Confidence, confidence),
+		Summary:           result.Summary,
+		Claims:            claimViews(result.Claims),
+		Social:            result.Social,
+		Evidence:          firstN(result.Evidence, maxListedItems),
+		Sources:           firstN(result.SourcesChecked, maxListedItems),
+		Recommendation:    result.Recommendation,
+		Resources:         resourcesFor(result),
+		AnalysisID:        result.AnalysisID,
+		Language:          lang,
+		M:                 m,
+		Result:            result,
+	}
+	if view.Recommendation == "" && result.isUnverifiable() {
+		view.Recommendation = m.UnverifiableAdvice
+	}
+	if result.similarity > 0 {
+		view.SimilarityNote = fmt.Sprintf(m.SimilarityNote, result.similarity*100)
+	}
+	if result.analyzedSeconds > 0 {
+		view.PartialNote = fmt.Sprintf(m.PartialNote, result.analyzedSeconds, result.totalSeconds)
+	}
+	if hidden := len(result.Evidence) - len(view.Evidence) + len(result.SourcesChecked) - len(view.Sources); hidden > 0 {
+		view.MoreNote = fmt.Sprintf(m.MoreNote, hidden)
+	}
+	return view
+}
+
+func firstN[T any](items []T, n int) []T {
+	if len(items) > n {
+		return items[:n]
+	}
+	return items
+}
+
+// renderVerdict executes the named template, falling back to a bare headline
+// if rendering fails so a bad template never swallows a verdict
+func renderVerdict(name string, result *AnalyzeResponse, lang, confidence string) string {
+	view := newVerdictView(result, lang, confidence)
+	var sb strings.Builder
+	if err := responseTemplates[name].Execute(&sb, view); err != nil {
+		fmt.Printf("Error rendering %s template: %v\n", name, err)
+		return fmt.Sprintf("%s *%s* (%.0f%%)\n%s", view.Emoji, view.Status, view.ConfidencePercent, view.Summary)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// formatResponse formats the analysis result for WhatsApp in the given
+// language and confidence style
+func formatResponse(result *AnalyzeResponse, lang, confidence string) string {
+	return renderVerdict(templateFull, result, lang, confidence)
+}
+
+// formatShortResponse formats a compact verdict: headline, confidence and summary
+func formatShortResponse(result *AnalyzeResponse, lang, confidence string) string {
+	return renderVerdict(templateShort, result, lang, confidence)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	translateBackend = "backend"
+	translateGoogle  = "google"
+	translateNone    = "none"
+)
+
+// TranslateRequest is the request body for the backend /translate endpoint
+type TranslateRequest struct {
+	Texts  []string `json:"texts"`
+	Source string   `json:"source"`
+	Target string   `json:"target"`
+}
+
+// TranslateResponse is the response from the backend /translate endpoint
+type TranslateResponse struct {
+	Translations []string `json:"translations"`
+}
+
+var translateClient = &http.Client{Timeout: 20 * time.Second}
+
+// translateTexts translates texts from source to target using the configured provider
+func translateTexts(texts []string, source, target string) ([]string, error) {
+	switch config.TranslationProvider {
+	case translateBackend:
+		return translateViaBackend(texts, source, target)
+	case translateGoogle:
+		return translateViaGoogle(texts, source, target)
+	default:
+		return nil, fmt.Errorf("translation disabled")
+	}
+}
+
+// translateViaBackend calls the backend's /translate endpoint
+func translateViaBackend(texts []string, source, target string) ([]string, error) {
+	jsonBody, err := json.Marshal(TranslateRequest{Texts: texts, Source: source, Target: target})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := newJSONRequest(fmt.Sprintf("%s/translate", backendURL()), jsonBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := translateClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call backend: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("backend returned status %d", resp.StatusCode)
+	}
+
+	var result TranslateResponse
+	if err := decodeResponse(resp, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Translations) != len(texts) {
+		return nil, fmt.Errorf("expected %d translations, got %d", len(texts), len(result.Translations))
+	}
+	return result.Translations, nil
+}
+
+// translateViaGoogle calls the Google Cloud Translation v2 API
+func translateViaGoogle(texts []string, source, target string) ([]string, error) {
+	if config.GoogleTranslateAPIKey.Get() == "" {
+		return nil, fmt.Errorf("GOOGLE_TRANSLATE_API_KEY is not set")
+	}
+
+	form := url.Values{}
+	for _, t := range texts {
+		form.Add("q", t)
+	}
+	form.Set("source", source)
+	form.Set("target", target)
+	form.Set("format", "text")
+	form.Set("key", config.GoogleTranslateAPIKey.Get())
+
+	resp, err := translateClient.PostForm("https://translation.googleapis.com/language/translate/v2", form)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call translation API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("translation API returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data struct {
+			Translations []struct {
+				TranslatedText string `json:"translatedText"`
+			} `json:"translations"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(result.Data.Translations) != len(texts) {
+		return nil, fmt.Errorf("expected %d translations, got %d", len(texts), len(result.Data.Translations))
+	}
+	out := make([]string, len(texts))
+	for i, t := range result.Data.Translations {
+		out[i] = t.TranslatedText
+	}
+	return out, nil
+}
+
+// translateResult returns a copy of result with its summary, evidence and
+// recommendation translated into lang, when the backend answered in English
+// but the chat reads another language. On failure the original is returned.
+func translateResult(result *AnalyzeResponse, lang string) *AnalyzeResponse {
+	if config.TranslationProvider == translateNone || lang == "" || lang == "en" {
+		return result
+	}
+	if detectLanguage(result.Summary+" "+result.Recommendation) != "en" {
+		return result
+	}
+
+	// Translate everything in one request: summary, recommendation, evidence, then claims
+	texts := append([]string{result.Summary, result.Recommendation}, result.Evidence...)
+	for _, c := range result.Claims {
+		texts = append(texts, c.Text)
+	}
+	translated, err := translateTexts(texts, "en", lang)
+	if err != nil {
+		fmt.Printf("Error translating reply to %s: %v\n", lang, err)
+		return result
+	}
+
+	out := *result
+	out.Summary = translated[0]
+	out.Recommendation = translated[1]
+	out.Evidence = translated[2 : 2+len(result.Evidence)]
+	out.Claims = make([]Claim, len(result.Claims))
+	for i, c := range result.Claims {
+		c.Text = translated[2+len(result.Evidence)+i]
+		out.Claims[i] = c
+	}
+	return &out
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+const (
+	trendsLocal = "local"
+	trendsOff   = "off"
+)
+
+// trendAlertMinConfidence is the confidence a flagged claim needs to count towards a local trend
+const trendAlertMinConfidence = 0.7
+
+// trendAlertSendDelay spaces out alert messages to avoid tripping spam detection
+const trendAlertSendDelay = 2 * time.Second
+
+// Trend is a misinformation claim spreading across chats
+type Trend struct {
+	ID             string `json:"id"`
+	Summary        string `json:"summary"`
+	Recommendation string `json:"recommendation"`
+	Chats          int    `json:"chats"`
+}
+
+// localTrends finds claims flagged as misinformation in at least minChats
+// different chats within the last window, from the analysis history
+func (s *Store) localTrends(window time.Duration, minChats int) ([]Trend, error) {
+	rows, err := s.db.Query(
+		`SELECT claim_key, MAX(summary), COUNT(DISTINCT chat) AS chats
+		FROM analysis_history
+		WHERE created_at >= ? AND is_news = 1 AND is_misinformation = 1 AND confidence >= ? AND claim_key != ''
+		GROUP BY claim_key
+		HAVING COUNT(DISTINCT chat) >= ?
+		ORDER BY chats DESC
+		LIMIT 5`,
+		time.Now().Add(-window).Unix(), trendAlertMinConfidence, minChats,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trends []Trend
+	for rows.Next() {
+		var t Trend
+		if err := rows.Scan(&t.ID, &t.Summary, &t.Chats); err != nil {
+			return nil, err
+		}
+		trends = append(trends, t)
+	}
+	return trends, rows.Err()
+}
+
+// markTrendAlerted records that chat was alerted about trend, reporting
+// whether this is the first time
+func (s *Store) markTrendAlerted(trendID string, chat types.JID) (bool, error) {
+	res, err := s.db.Exec(
+		`INSERT INTO trend_alerts (trend_id, chat, alerted_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`,
+		trendID, chat.ToNonAD().String(), time.Now().Unix(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// formatTrendAlert builds the alert message for trend in lang
+func formatTrendAlert(trend Trend, lang string) string {
+	m := messagesFor(lang)
+	translated := translateResult(&AnalyzeResponse{Summary: trend.Summary, Recommendation: trend.Recommendation}, lang)
+
+	text := fmt.Sprintf("📈 *%s*\n\n%s", m.TrendAlertTitle, fmt.Sprintf(m.TrendAlert, trend.Chats, int(config.TrendsWindow.Hours())))
+	if translated.Summary != "" {
+		text += "\n\n" + translated.Summary
+	}
+	if translated.Recommendation != "" {
+		text += fmt.Sprintf("\n\n*%s:*\n%s", m.Recommendation, translated.Recommendation)
+	}
+	return text
+}
+
+// checkTrends finds current trends and alerts subscribed chats that
+// haven't heard about them yet
+func checkTrends() {
+	trends, err := botStore.localTrends(config.TrendsWindow, config.TrendsMinChats)
+	if err != nil {
+		fmt.Printf("Error fetching trends: %v\n", err)
+		return
+	}
+	if len(trends) == 0 {
+		return
+	}
+
+	// In crisis mode every active chat gets alerts, not just subscribers
+	chats, err := botStore.subscribers("alerts")
+	if inCrisis() {
+		chats, err = botStore.knownChats()
+	}
+	if err != nil {
+		fmt.Printf("Error loading alert subscribers: %v\n", err)
+		return
+	}
+
+	for _, trend := range trends {
+		if trend.ID == "" || trend.Summary == "" {
+			continue
+		}
+		for _, chat := range chats {
+			// Chats in quiet hours or shadow mode get the alert on a later poll if it's still trending
+			if inQuietHours(chat) || isShadowChat(chat) || !access.isPermitted(types.MessageInfo{MessageSource: types.MessageSource{Chat: chat}}) {
+				continue
+			}
+			if botStore.getChatSettings(chat).Mode == modeOff || !featureEnabled(flagAlerts, chat) || !servesChat(chat) {
+				continue
+			}
+			isNew, err := botStore.markTrendAlerted(trend.ID, chat)
+			if err != nil {
+				fmt.Printf("Error recording trend alert: %v\n", err)
+				continue
+			}
+			if !isNew {
+				continue
+			}
+
+			lang := replyLanguage(botStore.getChatSettings(chat).Language, "")
+			if err := sendText(chat, formatTrendAlert(trend, lang)); err != nil {
+				fmt.Printf("Error sending trend alert to %s: %v\n", chat, err)
+				continue
+			}
+			metrics.inc("trend_alert_sent")
+			time.Sleep(trendAlertSendDelay)
+		}
+	}
+}
+
+// runTrendAlerts polls for trends in the background
+func runTrendAlerts() {
+	if config.TrendsSource == trendsOff || config.TrendsPollInterval <= 0 {
+		return
+	}
+	if config.TrendsSource != trendsLocal {
+		fmt.Printf("Unknown TRENDS_SOURCE %q, finding trends in the analysis history\n", config.TrendsSource)
+	}
+	for {
+		interval := config.TrendsPollInterval
+		if inCrisis() && config.CrisisTrendsPollInterval > 0 && config.CrisisTrendsPollInterval < interval {
+			interval = config.CrisisTrendsPollInterval
+		}
+		time.Sleep(interval)
+		checkTrends()
+	}
+}
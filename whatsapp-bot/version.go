@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+func init() {
+	// Fall back to the VCS stamp Go embeds when building from a checkout
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if commit == "" && len(s.Value) >= 7 {
+					commit = s.Value[:7]
+				}
+			case "vcs.time":
+				if buildDate == "" {
+					buildDate = s.Value
+				}
+			}
+		}
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+
+	registerCommand("version", &Command{
+		Usage:   "/version",
+		Help:    "Show which build of the bot is running",
+		Handler: cmdVersion,
+	})
+}
+
+func cmdVersion(evt *events.Message, args []string) {
+	reply := fmt.Sprintf("🤖 *Aletheia %s*\n\n*Commit:* %s", version, commit)
+	if buildDate != "" {
+		reply += fmt.Sprintf("\n*Built:* %s", buildDate)
+	}
+	reply += fmt.Sprintf("\n*Go:* %s", runtime.Version())
+	reply += fmt.Sprintf("\n*Uptime:* %s", time.Since(startedAt).Round(time.Second))
+	reply += fmt.Sprintf("\n*Messages processed:* %d", metrics.snapshot()["message_received"])
+
+	device := client.Store
+	if device.ID != nil {
+		reply += fmt.Sprintf("\n*Device:* %s", device.ID.ToNonAD())
+		if device.Platform != "" {
+			reply += fmt.Sprintf(" (%s)", device.Platform)
+		}
+	}
+	sendMessage(evt, reply)
+}
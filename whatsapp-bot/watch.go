@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// maxWatchesPerUser caps the claims one user can watch
+const maxWatchesPerUser = 10
+
+// watchNotifyInterval is how often one watch can notify about the same chat
+const watchNotifyInterval = time.Hour
+
+// minWatchWordLength drops short words like "is" and "the" from watch queries
+const minWatchWordLength = 3
+
+func init() {
+	registerCommand("watch", &Command{
+		Usage:   "/watch <topic or claim> | list",
+		Help:    "Get a DM when a claim is checked in any of your chats",
+		Handler: cmdWatch,
+	})
+	registerCommand("unwatch", &Command{
+		Usage:   "/unwatch <id>",
+		Help:    "Stop watching a claim",
+		Handler: cmdUnwatch,
+	})
+}
+
+// Watch is a topic or claim a user asked to be told about
+type Watch struct {
+	ID      int64
+	Watcher types.JID
+	Query   string
+}
+
+// watchWords splits text into the lowercased words watches are matched on
+func watchWords(text string) map[string]bool {
+	words := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(prepareText(text)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r)
+	}) {
+		if utf8.RuneCountInString(w) >= minWatchWordLength {
+			words[w] = true
+		}
+	}
+	return words
+}
+
+// watchMatches reports whether text is about query: short topics need every
+// word present, longer claims most of their words
+func watchMatches(query string, text map[string]bool) bool {
+	words := watchWords(query)
+	if len(words) == 0 {
+		return false
+	}
+	found := 0
+	for w := range words {
+		if text[w] {
+			found++
+		}
+	}
+	if len(words) <= 4 {
+		return found == len(words)
+	}
+	return float64(found) >= 0.7*float64(len(words))
+}
+
+// addWatch stores a watch for watcher, returning its id
+func (s *Store) addWatch(watcher types.JID, query string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(
+		`INSERT INTO watches (watcher, query, created_at) VALUES (?, ?, ?) RETURNING id`,
+		watcher.ToNonAD().String(), query, time.Now().Unix(),
+	).Scan(&id)
+	return id, err
+}
+
+// removeWatch deletes watcher's watch id, reporting whether it existed
+func (s *Store) removeWatch(watcher types.JID, id int64) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM watches WHERE id = ? AND watcher = ?`, id, watcher.ToNonAD().String())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// watches returns the watches of watcher, or everyone's when watcher is empty
+func (s *Store) watches(watcher types.JID) ([]Watch, error) {
+	query, args := `SELECT id, watcher, query FROM watches ORDER BY id`, []any{}
+	if !watcher.IsEmpty() {
+		query, args = `SELECT id, watcher, query FROM watches WHERE watcher = ? ORDER BY id`, []any{watcher.ToNonAD().String()}
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Watch
+	for rows.Next() {
+		var (
+			w   Watch
+			raw string
+		)
+		if err := rows.Scan(&w.ID, &raw, &w.Query); err != nil {
+			return nil, err
+		}
+		if w.Watcher, err = types.ParseJID(raw); err != nil {
+			continue
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// watchNotified holds when each watch last notified about each chat
+var watchNotified = struct {
+	sync.Mutex
+	at map[string]time.Time
+}{at: map[string]time.Time{}}
+
+// takeWatchNotification reports whether watch id may notify about chat now,
+// and if so records that it did
+func takeWatchNotification(id int64, chat types.JID) bool {
+	watchNotified.Lock()
+	defer watchNotified.Unlock()
+	key := fmt.Sprintf("%d/%s", id, chat)
+	if time.Since(watchNotified.at[key]) < watchNotifyInterval {
+		return false
+	}
+	watchNotified.at[key] = time.Now()
+	return true
+}
+
+// inChat reports whether user can see messages in chat: it's their DM with
+// the bot, or a group they're a member of
+func inChat(user types.JID, chat types.JID) bool {
+	if chat.Server != types.GroupServer {
+		return chat.User == user.User
+	}
+	meta, err := groupInfo(chat)
+	if err != nil {
+		fmt.Printf("Error checking group members: %v\n", err)
+		return false
+	}
+	return meta.members[user.User]
+}
+
+// notifyWatchers DMs the users watching a claim that text was just checked
+// in one of their chats, with the verdict
+func notifyWatchers(evt *events.Message, text string, result *AnalyzeResponse) {
+	if !result.IsNews {
+		return
+	}
+	watches, err := botStore.watches(types.EmptyJID)
+	if err != nil {
+		fmt.Printf("Error loading watches: %v\n", err)
+		return
+	}
+	words := watchWords(text)
+	for _, w := range watches {
+		if w.Watcher.User == evt.Info.Sender.User || !watchMatches(w.Query, words) {
+			continue
+		}
+		if !inChat(w.Watcher, evt.Info.Chat) || !takeWatchNotification(w.ID, evt.Info.Chat) {
+			continue
+		}
+		if inQuietHours(w.Watcher) || isShadowChat(w.Watcher) {
+			continue
+		}
+
+		where := "your chat with me"
+		if evt.Info.IsGroup {
+			where = evt.Info.Chat.String()
+			if meta, err := groupInfo(evt.Info.Chat); err == nil && meta.Name != "" {
+				where = meta.Name
+			}
+		}
+		preview := []rune(text)
+		if len(preview) > 120 {
+			preview = append(preview[:120], '…')
+		}
+		settings := botStore.getChatSettings(w.Watcher)
+		lang := settings.Language
+		notice := fmt.Sprintf("👀 *Watched claim spotted* in %s:\n\"%s\"\n\n%s\n\n_Watching \"%s\". Send /unwatch %d to stop._",
+			where, string(preview), formatShortResponse(translateResult(result, lang), lang, settings.confidenceStyle()), w.Query, w.ID)
+		if err := sendText(w.Watcher, notice); err != nil {
+			fmt.Printf("Error notifying watcher %s: %v\n", w.Watcher, err)
+			metrics.fail("send_error", err)
+			continue
+		}
+		metrics.inc("watch_notified")
+	}
+}
+
+func cmdWatch(evt *events.Message, args []string) {
+	if len(args) == 0 {
+		sendMessage(evt, "Usage: /watch <topic or claim> | list")
+		return
+	}
+
+	if len(args) == 1 && strings.ToLower(args[0]) == "list" {
+		watches, err := botStore.watches(evt.Info.Sender)
+		if err != nil {
+			fmt.Printf("Error loading watches: %v\n", err)
+			sendMessage(evt, "❌ *Error*\n\nCould not load your watchlist. Please try again.")
+			return
+		}
+		if len(watches) == 0 {
+			sendMessage(evt, "ℹ️ You aren't watching any claims. Send /watch <topic or claim> to start.")
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("👀 *Your watchlist*\n")
+		for _, w := range watches {
+			sb.WriteString(fmt.Sprintf("\n#%d %s", w.ID, w.Query))
+		}
+		sb.WriteString("\n\n_Send /unwatch <id> to stop watching one._")
+		sendMessage(evt, sb.String())
+		return
+	}
+
+	query := strings.TrimSpace(strings.Join(args, " "))
+	if len(watchWords(query)) == 0 {
+		sendMessage(evt, fmt.Sprintf("❌ Use words of at least %d letters to watch for.", minWatchWordLength))
+		return
+	}
+	existing, err := botStore.watches(evt.Info.Sender)
+	if err != nil {
+		fmt.Printf("Error loading watches: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not save the watch. Please try again.")
+		return
+	}
+	if len(existing) >= maxWatchesPerUser {
+		sendMessage(evt, fmt.Sprintf("❌ You can watch up to %d claims. Send /unwatch <id> to remove one first.", maxWatchesPerUser))
+		return
+	}
+	id, err := botStore.addWatch(evt.Info.Sender, query)
+	if err != nil {
+		fmt.Printf("Error saving watch: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not save the watch. Please try again.")
+		return
+	}
+	sendMessage(evt, fmt.Sprintf("👀 Watching #%d: \"%s\". I'll DM you when it's checked in any of your chats. Send /unwatch %d to stop.", id, query, id))
+}
+
+func cmdUnwatch(evt *events.Message, args []string) {
+	if len(args) != 1 {
+		sendMessage(evt, "Usage: /unwatch <id>")
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(args[0], "#"), 10, 64)
+	if err != nil {
+		sendMessage(evt, fmt.Sprintf("❌ Invalid watch id %q", args[0]))
+		return
+	}
+	removed, err := botStore.removeWatch(evt.Info.Sender, id)
+	if err != nil {
+		fmt.Printf("Error removing watch: %v\n", err)
+		sendMessage(evt, "❌ *Error*\n\nCould not remove the watch. Please try again.")
+		return
+	}
+	if !removed {
+		sendMessage(evt, fmt.Sprintf("ℹ️ You have no watch #%d.", id))
+		return
+	}
+	sendMessage(evt, fmt.Sprintf("✅ Stopped watching #%d.", id))
+}
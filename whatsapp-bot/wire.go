@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	wireJSON     = "json"
+	wireProtobuf = "protobuf"
+
+	contentTypeProtobuf = "application/x-protobuf"
+)
+
+// useProtobuf reports whether analyses are exchanged with the backend as
+// protobuf (proto/aletheia.proto) rather than JSON
+func useProtobuf() bool {
+	return config.BackendWireFormat == wireProtobuf
+}
+
+// isProtobuf reports whether resp carries a protobuf body
+func isProtobuf(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == contentTypeProtobuf
+}
+
+// decodeAnalysis decodes and validates an analysis response in whichever
+// format the backend answered with
+func decodeAnalysis(resp *http.Response, result *AnalyzeResponse) error {
+	if !isProtobuf(resp) {
+		if err := decodeResponse(resp, result); err != nil {
+			return err
+		}
+		return validateAnalysis(result)
+	}
+	body, err := readResponse(resp)
+	if err != nil {
+		return err
+	}
+	if err := unmarshalAnalyzeResponse(body, result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return validateAnalysis(result)
+}
+
+// The codec below is written by hand against proto/aletheia.proto so the bot
+// builds without protoc; keep the field numbers in step with it.
+
+// marshalAnalyzeRequest encodes req as an aletheia.AnalyzeRequest
+func marshalAnalyzeRequest(req *AnalyzeRequest) []byte {
+	var b []byte
+	b = appendString(b, 1, req.Text)
+	b = appendString(b, 2, req.Language)
+	for _, kind := range req.SenderTypes {
+		b = appendString(b, 3, kind)
+	}
+	return b
+}
+
+// unmarshalAnalyzeResponse decodes an aletheia.AnalyzeResponse into result
+func unmarshalAnalyzeResponse(b []byte, result *AnalyzeResponse) error {
+	return parseFields(b, func(f wireField) error {
+		switch {
+		case f.is(1, protowire.VarintType):
+			result.IsMisinformation = f.bool()
+		case f.is(2, protowire.Fixed64Type):
+			result.Confidence = f.double()
+		case f.is(3, protowire.VarintType):
+			result.IsNews = f.bool()
+		case f.is(4, protowire.BytesType):
+			result.Summary = f.string()
+		case f.is(5, protowire.BytesType):
+			result.Evidence = append(result.Evidence, f.string())
+		case f.is(6, protowire.BytesType):
+			var s Source
+			if err := unmarshalSource(f.bytes, &s); err != nil {
+				return err
+			}
+			result.SourcesChecked = append(result.SourcesChecked, s)
+		case f.is(7, protowire.BytesType):
+			result.Recommendation = f.string()
+		case f.is(8, protowire.BytesType):
+			result.MessageType = f.string()
+		case f.is(9, protowire.BytesType):
+			var c Claim
+			if err := unmarshalClaim(f.bytes, &c); err != nil {
+				return err
+			}
+			result.Claims = append(result.Claims, c)
+		case f.is(10, protowire.BytesType):
+			result.Social = &SocialContext{}
+			return unmarshalSocialContext(f.bytes, result.Social)
+		case f.is(11, protowire.VarintType):
+			result.Developing = f.bool()
+		case f.is(12, protowire.BytesType):
+			result.Topic = f.string()
+		case f.is(13, protowire.BytesType):
+			result.ModelVersion = f.string()
+		case f.is(14, protowire.BytesType):
+			result.AnalysisID = f.string()
+		case f.is(15, protowire.Fixed64Type):
+			result.ProcessingTime = f.double()
+		case f.is(18, protowire.VarintType):
+			result.SchemaVersion = int(f.value)
+		case f.is(19, protowire.BytesType):
+			result.Verdict = f.string()
+		case f.is(20, protowire.BytesType):
+			result.Publisher = f.string()
+		}
+		return nil
+	})
+}
+
+func unmarshalSource(b []byte, s *Source) error {
+	return parseFields(b, func(f wireField) error {
+		switch {
+		case f.is(1, protowire.BytesType):
+			s.Title = f.string()
+		case f.is(2, protowire.BytesType):
+			s.URL = f.string()
+		case f.is(3, protowire.BytesType):
+			s.Credibility = f.string()
+		}
+		return nil
+	})
+}
+
+func unmarshalClaim(b []byte, c *Claim) error {
+	return parseFields(b, func(f wireField) error {
+		switch {
+		case f.is(1, protowire.BytesType):
+			c.Text = f.string()
+		case f.is(2, protowire.BytesType):
+			c.Verdict = f.string()
+		case f.is(3, protowire.Fixed64Type):
+			c.Confidence = f.double()
+		}
+		return nil
+	})
+}
+
+func unmarshalSocialContext(b []byte, s *SocialContext) error {
+	return parseFields(b, func(f wireField) error {
+		switch {
+		case f.is(1, protowire.BytesType):
+			s.Platform = f.string()
+		case f.is(2, protowire.BytesType):
+			s.URL = f.string()
+		case f.is(3, protowire.BytesType):
+			s.Title = f.string()
+		case f.is(4, protowire.BytesType):
+			s.Author = f.string()
+		}
+		return nil
+	})
+}
+
+// wireField is one field of an encoded message
+type wireField struct {
+	num   protowire.Number
+	typ   protowire.Type
+	bytes []byte // length-delimited fields
+	value uint64 // varint and fixed64 fields
+}
+
+func (f wireField) is(num protowire.Number, typ protowire.Type) bool {
+	return f.num == num && f.typ == typ
+}
+
+func (f wireField) bool() bool      { return f.value != 0 }
+func (f wireField) double() float64 { return math.Float64frombits(f.value) }
+func (f wireField) string() string  { return string(f.bytes) }
+
+// parseFields calls fn for each field of an encoded message; fields fn
+// doesn't know are skipped, so either side can add fields first
+func parseFields(b []byte, fn func(wireField) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := wireField{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.value, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.value, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendString appends a string field, omitting it when empty as proto3 does
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}